@@ -15,20 +15,30 @@ import (
 	"embed"
 	"errors"
 	"log"
+	"marketplace/internal/address"
 	"marketplace/internal/auth"
 	"marketplace/internal/cart"
+	"marketplace/internal/currency"
+	"marketplace/internal/idempotency"
+	"marketplace/internal/invoice"
+	"marketplace/internal/ledger"
 	"marketplace/internal/logger"
 	"marketplace/internal/order"
+	"marketplace/internal/outbox"
 	"marketplace/internal/payment"
 	"marketplace/internal/product"
 	"marketplace/internal/repository/postgres"
+	"marketplace/internal/shipping"
 	"marketplace/internal/transport"
 	"marketplace/internal/user"
+	"marketplace/internal/wallet"
+	"marketplace/internal/webhook"
 	"marketplace/middleware"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"sync"
 	"syscall"
 	"time"
 
@@ -53,6 +63,18 @@ func env(key, fallback string) string {
 	return fallback
 }
 
+func envDuration(key string, fallback time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Fatalf("Invalid duration in %s: %v", key, err)
+	}
+	return d
+}
+
 func runMigrations(db *sqlx.DB, dir string) error {
 	// мигрируем из файловой системы
 	if abs, err := filepath.Abs(dir); err == nil {
@@ -77,9 +99,32 @@ func main() {
 	dsn := env("DATABASE_URL", "host=localhost port=5432 user=postgres password=postgres dbname=marketplace sslmode=disable")
 
 	migDir := env("MIGRATIONS_DIR", "./migrations")
+	paymentTTL := envDuration("PAYMENT_TTL", 30*time.Minute)
+	expiryInterval := envDuration("ORDER_EXPIRY_INTERVAL", time.Minute)
+	outboxInterval := envDuration("OUTBOX_DISPATCH_INTERVAL", time.Second)
+	webhookInterval := envDuration("WEBHOOK_DELIVERY_INTERVAL", 2*time.Second)
+	quoteTTL := envDuration("QUOTE_TTL", 10*time.Minute)
+	idemLease := envDuration("IDEMPOTENCY_LEASE", time.Minute)
+	idemTTL := envDuration("IDEMPOTENCY_TTL", 24*time.Hour)
+	idemGCInterval := envDuration("IDEMPOTENCY_GC_INTERVAL", 10*time.Minute)
+	webhookTolerance := envDuration("PAYMENT_WEBHOOK_TOLERANCE", payment.DefaultWebhookTolerance)
+	intentTTL := envDuration("PAYMENT_INTENT_TTL", payment.DefaultIntentTTL)
+	intentExpiryInterval := envDuration("PAYMENT_INTENT_EXPIRY_INTERVAL", time.Minute)
+	refundReconcileInterval := envDuration("REFUND_RECONCILE_INTERVAL", time.Minute)
 
-	if s := env("JWT_SECRET", "your-256-bit-secret"); s != "" {
-		auth.SetSecret([]byte(s))
+	jwtSecret := env("JWT_SECRET", "your-256-bit-secret")
+	if jwtSecret != "" {
+		auth.SetSecret([]byte(jwtSecret))
+	}
+	// токены цены подписываются своим ключом: без него preview их не выдает,
+	// а обязательные токены без ключа не включить
+	quoteSecret := os.Getenv("QUOTE_SECRET")
+	quoteRequired := os.Getenv("CHECKOUT_REQUIRE_QUOTE") == "true"
+	if quoteRequired && quoteSecret == "" {
+		log.Fatalf("CHECKOUT_REQUIRE_QUOTE needs QUOTE_SECRET")
+	}
+	if quoteSecret != "" && quoteSecret == jwtSecret {
+		log.Fatalf("QUOTE_SECRET must differ from JWT_SECRET")
 	}
 
 	db, err := sqlx.Connect("postgres", dsn)
@@ -105,12 +150,54 @@ func main() {
 	ordRepo := postgres.NewOrderRepo(db)
 	idemRepo := postgres.NewIdempotencyRepository(db)
 	payRepo := postgres.NewPaymentRepo(db)
+	outboxRepo := postgres.NewOutboxRepo(db)
+	webhookRepo := postgres.NewWebhookRepo(db)
+	addrRepo := postgres.NewAddressRepo(db)
+	shippingRepo := postgres.NewShippingRepo(db)
+	invoiceRepo := postgres.NewInvoiceRepo(db)
+	ledgerRepo := postgres.NewLedgerRepo(db)
+	walletRepo := postgres.NewWalletRepo(db)
+	currencyRepo := postgres.NewCurrencyRepo(db)
+
+	invoiceStore, err := invoice.NewDiskStore(env("INVOICE_DIR", "./data/invoices"))
+	if err != nil {
+		log.Fatalf("Failed to init invoice store: %v", err)
+	}
 
-	prodService := product.NewService(prodRepo)
+	currencyService := currency.NewService(currencyRepo)
+	prodService := product.NewService(prodRepo, product.WithRates(currencyService))
 	userService := user.NewService(userRepo)
 	cartService := cart.NewService(cartRepo)
-	ordService := order.NewService(ordRepo, idemRepo)
-	payService := payment.NewService(payRepo, ordRepo)
+	shippingService := shipping.NewService(shippingRepo)
+	orderEvents := order.NewHub()
+	orderOpts := []order.Option{
+		order.WithShipping(shippingService),
+		order.WithEventHub(orderEvents),
+		order.WithCart(cartService),
+		order.WithRates(currencyService),
+		order.WithAddressRequired(os.Getenv("CHECKOUT_REQUIRE_ADDRESS") == "true"),
+	}
+	if quoteSecret != "" {
+		orderOpts = append(orderOpts, order.WithQuotes(order.NewQuoteSigner([]byte(quoteSecret), quoteTTL), quoteRequired))
+	}
+	ordService := order.NewService(ordRepo, orderOpts...)
+	var gateway payment.Gateway = payment.NewFakeGateway()
+	if provider := env("PAYMENT_PROVIDER", "fake"); provider != "fake" {
+		gateway = payment.NewHTTPGateway(provider, os.Getenv("PAYMENT_API_URL"), os.Getenv("PAYMENT_API_KEY"), nil)
+	}
+	payService := payment.NewService(payRepo, ordRepo, gateway,
+		payment.WithWebhooks(os.Getenv("PAYMENT_WEBHOOK_SECRET"), webhookTolerance),
+		payment.WithIntentTTL(intentTTL),
+	)
+	webhookService := webhook.NewService(webhookRepo)
+	addrService := address.NewService(addrRepo)
+	ledgerService := ledger.NewService(ledgerRepo)
+	walletService := wallet.NewService(walletRepo)
+	invoiceService := invoice.NewService(invoiceRepo, ordRepo, invoiceStore, invoice.Seller{
+		Name:    env("INVOICE_SELLER_NAME", "Marketplace LLC"),
+		Address: os.Getenv("INVOICE_SELLER_ADDRESS"),
+		TaxID:   os.Getenv("INVOICE_SELLER_TAX_ID"),
+	})
 
 	if adminUser := os.Getenv("ADMIN_USER"); adminUser != "" {
 		if adminPass := os.Getenv("ADMIN_PASS"); adminPass != "" {
@@ -134,6 +221,8 @@ func main() {
 		middleware.RequestID(),
 		middleware.ZapRecovery(),
 		middleware.ZapLogger(),
+		// до ErrorHandler: сохраняем и ответы, которые он пишет
+		idempotency.Middleware(idemRepo, idemLease, idemTTL),
 		middleware.ErrorHandler(),
 		middleware.Metrics(),
 	)
@@ -154,14 +243,76 @@ func main() {
 	product.RegisterRoutes(r, prodService)
 	user.RegisterRoutes(r, userService)
 	cart.RegisterRoutes(r, cartService)
+	currency.RegisterRoutes(r, currencyService)
+	address.RegisterRoutes(r, addrService)
+	shipping.RegisterRoutes(r, shippingService)
 	order.RegisterRoutes(r, ordService)
 	payment.RegisterRoutes(r, payService)
+	invoice.RegisterRoutes(r, invoiceService)
+	ledger.RegisterRoutes(r, ledgerService)
+	wallet.RegisterRoutes(r, walletService)
+	webhook.RegisterRoutes(r, webhookService)
 
 	srv := &http.Server{
 		Addr:              httpAddr,
 		Handler:           r,
 		ReadHeaderTimeout: 10 * time.Second,
 	}
+	// SSE-соединения не закрываются сами: отключаем подписчиков, чтобы Shutdown не ждал их
+	srv.RegisterOnShutdown(orderEvents.Close)
+
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+
+	expiryWorker := order.NewExpiryWorker(ordService, paymentTTL, expiryInterval)
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		expiryWorker.Run(workersCtx)
+	}()
+
+	intentExpiryWorker := payment.NewExpiryWorker(payService, intentExpiryInterval)
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		intentExpiryWorker.Run(workersCtx)
+	}()
+
+	refundWorker := payment.NewRefundWorker(payService, refundReconcileInterval)
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		refundWorker.Run(workersCtx)
+	}()
+
+	publisher := outbox.MultiPublisher{outbox.LogPublisher{}, webhook.NewPublisher(webhookRepo)}
+	dispatcher := outbox.NewDispatcher(outboxRepo, publisher, outboxInterval)
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		dispatcher.Run(workersCtx)
+	}()
+
+	deliverer := webhook.NewDeliverer(webhookRepo, nil, webhookInterval)
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		deliverer.Run(workersCtx)
+	}()
+
+	idemCollector := idempotency.NewCollector(idemRepo, idemGCInterval)
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		idemCollector.Run(workersCtx)
+	}()
+
+	statusListener := postgres.NewOrderStatusListener(dsn, orderEvents)
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		statusListener.Run(workersCtx)
+	}()
 
 	go func() {
 		log.Printf("Starting server on port %s", srv.Addr)
@@ -179,4 +330,7 @@ func main() {
 	if err = srv.Shutdown(ctx); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
+
+	stopWorkers()
+	workers.Wait()
 }
@@ -0,0 +1,193 @@
+package address
+
+import (
+	"errors"
+	"marketplace/internal/auth"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Handler struct {
+	svc Service
+}
+
+func NewHandler(svc Service) *Handler {
+	return &Handler{svc: svc}
+}
+
+func RegisterRoutes(r *gin.Engine, svc Service) {
+	h := NewHandler(svc)
+
+	g := r.Group("/me/addresses", auth.JWTAuth())
+	{
+		g.GET("", h.list)
+		g.POST("", h.create)
+		g.GET("/:id", h.get)
+		g.PUT("/:id", h.update)
+		g.DELETE("/:id", h.delete)
+	}
+}
+
+type addressReq struct {
+	RecipientName string `json:"recipient_name" binding:"required,max=255"`
+	Phone         string `json:"phone" binding:"required,max=32"`
+	Country       string `json:"country" binding:"required,len=2,alpha"`
+	Region        string `json:"region" binding:"max=255"`
+	City          string `json:"city" binding:"required,max=255"`
+	PostalCode    string `json:"postal_code" binding:"required,max=20"`
+	Line1         string `json:"line1" binding:"required,max=255"`
+	Line2         string `json:"line2" binding:"max=255"`
+	IsDefault     bool   `json:"is_default"`
+}
+
+func (r addressReq) toAddress(userID int64) *Address {
+	return &Address{
+		UserID:        userID,
+		RecipientName: r.RecipientName,
+		Phone:         r.Phone,
+		Country:       r.Country,
+		Region:        r.Region,
+		City:          r.City,
+		PostalCode:    r.PostalCode,
+		Line1:         r.Line1,
+		Line2:         r.Line2,
+		IsDefault:     r.IsDefault,
+	}
+}
+
+func parseID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return 0, false
+	}
+	return id, true
+}
+
+func writeError(c *gin.Context, err error) {
+	if errors.Is(err, ErrAddressNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// @Summary List addresses
+// @Description List the current user's shipping addresses
+// @Tags addresses
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} address.Address
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /me/addresses [get]
+func (h *Handler) list(c *gin.Context) {
+	addrs, err := h.svc.List(c, auth.GetUserID(c))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, addrs)
+}
+
+// @Summary Create address
+// @Description Add a shipping address. The first address becomes the default one.
+// @Tags addresses
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param input body addressReq true "Address"
+// @Success 201 {object} address.Address
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /me/addresses [post]
+func (h *Handler) create(c *gin.Context) {
+	var req addressReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	a, err := h.svc.Create(c, req.toAddress(auth.GetUserID(c)))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, a)
+}
+
+// @Summary Get address
+// @Tags addresses
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Address ID"
+// @Success 200 {object} address.Address
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /me/addresses/{id} [get]
+func (h *Handler) get(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+	a, err := h.svc.Get(c, auth.GetUserID(c), id)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, a)
+}
+
+// @Summary Update address
+// @Tags addresses
+// @Security BearerAuth
+// @Accept json
+// @Param id path int true "Address ID"
+// @Param input body addressReq true "Address"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /me/addresses/{id} [put]
+func (h *Handler) update(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+	var req addressReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	a := req.toAddress(auth.GetUserID(c))
+	a.ID = id
+	if err := h.svc.Update(c, a); err != nil {
+		writeError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Delete address
+// @Tags addresses
+// @Security BearerAuth
+// @Param id path int true "Address ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /me/addresses/{id} [delete]
+func (h *Handler) delete(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+	if err := h.svc.Delete(c, auth.GetUserID(c), id); err != nil {
+		writeError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,83 @@
+package address
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// newRouter собирает маршруты адресной книги для пользователя 7 без проверки JWT.
+func newRouter(repo Repository) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	h := NewHandler(NewService(repo))
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("userID", int64(7)) })
+	r.POST("/me/addresses", h.create)
+	r.GET("/me/addresses/:id", h.get)
+	r.PUT("/me/addresses/:id", h.update)
+	r.DELETE("/me/addresses/:id", h.delete)
+	return r
+}
+
+const validAddress = `{"recipient_name":"Ivan","phone":"+70000000000","country":"RU","city":"Moscow",
+	"postal_code":"101000","line1":"Tverskaya 1"}`
+
+func serve(r *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestHandler_Create(t *testing.T) {
+	repo := new(mockRepo)
+	repo.On("Create", mock.Anything, mock.MatchedBy(func(a *Address) bool {
+		return a.UserID == 7 && a.Country == "RU" && a.Line1 == "Tverskaya 1"
+	})).Return(int64(3), nil)
+	repo.On("Get", mock.Anything, int64(7), int64(3)).Return(&Address{ID: 3, UserID: 7, IsDefault: true}, nil)
+
+	w := serve(newRouter(repo), http.MethodPost, "/me/addresses", validAddress)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"is_default":true`)
+}
+
+func TestHandler_CreateInvalid(t *testing.T) {
+	repo := new(mockRepo)
+
+	w := serve(newRouter(repo), http.MethodPost, "/me/addresses", `{"recipient_name":"Ivan","country":"Russia"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	repo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestHandler_GetForeignAddress(t *testing.T) {
+	repo := new(mockRepo)
+	repo.On("Get", mock.Anything, int64(7), int64(5)).Return(nil, ErrAddressNotFound)
+
+	w := serve(newRouter(repo), http.MethodGet, "/me/addresses/5", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandler_UpdateUsesPathID(t *testing.T) {
+	repo := new(mockRepo)
+	repo.On("Update", mock.Anything, mock.MatchedBy(func(a *Address) bool {
+		return a.ID == 5 && a.UserID == 7
+	})).Return(nil)
+
+	w := serve(newRouter(repo), http.MethodPut, "/me/addresses/5", validAddress)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	repo.AssertExpectations(t)
+}
+
+func TestHandler_DeleteInvalidID(t *testing.T) {
+	repo := new(mockRepo)
+
+	w := serve(newRouter(repo), http.MethodDelete, "/me/addresses/abc", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	repo.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,20 @@
+package address
+
+import "time"
+
+// Address — адрес доставки из адресной книги пользователя.
+type Address struct {
+	ID            int64     `json:"id" db:"id"`
+	UserID        int64     `json:"user_id" db:"user_id"`
+	RecipientName string    `json:"recipient_name" db:"recipient_name"`
+	Phone         string    `json:"phone" db:"phone"`
+	Country       string    `json:"country" db:"country"` // ISO 3166-1 alpha-2
+	Region        string    `json:"region" db:"region"`
+	City          string    `json:"city" db:"city"`
+	PostalCode    string    `json:"postal_code" db:"postal_code"`
+	Line1         string    `json:"line1" db:"line1"`
+	Line2         string    `json:"line2" db:"line2"`
+	IsDefault     bool      `json:"is_default" db:"is_default"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at" db:"updated_at"`
+}
@@ -0,0 +1,59 @@
+package address
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrAddressNotFound = errors.New("address not found")
+
+type Repository interface {
+	// Create и Update при IsDefault=true снимают флаг с остальных адресов пользователя.
+	// Create делает первый адрес пользователя адресом по умолчанию.
+	Create(ctx context.Context, a *Address) (int64, error)
+	Get(ctx context.Context, userID, id int64) (*Address, error)
+	List(ctx context.Context, userID int64) ([]*Address, error)
+	Update(ctx context.Context, a *Address) error
+	Delete(ctx context.Context, userID, id int64) error
+}
+
+type Service interface {
+	Create(ctx context.Context, a *Address) (*Address, error)
+	Get(ctx context.Context, userID, id int64) (*Address, error)
+	List(ctx context.Context, userID int64) ([]*Address, error)
+	Update(ctx context.Context, a *Address) error
+	Delete(ctx context.Context, userID, id int64) error
+}
+
+type addressService struct {
+	repo Repository
+}
+
+func NewService(repo Repository) Service {
+	return &addressService{repo: repo}
+}
+
+// Create сохраняет адрес; первый адрес пользователя становится адресом по умолчанию.
+func (s *addressService) Create(ctx context.Context, a *Address) (*Address, error) {
+	id, err := s.repo.Create(ctx, a)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.Get(ctx, a.UserID, id)
+}
+
+func (s *addressService) Get(ctx context.Context, userID, id int64) (*Address, error) {
+	return s.repo.Get(ctx, userID, id)
+}
+
+func (s *addressService) List(ctx context.Context, userID int64) ([]*Address, error) {
+	return s.repo.List(ctx, userID)
+}
+
+func (s *addressService) Update(ctx context.Context, a *Address) error {
+	return s.repo.Update(ctx, a)
+}
+
+func (s *addressService) Delete(ctx context.Context, userID, id int64) error {
+	return s.repo.Delete(ctx, userID, id)
+}
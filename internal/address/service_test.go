@@ -0,0 +1,69 @@
+package address
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type mockRepo struct {
+	mock.Mock
+}
+
+func (m *mockRepo) Create(ctx context.Context, a *Address) (int64, error) {
+	args := m.Called(ctx, a)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *mockRepo) Get(ctx context.Context, userID, id int64) (*Address, error) {
+	args := m.Called(ctx, userID, id)
+	a, _ := args.Get(0).(*Address)
+	return a, args.Error(1)
+}
+
+func (m *mockRepo) List(ctx context.Context, userID int64) ([]*Address, error) {
+	args := m.Called(ctx, userID)
+	addrs, _ := args.Get(0).([]*Address)
+	return addrs, args.Error(1)
+}
+
+func (m *mockRepo) Update(ctx context.Context, a *Address) error {
+	return m.Called(ctx, a).Error(0)
+}
+
+func (m *mockRepo) Delete(ctx context.Context, userID, id int64) error {
+	return m.Called(ctx, userID, id).Error(0)
+}
+
+func TestService_CreateReturnsStoredAddress(t *testing.T) {
+	ctx := context.Background()
+	repo := new(mockRepo)
+	svc := NewService(repo)
+	a := &Address{UserID: 7, City: "Moscow"}
+
+	// адрес по умолчанию выбирает репозиторий под блокировкой, сервис его не угадывает
+	repo.On("Create", ctx, a).Return(int64(3), nil)
+	repo.On("Get", ctx, int64(7), int64(3)).Return(&Address{ID: 3, UserID: 7, City: "Moscow", IsDefault: true}, nil)
+
+	got, err := svc.Create(ctx, a)
+	require.NoError(t, err)
+	assert.True(t, got.IsDefault)
+	repo.AssertNotCalled(t, "List", mock.Anything, mock.Anything)
+}
+
+func TestService_CreateError(t *testing.T) {
+	ctx := context.Background()
+	repo := new(mockRepo)
+	svc := NewService(repo)
+	a := &Address{UserID: 7}
+
+	repo.On("Create", ctx, a).Return(int64(0), errors.New("db down"))
+
+	_, err := svc.Create(ctx, a)
+	assert.Error(t, err)
+	repo.AssertNotCalled(t, "Get", mock.Anything, mock.Anything, mock.Anything)
+}
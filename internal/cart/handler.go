@@ -1,7 +1,9 @@
 package cart
 
 import (
+	"errors"
 	"marketplace/internal/auth"
+	"marketplace/internal/currency"
 	"net/http"
 	"strconv"
 
@@ -25,6 +27,8 @@ func RegisterRoutes(r *gin.Engine, svc Service) {
 		g.POST("/items", h.add)
 		g.DELETE("/items/:product_id", h.remove)
 		g.DELETE("", h.clear)
+		g.GET("/currency", h.getCurrency)
+		g.PUT("/currency", h.setCurrency)
 	}
 
 }
@@ -35,7 +39,8 @@ type addReq struct {
 }
 
 // @Summary Add item to cart
-// @Description Add an item to the user's cart
+// @Description Add an item to the user's cart. The cart holds one line per product:
+// @Description adding a product already in the cart increases its quantity and returns the id of that line.
 // @Tags Cart
 // @Security BearerAuth
 // @Accept json
@@ -120,3 +125,55 @@ func (h *Handler) clear(c *gin.Context) {
 	}
 	c.Status(http.StatusNoContent)
 }
+
+type currencyReq struct {
+	Currency string `json:"currency" binding:"required,len=3"`
+}
+
+// @Summary Get cart currency
+// @Description Currency the cart is priced and checked out in (default RUB)
+// @Tags Cart
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} map[string]string "currency"
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /cart/currency [get]
+func (h *Handler) getCurrency(c *gin.Context) {
+	code, err := h.svc.Currency(c.Request.Context(), auth.GetUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"currency": code})
+}
+
+// @Summary Set cart currency
+// @Description Choose the currency for prices and checkout. The exchange rate is fixed when the order is placed.
+// @Tags Cart
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param input body currencyReq true "ISO 4217 currency code"
+// @Success 200 {object} map[string]string "currency"
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /cart/currency [put]
+func (h *Handler) setCurrency(c *gin.Context) {
+	var req currencyReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	code, err := h.svc.SetCurrency(c.Request.Context(), auth.GetUserID(c), req.Currency)
+	if errors.Is(err, currency.ErrUnknownCurrency) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"currency": code})
+}
@@ -12,3 +12,30 @@ type CartItem struct {
 	CreatedAt time.Time `db:"created_at" json:"created_at"`
 	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
 }
+
+// AddedItem — сколько товара из запрошенного попало в корзину при добавлении через Service.AddItems.
+type AddedItem struct {
+	ProductID int64
+	Requested int64
+	Quantity  int64
+	// Missing — товара нет в каталоге
+	Missing bool
+}
+
+// FitStock решает, сколько каждой позиции положить в корзину: не больше остатка на складе
+// за вычетом того, что уже лежит в корзине. Повторяющийся товар делит один остаток, поэтому
+// inCart дополняется добавленным количеством.
+func FitStock(items []CartItem, stock, inCart map[int64]int64) []AddedItem {
+	res := make([]AddedItem, len(items))
+	for i, it := range items {
+		res[i] = AddedItem{ProductID: it.ProductID, Requested: it.Quantity}
+		left, ok := stock[it.ProductID]
+		if !ok {
+			res[i].Missing = true
+			continue
+		}
+		res[i].Quantity = max(min(it.Quantity, left-inCart[it.ProductID]), 0)
+		inCart[it.ProductID] += res[i].Quantity
+	}
+	return res
+}
@@ -0,0 +1,39 @@
+package cart
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFitStock(t *testing.T) {
+	stock := map[int64]int64{10: 5, 20: 3, 30: 0, 50: 2}
+	// в корзине уже лежит один чехол и весь остаток подставок
+	inCart := map[int64]int64{20: 1, 50: 2}
+
+	added := FitStock([]CartItem{
+		{ProductID: 10, Quantity: 1},
+		{ProductID: 20, Quantity: 3},
+		{ProductID: 30, Quantity: 1},
+		{ProductID: 40, Quantity: 1},
+		{ProductID: 50, Quantity: 1},
+	}, stock, inCart)
+
+	assert.Equal(t, []AddedItem{
+		{ProductID: 10, Requested: 1, Quantity: 1},
+		{ProductID: 20, Requested: 3, Quantity: 2},
+		{ProductID: 30, Requested: 1},
+		{ProductID: 40, Requested: 1, Missing: true},
+		{ProductID: 50, Requested: 1},
+	}, added)
+}
+
+func TestFitStock_RepeatedProductSharesStock(t *testing.T) {
+	added := FitStock([]CartItem{
+		{ProductID: 10, Quantity: 2},
+		{ProductID: 10, Quantity: 2},
+	}, map[int64]int64{10: 3}, map[int64]int64{})
+
+	assert.Equal(t, int64(2), added[0].Quantity)
+	assert.Equal(t, int64(1), added[1].Quantity)
+}
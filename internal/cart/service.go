@@ -1,19 +1,37 @@
 package cart
 
-import "context"
+import (
+	"context"
+	"marketplace/internal/currency"
+)
 
 type Repository interface {
 	AddItem(ctx context.Context, item *CartItem) (int64, error)
+	// AddItems в одной транзакции блокирует товары и строки корзины и добавляет позиции,
+	// урезанные по FitStock.
+	AddItems(ctx context.Context, userID int64, items []CartItem) ([]AddedItem, error)
 	ListItems(ctx context.Context, userID int64) ([]*CartItem, error)
 	RemoveItem(ctx context.Context, userID, productID int64) error
 	Clear(ctx context.Context, userID int64) error
+	// GetCurrency возвращает валюту корзины; пусто, если покупатель ее не выбирал.
+	GetCurrency(ctx context.Context, userID int64) (string, error)
+	SetCurrency(ctx context.Context, userID int64, code string) error
 }
 
 type Service interface {
+	// AddItem добавляет товар в корзину; если товар уже есть, увеличивает количество.
+	// Остаток на складе не проверяется: нехватку покажет расчет заказа.
 	AddItem(ctx context.Context, userID, productID int64, qty int) (int64, error)
+	// AddItems добавляет несколько товаров разом, все или ничего. Количество каждой позиции
+	// урезается до остатка на складе за вычетом того, что уже лежит в корзине; результат —
+	// по элементу на каждую позицию items.
+	AddItems(ctx context.Context, userID int64, items []CartItem) ([]AddedItem, error)
 	ListItems(ctx context.Context, userID int64) ([]*CartItem, error)
 	RemoveItem(ctx context.Context, userID, productID int64) error
 	Clear(ctx context.Context, userID int64) error
+	// Currency — валюта, в которой покупатель видит цены и оформляет заказ; по умолчанию currency.Base.
+	Currency(ctx context.Context, userID int64) (string, error)
+	SetCurrency(ctx context.Context, userID int64, code string) (string, error)
 }
 
 type cartService struct {
@@ -33,6 +51,13 @@ func (c *cartService) AddItem(ctx context.Context, userID, productID int64, qty
 	return c.repo.AddItem(ctx, item)
 }
 
+func (c *cartService) AddItems(ctx context.Context, userID int64, items []CartItem) ([]AddedItem, error) {
+	if len(items) == 0 {
+		return []AddedItem{}, nil
+	}
+	return c.repo.AddItems(ctx, userID, items)
+}
+
 func (c *cartService) ListItems(ctx context.Context, userID int64) ([]*CartItem, error) {
 	return c.repo.ListItems(ctx, userID)
 }
@@ -44,3 +69,25 @@ func (c *cartService) RemoveItem(ctx context.Context, userID, productID int64) e
 func (c *cartService) Clear(ctx context.Context, userID int64) error {
 	return c.repo.Clear(ctx, userID)
 }
+
+func (c *cartService) Currency(ctx context.Context, userID int64) (string, error) {
+	code, err := c.repo.GetCurrency(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	if code == "" {
+		return currency.Base, nil
+	}
+	return code, nil
+}
+
+func (c *cartService) SetCurrency(ctx context.Context, userID int64, code string) (string, error) {
+	code, err := currency.Normalize(code)
+	if err != nil {
+		return "", err
+	}
+	if err = c.repo.SetCurrency(ctx, userID, code); err != nil {
+		return "", err
+	}
+	return code, nil
+}
@@ -0,0 +1,139 @@
+package currency
+
+import (
+	"errors"
+	"marketplace/internal/auth"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Handler struct {
+	svc *Service
+}
+
+func NewHandler(svc *Service) *Handler {
+	return &Handler{svc: svc}
+}
+
+func RegisterRoutes(r *gin.Engine, svc *Service) {
+	h := NewHandler(svc)
+
+	public := r.Group("/currencies")
+	{
+		public.GET("", h.supported)
+		public.GET("/rates", h.current)
+	}
+
+	admin := r.Group("/admin/currencies")
+	admin.Use(auth.JWTAuth(), auth.RequireRole("admin"))
+	{
+		admin.GET("/rates", h.listRates)
+		admin.POST("/rates", h.createRate)
+	}
+}
+
+func writeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrUnknownCurrency), errors.Is(err, ErrInvalidRate):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrRateExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// @Summary Supported currencies
+// @Description ISO 4217 currencies with the number of minor-unit digits. Amounts are always integers in minor units.
+// @Tags currencies
+// @Produce json
+// @Success 200 {array} currency.Info
+// @Router /currencies [get]
+func (h *Handler) supported(c *gin.Context) {
+	c.JSON(http.StatusOK, Supported())
+}
+
+// @Summary Current exchange rates
+// @Description Latest effective rate for every configured pair
+// @Tags currencies
+// @Produce json
+// @Success 200 {array} currency.Rate
+// @Failure 500 {object} map[string]string
+// @Router /currencies/rates [get]
+func (h *Handler) current(c *gin.Context) {
+	rates, err := h.svc.Current(c)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, rates)
+}
+
+// @Summary List exchange rate history (admin)
+// @Description All rates including future and superseded ones, newest effective date first
+// @Tags admin-currencies
+// @Security BearerAuth
+// @Produce json
+// @Param base query string false "Base currency"
+// @Param quote query string false "Quote currency"
+// @Param offset query int false "Offset" default(0)
+// @Param limit query int false "Limit" default(50)
+// @Success 200 {array} currency.Rate
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/currencies/rates [get]
+func (h *Handler) listRates(c *gin.Context) {
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	rates, err := h.svc.ListRates(c, RateFilter{
+		Base:   c.Query("base"),
+		Quote:  c.Query("quote"),
+		Offset: offset,
+		Limit:  limit,
+	})
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, rates)
+}
+
+type rateReq struct {
+	Base  string `json:"base" binding:"required,len=3"`
+	Quote string `json:"quote" binding:"required,len=3"`
+	// Rate — сколько единиц quote за одну единицу base, десятичной строкой
+	Rate string `json:"rate" binding:"required"`
+	// EffectiveAt — с какого момента действует курс; по умолчанию сейчас
+	EffectiveAt *time.Time `json:"effective_at"`
+}
+
+// @Summary Add exchange rate (admin)
+// @Description Add a rate for a currency pair effective from the given time. Existing rates are never changed; orders keep the rate they were priced with.
+// @Tags admin-currencies
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param input body rateReq true "Rate"
+// @Success 201 {object} currency.Rate
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 409 {object} map[string]string "rate for the pair and effective time already exists"
+// @Router /admin/currencies/rates [post]
+func (h *Handler) createRate(c *gin.Context) {
+	var req rateReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rate, err := h.svc.SetRate(c, req.Base, req.Quote, req.Rate, req.EffectiveAt)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, rate)
+}
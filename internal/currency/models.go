@@ -0,0 +1,231 @@
+package currency
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Base — валюта учета: в ней заданы тарифы доставки и по умолчанию цены товаров.
+const Base = "RUB"
+
+var (
+	ErrUnknownCurrency = errors.New("unknown currency")
+	ErrInvalidRate     = errors.New("invalid exchange rate")
+	ErrRateNotFound    = errors.New("exchange rate not found")
+	ErrRateExists      = errors.New("exchange rate for the pair and effective time already exists")
+)
+
+// exponents — число знаков минорной единицы по ISO 4217: суммы всегда хранятся
+// целым числом минорных единиц (копейки, центы, иены, филсы).
+var exponents = map[string]int{
+	"RUB": 2, "USD": 2, "EUR": 2, "GBP": 2, "CHF": 2, "CNY": 2, "KZT": 2, "BYN": 2,
+	"AMD": 2, "UZS": 2, "TRY": 2, "AED": 2, "INR": 2,
+	"JPY": 0, "KRW": 0, "VND": 0, "CLP": 0, "ISK": 0,
+	"KWD": 3, "BHD": 3, "OMR": 3, "JOD": 3, "TND": 3,
+}
+
+// Normalize приводит код к верхнему регистру и проверяет, что валюта поддерживается.
+func Normalize(code string) (string, error) {
+	c := strings.ToUpper(strings.TrimSpace(code))
+	if _, ok := exponents[c]; !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownCurrency, code)
+	}
+	return c, nil
+}
+
+// Exponent — число знаков после запятой у валюты; для неизвестной — 2.
+func Exponent(code string) int {
+	if e, ok := exponents[code]; ok {
+		return e
+	}
+	return 2
+}
+
+// Info — поддерживаемая валюта.
+type Info struct {
+	Code     string `json:"code"`
+	Exponent int    `json:"exponent"`
+}
+
+// Supported возвращает поддерживаемые валюты по алфавиту.
+func Supported() []Info {
+	out := make([]Info, 0, len(exponents))
+	for code, e := range exponents {
+		out = append(out, Info{Code: code, Exponent: e})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Code < out[j].Code })
+	return out
+}
+
+// Rate — курс: одна единица Base стоит Rate единиц Quote (в основных единицах, не минорных).
+// Курс действует с EffectiveAt до появления более нового по той же паре.
+type Rate struct {
+	ID          int64     `json:"id" db:"id"`
+	Base        string    `json:"base" db:"base"`
+	Quote       string    `json:"quote" db:"quote"`
+	Rate        string    `json:"rate" db:"rate"` // десятичная строка, например "92.4512"
+	EffectiveAt time.Time `json:"effective_at" db:"effective_at"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// ParseRate разбирает десятичный курс; курс должен быть положительным.
+func ParseRate(s string) (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok || r.Sign() <= 0 {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidRate, s)
+	}
+	return r, nil
+}
+
+// Convert пересчитывает сумму в минорных единицах from в минорные единицы to по курсу
+// (единиц to за единицу from). Округление — до ближайшего, половина от нуля.
+func Convert(amount int64, from, to string, rate *big.Rat) int64 {
+	v := new(big.Rat).Mul(new(big.Rat).SetInt64(amount), rate)
+	shift := Exponent(to) - Exponent(from)
+	pow := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(shift))), nil))
+	if shift >= 0 {
+		v.Mul(v, pow)
+	} else {
+		v.Quo(v, pow)
+	}
+	return round(v)
+}
+
+func round(v *big.Rat) int64 {
+	num := new(big.Int).Abs(v.Num())
+	q, r := new(big.Int).QuoRem(num, v.Denom(), new(big.Int))
+	if r.Lsh(r, 1).Cmp(v.Denom()) >= 0 {
+		q.Add(q, big.NewInt(1))
+	}
+	if v.Sign() < 0 {
+		q.Neg(q)
+	}
+	return q.Int64()
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+type pair struct{ base, quote string }
+
+// Table — курсы, действующие на момент расчета. Пересчет ищет прямой курс,
+// затем обратный, затем кросс-курс через Base. Used — строки курсов,
+// по которым реально считали: их сохраняют в заказе. Таблица не потокобезопасна:
+// ее собирают на каждый расчет.
+type Table struct {
+	rates map[pair]Rate
+	used  map[int64]Rate
+}
+
+// NewTable собирает таблицу из курсов; по каждой паре должен быть один курс.
+func NewTable(rates []Rate) *Table {
+	t := &Table{rates: make(map[pair]Rate, len(rates)), used: map[int64]Rate{}}
+	for _, r := range rates {
+		t.rates[pair{r.Base, r.Quote}] = r
+	}
+	return t
+}
+
+// Rate возвращает курс from -> to: сколько единиц to за одну единицу from.
+func (t *Table) Rate(from, to string) (*big.Rat, error) {
+	if from == to {
+		return big.NewRat(1, 1), nil
+	}
+	if r, ok, err := t.direct(from, to); ok || err != nil {
+		return r, err
+	}
+	if from != Base && to != Base {
+		a, aok, err := t.direct(from, Base)
+		if err != nil {
+			return nil, err
+		}
+		b, bok, err := t.direct(Base, to)
+		if err != nil {
+			return nil, err
+		}
+		if aok && bok {
+			return a.Mul(a, b), nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s/%s", ErrRateNotFound, from, to)
+}
+
+// direct ищет курс пары или обратной к ней.
+func (t *Table) direct(from, to string) (*big.Rat, bool, error) {
+	if r, ok := t.rates[pair{from, to}]; ok {
+		v, err := t.use(r)
+		return v, true, err
+	}
+	if r, ok := t.rates[pair{to, from}]; ok {
+		v, err := t.use(r)
+		if err != nil {
+			return nil, true, err
+		}
+		return v.Inv(v), true, nil
+	}
+	return nil, false, nil
+}
+
+func (t *Table) use(r Rate) (*big.Rat, error) {
+	v, err := ParseRate(r.Rate)
+	if err != nil {
+		return nil, err
+	}
+	t.used[r.ID] = r
+	return v, nil
+}
+
+// Convert пересчитывает сумму в минорных единицах из from в to.
+func (t *Table) Convert(amount int64, from, to string) (int64, error) {
+	if from == to {
+		return amount, nil
+	}
+	rate, err := t.Rate(from, to)
+	if err != nil {
+		return 0, err
+	}
+	return Convert(amount, from, to, rate), nil
+}
+
+// Used возвращает курсы, по которым пересчитывали, по возрастанию id.
+func (t *Table) Used() []Rate {
+	out := make([]Rate, 0, len(t.used))
+	for _, r := range t.used {
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// Rates — курсы, зафиксированные в заказе (orders.exchange_rates).
+type Rates []Rate
+
+func (r Rates) Value() (driver.Value, error) {
+	if r == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(r)
+}
+
+func (r *Rates) Scan(src any) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, r)
+	case string:
+		return json.Unmarshal([]byte(v), r)
+	case nil:
+		*r = nil
+		return nil
+	}
+	return errors.New("unsupported exchange_rates type")
+}
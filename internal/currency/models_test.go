@@ -0,0 +1,90 @@
+package currency
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvert_MinorUnits(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   int64
+		from, to string
+		rate     *big.Rat
+		want     int64
+	}{
+		// 100.00 USD по 92.5 = 9250.00 RUB
+		{"same exponent", 10000, "USD", "RUB", big.NewRat(925, 10), 925000},
+		// 1 000 JPY по 0.62 = 620.00 RUB: у иены нет дробной части
+		{"from zero decimals", 1000, "JPY", "RUB", big.NewRat(62, 100), 62000},
+		// 1 234.56 RUB по 1.613 = 1 991 JPY
+		{"to zero decimals", 123456, "RUB", "JPY", big.NewRat(1613, 1000), 1991},
+		// 100.00 RUB по 0.0033 = 0.330 KWD
+		{"to three decimals", 10000, "RUB", "KWD", big.NewRat(33, 10000), 330},
+		// 0.005 → 0.01: половина округляется от нуля
+		{"half away from zero", 5, "KWD", "USD", big.NewRat(1, 1), 1},
+		{"negative half away from zero", -5, "KWD", "USD", big.NewRat(1, 1), -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Convert(tt.amount, tt.from, tt.to, tt.rate))
+		})
+	}
+}
+
+func TestTable_DirectInverseAndCross(t *testing.T) {
+	table := NewTable([]Rate{
+		{ID: 1, Base: "USD", Quote: "RUB", Rate: "90", EffectiveAt: time.Now()},
+		{ID: 2, Base: "EUR", Quote: "RUB", Rate: "100", EffectiveAt: time.Now()},
+	})
+
+	got, err := table.Convert(1000, "USD", "RUB")
+	require.NoError(t, err)
+	assert.Equal(t, int64(90000), got)
+
+	// обратный курс
+	got, err = table.Convert(90000, "RUB", "USD")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1000), got)
+
+	// кросс-курс через рубль: 1 EUR = 100/90 USD
+	got, err = table.Convert(900, "EUR", "USD")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1000), got)
+
+	_, err = table.Convert(100, "JPY", "RUB")
+	assert.ErrorIs(t, err, ErrRateNotFound)
+
+	used := table.Used()
+	require.Len(t, used, 2)
+	assert.Equal(t, int64(1), used[0].ID)
+	assert.Equal(t, int64(2), used[1].ID)
+}
+
+func TestTable_SameCurrencyNeedsNoRate(t *testing.T) {
+	table := NewTable(nil)
+	got, err := table.Convert(12345, "RUB", "RUB")
+	require.NoError(t, err)
+	assert.Equal(t, int64(12345), got)
+	assert.Empty(t, table.Used())
+}
+
+func TestNormalizeAndParseRate(t *testing.T) {
+	code, err := Normalize(" usd ")
+	require.NoError(t, err)
+	assert.Equal(t, "USD", code)
+	_, err = Normalize("XXX")
+	assert.ErrorIs(t, err, ErrUnknownCurrency)
+
+	_, err = ParseRate("0")
+	assert.ErrorIs(t, err, ErrInvalidRate)
+	_, err = ParseRate("abc")
+	assert.ErrorIs(t, err, ErrInvalidRate)
+	r, err := ParseRate("92.4512")
+	require.NoError(t, err)
+	assert.Equal(t, 0, r.Cmp(big.NewRat(924512, 10000)))
+}
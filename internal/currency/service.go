@@ -0,0 +1,78 @@
+package currency
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type Repository interface {
+	CreateRate(ctx context.Context, r *Rate) (*Rate, error)
+	ListRates(ctx context.Context, f RateFilter) ([]Rate, error)
+	// RatesAt возвращает по каждой паре последний курс с effective_at <= at.
+	RatesAt(ctx context.Context, at time.Time) ([]Rate, error)
+}
+
+type RateFilter struct {
+	Base   string
+	Quote  string
+	Offset int
+	Limit  int
+}
+
+type Service struct {
+	repo Repository
+	now  func() time.Time
+}
+
+func NewService(repo Repository) *Service {
+	return &Service{repo: repo, now: time.Now}
+}
+
+// SetRate добавляет курс пары. Прошлые курсы не меняются: заказы ссылаются на них,
+// а новый курс просто начинает действовать с effectiveAt (по умолчанию — сейчас).
+func (s *Service) SetRate(ctx context.Context, base, quote, rate string, effectiveAt *time.Time) (*Rate, error) {
+	b, err := Normalize(base)
+	if err != nil {
+		return nil, err
+	}
+	q, err := Normalize(quote)
+	if err != nil {
+		return nil, err
+	}
+	if b == q {
+		return nil, fmt.Errorf("%w: base and quote must differ", ErrInvalidRate)
+	}
+	if _, err = ParseRate(rate); err != nil {
+		return nil, err
+	}
+	r := &Rate{Base: b, Quote: q, Rate: rate, EffectiveAt: s.now()}
+	if effectiveAt != nil {
+		r.EffectiveAt = *effectiveAt
+	}
+	return s.repo.CreateRate(ctx, r)
+}
+
+func (s *Service) ListRates(ctx context.Context, f RateFilter) ([]Rate, error) {
+	if f.Limit <= 0 || f.Limit > 200 {
+		f.Limit = 50
+	}
+	if f.Offset < 0 {
+		f.Offset = 0
+	}
+	return s.repo.ListRates(ctx, f)
+}
+
+// Current — курсы, действующие сейчас.
+func (s *Service) Current(ctx context.Context) ([]Rate, error) {
+	return s.repo.RatesAt(ctx, s.now())
+}
+
+// Table собирает таблицу курсов, действующих на момент at.
+func (s *Service) Table(ctx context.Context, at time.Time) (*Table, error) {
+	rates, err := s.repo.RatesAt(ctx, at)
+	if err != nil {
+		return nil, fmt.Errorf("load exchange rates: %w", err)
+	}
+	return NewTable(rates), nil
+}
@@ -0,0 +1,52 @@
+package idempotency
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Collector периодически удаляет истекшие ключи.
+type Collector struct {
+	store     Store
+	interval  time.Duration
+	batchSize int
+}
+
+func NewCollector(store Store, interval time.Duration) *Collector {
+	return &Collector{store: store, interval: interval, batchSize: 1000}
+}
+
+// Run блокируется до отмены ctx.
+func (w *Collector) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.tick(ctx)
+		}
+	}
+}
+
+func (w *Collector) tick(ctx context.Context) {
+	for {
+		n, err := w.store.DeleteExpired(ctx, w.batchSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				zap.L().Error("Failed to delete expired idempotency keys", zap.Error(err))
+			}
+			return
+		}
+		if n > 0 {
+			zap.L().Info("Deleted expired idempotency keys", zap.Int("count", n))
+		}
+		if n < w.batchSize {
+			return
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// Package idempotency повторяет сохраненный ответ на запрос с тем же Idempotency-Key,
+// чтобы повторная отправка формы или ретрай клиента не создавали дубликаты.
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// HeaderKey — заголовок с ключом идемпотентности от клиента.
+const HeaderKey = "Idempotency-Key"
+
+// HeaderReplayed выставляется в ответе, взятом из сохраненного результата.
+const HeaderReplayed = "Idempotent-Replayed"
+
+// maxKeyLength ограничивает длину ключа; UUID с запасом помещается.
+const maxKeyLength = 255
+
+// maxBodyBytes ограничивает тело запроса с ключом: мидлварь читает его целиком, чтобы посчитать хэш.
+const maxBodyBytes = 1 << 20
+
+// Состояния ключа.
+const (
+	// StateInProgress — запрос выполняется; после истечения аренды ключ можно перехватить
+	StateInProgress = "in_progress"
+	// StateCompleted — ответ сохранен и повторяется до истечения ключа
+	StateCompleted = "completed"
+	// StateFailed — запрос упал (5xx или паника), ключ можно использовать повторно
+	StateFailed = "failed"
+)
+
+// Request — то, с чем ключ был использован впервые. Ключи принадлежат пользователю;
+// повтор ключа с другим методом, путем или телом отклоняется.
+type Request struct {
+	UserID   int64 // 0 — анонимный запрос
+	Key      string
+	Method   string
+	Path     string
+	BodyHash string
+}
+
+// Matches сообщает, что повторный запрос совпадает с исходным.
+func (r Request) Matches(o Request) bool {
+	return r.UserID == o.UserID && r.Method == o.Method && r.Path == o.Path && r.BodyHash == o.BodyHash
+}
+
+// Response — сохраненный ответ обработчика.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// Record — запись о ключе; Response заполнен только в состоянии completed.
+type Record struct {
+	Request
+	State    string
+	Response *Response
+}
+
+type Store interface {
+	// Start захватывает ключ пользователя на время lease и возвращает токен захвата.
+	// Свободным считается новый ключ, failed-ключ или in_progress с истекшей арендой
+	// (при совпадающем запросе), а также любой ключ старше ttl. Если ключ занят,
+	// токен пустой и возвращается существующая запись.
+	Start(ctx context.Context, req Request, lease, ttl time.Duration) (rec *Record, token string, err error)
+	// Complete сохраняет ответ, если ключ все еще захвачен этим токеном.
+	Complete(ctx context.Context, req Request, token string, resp Response) error
+	// Fail переводит ключ в failed, чтобы запрос можно было повторить.
+	Fail(ctx context.Context, req Request, token string) error
+	// DeleteExpired удаляет до limit истекших ключей и возвращает их число.
+	DeleteExpired(ctx context.Context, limit int) (int, error)
+}
@@ -0,0 +1,191 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"marketplace/internal/auth"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// skipHeaders не сохраняются: они относятся к конкретному HTTP-ответу, а не к результату.
+var skipHeaders = map[string]bool{
+	"Content-Length":    true,
+	"Date":              true,
+	"Connection":        true,
+	"Transfer-Encoding": true,
+	"X-Request-Id":      true,
+}
+
+// Middleware учитывает Idempotency-Key на POST, PUT и DELETE. Первый запрос с ключом
+// захватывает его на время lease, выполняется, и его ответ (код, заголовки, тело)
+// сохраняется на ttl; повторы получают сохраненный ответ. Ключ с другим методом, путем
+// или телом — 422, ключ, запрос по которому еще выполняется, — 409. Ответы 5xx и паники
+// переводят ключ в failed, такой запрос можно повторить. Если процесс упал посреди запроса,
+// ключ освобождается по истечении lease.
+//
+// Ключи действуют в пределах пользователя, поэтому запросы без токена ключом не защищаются:
+// иначе все анонимные клиенты делили бы одно пространство ключей. Тело запроса с ключом
+// больше maxBodyBytes — 413.
+//
+// Подключается до ErrorHandler, чтобы сохранялись и ответы, записанные им.
+func Middleware(store Store, lease, ttl time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(HeaderKey)
+		if key == "" || !mutating(c.Request.Method) {
+			c.Next()
+			return
+		}
+		if len(key) > maxKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+			return
+		}
+		userID := requestUserID(c)
+		if userID == 0 {
+			c.Next()
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxBodyBytes))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body is too large"})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "cannot read request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		req := Request{
+			UserID:   userID,
+			Key:      key,
+			Method:   c.Request.Method,
+			Path:     c.Request.URL.Path,
+			BodyHash: bodyHash(body),
+		}
+
+		rec, token, err := store.Start(c, req, lease, ttl)
+		if err != nil {
+			zap.L().Error("idempotency: cannot start key", zap.String("key", key), zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "cannot process Idempotency-Key"})
+			return
+		}
+		if token == "" {
+			switch {
+			case !rec.Request.Matches(req):
+				c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used with a different request"})
+			case rec.State == StateCompleted && rec.Response != nil:
+				replay(c, rec.Response)
+			default:
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "request with this Idempotency-Key is still in progress"})
+			}
+			return
+		}
+
+		w := &recorder{ResponseWriter: c.Writer}
+		c.Writer = w
+		completed := false
+		defer func() {
+			if completed {
+				return
+			}
+			// паника: освобождаем ключ и отдаем ее ZapRecovery
+			ctx, cancel := detached(c)
+			defer cancel()
+			if err := store.Fail(ctx, req, token); err != nil {
+				zap.L().Error("idempotency: cannot release key", zap.String("key", key), zap.Error(err))
+			}
+		}()
+		c.Next()
+		completed = true
+
+		// ответ уже ушел клиенту: сохраняем его, даже если клиент отключился
+		ctx, cancel := detached(c)
+		defer cancel()
+		if w.Status() >= http.StatusInternalServerError {
+			if err = store.Fail(ctx, req, token); err != nil {
+				zap.L().Error("idempotency: cannot release key", zap.String("key", key), zap.Error(err))
+			}
+			return
+		}
+		if err = store.Complete(ctx, req, token, Response{
+			StatusCode: w.Status(),
+			Header:     storedHeader(w.Header()),
+			Body:       w.body.Bytes(),
+		}); err != nil {
+			zap.L().Error("idempotency: cannot save response", zap.String("key", key), zap.Error(err))
+		}
+	}
+}
+
+func detached(c *gin.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(c.Request.Context()), 5*time.Second)
+}
+
+func bodyHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+func mutating(method string) bool {
+	return method == http.MethodPost || method == http.MethodPut || method == http.MethodDelete
+}
+
+// requestUserID достает пользователя из токена: мидлварь стоит глобально,
+// раньше JWTAuth групп. Без токена или с неверным токеном — 0.
+func requestUserID(c *gin.Context) int64 {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok {
+		return 0
+	}
+	claims, err := auth.ParseToken(token)
+	if err != nil || claims == nil {
+		return 0
+	}
+	return claims.UserID
+}
+
+func replay(c *gin.Context, resp *Response) {
+	for k, v := range resp.Header {
+		c.Writer.Header()[k] = v
+	}
+	c.Header(HeaderReplayed, "true")
+	c.Status(resp.StatusCode)
+	_, _ = c.Writer.Write(resp.Body)
+	c.Abort()
+}
+
+func storedHeader(h http.Header) http.Header {
+	out := make(http.Header, len(h))
+	for k, v := range h {
+		if skipHeaders[http.CanonicalHeaderKey(k)] {
+			continue
+		}
+		out[k] = append([]string(nil), v...)
+	}
+	return out
+}
+
+// recorder дублирует тело ответа в буфер.
+type recorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *recorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
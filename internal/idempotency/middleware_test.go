@@ -0,0 +1,269 @@
+package idempotency
+
+import (
+	"context"
+	"fmt"
+	"marketplace/internal/auth"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memKey struct {
+	userID int64
+	key    string
+}
+
+type memRecord struct {
+	Record
+	token       string
+	lockedUntil time.Time
+	expiresAt   time.Time
+}
+
+// memStore повторяет семантику IdemRepo в памяти.
+type memStore struct {
+	mu   sync.Mutex
+	now  time.Time
+	seq  int
+	recs map[memKey]*memRecord
+}
+
+func newMemStore() *memStore {
+	return &memStore{now: time.Now(), recs: map[memKey]*memRecord{}}
+}
+
+func (m *memStore) Start(_ context.Context, req Request, lease, ttl time.Duration) (*Record, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := memKey{req.UserID, req.Key}
+	if rec, ok := m.recs[k]; ok {
+		free := rec.expiresAt.Before(m.now) || rec.Request.Matches(req) &&
+			(rec.State == StateFailed || rec.State == StateInProgress && rec.lockedUntil.Before(m.now))
+		if !free {
+			r := rec.Record
+			return &r, "", nil
+		}
+	}
+	m.seq++
+	token := fmt.Sprintf("t%d", m.seq)
+	m.recs[k] = &memRecord{
+		Record:      Record{Request: req, State: StateInProgress},
+		token:       token,
+		lockedUntil: m.now.Add(lease),
+		expiresAt:   m.now.Add(ttl),
+	}
+	return nil, token, nil
+}
+
+func (m *memStore) Complete(_ context.Context, req Request, token string, resp Response) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if rec := m.recs[memKey{req.UserID, req.Key}]; rec != nil && rec.token == token {
+		rec.State, rec.Response, rec.token = StateCompleted, &resp, ""
+	}
+	return nil
+}
+
+func (m *memStore) Fail(_ context.Context, req Request, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if rec := m.recs[memKey{req.UserID, req.Key}]; rec != nil && rec.token == token {
+		rec.State, rec.token = StateFailed, ""
+	}
+	return nil
+}
+
+func (m *memStore) DeleteExpired(_ context.Context, limit int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for k, rec := range m.recs {
+		if n < limit && rec.expiresAt.Before(m.now) {
+			delete(m.recs, k)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *memStore) state(userID int64, key string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if rec := m.recs[memKey{userID, key}]; rec != nil {
+		return rec.State
+	}
+	return ""
+}
+
+func (m *memStore) advance(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.now = m.now.Add(d)
+}
+
+func newRouter(store Store, calls *int, status int) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Middleware(store, time.Minute, time.Hour))
+	h := func(c *gin.Context) {
+		*calls++
+		c.Header("Location", "/things/1")
+		c.JSON(status, gin.H{"call": *calls})
+	}
+	r.POST("/things", h)
+	r.PUT("/things/:id", h)
+	return r
+}
+
+// testUserID — пользователь, от имени которого do шлет запросы.
+const testUserID = 1
+
+func do(r http.Handler, method, path, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(HeaderKey, key)
+	}
+	token, err := auth.GenerateToken(testUserID, "alice", "user")
+	if err != nil {
+		panic(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestMiddleware_ReplaysResponse(t *testing.T) {
+	calls := 0
+	r := newRouter(newMemStore(), &calls, http.StatusCreated)
+
+	first := do(r, http.MethodPost, "/things", "k1", `{"a":1}`)
+	second := do(r, http.MethodPost, "/things", "k1", `{"a":1}`)
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, http.StatusCreated, second.Code)
+	assert.Equal(t, first.Body.String(), second.Body.String())
+	assert.Equal(t, "/things/1", second.Header().Get("Location"))
+	assert.Equal(t, "true", second.Header().Get(HeaderReplayed))
+	assert.Empty(t, first.Header().Get(HeaderReplayed))
+}
+
+func TestMiddleware_RejectsDifferentRequest(t *testing.T) {
+	calls := 0
+	r := newRouter(newMemStore(), &calls, http.StatusCreated)
+	do(r, http.MethodPost, "/things", "k1", `{"a":1}`)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, do(r, http.MethodPost, "/things", "k1", `{"a":2}`).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, do(r, http.MethodPut, "/things/1", "k1", `{"a":1}`).Code)
+	assert.Equal(t, 1, calls)
+}
+
+func TestMiddleware_InProgress(t *testing.T) {
+	store := newMemStore()
+	req := Request{UserID: testUserID, Key: "k1", Method: http.MethodPost, Path: "/things", BodyHash: bodyHash(nil)}
+	_, token, err := store.Start(context.Background(), req, time.Minute, time.Hour)
+	require.NoError(t, err)
+	require.NotEmpty(t, token)
+	calls := 0
+	r := newRouter(store, &calls, http.StatusCreated)
+
+	assert.Equal(t, http.StatusConflict, do(r, http.MethodPost, "/things", "k1", "").Code)
+	assert.Equal(t, 0, calls)
+
+	// процесс, захвативший ключ, умер: после истечения аренды ключ перехватывается
+	store.advance(2 * time.Minute)
+	assert.Equal(t, http.StatusCreated, do(r, http.MethodPost, "/things", "k1", "").Code)
+	assert.Equal(t, 1, calls)
+	// запоздавший первый запрос не перезаписывает результат
+	assert.NoError(t, store.Complete(context.Background(), req, token, Response{StatusCode: http.StatusTeapot}))
+	assert.Equal(t, http.StatusCreated, do(r, http.MethodPost, "/things", "k1", "").Code)
+}
+
+func TestMiddleware_ServerErrorMarksFailed(t *testing.T) {
+	store := newMemStore()
+	calls := 0
+	r := newRouter(store, &calls, http.StatusInternalServerError)
+
+	do(r, http.MethodPost, "/things", "k1", "")
+	assert.Equal(t, StateFailed, store.state(testUserID, "k1"))
+	do(r, http.MethodPost, "/things", "k1", "")
+	assert.Equal(t, 2, calls)
+}
+
+func TestMiddleware_PanicMarksFailed(t *testing.T) {
+	store := newMemStore()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(gin.Recovery(), Middleware(store, time.Minute, time.Hour))
+	r.POST("/boom", func(c *gin.Context) { panic("boom") })
+
+	assert.Equal(t, http.StatusInternalServerError, do(r, http.MethodPost, "/boom", "k1", "").Code)
+	assert.Equal(t, StateFailed, store.state(testUserID, "k1"))
+}
+
+func TestMiddleware_KeysScopedPerUser(t *testing.T) {
+	store := newMemStore()
+	ctx := context.Background()
+	alice := Request{UserID: 1, Key: "k1", Method: http.MethodPost, Path: "/things", BodyHash: bodyHash(nil)}
+	_, token, err := store.Start(ctx, alice, time.Minute, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, store.Complete(ctx, alice, token, Response{StatusCode: http.StatusCreated}))
+
+	bob := alice
+	bob.UserID = 2
+	_, token, err = store.Start(ctx, bob, time.Minute, time.Hour)
+	require.NoError(t, err)
+	assert.NotEmpty(t, token)
+}
+
+func TestCollector_DeletesExpired(t *testing.T) {
+	store := newMemStore()
+	calls := 0
+	r := newRouter(store, &calls, http.StatusCreated)
+	do(r, http.MethodPost, "/things", "k1", "")
+
+	store.advance(2 * time.Hour)
+	NewCollector(store, time.Minute).tick(context.Background())
+	assert.Empty(t, store.state(testUserID, "k1"))
+}
+
+func TestMiddleware_WithoutKey(t *testing.T) {
+	calls := 0
+	r := newRouter(newMemStore(), &calls, http.StatusCreated)
+	do(r, http.MethodPost, "/things", "", "")
+	do(r, http.MethodPost, "/things", "", "")
+	assert.Equal(t, 2, calls)
+}
+
+func TestMiddleware_SkipsAnonymous(t *testing.T) {
+	calls := 0
+	r := newRouter(newMemStore(), &calls, http.StatusCreated)
+	for range 2 {
+		req := httptest.NewRequest(http.MethodPost, "/things", strings.NewReader(`{"a":1}`))
+		req.Header.Set(HeaderKey, "k1")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Empty(t, w.Header().Get(HeaderReplayed))
+	}
+	// без токена ключ ничего не значит: чужой анонимный клиент не получит этот ответ
+	assert.Equal(t, 2, calls)
+}
+
+func TestMiddleware_BodyTooLarge(t *testing.T) {
+	store := newMemStore()
+	calls := 0
+	r := newRouter(store, &calls, http.StatusCreated)
+
+	w := do(r, http.MethodPost, "/things", "k1", strings.Repeat("a", maxBodyBytes+1))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, 0, calls)
+	assert.Empty(t, store.state(testUserID, "k1"))
+}
@@ -0,0 +1,151 @@
+package invoice
+
+import (
+	"errors"
+	"marketplace/internal/auth"
+	"marketplace/internal/order"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Handler struct {
+	svc *Service
+}
+
+func NewHandler(svc *Service) *Handler {
+	return &Handler{svc: svc}
+}
+
+func RegisterRoutes(r *gin.Engine, svc *Service) {
+	h := NewHandler(svc)
+
+	g := r.Group("/orders", auth.JWTAuth())
+	{
+		g.GET("/:id/invoice", h.get)
+	}
+
+	admin := r.Group("/admin/orders")
+	admin.Use(auth.JWTAuth(), auth.RequireRole("admin"))
+	{
+		admin.GET("/:id/invoice", h.adminGet)
+		admin.POST("/:id/invoice/regenerate", h.adminRegenerate)
+	}
+}
+
+func parseRequest(c *gin.Context) (int64, Format, bool) {
+	oid, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid order id"})
+		return 0, "", false
+	}
+	format, err := ParseFormat(c.DefaultQuery("format", string(FormatPDF)))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return 0, "", false
+	}
+	return oid, format, true
+}
+
+func writeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, order.ErrOrderNotFound), errors.Is(err, ErrInvoiceNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrNotInvoiceable):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func writeDocument(c *gin.Context, doc *Document) {
+	disposition := "inline"
+	if doc.Format == FormatPDF {
+		disposition = "attachment"
+	}
+	c.Header("Content-Disposition", disposition+`; filename="`+doc.Filename()+`"`)
+	c.Data(http.StatusOK, doc.Format.ContentType(), doc.Body)
+}
+
+// @Summary Get Order Invoice
+// @Description Render the invoice of a paid order. The invoice number is assigned on first request.
+// @Tags orders
+// @Security BearerAuth
+// @Produce application/pdf,text/html
+// @Param id path int true "Order ID"
+// @Param format query string false "Document format" Enums(pdf, html) default(pdf)
+// @Success 200 {file} binary
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string "order is not paid"
+// @Failure 500 {object} map[string]string
+// @Router /orders/{id}/invoice [get]
+func (h *Handler) get(c *gin.Context) {
+	oid, format, ok := parseRequest(c)
+	if !ok {
+		return
+	}
+	doc, err := h.svc.ForUser(c, auth.GetUserID(c), oid, format)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	writeDocument(c, doc)
+}
+
+// @Summary Get any order invoice (admin)
+// @Tags admin-orders
+// @Security BearerAuth
+// @Produce application/pdf,text/html
+// @Param id path int true "Order ID"
+// @Param format query string false "Document format" Enums(pdf, html) default(pdf)
+// @Success 200 {file} binary
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string "order is not paid"
+// @Failure 500 {object} map[string]string
+// @Router /admin/orders/{id}/invoice [get]
+func (h *Handler) adminGet(c *gin.Context) {
+	oid, format, ok := parseRequest(c)
+	if !ok {
+		return
+	}
+	doc, err := h.svc.ForAdmin(c, oid, format)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	writeDocument(c, doc)
+}
+
+// @Summary Regenerate order invoice (admin)
+// @Description Drop cached documents and render them again on next request. The invoice number is kept.
+// @Tags admin-orders
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Order ID"
+// @Success 200 {object} invoice.Invoice
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string "order is not paid"
+// @Failure 500 {object} map[string]string
+// @Router /admin/orders/{id}/invoice/regenerate [post]
+func (h *Handler) adminRegenerate(c *gin.Context) {
+	oid, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid order id"})
+		return
+	}
+	inv, err := h.svc.Regenerate(c, oid)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, inv)
+}
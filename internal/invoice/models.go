@@ -0,0 +1,66 @@
+package invoice
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Invoice — выставленный по заказу счет. Номер присваивается один раз и не меняется,
+// Version растет при каждой перегенерации документа.
+type Invoice struct {
+	ID          int64     `json:"id" db:"id"`
+	OrderID     int64     `json:"order_id" db:"order_id"`
+	Number      int64     `json:"number" db:"number"`
+	Version     int       `json:"version" db:"version"`
+	IssuedAt    time.Time `json:"issued_at" db:"issued_at"`
+	GeneratedAt time.Time `json:"generated_at" db:"generated_at"`
+}
+
+// DisplayNumber — номер счета в виде, который печатается в документе.
+func (i *Invoice) DisplayNumber() string {
+	return fmt.Sprintf("INV-%06d", i.Number)
+}
+
+type Format string
+
+const (
+	FormatHTML Format = "html"
+	FormatPDF  Format = "pdf"
+)
+
+var ErrUnknownFormat = errors.New("format must be html or pdf")
+
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case FormatHTML, FormatPDF:
+		return f, nil
+	default:
+		return "", ErrUnknownFormat
+	}
+}
+
+func (f Format) ContentType() string {
+	if f == FormatPDF {
+		return "application/pdf"
+	}
+	return "text/html; charset=utf-8"
+}
+
+// Seller — реквизиты продавца, печатаемые в счете.
+type Seller struct {
+	Name    string
+	Address string
+	TaxID   string // ИНН
+}
+
+// Document — отрендеренный счет.
+type Document struct {
+	Invoice *Invoice
+	Format  Format
+	Body    []byte
+}
+
+func (d *Document) Filename() string {
+	return d.Invoice.DisplayNumber() + "." + string(d.Format)
+}
@@ -0,0 +1,224 @@
+package invoice
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"marketplace/internal/currency"
+	"marketplace/internal/order"
+	"marketplace/internal/tax"
+	"strconv"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+//go:embed templates/invoice.html
+var templatesFS embed.FS
+
+// DejaVu покрывает кириллицу; стандартные шрифты PDF ее не содержат.
+//
+//go:embed fonts/DejaVuSansCondensed.ttf
+var fontDejaVu []byte
+
+var htmlTemplate = template.Must(template.ParseFS(templatesFS, "templates/invoice.html"))
+
+type lineView struct {
+	N        int
+	Name     string
+	Quantity int
+	Price    string
+	VAT      string
+	Tax      string
+	Amount   string
+}
+
+// view — данные счета, уже отформатированные для печати.
+type view struct {
+	Number     string
+	IssuedAt   string
+	OrderID    int64
+	Seller     Seller
+	BuyerLines []string
+	Lines      []lineView
+	Subtotal   string
+	Tax        string
+	Shipping   string
+	Total      string
+	// Currency — подпись валюты в итоге: «руб.» или код ISO 4217
+	Currency string
+}
+
+func newView(inv *Invoice, o *order.Order, seller Seller) view {
+	cur := o.Currency
+	if cur == "" {
+		cur = currency.Base
+	}
+	money := func(amount int64) string { return formatMoney(amount, cur) }
+	v := view{
+		Number:   inv.DisplayNumber(),
+		IssuedAt: inv.IssuedAt.Format("02.01.2006"),
+		OrderID:  o.ID,
+		Seller:   seller,
+		Subtotal: money(o.SubtotalAmount),
+		Tax:      money(o.TaxAmount),
+		Shipping: money(o.ShippingAmount),
+		Total:    money(o.TotalAmount),
+		Currency: currencyLabel(cur),
+	}
+	if a := o.ShippingAddress; a != nil {
+		v.BuyerLines = []string{a.RecipientName, a.Phone}
+		addr := []string{a.PostalCode, a.Country}
+		if a.Region != "" {
+			addr = append(addr, a.Region)
+		}
+		addr = append(addr, a.City, a.Line1)
+		if a.Line2 != "" {
+			addr = append(addr, a.Line2)
+		}
+		v.BuyerLines = append(v.BuyerLines, strings.Join(addr, ", "))
+	}
+	for i, item := range o.Items {
+		v.Lines = append(v.Lines, lineView{
+			N:        i + 1,
+			Name:     item.ProductName,
+			Quantity: item.Quantity,
+			Price:    money(item.Price),
+			VAT:      formatVAT(item.VATRate),
+			Tax:      money(item.TaxAmount),
+			Amount:   money(item.Amount()),
+		})
+	}
+	return v
+}
+
+// formatMoney печатает минорные единицы валюты в основных с ее числом знаков:
+// 123456 RUB -> "1 234,56", 123456 JPY -> "123 456", 123456 KWD -> "123,456".
+func formatMoney(minor int64, code string) string {
+	sign := ""
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+	exp := currency.Exponent(code)
+	unit := int64(1)
+	for range exp {
+		unit *= 10
+	}
+	major := strconv.FormatInt(minor/unit, 10)
+	var b strings.Builder
+	for i, r := range major {
+		if i > 0 && (len(major)-i)%3 == 0 {
+			b.WriteRune(' ')
+		}
+		b.WriteRune(r)
+	}
+	if exp == 0 {
+		return sign + b.String()
+	}
+	return fmt.Sprintf("%s%s,%0*d", sign, b.String(), exp, minor%unit)
+}
+
+func currencyLabel(code string) string {
+	if code == "RUB" {
+		return "руб."
+	}
+	return code
+}
+
+func formatVAT(r tax.Rate) string {
+	if r == tax.RateNone || r == "" {
+		return "без НДС"
+	}
+	return string(r) + "%"
+}
+
+// Render рендерит счет в нужном формате.
+func Render(inv *Invoice, o *order.Order, seller Seller, format Format) ([]byte, error) {
+	v := newView(inv, o, seller)
+	if format == FormatPDF {
+		return renderPDF(v)
+	}
+	var buf bytes.Buffer
+	if err := htmlTemplate.Execute(&buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func renderPDF(v view) ([]byte, error) {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle("Счет "+v.Number, true)
+	pdf.AddUTF8FontFromBytes("DejaVu", "", fontDejaVu)
+	pdf.SetAutoPageBreak(true, 15)
+	pdf.AddPage()
+
+	pdf.SetFont("DejaVu", "", 18)
+	pdf.CellFormat(0, 10, "Счет "+v.Number, "", 1, "L", false, 0, "")
+	pdf.SetFont("DejaVu", "", 10)
+	pdf.CellFormat(0, 6, fmt.Sprintf("от %s · заказ №%d", v.IssuedAt, v.OrderID), "", 1, "L", false, 0, "")
+	pdf.Ln(4)
+
+	seller := []string{"Продавец", v.Seller.Name}
+	if v.Seller.TaxID != "" {
+		seller = append(seller, "ИНН "+v.Seller.TaxID)
+	}
+	seller = append(seller, v.Seller.Address)
+	buyer := append([]string{"Покупатель"}, v.BuyerLines...)
+	top := pdf.GetY()
+	pdf.MultiCell(90, 5, strings.Join(seller, "\n"), "", "L", false)
+	bottom := pdf.GetY()
+	pdf.SetXY(110, top)
+	pdf.MultiCell(90, 5, strings.Join(buyer, "\n"), "", "L", false)
+	if pdf.GetY() < bottom {
+		pdf.SetY(bottom)
+	}
+	pdf.Ln(6)
+
+	cols := []struct {
+		title string
+		width float64
+		align string
+	}{
+		{"№", 8, "L"}, {"Товар", 72, "L"}, {"Кол-во", 16, "R"}, {"Цена", 24, "R"},
+		{"НДС", 18, "R"}, {"Сумма НДС", 22, "R"}, {"Сумма", 26, "R"},
+	}
+	for _, c := range cols {
+		pdf.CellFormat(c.width, 7, c.title, "B", 0, c.align, false, 0, "")
+	}
+	pdf.Ln(-1)
+	for _, l := range v.Lines {
+		cells := []string{strconv.Itoa(l.N), l.Name, strconv.Itoa(l.Quantity), l.Price, l.VAT, l.Tax, l.Amount}
+		for i, c := range cols {
+			text := cells[i]
+			// длинные названия обрезаем, чтобы строка таблицы не разъезжалась
+			for i == 1 && pdf.GetStringWidth(text) > c.width-2 && len([]rune(text)) > 1 {
+				r := []rune(text)
+				text = string(r[:len(r)-2]) + "…"
+			}
+			pdf.CellFormat(c.width, 6, text, "B", 0, c.align, false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+	pdf.Ln(4)
+
+	totals := [][2]string{
+		{"Товары без НДС", v.Subtotal},
+		{"НДС", v.Tax},
+		{"Доставка", v.Shipping},
+	}
+	for _, t := range totals {
+		pdf.CellFormat(146, 6, t[0], "", 0, "R", false, 0, "")
+		pdf.CellFormat(40, 6, t[1], "", 1, "R", false, 0, "")
+	}
+	pdf.SetFont("DejaVu", "", 12)
+	pdf.CellFormat(146, 8, "Итого, "+v.Currency, "T", 0, "R", false, 0, "")
+	pdf.CellFormat(40, 8, v.Total, "T", 1, "R", false, 0, "")
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
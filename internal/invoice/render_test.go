@@ -0,0 +1,77 @@
+package invoice
+
+import (
+	"bytes"
+	"marketplace/internal/order"
+	"marketplace/internal/tax"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testOrder() *order.Order {
+	return &order.Order{
+		ID:             7,
+		UserID:         1,
+		Status:         order.StatusPaid,
+		SubtotalAmount: 30000,
+		TaxAmount:      5000,
+		ShippingAmount: 35000,
+		TotalAmount:    70000,
+		ShippingAddress: &order.ShippingAddress{
+			RecipientName: "Иван Иванов",
+			Phone:         "+79990000000",
+			Country:       "RU",
+			City:          "Москва",
+			PostalCode:    "101000",
+			Line1:         "Тверская 1",
+		},
+		Items: []order.OrderItem{
+			{ProductName: "Телефон", Quantity: 2, Price: 12000, VATRate: tax.Rate20, TaxAmount: 4000, PriceIncludesTax: true},
+			{ProductName: "Чехол <b>", Quantity: 1, Price: 10000, VATRate: tax.Rate10, TaxAmount: 1000},
+		},
+	}
+}
+
+func testInvoice() *Invoice {
+	return &Invoice{ID: 1, OrderID: 7, Number: 42, Version: 1, IssuedAt: time.Date(2026, 3, 5, 10, 0, 0, 0, time.UTC)}
+}
+
+func TestFormatMoney(t *testing.T) {
+	assert.Equal(t, "0,00", formatMoney(0, "RUB"))
+	assert.Equal(t, "0,05", formatMoney(5, "RUB"))
+	assert.Equal(t, "999,99", formatMoney(99999, "RUB"))
+	assert.Equal(t, "1 234,56", formatMoney(123456, "RUB"))
+	assert.Equal(t, "1 000 000,00", formatMoney(100000000, "RUB"))
+	assert.Equal(t, "-12,30", formatMoney(-1230, "RUB"))
+	assert.Equal(t, "123 456", formatMoney(123456, "JPY"))
+	assert.Equal(t, "1 234,567", formatMoney(1234567, "KWD"))
+	assert.Equal(t, "0,005", formatMoney(5, "KWD"))
+}
+
+func TestRender_HTML(t *testing.T) {
+	body, err := Render(testInvoice(), testOrder(), Seller{Name: "ООО Маркет", TaxID: "7700000000"}, FormatHTML)
+	require.NoError(t, err)
+	html := string(body)
+
+	assert.Contains(t, html, "Счет INV-000042")
+	assert.Contains(t, html, "от 05.03.2026")
+	assert.Contains(t, html, "ИНН 7700000000")
+	assert.Contains(t, html, "Иван Иванов")
+	assert.Contains(t, html, "240,00")          // 2 × 120,00 с НДС
+	assert.Contains(t, html, "110,00")          // 100,00 + НДС 10%
+	assert.Contains(t, html, "700,00")          // итого
+	assert.Contains(t, html, "Чехол &lt;b&gt;") // названия экранируются
+}
+
+func TestRender_PDF(t *testing.T) {
+	o := testOrder()
+	o.Items[0].ProductName = strings.Repeat("Очень длинное название ", 10)
+	body, err := Render(testInvoice(), o, Seller{Name: "ООО Маркет"}, FormatPDF)
+	require.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(body, []byte("%PDF-")))
+	assert.True(t, bytes.Contains(body, []byte("%%EOF")))
+}
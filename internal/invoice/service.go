@@ -0,0 +1,141 @@
+package invoice
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"marketplace/internal/order"
+
+	"go.uber.org/zap"
+)
+
+var (
+	ErrInvoiceNotFound = errors.New("invoice not found")
+	ErrNotInvoiceable  = errors.New("invoice is available only for paid orders")
+)
+
+type Repository interface {
+	// GetByOrderID возвращает ErrInvoiceNotFound, если счет еще не выставлен.
+	GetByOrderID(ctx context.Context, orderID int64) (*Invoice, error)
+	// Issue выставляет счет со следующим номером; повторный вызов возвращает уже выставленный счет.
+	Issue(ctx context.Context, orderID int64) (*Invoice, error)
+	// BumpVersion увеличивает версию документа, номер счета не меняется.
+	BumpVersion(ctx context.Context, orderID int64) (*Invoice, error)
+}
+
+// OrderReader — чтение заказов; реализуется репозиторием заказов.
+type OrderReader interface {
+	GetOrderWithItems(ctx context.Context, userID, orderID int64) (*order.Order, error)
+	GetOrderByID(ctx context.Context, orderID int64) (*order.Order, error)
+}
+
+type Service struct {
+	repo   Repository
+	orders OrderReader
+	store  Store
+	seller Seller
+}
+
+func NewService(repo Repository, orders OrderReader, store Store, seller Seller) *Service {
+	return &Service{repo: repo, orders: orders, store: store, seller: seller}
+}
+
+// invoiceable — статусы, в которых заказ оплачен и по нему можно выставить счет.
+func invoiceable(status string) bool {
+	switch status {
+	case order.StatusPaid, order.StatusShipped, order.StatusDelivered:
+		return true
+	}
+	return false
+}
+
+func cacheKey(inv *Invoice, format Format) string {
+	return fmt.Sprintf("%s-v%d.%s", inv.DisplayNumber(), inv.Version, format)
+}
+
+// ForUser возвращает счет по заказу покупателя.
+func (s *Service) ForUser(ctx context.Context, userID, orderID int64, format Format) (*Document, error) {
+	o, err := s.orders.GetOrderWithItems(ctx, userID, orderID)
+	if err != nil {
+		return nil, mapOrderErr(err)
+	}
+	return s.document(ctx, o, format)
+}
+
+// ForAdmin возвращает счет по любому заказу.
+func (s *Service) ForAdmin(ctx context.Context, orderID int64, format Format) (*Document, error) {
+	o, err := s.orders.GetOrderByID(ctx, orderID)
+	if err != nil {
+		return nil, mapOrderErr(err)
+	}
+	return s.document(ctx, o, format)
+}
+
+// Regenerate сбрасывает кэш документов; номер счета сохраняется.
+func (s *Service) Regenerate(ctx context.Context, orderID int64) (*Invoice, error) {
+	o, err := s.orders.GetOrderByID(ctx, orderID)
+	if err != nil {
+		return nil, mapOrderErr(err)
+	}
+	prev, err := s.invoiceFor(ctx, o)
+	if err != nil {
+		return nil, err
+	}
+	inv, err := s.repo.BumpVersion(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range []Format{FormatHTML, FormatPDF} {
+		if err = s.store.Delete(ctx, cacheKey(prev, f)); err != nil {
+			zap.L().Warn("cannot delete cached invoice", zap.Int64("order_id", orderID), zap.Error(err))
+		}
+	}
+	return inv, nil
+}
+
+// invoiceFor возвращает счет заказа, выставляя его при первом обращении.
+func (s *Service) invoiceFor(ctx context.Context, o *order.Order) (*Invoice, error) {
+	inv, err := s.repo.GetByOrderID(ctx, o.ID)
+	if err == nil {
+		return inv, nil
+	}
+	if !errors.Is(err, ErrInvoiceNotFound) {
+		return nil, err
+	}
+	if !invoiceable(o.Status) {
+		return nil, ErrNotInvoiceable
+	}
+	return s.repo.Issue(ctx, o.ID)
+}
+
+func (s *Service) document(ctx context.Context, o *order.Order, format Format) (*Document, error) {
+	inv, err := s.invoiceFor(ctx, o)
+	if err != nil {
+		return nil, err
+	}
+	key := cacheKey(inv, format)
+	body, err := s.store.Get(ctx, key)
+	if err == nil {
+		return &Document{Invoice: inv, Format: format, Body: body}, nil
+	}
+	if !errors.Is(err, ErrNotCached) {
+		zap.L().Warn("cannot read cached invoice", zap.String("key", key), zap.Error(err))
+	}
+
+	if body, err = Render(inv, o, s.seller, format); err != nil {
+		return nil, fmt.Errorf("cannot render invoice: %w", err)
+	}
+	// ошибка кэша не мешает отдать документ
+	if err = s.store.Put(ctx, key, body); err != nil {
+		zap.L().Warn("cannot cache invoice", zap.String("key", key), zap.Error(err))
+	}
+	return &Document{Invoice: inv, Format: format, Body: body}, nil
+}
+
+func mapOrderErr(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return order.ErrOrderNotFound
+	}
+	return err
+}
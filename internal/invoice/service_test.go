@@ -0,0 +1,136 @@
+package invoice
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"marketplace/internal/order"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type mockRepo struct {
+	mock.Mock
+}
+
+func (m *mockRepo) GetByOrderID(ctx context.Context, orderID int64) (*Invoice, error) {
+	args := m.Called(ctx, orderID)
+	inv, _ := args.Get(0).(*Invoice)
+	return inv, args.Error(1)
+}
+func (m *mockRepo) Issue(ctx context.Context, orderID int64) (*Invoice, error) {
+	args := m.Called(ctx, orderID)
+	inv, _ := args.Get(0).(*Invoice)
+	return inv, args.Error(1)
+}
+func (m *mockRepo) BumpVersion(ctx context.Context, orderID int64) (*Invoice, error) {
+	args := m.Called(ctx, orderID)
+	inv, _ := args.Get(0).(*Invoice)
+	return inv, args.Error(1)
+}
+
+type mockOrders struct {
+	mock.Mock
+}
+
+func (m *mockOrders) GetOrderWithItems(ctx context.Context, userID, orderID int64) (*order.Order, error) {
+	args := m.Called(ctx, userID, orderID)
+	o, _ := args.Get(0).(*order.Order)
+	return o, args.Error(1)
+}
+func (m *mockOrders) GetOrderByID(ctx context.Context, orderID int64) (*order.Order, error) {
+	args := m.Called(ctx, orderID)
+	o, _ := args.Get(0).(*order.Order)
+	return o, args.Error(1)
+}
+
+type memStore map[string][]byte
+
+func (s memStore) Get(_ context.Context, key string) ([]byte, error) {
+	if b, ok := s[key]; ok {
+		return b, nil
+	}
+	return nil, ErrNotCached
+}
+func (s memStore) Put(_ context.Context, key string, data []byte) error {
+	s[key] = data
+	return nil
+}
+func (s memStore) Delete(_ context.Context, key string) error {
+	delete(s, key)
+	return nil
+}
+
+func TestForUser_IssuesOnFirstRequestAndCaches(t *testing.T) {
+	ctx := context.Background()
+	repo, orders, store := new(mockRepo), new(mockOrders), memStore{}
+	svc := NewService(repo, orders, store, Seller{Name: "Shop"})
+	inv := testInvoice()
+
+	orders.On("GetOrderWithItems", ctx, int64(1), int64(7)).Return(testOrder(), nil)
+	repo.On("GetByOrderID", ctx, int64(7)).Return(nil, ErrInvoiceNotFound).Once()
+	repo.On("Issue", ctx, int64(7)).Return(inv, nil).Once()
+
+	doc, err := svc.ForUser(ctx, 1, 7, FormatHTML)
+	require.NoError(t, err)
+	assert.Equal(t, "INV-000042.html", doc.Filename())
+	assert.Contains(t, store, "INV-000042-v1.html")
+
+	// повторный запрос берет выставленный счет и документ из кэша
+	store["INV-000042-v1.html"] = []byte("cached")
+	repo.On("GetByOrderID", ctx, int64(7)).Return(inv, nil).Once()
+	doc, err = svc.ForUser(ctx, 1, 7, FormatHTML)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("cached"), doc.Body)
+
+	repo.AssertExpectations(t)
+}
+
+func TestForUser_NotPaid(t *testing.T) {
+	ctx := context.Background()
+	repo, orders := new(mockRepo), new(mockOrders)
+	svc := NewService(repo, orders, memStore{}, Seller{})
+	o := testOrder()
+	o.Status = order.StatusAwaitingPayment
+
+	orders.On("GetOrderWithItems", ctx, int64(1), int64(7)).Return(o, nil)
+	repo.On("GetByOrderID", ctx, int64(7)).Return(nil, ErrInvoiceNotFound)
+
+	_, err := svc.ForUser(ctx, 1, 7, FormatPDF)
+	assert.ErrorIs(t, err, ErrNotInvoiceable)
+	repo.AssertNotCalled(t, "Issue", mock.Anything, mock.Anything)
+}
+
+func TestForUser_ForeignOrder(t *testing.T) {
+	ctx := context.Background()
+	orders := new(mockOrders)
+	svc := NewService(new(mockRepo), orders, memStore{}, Seller{})
+
+	orders.On("GetOrderWithItems", ctx, int64(2), int64(7)).Return(nil, sql.ErrNoRows)
+
+	_, err := svc.ForUser(ctx, 2, 7, FormatPDF)
+	assert.ErrorIs(t, err, order.ErrOrderNotFound)
+}
+
+func TestRegenerate_KeepsNumberAndDropsCache(t *testing.T) {
+	ctx := context.Background()
+	repo, orders := new(mockRepo), new(mockOrders)
+	store := memStore{"INV-000042-v1.pdf": []byte("old"), "INV-000042-v1.html": []byte("old")}
+	svc := NewService(repo, orders, store, Seller{})
+	inv := testInvoice()
+	bumped := *inv
+	bumped.Version = 2
+
+	orders.On("GetOrderByID", ctx, int64(7)).Return(testOrder(), nil)
+	repo.On("GetByOrderID", ctx, int64(7)).Return(inv, nil)
+	repo.On("BumpVersion", ctx, int64(7)).Return(&bumped, nil)
+
+	got, err := svc.Regenerate(ctx, 7)
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), got.Number)
+	assert.Equal(t, 2, got.Version)
+	assert.Empty(t, store)
+}
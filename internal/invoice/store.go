@@ -0,0 +1,70 @@
+package invoice
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+var ErrNotCached = errors.New("document is not cached")
+
+// Store — кэш отрендеренных документов.
+type Store interface {
+	// Get возвращает ErrNotCached, если документа нет.
+	Get(ctx context.Context, key string) ([]byte, error)
+	Put(ctx context.Context, key string, data []byte) error
+	// Delete не считает ошибкой отсутствие документа.
+	Delete(ctx context.Context, key string) error
+}
+
+// DiskStore хранит документы файлами в одном каталоге.
+type DiskStore struct {
+	dir string
+}
+
+func NewDiskStore(dir string) (*DiskStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &DiskStore{dir: dir}, nil
+}
+
+// path не дает ключу выйти за пределы каталога.
+func (s *DiskStore) path(key string) string {
+	return filepath.Join(s.dir, filepath.Base(key))
+}
+
+func (s *DiskStore) Get(_ context.Context, key string) ([]byte, error) {
+	data, err := os.ReadFile(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotCached
+	}
+	return data, err
+}
+
+// Put пишет во временный файл и переименовывает его, чтобы читатели
+// никогда не увидели недописанный документ.
+func (s *DiskStore) Put(_ context.Context, key string, data []byte) error {
+	f, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.path(key))
+}
+
+func (s *DiskStore) Delete(_ context.Context, key string) error {
+	err := os.Remove(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
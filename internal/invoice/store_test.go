@@ -0,0 +1,36 @@
+package invoice
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskStore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s, err := NewDiskStore(filepath.Join(dir, "invoices"))
+	require.NoError(t, err)
+
+	_, err = s.Get(ctx, "INV-000001-v1.pdf")
+	assert.ErrorIs(t, err, ErrNotCached)
+
+	require.NoError(t, s.Put(ctx, "INV-000001-v1.pdf", []byte("doc")))
+	got, err := s.Get(ctx, "INV-000001-v1.pdf")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("doc"), got)
+
+	// ключ не может выйти за пределы каталога
+	require.NoError(t, s.Put(ctx, "../escape.pdf", []byte("x")))
+	_, err = os.Stat(filepath.Join(dir, "escape.pdf"))
+	assert.True(t, os.IsNotExist(err))
+
+	require.NoError(t, s.Delete(ctx, "INV-000001-v1.pdf"))
+	require.NoError(t, s.Delete(ctx, "INV-000001-v1.pdf"))
+	_, err = s.Get(ctx, "INV-000001-v1.pdf")
+	assert.ErrorIs(t, err, ErrNotCached)
+}
@@ -0,0 +1,151 @@
+package ledger
+
+import (
+	"errors"
+	"marketplace/internal/auth"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Handler struct {
+	svc *Service
+}
+
+func NewHandler(svc *Service) *Handler {
+	return &Handler{svc: svc}
+}
+
+func RegisterRoutes(r *gin.Engine, svc *Service) {
+	h := NewHandler(svc)
+
+	admin := r.Group("/admin/ledger")
+	admin.Use(auth.JWTAuth(), auth.RequireRole("admin"))
+	{
+		admin.GET("/accounts", h.balances)
+		admin.GET("/journals", h.journals)
+		admin.GET("/check", h.check)
+		admin.POST("/payouts", h.payout)
+	}
+}
+
+func writeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidJournal), errors.Is(err, ErrUnbalanced):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrInsufficientBalance):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// @Summary Ledger account balances (admin)
+// @Description Balance of every ledger account per currency. Amounts are signed minor units; balances in each currency sum to zero.
+// @Tags admin-ledger
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} ledger.AccountBalance
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/ledger/accounts [get]
+func (h *Handler) balances(c *gin.Context) {
+	balances, err := h.svc.Balances(c)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, balances)
+}
+
+// @Summary List ledger journals (admin)
+// @Description Journals with their entries, newest first
+// @Tags admin-ledger
+// @Security BearerAuth
+// @Produce json
+// @Param order_id query int false "Order ID"
+// @Param kind query string false "Journal kind, e.g. payment.captured"
+// @Param offset query int false "Offset" default(0)
+// @Param limit query int false "Limit" default(50)
+// @Success 200 {array} ledger.Journal
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/ledger/journals [get]
+func (h *Handler) journals(c *gin.Context) {
+	orderID, _ := strconv.ParseInt(c.Query("order_id"), 10, 64)
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	journals, err := h.svc.Journals(c, JournalFilter{
+		OrderID: orderID,
+		Kind:    c.Query("kind"),
+		Offset:  offset,
+		Limit:   limit,
+	})
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, journals)
+}
+
+// @Summary Check ledger invariants (admin)
+// @Description Verify that every journal sums to zero. Responds 500 with the report if the check fails.
+// @Tags admin-ledger
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} ledger.Check
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} ledger.Check
+// @Router /admin/ledger/check [get]
+func (h *Handler) check(c *gin.Context) {
+	res, err := h.svc.Check(c)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	if !res.OK {
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+type payoutReq struct {
+	// Reference — номер платежного поручения; повтор с тем же номером не проводится
+	Reference string `json:"reference" binding:"required,max=64"`
+	Amount    int64  `json:"amount" binding:"required,gt=0"`
+	// Currency — валюта выплаты, по умолчанию RUB
+	Currency string `json:"currency" binding:"omitempty,len=3"`
+	Memo     string `json:"memo"`
+}
+
+// @Summary Record seller payout (admin)
+// @Description Post a payout from seller_payable in the given currency. Repeating the same reference returns the existing journal.
+// @Tags admin-ledger
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param input body payoutReq true "Payout"
+// @Success 201 {object} ledger.Journal
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 409 {object} map[string]string "insufficient seller payable balance"
+// @Router /admin/ledger/payouts [post]
+func (h *Handler) payout(c *gin.Context) {
+	var req payoutReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	j, err := h.svc.Payout(c, req.Reference, req.Currency, req.Amount, req.Memo)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, j)
+}
@@ -0,0 +1,224 @@
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Счета главной книги. Сумма строки со знаком: проводка в целом всегда равна нулю,
+// все строки проводки — в ее валюте, и балансы ведутся по каждой валюте отдельно,
+// поэтому отрицательный баланс customer — деньги, полученные от покупателей,
+// а положительные балансы остальных счетов показывают, куда они распределены.
+const (
+	AccountCustomer        = "customer"
+	AccountSellerPayable   = "seller_payable"
+	AccountTaxPayable      = "tax_payable"
+	AccountPlatformRevenue = "platform_revenue"
+	AccountRefundsPayable  = "refunds_payable"
+	AccountPayouts         = "payouts"
+	// AccountStoreCredit — бонусный баланс покупателей в кошельках, долг площадки перед ними
+	AccountStoreCredit = "store_credit"
+)
+
+var knownAccounts = map[string]struct{}{
+	AccountCustomer:        {},
+	AccountSellerPayable:   {},
+	AccountTaxPayable:      {},
+	AccountPlatformRevenue: {},
+	AccountRefundsPayable:  {},
+	AccountPayouts:         {},
+	AccountStoreCredit:     {},
+}
+
+// Виды проводок.
+const (
+	KindPaymentCaptured = "payment.captured"
+	KindPaymentReversed = "payment.reversed"
+	KindRefundRequested = "refund.requested"
+	KindRefundSucceeded = "refund.succeeded"
+	KindRefundFailed    = "refund.failed"
+	KindPayout          = "payout"
+	KindWalletCredited  = "wallet.credited"
+	KindWalletDebited   = "wallet.debited"
+)
+
+var (
+	ErrUnbalanced          = errors.New("journal entries do not sum to zero")
+	ErrInvalidJournal      = errors.New("invalid journal")
+	ErrInsufficientBalance = errors.New("insufficient seller payable balance")
+)
+
+type Journal struct {
+	ID        int64     `json:"id" db:"id"`
+	Kind      string    `json:"kind" db:"kind"`
+	Reference string    `json:"reference" db:"reference"`
+	Currency  string    `json:"currency" db:"currency"`
+	OrderID   *int64    `json:"order_id,omitempty" db:"order_id"`
+	Memo      *string   `json:"memo,omitempty" db:"memo"`
+	Entries   []Entry   `json:"entries" db:"-"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+type Entry struct {
+	Account string `json:"account" db:"account"`
+	Amount  int64  `json:"amount" db:"amount"` // в минорных единицах валюты проводки, со знаком
+}
+
+// Validate проверяет проводку до записи; тот же инвариант держит триггер в БД.
+func (j *Journal) Validate() error {
+	if j.Kind == "" || j.Reference == "" {
+		return fmt.Errorf("%w: kind and reference required", ErrInvalidJournal)
+	}
+	if j.Currency == "" {
+		return fmt.Errorf("%w: currency required", ErrInvalidJournal)
+	}
+	if len(j.Entries) < 2 {
+		return fmt.Errorf("%w: at least two entries required", ErrInvalidJournal)
+	}
+	var sum int64
+	for _, e := range j.Entries {
+		if _, ok := knownAccounts[e.Account]; !ok {
+			return fmt.Errorf("%w: unknown account %q", ErrInvalidJournal, e.Account)
+		}
+		if e.Amount == 0 {
+			return fmt.Errorf("%w: zero amount on %s", ErrInvalidJournal, e.Account)
+		}
+		sum += e.Amount
+	}
+	if sum != 0 {
+		return fmt.Errorf("%w: off by %d", ErrUnbalanced, sum)
+	}
+	return nil
+}
+
+// AccountBalance — остаток по счету в одной валюте.
+type AccountBalance struct {
+	Code     string `json:"code" db:"code"`
+	Name     string `json:"name" db:"name"`
+	Currency string `json:"currency" db:"currency"`
+	Balance  int64  `json:"balance" db:"balance"`
+}
+
+// Check — результат сверки: все проводки сбалансированы и книга по каждой валюте равна нулю.
+type Check struct {
+	OK bool `json:"ok"`
+	// Unbalanced — проводки с ненулевой суммой строк
+	Unbalanced []int64 `json:"unbalanced"`
+	// Totals — сумма всех строк книги по валютам
+	Totals   map[string]int64 `json:"totals"`
+	Journals int64            `json:"journals"`
+}
+
+// Capture распределяет оплату заказа: товары — продавцам, НДС — к уплате,
+// остаток (доставка) — в выручку площадки. amount — деньги от провайдера,
+// credit — часть заказа, оплаченная из кошелька покупателя.
+func Capture(currency string, orderID, intentID, amount, credit, subtotal, tax int64) *Journal {
+	j := &Journal{
+		Kind:      KindPaymentCaptured,
+		Reference: fmt.Sprintf("payment_intent:%d", intentID),
+		Currency:  currency,
+		OrderID:   &orderID,
+	}
+	j.add(AccountCustomer, -amount)
+	j.add(AccountStoreCredit, -credit)
+	j.add(AccountSellerPayable, subtotal)
+	j.add(AccountTaxPayable, tax)
+	j.add(AccountPlatformRevenue, amount+credit-subtotal-tax)
+	return j
+}
+
+// CaptureReversed сторнирует оплату заказа, который отменили после оплаты: долг продавцам,
+// НДС и выручка по заказу обнуляются. credit — бонусы, возвращенные на кошелек;
+// остальное ждет возврата покупателю в refunds_payable. Суммы — остатки счетов по заказу.
+func CaptureReversed(reference, currency string, orderID, seller, tax, revenue, credit int64) *Journal {
+	j := &Journal{Kind: KindPaymentReversed, Reference: reference, Currency: currency, OrderID: &orderID}
+	j.add(AccountSellerPayable, -seller)
+	j.add(AccountTaxPayable, -tax)
+	j.add(AccountPlatformRevenue, -revenue)
+	j.add(AccountStoreCredit, credit)
+	j.add(AccountRefundsPayable, seller+tax+revenue-credit)
+	return j
+}
+
+// RefundRequested резервирует сумму возврата за счет продавца, пока провайдер его не провел.
+func RefundRequested(currency string, orderID, refundID, amount int64) *Journal {
+	j := &Journal{Kind: KindRefundRequested, Reference: refundRef(refundID), Currency: currency, OrderID: &orderID}
+	j.add(AccountSellerPayable, -amount)
+	j.add(AccountRefundsPayable, amount)
+	return j
+}
+
+// RefundSucceeded отдает зарезервированную сумму покупателю.
+func RefundSucceeded(currency string, orderID, refundID, amount int64) *Journal {
+	j := &Journal{Kind: KindRefundSucceeded, Reference: refundRef(refundID), Currency: currency, OrderID: &orderID}
+	j.add(AccountRefundsPayable, -amount)
+	j.add(AccountCustomer, amount)
+	return j
+}
+
+// RefundToWallet отдает зарезервированную сумму на кошелек покупателя,
+// например при возврате оплаты из кошелька.
+func RefundToWallet(currency string, orderID, refundID, amount int64) *Journal {
+	j := &Journal{Kind: KindRefundSucceeded, Reference: refundRef(refundID), Currency: currency, OrderID: &orderID}
+	j.add(AccountRefundsPayable, -amount)
+	j.add(AccountStoreCredit, amount)
+	return j
+}
+
+// RefundFailed возвращает резерв продавцу.
+func RefundFailed(currency string, orderID, refundID, amount int64) *Journal {
+	j := &Journal{Kind: KindRefundFailed, Reference: refundRef(refundID), Currency: currency, OrderID: &orderID}
+	j.add(AccountRefundsPayable, -amount)
+	j.add(AccountSellerPayable, amount)
+	return j
+}
+
+// Payout — выплата продавцам; reference — номер платежки, повтор с ним же не проводится.
+func Payout(reference, currency string, amount int64, memo string) *Journal {
+	j := &Journal{Kind: KindPayout, Reference: reference, Currency: currency}
+	if memo != "" {
+		j.Memo = &memo
+	}
+	j.add(AccountSellerPayable, -amount)
+	j.add(AccountPayouts, amount)
+	return j
+}
+
+// WalletCredited — начисление на кошелек администратором (компенсация, жест доброй воли)
+// за счет выручки площадки; reference — операция кошелька.
+func WalletCredited(currency string, walletTxID, amount int64, memo string) *Journal {
+	j := &Journal{Kind: KindWalletCredited, Reference: walletRef(walletTxID), Currency: currency}
+	if memo != "" {
+		j.Memo = &memo
+	}
+	j.add(AccountPlatformRevenue, -amount)
+	j.add(AccountStoreCredit, amount)
+	return j
+}
+
+// WalletDebited — списание с кошелька администратором обратно в выручку.
+func WalletDebited(currency string, walletTxID, amount int64, memo string) *Journal {
+	j := &Journal{Kind: KindWalletDebited, Reference: walletRef(walletTxID), Currency: currency}
+	if memo != "" {
+		j.Memo = &memo
+	}
+	j.add(AccountStoreCredit, -amount)
+	j.add(AccountPlatformRevenue, amount)
+	return j
+}
+
+func walletRef(walletTxID int64) string {
+	return fmt.Sprintf("wallet_transaction:%d", walletTxID)
+}
+
+func refundRef(refundID int64) string {
+	return fmt.Sprintf("refund:%d", refundID)
+}
+
+// add пропускает нулевые строки, например НДС у товаров без налога.
+func (j *Journal) add(account string, amount int64) {
+	if amount != 0 {
+		j.Entries = append(j.Entries, Entry{Account: account, Amount: amount})
+	}
+}
@@ -0,0 +1,117 @@
+package ledger
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sum(j *Journal) int64 {
+	var s int64
+	for _, e := range j.Entries {
+		s += e.Amount
+	}
+	return s
+}
+
+func TestJournals_Balanced(t *testing.T) {
+	journals := []*Journal{
+		Capture("RUB", 5, 9, 1500, 0, 1000, 200),
+		Capture("RUB", 6, 11, 500, 1000, 1000, 200),
+		CaptureReversed("order:6", "RUB", 6, 1000, 200, 300, 1000),
+		RefundToWallet("RUB", 6, 7, 300),
+		WalletCredited("RUB", 1, 250, "goodwill"),
+		WalletDebited("RUB", 2, 100, ""),
+		RefundRequested("RUB", 5, 3, 400),
+		RefundSucceeded("RUB", 5, 3, 400),
+		RefundFailed("RUB", 5, 4, 100),
+		Payout("PP-1", "RUB", 700, "weekly"),
+	}
+	for _, j := range journals {
+		require.NoError(t, j.Validate(), j.Kind)
+		assert.Zero(t, sum(j), j.Kind)
+	}
+}
+
+func TestCapture_Allocation(t *testing.T) {
+	j := Capture("RUB", 5, 9, 1500, 0, 1000, 200)
+	assert.Equal(t, "payment_intent:9", j.Reference)
+	assert.Equal(t, []Entry{
+		{AccountCustomer, -1500},
+		{AccountSellerPayable, 1000},
+		{AccountTaxPayable, 200},
+		{AccountPlatformRevenue, 300},
+	}, j.Entries)
+
+	// без НДС и доставки нулевых строк нет
+	j = Capture("RUB", 5, 10, 1000, 0, 1000, 0)
+	assert.Equal(t, []Entry{{AccountCustomer, -1000}, {AccountSellerPayable, 1000}}, j.Entries)
+
+	// часть заказа оплачена из кошелька: деньги провайдера и бонусы вместе покрывают весь заказ
+	j = Capture("RUB", 5, 11, 500, 1000, 1000, 200)
+	assert.Equal(t, []Entry{
+		{AccountCustomer, -500},
+		{AccountStoreCredit, -1000},
+		{AccountSellerPayable, 1000},
+		{AccountTaxPayable, 200},
+		{AccountPlatformRevenue, 300},
+	}, j.Entries)
+}
+
+func TestJournal_ValidateRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		j    Journal
+		want error
+	}{
+		{"unbalanced", Journal{Kind: KindPayout, Reference: "x", Currency: "RUB", Entries: []Entry{{AccountSellerPayable, -10}, {AccountPayouts, 9}}}, ErrUnbalanced},
+		{"unknown account", Journal{Kind: KindPayout, Reference: "x", Currency: "RUB", Entries: []Entry{{"cash", -10}, {AccountPayouts, 10}}}, ErrInvalidJournal},
+		{"single entry", Journal{Kind: KindPayout, Reference: "x", Currency: "RUB", Entries: []Entry{{AccountPayouts, 0}}}, ErrInvalidJournal},
+		{"no reference", Journal{Kind: KindPayout, Currency: "RUB", Entries: []Entry{{AccountSellerPayable, -10}, {AccountPayouts, 10}}}, ErrInvalidJournal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorIs(t, tt.j.Validate(), tt.want)
+		})
+	}
+}
+
+// balances сводит проводки в остатки по счетам.
+func balances(journals ...*Journal) map[string]int64 {
+	out := map[string]int64{}
+	for _, j := range journals {
+		for _, e := range j.Entries {
+			out[e.Account] += e.Amount
+		}
+	}
+	return out
+}
+
+func TestCaptureReversed_ZeroesOrderAccounts(t *testing.T) {
+	// заказ на 1500: 500 картой и 1000 бонусами; отменен после оплаты
+	capture := Capture("RUB", 6, 11, 500, 1000, 1000, 200)
+	reversal := CaptureReversed("order:6", "RUB", 6, 1000, 200, 300, 1000)
+	require.NoError(t, reversal.Validate())
+	assert.Equal(t, KindPaymentReversed, reversal.Kind)
+
+	got := balances(capture, reversal)
+	for _, acc := range []string{AccountSellerPayable, AccountTaxPayable, AccountPlatformRevenue, AccountStoreCredit} {
+		assert.Zero(t, got[acc], acc)
+	}
+	// деньги провайдера ждут возврата покупателю
+	assert.Equal(t, int64(500), got[AccountRefundsPayable])
+	assert.Equal(t, int64(-500), got[AccountCustomer])
+
+	// после возврата всех денег по заказу все счета снова по нулю
+	got = balances(capture, reversal, RefundSucceeded("RUB", 6, 3, 500))
+	for acc, b := range got {
+		assert.Zero(t, b, acc)
+	}
+
+	// заказ оплачен только бонусами: отмена сразу обнуляет книгу
+	got = balances(Capture("RUB", 7, 12, 0, 1500, 1000, 200), CaptureReversed("order:7", "RUB", 7, 1000, 200, 300, 1500))
+	for acc, b := range got {
+		assert.Zero(t, b, acc)
+	}
+}
@@ -0,0 +1,68 @@
+package ledger
+
+import (
+	"context"
+	"fmt"
+	"marketplace/internal/currency"
+)
+
+type Repository interface {
+	Balances(ctx context.Context) ([]AccountBalance, error)
+	ListJournals(ctx context.Context, f JournalFilter) ([]*Journal, error)
+	Check(ctx context.Context) (*Check, error)
+	// PostPayout проводит выплату, если на seller_payable в валюте выплаты хватает денег, иначе ErrInsufficientBalance.
+	// Повтор с тем же reference возвращает уже проведенную выплату.
+	PostPayout(ctx context.Context, j *Journal) (*Journal, error)
+}
+
+type JournalFilter struct {
+	OrderID int64
+	Kind    string
+	Offset  int
+	Limit   int
+}
+
+type Service struct {
+	repo Repository
+}
+
+func NewService(repo Repository) *Service {
+	return &Service{repo: repo}
+}
+
+func (s *Service) Balances(ctx context.Context) ([]AccountBalance, error) {
+	return s.repo.Balances(ctx)
+}
+
+func (s *Service) Journals(ctx context.Context, f JournalFilter) ([]*Journal, error) {
+	if f.Limit <= 0 || f.Limit > 200 {
+		f.Limit = 50
+	}
+	if f.Offset < 0 {
+		f.Offset = 0
+	}
+	return s.repo.ListJournals(ctx, f)
+}
+
+func (s *Service) Check(ctx context.Context) (*Check, error) {
+	return s.repo.Check(ctx)
+}
+
+// Payout выплачивает продавцам amount в валюте code (по умолчанию currency.Base).
+func (s *Service) Payout(ctx context.Context, reference, code string, amount int64, memo string) (*Journal, error) {
+	if amount <= 0 {
+		return nil, fmt.Errorf("%w: amount must be positive", ErrInvalidJournal)
+	}
+	if code == "" {
+		code = currency.Base
+	}
+	code, err := currency.Normalize(code)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidJournal, err)
+	}
+	j := Payout(reference, code, amount, memo)
+	if err := j.Validate(); err != nil {
+		return nil, err
+	}
+	return s.repo.PostPayout(ctx, j)
+}
@@ -0,0 +1,49 @@
+package order
+
+import "marketplace/internal/outbox"
+
+const AggregateOrder = "order"
+
+const (
+	EventOrderCreated   = "order.created"
+	EventOrderPaid      = "order.paid"
+	EventOrderShipped   = "order.shipped"
+	EventOrderDelivered = "order.delivered"
+	EventOrderCancelled = "order.cancelled"
+	EventOrderRefunded  = "order.refunded"
+)
+
+var statusEvents = map[string]string{
+	StatusPaid:      EventOrderPaid,
+	StatusShipped:   EventOrderShipped,
+	StatusDelivered: EventOrderDelivered,
+	StatusCancelled: EventOrderCancelled,
+	StatusRefunded:  EventOrderRefunded,
+}
+
+// EventPayload — тело событий заказа в outbox.
+type EventPayload struct {
+	OrderID     int64  `json:"order_id"`
+	UserID      int64  `json:"user_id,omitempty"`
+	Status      string `json:"status"`
+	FromStatus  string `json:"from_status,omitempty"`
+	TotalAmount int64  `json:"total_amount,omitempty"`
+	Currency    string `json:"currency,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+// NewStatusEvent собирает событие для перехода заказа в статус to.
+// Для статусов без события возвращает ok=false.
+func NewStatusEvent(orderID int64, from, to, reason string) (e outbox.Event, ok bool, err error) {
+	eventType, ok := statusEvents[to]
+	if !ok {
+		return outbox.Event{}, false, nil
+	}
+	e, err = outbox.NewEvent(AggregateOrder, orderID, eventType, EventPayload{
+		OrderID:    orderID,
+		Status:     to,
+		FromStatus: from,
+		Reason:     reason,
+	})
+	return e, true, err
+}
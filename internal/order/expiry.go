@@ -0,0 +1,58 @@
+package order
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ExpiryWorker периодически отменяет заказы, не оплаченные за PaymentTTL.
+type ExpiryWorker struct {
+	svc        AdminService
+	paymentTTL time.Duration
+	interval   time.Duration
+	batchSize  int
+}
+
+func NewExpiryWorker(svc AdminService, paymentTTL, interval time.Duration) *ExpiryWorker {
+	return &ExpiryWorker{
+		svc:        svc,
+		paymentTTL: paymentTTL,
+		interval:   interval,
+		batchSize:  100,
+	}
+}
+
+// Run блокируется до отмены ctx.
+func (w *ExpiryWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.tick(ctx)
+		}
+	}
+}
+
+func (w *ExpiryWorker) tick(ctx context.Context) {
+	for {
+		n, err := w.svc.ExpireUnpaidOrders(ctx, w.paymentTTL, w.batchSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				zap.L().Error("Failed to expire unpaid orders", zap.Error(err))
+			}
+			return
+		}
+		if n > 0 {
+			zap.L().Info("Expired unpaid orders", zap.Int("count", n))
+		}
+		if n < w.batchSize {
+			return
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package order
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+const (
+	SortCreatedDesc = "created_at_desc"
+	SortCreatedAsc  = "created_at_asc"
+)
+
+// Cursor — позиция последнего заказа на странице для keyset-пагинации.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        int64
+}
+
+func (c Cursor) Encode() string {
+	raw := strconv.FormatInt(c.CreatedAt.UnixNano(), 10) + ":" + strconv.FormatInt(c.ID, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeCursor(s string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	ts, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+	nanos, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	oid, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &Cursor{CreatedAt: time.Unix(0, nanos).UTC(), ID: oid}, nil
+}
+
+// ListFilter — параметры выборки заказов пользователя.
+type ListFilter struct {
+	Status      string
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	Sort        string
+	After       *Cursor
+	Limit       int
+}
+
+func (f ListFilter) Validate() error {
+	if f.Status != "" && !IsKnownStatus(f.Status) {
+		return fmt.Errorf("unknown status %q", f.Status)
+	}
+	if f.Sort != SortCreatedDesc && f.Sort != SortCreatedAsc {
+		return fmt.Errorf("unknown sort %q", f.Sort)
+	}
+	if f.CreatedFrom != nil && f.CreatedTo != nil && f.CreatedFrom.After(*f.CreatedTo) {
+		return errors.New("created_from is after created_to")
+	}
+	if f.Limit <= 0 {
+		return errors.New("limit must be positive")
+	}
+	return nil
+}
+
+// OrderPage — страница заказов и курсор на следующую страницу.
+type OrderPage struct {
+	Items      []*Order `json:"items"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
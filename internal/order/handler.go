@@ -1,10 +1,16 @@
 package order
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"marketplace/internal/auth"
+	"marketplace/internal/currency"
+	"marketplace/internal/shipping"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -23,58 +29,332 @@ func RegisterRoutes(r *gin.Engine, svc Service) {
 	{
 		g.POST("", h.createFromCart)
 		g.GET("", h.listOrders)
+		g.POST("/preview", h.preview)
+		g.GET("/shipping-options", h.shippingOptions)
+		g.GET("/events", h.streamEvents)
 		g.GET("/:id", h.getOrder)
+		g.GET("/:id/history", h.getOrderHistory)
+		g.POST("/:id/reorder", h.reorder)
+	}
+
+	admin := r.Group("/admin/orders")
+	admin.Use(auth.JWTAuth(), auth.RequireRole("admin"))
+	{
+		admin.GET("", h.adminListOrders)
+		admin.GET("/:id", h.adminGetOrder)
+		admin.GET("/:id/history", h.adminGetOrderHistory)
+		admin.POST("/:id/ship", h.adminShip)
+		admin.POST("/:id/deliver", h.adminDeliver)
+		admin.POST("/:id/cancel", h.adminCancel)
+	}
+}
+
+type createOrderReq struct {
+	// ID адреса из адресной книги; если не задан, берется адрес по умолчанию
+	AddressID int64 `json:"address_id" binding:"omitempty,gt=0"`
+	// ID способа доставки из GET /orders/shipping-options
+	ShippingMethodID int64 `json:"shipping_method_id" binding:"omitempty,gt=0"`
+	// токен из POST /orders/preview; цена заказа должна совпасть с предпросмотром
+	QuoteToken string `json:"quote_token"`
+}
+
+func (r createOrderReq) options() CheckoutOptions {
+	return CheckoutOptions{
+		AddressID:        r.AddressID,
+		ShippingMethodID: r.ShippingMethodID,
+		QuoteToken:       r.QuoteToken,
+	}
+}
+
+// bindOptionalJSON разбирает необязательное тело запроса. Пустое тело — не ошибка; длину тела
+// не проверяем: при chunked-передаче она неизвестна (-1), а тело есть.
+func bindOptionalJSON(c *gin.Context, obj any) bool {
+	if err := c.ShouldBindJSON(obj); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// checkoutError отвечает на ошибки расчета и оформления заказа. 4xx — только для известных
+// ошибок запроса; сбой БД или транзакции — 500, чтобы идемпотентный ключ не сохранил его
+// как окончательный ответ и повтор с тем же ключом мог пройти.
+func checkoutError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrInsufficientStock), errors.Is(err, ErrQuoteExpired), errors.Is(err, ErrQuoteMismatch),
+		errors.Is(err, ErrProductUnavailable):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrQuoteRequired):
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrAddressNotFound), errors.Is(err, shipping.ErrMethodNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrEmptyCart), errors.Is(err, ErrShippingRequired), errors.Is(err, ErrQuoteInvalid),
+		errors.Is(err, shipping.ErrNotDeliverable), errors.Is(err, currency.ErrRateNotFound),
+		errors.Is(err, currency.ErrUnknownCurrency):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 	}
 }
 
 // @Summary Create Order from Cart
-// @Description Create a new order based on the current user's cart
+// @Description Create a new order based on the current user's cart.
+// @Description Without address_id the default address is used; with no default address the order has no address,
+// @Description unless shipping is priced or CHECKOUT_REQUIRE_ADDRESS is set.
 // @Tags orders
 // @Security BearerAuth
 // @Accept json
 // @Produce json
 // @Param Idempotency-Key header string false "Idempotency Key"
+// @Param input body createOrderReq false "Checkout options"
 // @Success 201 {object} map[string]int64 "id"
 // @Failure 400 {object} map[string]string
 // @Failure 401 {object} map[string]string
-// @Failure 409 {object} map[string]string "idempotency conflict"
+// @Failure 404 {object} map[string]string "shipping address or method not found"
+// @Failure 409 {object} map[string]string "not enough stock, product no longer available, quote expired or prices changed"
+// @Failure 428 {object} map[string]string "quote token required"
 // @Failure 500 {object} map[string]string
 // @Router /orders [post]
 func (h *Handler) createFromCart(c *gin.Context) {
-	idKey := c.GetHeader("Idempotency-Key")
+	var req createOrderReq
+	if !bindOptionalJSON(c, &req) {
+		return
+	}
+	id, err := h.svc.CreateFromCart(c, auth.GetUserID(c), req.options())
+	if err != nil {
+		checkoutError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"id": id})
+}
+
+// @Summary Preview Order
+// @Description Price the current cart without creating an order: line prices, taxes, shipping, total,
+// @Description stock shortfalls and a short-lived quote token to pass to POST /orders as quote_token.
+// @Tags orders
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param input body createOrderReq false "Checkout options (quote_token is ignored)"
+// @Success 200 {object} order.Quote
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string "shipping address or method not found"
+// @Failure 409 {object} map[string]string "product no longer available"
+// @Failure 500 {object} map[string]string
+// @Router /orders/preview [post]
+func (h *Handler) preview(c *gin.Context) {
+	var req createOrderReq
+	if !bindOptionalJSON(c, &req) {
+		return
+	}
+	q, err := h.svc.Preview(c, auth.GetUserID(c), req.options())
+	if err != nil {
+		checkoutError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, q)
+}
 
-	id, err := h.svc.CreateFromCart(c, auth.GetUserID(c), idKey)
+// @Summary List Shipping Options
+// @Description List shipping methods available for the current cart and address, with prices
+// @Tags orders
+// @Security BearerAuth
+// @Produce json
+// @Param address_id query int false "Address ID (default address if omitted)"
+// @Success 200 {array} shipping.Option
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string "shipping address not found"
+// @Failure 409 {object} map[string]string "product no longer available"
+// @Failure 500 {object} map[string]string
+// @Router /orders/shipping-options [get]
+func (h *Handler) shippingOptions(c *gin.Context) {
+	addressID, err := strconv.ParseInt(c.DefaultQuery("address_id", "0"), 10, 64)
+	if err != nil || addressID < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid address_id"})
+		return
+	}
+	opts, err := h.svc.ShippingOptions(c, auth.GetUserID(c), addressID)
 	if err != nil {
-		switch {
-		case errors.Is(err, ErrIdempotencyConflict):
-			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		checkoutError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, opts)
+}
+
+// heartbeatInterval — как часто слать комментарий в SSE-поток, чтобы прокси не рвали соединение.
+const heartbeatInterval = 15 * time.Second
+
+// @Summary Order Status Events
+// @Description Server-sent events stream of status transitions of the current user's orders.
+// @Description Each event has id = status history id, event = "order.status" and a JSON StatusChange as data.
+// @Description Send Last-Event-ID (header or last_event_id query) to receive transitions missed while disconnected;
+// @Description a few events before it may be sent again, so deduplicate by id.
+// @Tags orders
+// @Security BearerAuth
+// @Produce text/event-stream
+// @Param Last-Event-ID header int false "Last received event ID"
+// @Param last_event_id query int false "Last received event ID, for clients that cannot set headers"
+// @Success 200 {object} order.StatusChange
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Router /orders/events [get]
+func (h *Handler) streamEvents(c *gin.Context) {
+	raw := c.GetHeader("Last-Event-ID")
+	if raw == "" {
+		raw = c.Query("last_event_id")
+	}
+	var lastID int64
+	if raw != "" {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || id < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid Last-Event-ID"})
+			return
+		}
+		lastID = id
+	}
+
+	backlog, sub, err := h.svc.SubscribeStatusEvents(c, auth.GetUserID(c), lastID)
+	if err != nil {
+		if errors.Is(err, ErrStreamClosed) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer sub.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	// события из истории и из подписки пересекаются: каждое отправляется один раз
+	seen := NewSeenEvents()
+	for _, e := range backlog {
+		if !seen.Add(e.ID) {
+			continue
+		}
+		if err = writeStatusEvent(c.Writer, e); err != nil {
 			return
-		default:
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
 			return
+		case e, ok := <-sub.C:
+			if !ok {
+				// подписку закрыли: сервер останавливается или клиент не успевал читать
+				return
+			}
+			if !seen.Add(e.ID) {
+				continue
+			}
+			if err = writeStatusEvent(c.Writer, e); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err = io.WriteString(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
 		}
+		c.Writer.Flush()
+	}
+}
 
+func writeStatusEvent(w io.Writer, e StatusEvent) error {
+	data, err := json.Marshal(e.StatusChange)
+	if err != nil {
+		return err
 	}
-	c.JSON(http.StatusCreated, gin.H{"id": id})
+	_, err = fmt.Fprintf(w, "id: %d\nevent: order.status\ndata: %s\n\n", e.ID, data)
+	return err
 }
 
 // @Summary List Orders
-// @Description List orders for the current user
+// @Description List orders for the current user with filtering and keyset pagination
 // @Tags orders
 // @Security BearerAuth
 // @Accept json
 // @Produce json
-// @Success 200 {array} order.Order
+// @Param status query string false "Order status"
+// @Param created_from query string false "Created at or after (RFC3339 or YYYY-MM-DD)"
+// @Param created_to query string false "Created before (RFC3339 or YYYY-MM-DD)"
+// @Param sort query string false "Sort order" Enums(created_at_desc, created_at_asc) default(created_at_desc)
+// @Param limit query int false "Page size" default(20)
+// @Param cursor query string false "Cursor from the previous page"
+// @Success 200 {object} order.OrderPage
+// @Failure 400 {object} map[string]string
 // @Failure 401 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /orders [get]
 func (h *Handler) listOrders(c *gin.Context) {
-	orders, err := h.svc.ListOrders(c, auth.GetUserID(c), 0, 50)
+	filter, err := parseListFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err = filter.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	page, err := h.svc.ListOrders(c, auth.GetUserID(c), filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, orders)
+	c.JSON(http.StatusOK, page)
+}
+
+func parseListFilter(c *gin.Context) (ListFilter, error) {
+	f := ListFilter{
+		Status: c.Query("status"),
+		Sort:   c.DefaultQuery("sort", SortCreatedDesc),
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 || limit > 100 {
+		return f, errors.New("limit must be between 1 and 100")
+	}
+	f.Limit = limit
+	if v := c.Query("created_from"); v != "" {
+		t, err := parseTimeParam(v)
+		if err != nil {
+			return f, fmt.Errorf("invalid created_from: %w", err)
+		}
+		f.CreatedFrom = &t
+	}
+	if v := c.Query("created_to"); v != "" {
+		t, err := parseTimeParam(v)
+		if err != nil {
+			return f, fmt.Errorf("invalid created_to: %w", err)
+		}
+		f.CreatedTo = &t
+	}
+	if v := c.Query("cursor"); v != "" {
+		cur, err := DecodeCursor(v)
+		if err != nil {
+			return f, err
+		}
+		f.After = cur
+	}
+	return f, nil
+}
+
+// parseTimeParam принимает RFC3339 или дату в формате YYYY-MM-DD.
+func parseTimeParam(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, v)
 }
 
 // @Summary Get Order
@@ -99,3 +379,56 @@ func (h *Handler) getOrder(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, order)
 }
+
+// @Summary Get Order History
+// @Description Get the status timeline of the current user's order
+// @Tags orders
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Order ID"
+// @Success 200 {array} order.StatusChange
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /orders/{id}/history [get]
+func (h *Handler) getOrderHistory(c *gin.Context) {
+	oid, ok := parseOrderID(c)
+	if !ok {
+		return
+	}
+	history, err := h.svc.GetOrderHistory(c, auth.GetUserID(c), oid)
+	if err != nil {
+		writeOrderError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, history)
+}
+
+// @Summary Reorder
+// @Description Copy the lines of a past order into the current user's cart, merging with items already there.
+// @Description Quantities are capped at the stock left after what the cart already holds; all lines are added at once.
+// @Description Reports lines skipped because the product is gone or out of stock, lines cut down to the stock left,
+// @Description and lines whose price has changed.
+// @Tags orders
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Order ID"
+// @Success 200 {object} order.ReorderResult
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /orders/{id}/reorder [post]
+func (h *Handler) reorder(c *gin.Context) {
+	oid, ok := parseOrderID(c)
+	if !ok {
+		return
+	}
+	res, err := h.svc.Reorder(c, auth.GetUserID(c), oid)
+	if err != nil {
+		writeOrderError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
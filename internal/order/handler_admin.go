@@ -0,0 +1,193 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"marketplace/internal/auth"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func parseOrderID(c *gin.Context) (int64, bool) {
+	oid, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid order id"})
+		return 0, false
+	}
+	return oid, true
+}
+
+// writeOrderError отдает ответ по ошибке сервиса с нужным HTTP-статусом.
+func writeOrderError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrOrderNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrInvalidStatusTransition):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// @Summary List all orders (admin)
+// @Description List orders of all users
+// @Tags admin-orders
+// @Security BearerAuth
+// @Produce json
+// @Param offset query int false "Offset" default(0)
+// @Param limit query int false "Limit" default(50)
+// @Success 200 {array} order.Order
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/orders [get]
+func (h *Handler) adminListOrders(c *gin.Context) {
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid offset"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 200 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+		return
+	}
+	orders, err := h.svc.ListAllOrders(c, offset, limit)
+	if err != nil {
+		writeOrderError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, orders)
+}
+
+// @Summary Get any order (admin)
+// @Description Get details of any order by ID
+// @Tags admin-orders
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Order ID"
+// @Success 200 {object} order.Order
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/orders/{id} [get]
+func (h *Handler) adminGetOrder(c *gin.Context) {
+	oid, ok := parseOrderID(c)
+	if !ok {
+		return
+	}
+	o, err := h.svc.GetAnyOrder(c, oid)
+	if err != nil {
+		writeOrderError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, o)
+}
+
+// @Summary Get order status history (admin)
+// @Description Get the status timeline of any order
+// @Tags admin-orders
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Order ID"
+// @Success 200 {array} order.StatusChange
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/orders/{id}/history [get]
+func (h *Handler) adminGetOrderHistory(c *gin.Context) {
+	oid, ok := parseOrderID(c)
+	if !ok {
+		return
+	}
+	history, err := h.svc.GetAnyOrderHistory(c, oid)
+	if err != nil {
+		writeOrderError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, history)
+}
+
+// @Summary Ship order (admin)
+// @Description Move a paid order to the shipped status
+// @Tags admin-orders
+// @Security BearerAuth
+// @Accept json
+// @Param id path int true "Order ID"
+// @Param input body transitionReq false "Reason"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string "invalid status transition"
+// @Failure 500 {object} map[string]string
+// @Router /admin/orders/{id}/ship [post]
+func (h *Handler) adminShip(c *gin.Context) {
+	h.adminTransition(c, h.svc.Ship)
+}
+
+// @Summary Deliver order (admin)
+// @Description Move a shipped order to the delivered status
+// @Tags admin-orders
+// @Security BearerAuth
+// @Accept json
+// @Param id path int true "Order ID"
+// @Param input body transitionReq false "Reason"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string "invalid status transition"
+// @Failure 500 {object} map[string]string
+// @Router /admin/orders/{id}/deliver [post]
+func (h *Handler) adminDeliver(c *gin.Context) {
+	h.adminTransition(c, h.svc.Deliver)
+}
+
+// @Summary Cancel order (admin)
+// @Description Cancel an order that has not been shipped yet
+// @Tags admin-orders
+// @Security BearerAuth
+// @Accept json
+// @Param id path int true "Order ID"
+// @Param input body transitionReq false "Reason"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string "invalid status transition"
+// @Failure 500 {object} map[string]string
+// @Router /admin/orders/{id}/cancel [post]
+func (h *Handler) adminCancel(c *gin.Context) {
+	h.adminTransition(c, h.svc.Cancel)
+}
+
+type transitionReq struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+func (h *Handler) adminTransition(c *gin.Context, fn func(ctx context.Context, orderID, actorID int64, reason string) error) {
+	oid, ok := parseOrderID(c)
+	if !ok {
+		return
+	}
+	var req transitionReq
+	if !bindOptionalJSON(c, &req) {
+		return
+	}
+	if err := fn(c, oid, auth.GetUserID(c), req.Reason); err != nil {
+		writeOrderError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
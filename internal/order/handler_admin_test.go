@@ -0,0 +1,63 @@
+package order
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newAdminRouter(repo *mockRepo) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	h := NewHandler(NewService(repo))
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("userID", int64(1)) })
+	r.POST("/admin/orders/:id/ship", h.adminShip)
+	r.POST("/admin/orders/:id/deliver", h.adminDeliver)
+	return r
+}
+
+func TestAdminTransition_RepeatedIsConflict(t *testing.T) {
+	cases := []struct {
+		path   string
+		status string
+	}{
+		{"/admin/orders/7/ship", StatusShipped},
+		{"/admin/orders/7/deliver", StatusDelivered},
+	}
+	for _, tc := range cases {
+		t.Run(tc.status, func(t *testing.T) {
+			repo := new(mockRepo)
+			repo.On("GetOrderStatus", mock.Anything, int64(7)).Return(tc.status, nil)
+
+			w := httptest.NewRecorder()
+			newAdminRouter(repo).ServeHTTP(w, httptest.NewRequest(http.MethodPost, tc.path, http.NoBody))
+
+			// повтор не пишет вторую запись истории и второе событие для webhook
+			assert.Equal(t, http.StatusConflict, w.Code)
+			repo.AssertNotCalled(t, "BeginTx", mock.Anything)
+			repo.AssertNotCalled(t, "AddOutboxEvent", mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestAdminTransition_Ship(t *testing.T) {
+	repo := new(mockRepo)
+	tx := new(mockTx)
+	repo.On("GetOrderStatus", mock.Anything, int64(7)).Return(StatusPaid, nil)
+	repo.On("BeginTx", mock.Anything).Return(tx, nil)
+	repo.On("UpdateOrderStatus", mock.Anything, tx, int64(7), StatusPaid, StatusShipped).Return(nil)
+	repo.On("AddStatusHistory", mock.Anything, tx, mock.Anything).Return(nil)
+	repo.On("AddOutboxEvent", mock.Anything, tx, mock.Anything).Return(nil)
+	tx.On("Rollback").Return(nil)
+	tx.On("Commit").Return(nil)
+
+	w := httptest.NewRecorder()
+	newAdminRouter(repo).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/orders/7/ship", http.NoBody))
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	repo.AssertCalled(t, "UpdateOrderStatus", mock.Anything, tx, int64(7), StatusPaid, StatusShipped)
+}
@@ -0,0 +1,71 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+	"marketplace/internal/currency"
+	"marketplace/internal/shipping"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func bindTransition(body string, contentLength int64) (*httptest.ResponseRecorder, transitionReq, bool) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/admin/orders/1/cancel", strings.NewReader(body))
+	c.Request.ContentLength = contentLength
+	var req transitionReq
+	ok := bindOptionalJSON(c, &req)
+	return w, req, ok
+}
+
+func TestBindOptionalJSON_ChunkedBody(t *testing.T) {
+	// chunked-запрос: длина неизвестна, но причина должна дойти до истории статусов
+	_, req, ok := bindTransition(`{"reason":"customer asked"}`, -1)
+	assert.True(t, ok)
+	assert.Equal(t, "customer asked", req.Reason)
+}
+
+func TestBindOptionalJSON_EmptyBody(t *testing.T) {
+	_, req, ok := bindTransition("", 0)
+	assert.True(t, ok)
+	assert.Empty(t, req.Reason)
+}
+
+func TestBindOptionalJSON_InvalidBody(t *testing.T) {
+	w, _, ok := bindTransition(`{"reason":`, -1)
+	assert.False(t, ok)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestCheckoutError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cases := []struct {
+		err  error
+		code int
+	}{
+		{fmt.Errorf("%w: product=1", ErrInsufficientStock), http.StatusConflict},
+		{ErrQuoteRequired, http.StatusPreconditionRequired},
+		{fmt.Errorf("cannot get shipping address: %w", ErrAddressNotFound), http.StatusNotFound},
+		{ErrEmptyCart, http.StatusBadRequest},
+		{fmt.Errorf("cannot quote shipping: %w", shipping.ErrNotDeliverable), http.StatusBadRequest},
+		{fmt.Errorf("cannot convert cart total: %w", currency.ErrRateNotFound), http.StatusBadRequest},
+		// сбой БД не должен выглядеть ошибкой клиента, иначе идемпотентный ключ закрепит его
+		{fmt.Errorf("cannot commit tx: %w", errors.New("connection reset")), http.StatusInternalServerError},
+		{fmt.Errorf("cannot get cart: %w", errors.New("connection reset")), http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		t.Run(tc.err.Error(), func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			checkoutError(c, tc.err)
+			assert.Equal(t, tc.code, w.Code)
+		})
+	}
+}
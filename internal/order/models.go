@@ -1,21 +1,134 @@
 package order
 
-import "time"
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"marketplace/internal/currency"
+	"marketplace/internal/tax"
+	"time"
+)
 
 type Order struct {
-	ID          int64       `json:"id" db:"id"`
-	UserID      int64       `json:"user_id" db:"user_id"`
-	Status      string      `json:"status" db:"status"`
-	TotalAmount int64       `json:"total_amount" db:"total_amount"`
-	Items       []OrderItem `json:"items" db:"-"`
-	CreatedAt   time.Time   `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time   `json:"updated_at" db:"updated_at"`
+	ID               int64            `json:"id" db:"id"`
+	UserID           int64            `json:"user_id" db:"user_id"`
+	Status           string           `json:"status" db:"status"`
+	Currency         string           `json:"currency" db:"currency"`               // все суммы заказа — минорные единицы этой валюты
+	SubtotalAmount   int64            `json:"subtotal_amount" db:"subtotal_amount"` // товары без НДС
+	TaxAmount        int64            `json:"tax_amount" db:"tax_amount"`
+	TotalAmount      int64            `json:"total_amount" db:"total_amount"` // subtotal + tax + shipping
+	ShippingMethodID *int64           `json:"shipping_method_id,omitempty" db:"shipping_method_id"`
+	ShippingAmount   int64            `json:"shipping_amount" db:"shipping_amount"`
+	ShippingAddress  *ShippingAddress `json:"shipping_address,omitempty" db:"shipping_address"`
+	// ExchangeRates — курсы, по которым цены каталога пересчитаны в валюту заказа при оформлении
+	ExchangeRates currency.Rates `json:"exchange_rates" db:"exchange_rates"`
+	Items         []OrderItem    `json:"items" db:"-"`
+	// RefundedAmount — сумма проведенных возвратов; Refunds — все попытки возврата
+	RefundedAmount int64         `json:"refunded_amount" db:"-"`
+	Refunds        []RefundEntry `json:"refunds,omitempty" db:"-"`
+	CreatedAt      time.Time     `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time     `json:"updated_at" db:"updated_at"`
+}
+
+// RefundEntry — возврат денег по заказу в том виде, в каком он показывается в заказе.
+type RefundEntry struct {
+	ID        int64        `json:"id" db:"id"`
+	Amount    int64        `json:"amount" db:"amount"`
+	Status    string       `json:"status" db:"status"`
+	Reason    *string      `json:"reason,omitempty" db:"reason"`
+	Lines     []RefundLine `json:"lines,omitempty" db:"-"`
+	CreatedAt time.Time    `json:"created_at" db:"created_at"`
+}
+
+// RefundLine — позиция заказа, за которую вернули деньги.
+type RefundLine struct {
+	OrderItemID int64 `json:"order_item_id" db:"order_item_id"`
+	Quantity    int   `json:"quantity" db:"quantity"`
+	Amount      int64 `json:"amount" db:"amount"`
+}
+
+// ShippingAddress — снимок адреса доставки, сохраненный в заказе (orders.shipping_address).
+type ShippingAddress struct {
+	AddressID     int64  `json:"address_id"`
+	RecipientName string `json:"recipient_name"`
+	Phone         string `json:"phone"`
+	Country       string `json:"country"`
+	Region        string `json:"region,omitempty"`
+	City          string `json:"city"`
+	PostalCode    string `json:"postal_code"`
+	Line1         string `json:"line1"`
+	Line2         string `json:"line2,omitempty"`
+}
+
+func (a ShippingAddress) Value() (driver.Value, error) {
+	return json.Marshal(a)
+}
+
+func (a *ShippingAddress) Scan(src any) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, a)
+	case string:
+		return json.Unmarshal([]byte(v), a)
+	}
+	return errors.New("unsupported shipping_address type")
 }
 
 type OrderItem struct {
 	ID        int64 `json:"id" db:"id"`
 	OrderID   int64 `json:"order_id" db:"order_id"`
-	ProductID int64 `json:"product_id" db:"product_id"`
+	ProductID int64 `json:"product_id" db:"product_id"` // 0, если товар удален
 	Quantity  int   `json:"quantity" db:"quantity"`
-	Price     int64 `json:"price" db:"price"`
+	Price     int64 `json:"price" db:"price"` // цена единицы в валюте заказа
+
+	// налог по позиции, см. tax.Compute
+	VATRate   tax.Rate `json:"vat_rate" db:"vat_rate" swaggertype:"string"`
+	TaxAmount int64    `json:"tax_amount" db:"tax_amount"`
+	// PriceIncludesTax — НДС уже входит в Price; иначе начислен сверху
+	PriceIncludesTax bool `json:"price_includes_tax" db:"price_includes_tax"`
+
+	// снимок товара на момент покупки
+	ProductName        string `json:"product_name" db:"product_name"`
+	ProductDescription string `json:"product_description" db:"product_description"`
+	CategoryID         int64  `json:"category_id" db:"category_id"`
+	CategoryName       string `json:"category_name" db:"category_name"`
+	// цена в каталоге до пересчета в валюту заказа
+	CatalogPrice    int64  `json:"catalog_price" db:"catalog_price"`
+	CatalogCurrency string `json:"catalog_currency" db:"catalog_currency"`
+}
+
+// Amount — сумма позиции для покупателя, с НДС.
+func (i OrderItem) Amount() int64 {
+	amount := i.Price * int64(i.Quantity)
+	if !i.PriceIncludesTax {
+		amount += i.TaxAmount
+	}
+	return amount
+}
+
+// ProductSnapshot — актуальные данные товара, которые копируются в позицию заказа.
+type ProductSnapshot struct {
+	ID           int64  `db:"id"`
+	Name         string `db:"name"`
+	Description  string `db:"description"`
+	Price        int64  `db:"price"`
+	Currency     string `db:"currency"`
+	CategoryID   int64  `db:"category_id"`
+	CategoryName string `db:"category_name"`
+	WeightGrams  int    `db:"weight_grams"`
+	Stock        int    `db:"stock"`
+
+	VATRate          tax.Rate `db:"vat_rate"`
+	PriceIncludesTax bool     `db:"price_includes_tax"`
+}
+
+// StatusChange — запись в истории статусов заказа.
+type StatusChange struct {
+	ID         int64     `json:"id" db:"id"`
+	OrderID    int64     `json:"order_id" db:"order_id"`
+	FromStatus string    `json:"from_status" db:"from_status"`
+	ToStatus   string    `json:"to_status" db:"to_status"`
+	ActorID    *int64    `json:"actor_id,omitempty" db:"actor_id"`
+	Reason     string    `json:"reason" db:"reason"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
 }
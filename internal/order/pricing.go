@@ -0,0 +1,235 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"marketplace/internal/currency"
+	"marketplace/internal/shipping"
+	"marketplace/internal/tax"
+	"time"
+)
+
+// cartTotals — суммы по товарам корзины в минорных единицах валюты корзины.
+type cartTotals struct {
+	Subtotal    int64 // без НДС
+	Tax         int64
+	WeightGrams int
+	// Shortfalls — позиции, которых на складе меньше, чем в корзине
+	Shortfalls []StockShortfall
+}
+
+// Gross — стоимость товаров для покупателя, с НДС.
+func (t cartTotals) Gross() int64 {
+	return t.Subtotal + t.Tax
+}
+
+// StockShortfall — нехватка товара на складе для позиции корзины.
+type StockShortfall struct {
+	ProductID int64 `json:"product_id"`
+	Requested int   `json:"requested"`
+	Available int   `json:"available"`
+}
+
+// cartLines возвращает содержимое корзины; пустая корзина — ошибка.
+func (s *service) cartLines(ctx context.Context, userID int64) ([]CartItemLite, error) {
+	cartItems, err := s.repo.GetCartItemsForUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get cart: %w", err)
+	}
+	if len(cartItems) == 0 {
+		return nil, ErrEmptyCart
+	}
+	return cartItems, nil
+}
+
+// RateSource отдает курсы валют на момент времени; реализуется currency.Service.
+type RateSource interface {
+	Table(ctx context.Context, at time.Time) (*currency.Table, error)
+}
+
+// WithRates включает оформление заказов в валюте, отличной от валюты цен каталога.
+// Без него заказ можно оформить только в валюте товаров.
+func WithRates(src RateSource) Option {
+	return func(s *service) { s.rates = src }
+}
+
+// rateTable — курсы, действующие сейчас; без источника курсов — пустая таблица.
+func (s *service) rateTable(ctx context.Context) (*currency.Table, error) {
+	if s.rates == nil {
+		return currency.NewTable(nil), nil
+	}
+	return s.rates.Table(ctx, time.Now())
+}
+
+// cartItems собирает позиции заказа из корзины, пересчитывает цены каталога в валюту
+// корзины cur и считает налог по каждой позиции уже в ней.
+// Внутри транзакции (tx != nil) товары читаются под блокировкой строк, и цены
+// не могут измениться до коммита.
+func (s *service) cartItems(ctx context.Context, cartItems []CartItemLite, cur string, rates *currency.Table, tx Tx) ([]OrderItem, cartTotals, error) {
+	var (
+		totals   cartTotals
+		products map[int64]ProductSnapshot
+		err      error
+	)
+	productIDs := make([]int64, 0, len(cartItems))
+	for _, item := range cartItems {
+		productIDs = append(productIDs, item.ProductID)
+	}
+	if tx != nil {
+		products, err = s.repo.LockProductsForOrder(ctx, tx, productIDs)
+	} else {
+		products, err = s.repo.GetProductsForOrder(ctx, productIDs)
+	}
+	if err != nil {
+		return nil, totals, fmt.Errorf("cannot get prices: %w", err)
+	}
+	items := make([]OrderItem, 0, len(cartItems))
+	for _, item := range cartItems {
+		p, ok := products[item.ProductID]
+		if !ok {
+			return nil, totals, fmt.Errorf("%w: product %d", ErrProductUnavailable, item.ProductID)
+		}
+		rate := p.VATRate
+		if rate == "" {
+			rate = tax.RateNone
+		}
+		price, err := rates.Convert(p.Price, p.Currency, cur)
+		if err != nil {
+			return nil, totals, fmt.Errorf("cannot convert price of product %d: %w", item.ProductID, err)
+		}
+		line := tax.Compute(price, item.Quantity, rate, p.PriceIncludesTax)
+		totals.Subtotal += line.Net
+		totals.Tax += line.Tax
+		totals.WeightGrams += p.WeightGrams * item.Quantity
+		if p.Stock < item.Quantity {
+			totals.Shortfalls = append(totals.Shortfalls, StockShortfall{
+				ProductID: item.ProductID,
+				Requested: item.Quantity,
+				Available: max(p.Stock, 0),
+			})
+		}
+		items = append(items, OrderItem{
+			ProductID:          item.ProductID,
+			Quantity:           item.Quantity,
+			Price:              price,
+			VATRate:            rate,
+			TaxAmount:          line.Tax,
+			PriceIncludesTax:   p.PriceIncludesTax,
+			ProductName:        p.Name,
+			ProductDescription: p.Description,
+			CategoryID:         p.CategoryID,
+			CategoryName:       p.CategoryName,
+			CatalogPrice:       p.Price,
+			CatalogCurrency:    p.Currency,
+		})
+	}
+	return items, totals, nil
+}
+
+// pricing — расчет заказа по текущей корзине: то же самое видит покупатель
+// в предпросмотре и то же записывается в заказ.
+type pricing struct {
+	currency         string
+	rates            *currency.Table
+	items            []OrderItem
+	totals           cartTotals
+	address          *ShippingAddress
+	shippingMethodID *int64
+	shippingAmount   int64
+	total            int64
+}
+
+// checkout — то, что покупатель выбрал до расчета цен.
+type checkout struct {
+	lines    []CartItemLite
+	address  *ShippingAddress
+	currency string
+}
+
+// prepare проверяет то, что не зависит от цен: корзину, адрес и выбор доставки.
+// Вызывается до транзакции, чтобы не держать блокировки на заведомо неверном запросе.
+func (s *service) prepare(ctx context.Context, userID int64, opts CheckoutOptions) (*checkout, error) {
+	lines, err := s.cartLines(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if s.shipping != nil && opts.ShippingMethodID == 0 {
+		return nil, ErrShippingRequired
+	}
+	address, err := s.shippingAddress(ctx, userID, opts.AddressID, s.addressRequired || s.shipping != nil)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := s.cartCurrency(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &checkout{lines: lines, address: address, currency: cur}, nil
+}
+
+// shippingAddress берет адрес доставки: выбранный или адрес по умолчанию. Если адрес не выбран,
+// а адреса по умолчанию нет, необязательный адрес остается пустым.
+func (s *service) shippingAddress(ctx context.Context, userID, addressID int64, required bool) (*ShippingAddress, error) {
+	address, err := s.repo.GetShippingAddress(ctx, userID, addressID)
+	if errors.Is(err, ErrAddressNotFound) && addressID == 0 && !required {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot get shipping address: %w", err)
+	}
+	return address, nil
+}
+
+// cartCurrency — валюта корзины; если покупатель ее не выбирал — currency.Base.
+func (s *service) cartCurrency(ctx context.Context, userID int64) (string, error) {
+	cur, err := s.repo.GetCartCurrency(ctx, userID)
+	if err != nil {
+		return "", fmt.Errorf("cannot get cart currency: %w", err)
+	}
+	if cur == "" {
+		return currency.Base, nil
+	}
+	return cur, nil
+}
+
+// price считает заказ без записи в БД: позиции, налог и доставку в валюте корзины
+// по курсам, действующим сейчас. tx передается при оформлении заказа, для предпросмотра — nil.
+func (s *service) price(ctx context.Context, co *checkout, opts CheckoutOptions, tx Tx) (*pricing, error) {
+	rates, err := s.rateTable(ctx)
+	if err != nil {
+		return nil, err
+	}
+	items, totals, err := s.cartItems(ctx, co.lines, co.currency, rates, tx)
+	if err != nil {
+		return nil, err
+	}
+	pr := &pricing{currency: co.currency, rates: rates, items: items, totals: totals, address: co.address}
+	if s.shipping != nil {
+		quote, err := s.quoteShipping(ctx, opts.ShippingMethodID, co.address.Country, co.currency, rates, totals)
+		if err != nil {
+			return nil, err
+		}
+		pr.shippingMethodID = &quote.MethodID
+		pr.shippingAmount = quote.Price
+	}
+	pr.total = totals.Gross() + pr.shippingAmount
+	return pr, nil
+}
+
+// quoteShipping считает доставку: тарифы и порог бесплатной доставки заданы в currency.Base,
+// цена пересчитывается в валюту корзины cur.
+func (s *service) quoteShipping(ctx context.Context, methodID int64, country, cur string, rates *currency.Table, totals cartTotals) (shipping.Option, error) {
+	gross, err := rates.Convert(totals.Gross(), cur, currency.Base)
+	if err != nil {
+		return shipping.Option{}, fmt.Errorf("cannot convert cart total: %w", err)
+	}
+	quote, err := s.shipping.Quote(ctx, methodID, country, totals.WeightGrams, gross)
+	if err != nil {
+		return shipping.Option{}, fmt.Errorf("cannot quote shipping: %w", err)
+	}
+	if quote.Price, err = rates.Convert(quote.Price, currency.Base, cur); err != nil {
+		return shipping.Option{}, fmt.Errorf("cannot convert shipping price: %w", err)
+	}
+	return quote, nil
+}
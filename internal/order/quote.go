@@ -0,0 +1,198 @@
+package order
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrQuoteRequired = errors.New("quote token is required, call POST /orders/preview first")
+	ErrQuoteInvalid  = errors.New("invalid quote token")
+	ErrQuoteExpired  = errors.New("quote token expired")
+	ErrQuoteMismatch = errors.New("cart or prices changed since preview")
+)
+
+// QuoteSigner выпускает и проверяет подписанные токены предпросмотра.
+// Токен не хранится на сервере: в нем лежат пользователь, отпечаток расчета и срок жизни.
+type QuoteSigner struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+func NewQuoteSigner(secret []byte, ttl time.Duration) *QuoteSigner {
+	return &QuoteSigner{secret: secret, ttl: ttl, now: time.Now}
+}
+
+type quoteClaims struct {
+	UserID      int64  `json:"uid"`
+	Fingerprint string `json:"fp"`
+	ExpiresAt   int64  `json:"exp"`
+}
+
+// Sign возвращает токен вида base64(claims).base64(hmac) и момент его истечения.
+func (q *QuoteSigner) Sign(userID int64, fingerprint string) (string, time.Time, error) {
+	exp := q.now().Add(q.ttl).Truncate(time.Second)
+	payload, err := json.Marshal(quoteClaims{UserID: userID, Fingerprint: fingerprint, ExpiresAt: exp.Unix()})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	body := base64.RawURLEncoding.EncodeToString(payload)
+	return body + "." + q.mac(body), exp, nil
+}
+
+// Verify проверяет подпись, владельца и срок токена и возвращает отпечаток расчета.
+func (q *QuoteSigner) Verify(token string, userID int64) (string, error) {
+	body, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(q.mac(body))) {
+		return "", ErrQuoteInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		return "", ErrQuoteInvalid
+	}
+	var c quoteClaims
+	if err = json.Unmarshal(payload, &c); err != nil || c.UserID != userID {
+		return "", ErrQuoteInvalid
+	}
+	if q.now().Unix() >= c.ExpiresAt {
+		return "", ErrQuoteExpired
+	}
+	return c.Fingerprint, nil
+}
+
+func (q *QuoteSigner) mac(body string) string {
+	m := hmac.New(sha256.New, q.secret)
+	m.Write([]byte(body))
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
+
+// WithQuotes включает выдачу токенов в предпросмотре. Если required=true,
+// заказ оформляется только с действующим токеном.
+func WithQuotes(signer *QuoteSigner, required bool) Option {
+	return func(s *service) {
+		s.quotes = signer
+		s.quoteRequired = required
+	}
+}
+
+// QuoteLine — позиция предпросмотра.
+type QuoteLine struct {
+	ProductID   int64  `json:"product_id"`
+	ProductName string `json:"product_name"`
+	Quantity    int    `json:"quantity"`
+	UnitPrice   int64  `json:"unit_price"`
+	TaxAmount   int64  `json:"tax_amount"`
+	Amount      int64  `json:"amount"` // с НДС
+}
+
+// Quote — расчет заказа по текущей корзине без его создания.
+type Quote struct {
+	Currency         string           `json:"currency"`
+	Lines            []QuoteLine      `json:"lines"`
+	SubtotalAmount   int64            `json:"subtotal_amount"`
+	TaxAmount        int64            `json:"tax_amount"`
+	ShippingMethodID *int64           `json:"shipping_method_id,omitempty"`
+	ShippingAmount   int64            `json:"shipping_amount"`
+	TotalAmount      int64            `json:"total_amount"`
+	Shortfalls       []StockShortfall `json:"shortfalls"`
+	// Token передается в POST /orders как quote_token; пусто, если токены не настроены
+	Token     string     `json:"quote_token,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Preview считает заказ так же, как CreateFromCart, но ничего не пишет в БД.
+func (s *service) Preview(ctx context.Context, userID int64, opts CheckoutOptions) (*Quote, error) {
+	co, err := s.prepare(ctx, userID, opts)
+	if err != nil {
+		return nil, err
+	}
+	pr, err := s.price(ctx, co, opts, nil)
+	if err != nil {
+		return nil, err
+	}
+	q := &Quote{
+		Currency:         pr.currency,
+		Lines:            make([]QuoteLine, 0, len(pr.items)),
+		SubtotalAmount:   pr.totals.Subtotal,
+		TaxAmount:        pr.totals.Tax,
+		ShippingMethodID: pr.shippingMethodID,
+		ShippingAmount:   pr.shippingAmount,
+		TotalAmount:      pr.total,
+		Shortfalls:       pr.totals.Shortfalls,
+	}
+	for _, item := range pr.items {
+		q.Lines = append(q.Lines, QuoteLine{
+			ProductID:   item.ProductID,
+			ProductName: item.ProductName,
+			Quantity:    item.Quantity,
+			UnitPrice:   item.Price,
+			TaxAmount:   item.TaxAmount,
+			Amount:      item.Amount(),
+		})
+	}
+	if q.Shortfalls == nil {
+		q.Shortfalls = []StockShortfall{}
+	}
+	if s.quotes != nil {
+		token, exp, err := s.quotes.Sign(userID, pr.fingerprint(userID))
+		if err != nil {
+			return nil, fmt.Errorf("cannot sign quote: %w", err)
+		}
+		q.Token, q.ExpiresAt = token, &exp
+	}
+	return q, nil
+}
+
+// checkQuote сверяет токен предпросмотра с расчетом, сделанным при оформлении.
+func (s *service) checkQuote(userID int64, token string, pr *pricing) error {
+	if s.quotes == nil {
+		return nil
+	}
+	if token == "" {
+		if s.quoteRequired {
+			return ErrQuoteRequired
+		}
+		return nil
+	}
+	fp, err := s.quotes.Verify(token, userID)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(fp), []byte(pr.fingerprint(userID))) {
+		return ErrQuoteMismatch
+	}
+	return nil
+}
+
+// fingerprint — отпечаток всего, что влияет на сумму к оплате: если он совпал,
+// покупатель платит ровно то, что видел в предпросмотре.
+func (p *pricing) fingerprint(userID int64) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "user:%d\ncurrency:%s\n", userID, p.currency)
+	// другой курс — другие суммы: токен, выданный до смены курса, не подойдет
+	for _, r := range p.rates.Used() {
+		fmt.Fprintf(h, "rate:%d:%s\n", r.ID, r.Rate)
+	}
+	for _, item := range p.items {
+		fmt.Fprintf(h, "item:%d:%d:%d:%s:%d\n", item.ProductID, item.Quantity, item.Price, item.VATRate, item.TaxAmount)
+	}
+	if p.address != nil {
+		addr, _ := json.Marshal(p.address)
+		fmt.Fprintf(h, "address:%s\n", addr)
+	}
+	var methodID int64
+	if p.shippingMethodID != nil {
+		methodID = *p.shippingMethodID
+	}
+	fmt.Fprintf(h, "shipping:%d:%d\ntotal:%d\n", methodID, p.shippingAmount, p.total)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,41 @@
+package order
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuoteSigner_RoundTrip(t *testing.T) {
+	signer := NewQuoteSigner([]byte("secret"), time.Minute)
+	token, exp, err := signer.Sign(1, "fp")
+	require.NoError(t, err)
+	assert.True(t, exp.After(time.Now()))
+
+	fp, err := signer.Verify(token, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "fp", fp)
+}
+
+func TestQuoteSigner_Rejects(t *testing.T) {
+	signer := NewQuoteSigner([]byte("secret"), time.Minute)
+	token, _, err := signer.Sign(1, "fp")
+	require.NoError(t, err)
+
+	// чужой пользователь
+	_, err = signer.Verify(token, 2)
+	assert.ErrorIs(t, err, ErrQuoteInvalid)
+	// другой секрет
+	_, err = NewQuoteSigner([]byte("other"), time.Minute).Verify(token, 1)
+	assert.ErrorIs(t, err, ErrQuoteInvalid)
+	// мусор
+	_, err = signer.Verify("garbage", 1)
+	assert.ErrorIs(t, err, ErrQuoteInvalid)
+
+	// истекший
+	signer.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	_, err = signer.Verify(token, 1)
+	assert.ErrorIs(t, err, ErrQuoteExpired)
+}
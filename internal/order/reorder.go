@@ -0,0 +1,121 @@
+package order
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"marketplace/internal/cart"
+)
+
+// Причины, по которым позиция не попала в корзину целиком при повторном заказе.
+const (
+	SkipProductUnavailable = "product_unavailable"
+	SkipOutOfStock         = "out_of_stock"
+	// ClampLimitedStock — добавлено меньше, чем было в заказе: остаток за вычетом корзины меньше
+	ClampLimitedStock = "limited_stock"
+)
+
+var ErrCartUnavailable = errors.New("cart service is not configured")
+
+// CartAdder добавляет товары в корзину; реализуется cart.Service.
+type CartAdder interface {
+	AddItems(ctx context.Context, userID int64, items []cart.CartItem) ([]cart.AddedItem, error)
+}
+
+// WithCart включает повторный заказ.
+func WithCart(c CartAdder) Option {
+	return func(s *service) { s.cart = c }
+}
+
+// ReorderLine — позиция прошлого заказа и то, что с ней произошло.
+type ReorderLine struct {
+	ProductID   int64  `json:"product_id"`
+	ProductName string `json:"product_name"`
+	Requested   int    `json:"requested"` // количество в прошлом заказе
+	Quantity    int    `json:"quantity"`  // добавлено в корзину
+	Reason      string `json:"reason,omitempty" enums:"product_unavailable,out_of_stock,limited_stock"`
+	// цены каталога: в прошлом заказе и сейчас
+	OldPrice    int64  `json:"old_price,omitempty"`
+	OldCurrency string `json:"old_currency,omitempty"`
+	NewPrice    int64  `json:"new_price,omitempty"`
+	NewCurrency string `json:"new_currency,omitempty"`
+}
+
+type ReorderResult struct {
+	Added []ReorderLine `json:"added"`
+	// Skipped — товар удален или закончился
+	Skipped []ReorderLine `json:"skipped"`
+	// Clamped — добавленные позиции, урезанные до остатка на складе
+	Clamped []ReorderLine `json:"clamped"`
+	// PriceChanged — добавленные позиции, цена которых отличается от цены в заказе
+	PriceChanged []ReorderLine `json:"price_changed"`
+}
+
+// Reorder копирует позиции заказа пользователя в его корзину через cart.Service.AddItems:
+// объединение с корзиной и урезание до остатка на складе — правила корзины, здесь только отчет.
+func (s *service) Reorder(ctx context.Context, userID, orderID int64) (*ReorderResult, error) {
+	if s.cart == nil {
+		return nil, ErrCartUnavailable
+	}
+	o, err := s.repo.GetOrderWithItems(ctx, userID, orderID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrOrderNotFound
+		}
+		return nil, err
+	}
+	productIDs := make([]int64, 0, len(o.Items))
+	items := make([]cart.CartItem, 0, len(o.Items))
+	for _, item := range o.Items {
+		if item.ProductID != 0 {
+			productIDs = append(productIDs, item.ProductID)
+		}
+		items = append(items, cart.CartItem{ProductID: item.ProductID, Quantity: int64(item.Quantity)})
+	}
+	// цены нужны только для отчета, поэтому читаются без блокировки
+	products := map[int64]ProductSnapshot{}
+	if len(productIDs) > 0 {
+		if products, err = s.repo.GetProductsForOrder(ctx, productIDs); err != nil {
+			return nil, fmt.Errorf("cannot get products: %w", err)
+		}
+	}
+	added, err := s.cart.AddItems(ctx, userID, items)
+	if err != nil {
+		return nil, fmt.Errorf("cannot add items to cart: %w", err)
+	}
+
+	res := &ReorderResult{Added: []ReorderLine{}, Skipped: []ReorderLine{}, Clamped: []ReorderLine{}, PriceChanged: []ReorderLine{}}
+	for i, item := range o.Items {
+		line := ReorderLine{
+			ProductID:   item.ProductID,
+			ProductName: item.ProductName,
+			Requested:   item.Quantity,
+			Quantity:    int(added[i].Quantity),
+		}
+		switch {
+		case added[i].Missing:
+			line.Reason = SkipProductUnavailable
+			res.Skipped = append(res.Skipped, line)
+			continue
+		case line.Quantity == 0:
+			line.Reason = SkipOutOfStock
+			res.Skipped = append(res.Skipped, line)
+			continue
+		}
+		res.Added = append(res.Added, line)
+		if line.Quantity < item.Quantity {
+			clamped := line
+			clamped.Reason = ClampLimitedStock
+			res.Clamped = append(res.Clamped, clamped)
+		}
+		// сравниваем с ценой каталога, а не с пересчитанной в валюту заказа
+		p, ok := products[item.ProductID]
+		if ok && (p.Price != item.CatalogPrice || p.Currency != item.CatalogCurrency) {
+			line.OldPrice, line.OldCurrency = item.CatalogPrice, item.CatalogCurrency
+			line.NewPrice, line.NewCurrency = p.Price, p.Currency
+			res.PriceChanged = append(res.PriceChanged, line)
+		}
+	}
+	return res, nil
+}
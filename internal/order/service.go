@@ -3,27 +3,64 @@ package order
 import (
 	"context"
 	"errors"
+	"marketplace/internal/outbox"
+	"marketplace/internal/shipping"
+	"time"
 )
 
-var ErrIdempotencyConflict = errors.New("idempotency conflict")
-
-type IdempotencyRepository interface {
-	TryStartIdempotent(ctx context.Context, userID int64, key string, reqHash string) (ok bool, savedStatus int, savedOrderID int64, err error)
-	SaveIdempotentResult(ctx context.Context, key string, status int, orderID int64) error
-}
+var (
+	ErrAddressNotFound   = errors.New("shipping address not found")
+	ErrShippingRequired  = errors.New("shipping method is required")
+	ErrInsufficientStock = errors.New("not enough stock")
+	ErrEmptyCart         = errors.New("cart is empty")
+	// ErrProductUnavailable — товар из корзины удален из каталога.
+	ErrProductUnavailable = errors.New("product is no longer available")
+)
 
 type Repository interface {
 	BeginTx(ctx context.Context) (Tx, error)
 	GetCartItemsForUser(ctx context.Context, userID int64) ([]CartItemLite, error)
-	GetProductsPrices(ctx context.Context, productIDs []int64) (map[int64]int64, error)
-	DecrementStock(ctx context.Context, tx Tx, productID int64, quantity int) error
+	// GetCartCurrency возвращает валюту корзины; пусто, если покупатель ее не выбирал.
+	GetCartCurrency(ctx context.Context, userID int64) (string, error)
+	// GetShippingAddress возвращает адрес пользователя; addressID=0 — адрес по умолчанию.
+	GetShippingAddress(ctx context.Context, userID, addressID int64) (*ShippingAddress, error)
+	GetProductsForOrder(ctx context.Context, productIDs []int64) (map[int64]ProductSnapshot, error)
+	// LockProductsForOrder читает товары с блокировкой строк (SELECT ... FOR UPDATE)
+	// строго по возрастанию id, чтобы параллельные оформления не взаимоблокировались.
+	LockProductsForOrder(ctx context.Context, tx Tx, productIDs []int64) (map[int64]ProductSnapshot, error)
+	// ReserveStock списывает остатки по всем позициям разом или возвращает ErrInsufficientStock.
+	ReserveStock(ctx context.Context, tx Tx, items []OrderItem) error
+	RestoreStock(ctx context.Context, tx Tx, orderID int64) error
+	CompensatePayment(ctx context.Context, tx Tx, orderID int64, reason string) error
+	// ExpirePaymentIntents завершает срок активных намерений заказа, включая ждущие 3-D Secure.
+	// Отменяет их ExpiryWorker платежей: сначала у провайдера, потом в БД, а деньги,
+	// списанные провайдером в последний момент, проводит как оплату отмененного заказа.
+	ExpirePaymentIntents(ctx context.Context, tx Tx, orderID int64) error
+	// ReleaseWalletPayments возвращает на кошелек покупателя списанное в оплату заказа
+	// за вычетом уже возвращенного; вызывается до CompensatePayment.
+	ReleaseWalletPayments(ctx context.Context, tx Tx, orderID int64) error
+	// ClaimExpiredOrders блокирует заказы, ждущие оплаты дольше ttl по часам БД.
+	ClaimExpiredOrders(ctx context.Context, tx Tx, ttl time.Duration, limit int) ([]int64, error)
 	CreateOrder(ctx context.Context, tx Tx, order *Order) (int64, error)
 	BulkInsertItems(ctx context.Context, tx Tx, orderID int64, items []OrderItem) error
 	ClearCart(ctx context.Context, tx Tx, userID int64) error
-	GetUserOrders(ctx context.Context, userID int64, offset, limit int) ([]*Order, error)
+	GetUserOrders(ctx context.Context, userID int64, filter ListFilter) ([]*Order, error)
 	GetOrderWithItems(ctx context.Context, userID, orderID int64) (*Order, error)
+	GetAllOrders(ctx context.Context, offset, limit int) ([]*Order, error)
+	GetOrderByID(ctx context.Context, orderID int64) (*Order, error)
 	GetOrderStatus(ctx context.Context, orderID int64) (string, error)
-	UpdateOrderStatus(ctx context.Context, orderID int64, from, to string) error
+	UpdateOrderStatus(ctx context.Context, tx Tx, orderID int64, from, to string) error
+	AddStatusHistory(ctx context.Context, tx Tx, change *StatusChange) error
+	GetStatusHistory(ctx context.Context, orderID int64) ([]StatusChange, error)
+	// GetStatusEventsSince возвращает переходы по заказам пользователя с id > afterID.
+	GetStatusEventsSince(ctx context.Context, userID, afterID int64, limit int) ([]StatusEvent, error)
+	AddOutboxEvent(ctx context.Context, tx Tx, event outbox.Event) error
+}
+
+// ShippingCalculator считает стоимость доставки; реализуется shipping.Service.
+type ShippingCalculator interface {
+	Options(ctx context.Context, country string, weightGrams int, subtotal int64) ([]shipping.Option, error)
+	Quote(ctx context.Context, methodID int64, country string, weightGrams int, subtotal int64) (shipping.Option, error)
 }
 
 type Tx interface {
@@ -32,12 +69,31 @@ type Tx interface {
 }
 
 type CartItemLite struct {
-	ProductID int64
-	Quantity  int
+	ProductID int64 `db:"product_id"`
+	Quantity  int   `db:"quantity"`
+}
+
+// CheckoutOptions — параметры оформления заказа, выбранные покупателем.
+type CheckoutOptions struct {
+	AddressID        int64  // 0 — адрес по умолчанию
+	ShippingMethodID int64  // обязателен, если настроен расчет доставки
+	QuoteToken       string // токен из POST /orders/preview
 }
 
 type Service interface {
-	CreateFromCart(ctx context.Context, userID int64, idemKey string) (int64, error)
-	ListOrders(ctx context.Context, userID int64, offset, limit int) ([]*Order, error)
+	CreateFromCart(ctx context.Context, userID int64, opts CheckoutOptions) (int64, error)
+	ShippingOptions(ctx context.Context, userID, addressID int64) ([]shipping.Option, error)
+	// Preview считает заказ по корзине без его создания и выдает токен цены.
+	Preview(ctx context.Context, userID int64, opts CheckoutOptions) (*Quote, error)
+	ListOrders(ctx context.Context, userID int64, filter ListFilter) (*OrderPage, error)
 	GetOrder(ctx context.Context, userID, orderID int64) (*Order, error)
+	GetOrderHistory(ctx context.Context, userID, orderID int64) ([]StatusChange, error)
+	// SubscribeStatusEvents подписывает на переходы статусов заказов пользователя.
+	// Если lastEventID > 0, возвращает пропущенные после него события; подписка
+	// оформляется до их чтения, поэтому новые события могут повториться в backlog
+	// и в подписке — их отсекают по ID.
+	SubscribeStatusEvents(ctx context.Context, userID, lastEventID int64) (backlog []StatusEvent, sub *Subscription, err error)
+	Reorder(ctx context.Context, userID, orderID int64) (*ReorderResult, error)
+
+	AdminService
 }
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 )
 
 var (
@@ -13,45 +14,172 @@ var (
 )
 
 type AdminService interface {
-	Ship(ctx context.Context, orderID int64) error
-	Deliver(ctx context.Context, orderID int64) error
-	Cancel(ctx context.Context, orderID int64) error
+	ListAllOrders(ctx context.Context, offset, limit int) ([]*Order, error)
+	GetAnyOrder(ctx context.Context, orderID int64) (*Order, error)
+	GetAnyOrderHistory(ctx context.Context, orderID int64) ([]StatusChange, error)
+	Ship(ctx context.Context, orderID, actorID int64, reason string) error
+	Deliver(ctx context.Context, orderID, actorID int64, reason string) error
+	Cancel(ctx context.Context, orderID, actorID int64, reason string) error
+	ExpireUnpaidOrders(ctx context.Context, ttl time.Duration, limit int) (int, error)
 }
 
-func (s *service) Ship(ctx context.Context, orderID int64) error {
-	from, err := s.repoStatus(ctx, orderID)
+func (s *service) ListAllOrders(ctx context.Context, offset, limit int) ([]*Order, error) {
+	return s.repo.GetAllOrders(ctx, offset, limit)
+}
+
+func (s *service) GetAnyOrder(ctx context.Context, orderID int64) (*Order, error) {
+	o, err := s.repo.GetOrderByID(ctx, orderID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOrderNotFound
+	}
+	return o, err
+}
+
+func (s *service) GetAnyOrderHistory(ctx context.Context, orderID int64) ([]StatusChange, error) {
+	if _, err := s.repoStatus(ctx, orderID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetStatusHistory(ctx, orderID)
+}
+
+func (s *service) Ship(ctx context.Context, orderID, actorID int64, reason string) error {
+	return s.transition(ctx, orderID, StatusShipped, actorID, reason)
+}
+
+func (s *service) Deliver(ctx context.Context, orderID, actorID int64, reason string) error {
+	return s.transition(ctx, orderID, StatusDelivered, actorID, reason)
+}
+
+func (s *service) Cancel(ctx context.Context, orderID, actorID int64, reason string) error {
+	return s.transition(ctx, orderID, StatusCancelled, actorID, reason, s.releaseOrder)
+}
+
+// ExpireUnpaidOrders отменяет заказы, платеж по которым не подтвержден за ttl.
+// Заказы захватываются через SKIP LOCKED, поэтому метод безопасно
+// вызывать одновременно из нескольких реплик. Заказ блокируется раньше
+// его платежей — в том же порядке, что и при подтверждении оплаты.
+func (s *service) ExpireUnpaidOrders(ctx context.Context, ttl time.Duration, limit int) (int, error) {
+	tx, err := s.repo.BeginTx(ctx)
 	if err != nil {
-		return err
+		return 0, fmt.Errorf("cannot begin tx: %w", err)
 	}
-	to := StatusShipped
-	if !IsValidStatusTransition(from, to) {
-		return fmt.Errorf("%w: %s --> %s", ErrInvalidStatusTransition, from, to)
+	defer tx.Rollback()
+
+	ids, err := s.repo.ClaimExpiredOrders(ctx, tx, ttl, limit)
+	if err != nil {
+		return 0, fmt.Errorf("cannot claim expired orders: %w", err)
 	}
-	return s.repo.UpdateOrderStatus(ctx, orderID, from, to)
+	const reason = "payment timeout"
+	for _, id := range ids {
+		if err = s.repo.UpdateOrderStatus(ctx, tx, id, StatusAwaitingPayment, StatusCancelled); err != nil {
+			return 0, fmt.Errorf("cannot cancel order %d: %w", id, err)
+		}
+		if err = s.recordTransition(ctx, tx, &StatusChange{
+			OrderID:    id,
+			FromStatus: StatusAwaitingPayment,
+			ToStatus:   StatusCancelled,
+			Reason:     reason,
+		}); err != nil {
+			return 0, err
+		}
+		if err = s.releaseOrder(ctx, tx, id, StatusAwaitingPayment, reason); err != nil {
+			return 0, err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("cannot commit tx: %w", err)
+	}
+	return len(ids), nil
 }
 
-func (s *service) Deliver(ctx context.Context, orderID int64) error {
+// releaseOrder возвращает зарезервированные товары на склад, передает
+// неподтвержденные платежи на отмену у провайдера и возвращает на кошелек
+// оплаченное из него. Если заказ уже был оплачен, по остальным платежам
+// создается компенсирующая запись.
+// Вызывается только после успешной смены статуса на cancelled из другого статуса,
+// поэтому и при повторных, и при параллельных отменах склад пополняется ровно один раз.
+func (s *service) releaseOrder(ctx context.Context, tx Tx, orderID int64, from, reason string) error {
+	if err := s.repo.RestoreStock(ctx, tx, orderID); err != nil {
+		return fmt.Errorf("cannot restore stock: %w", err)
+	}
+	if err := s.repo.ExpirePaymentIntents(ctx, tx, orderID); err != nil {
+		return fmt.Errorf("cannot expire payment intents: %w", err)
+	}
+	if from == StatusAwaitingPayment || from == StatusPaid {
+		if err := s.repo.ReleaseWalletPayments(ctx, tx, orderID); err != nil {
+			return fmt.Errorf("cannot release wallet payments: %w", err)
+		}
+	}
+	if from == StatusPaid {
+		if err := s.repo.CompensatePayment(ctx, tx, orderID, reason); err != nil {
+			return fmt.Errorf("cannot compensate payment: %w", err)
+		}
+	}
+	return nil
+}
+
+// transitionHook выполняется в транзакции перехода после смены статуса.
+type transitionHook func(ctx context.Context, tx Tx, orderID int64, from, reason string) error
+
+// transition переводит заказ в статус to, проверяя допустимость перехода,
+// и в той же транзакции пишет запись в историю статусов. Заказ уже в статусе to —
+// ErrInvalidStatusTransition: повтор не должен второй раз запускать хуки и события.
+func (s *service) transition(ctx context.Context, orderID int64, to string, actorID int64, reason string, hooks ...transitionHook) error {
 	from, err := s.repoStatus(ctx, orderID)
 	if err != nil {
 		return err
 	}
-	to := StatusDelivered
-	if !IsValidStatusTransition(from, to) {
+	if from == to || !IsValidStatusTransition(from, to) {
 		return fmt.Errorf("%w: %s --> %s", ErrInvalidStatusTransition, from, to)
 	}
-	return s.repo.UpdateOrderStatus(ctx, orderID, from, to)
-}
 
-func (s *service) Cancel(ctx context.Context, orderID int64) error {
-	from, err := s.repoStatus(ctx, orderID)
+	tx, err := s.repo.BeginTx(ctx)
 	if err != nil {
-		return err
+		return fmt.Errorf("cannot begin tx: %w", err)
 	}
-	to := StatusCancelled
-	if !IsValidStatusTransition(from, to) {
+	defer tx.Rollback()
+
+	err = s.repo.UpdateOrderStatus(ctx, tx, orderID, from, to)
+	if errors.Is(err, sql.ErrNoRows) {
+		// статус успели поменять параллельно
 		return fmt.Errorf("%w: %s --> %s", ErrInvalidStatusTransition, from, to)
 	}
-	return s.repo.UpdateOrderStatus(ctx, orderID, from, to)
+	if err != nil {
+		return err
+	}
+	if err = s.recordTransition(ctx, tx, &StatusChange{
+		OrderID:    orderID,
+		FromStatus: from,
+		ToStatus:   to,
+		ActorID:    ActorRef(actorID),
+		Reason:     reason,
+	}); err != nil {
+		return err
+	}
+	for _, hook := range hooks {
+		if err = hook(ctx, tx, orderID, from, reason); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// recordTransition пишет историю статусов и доменное событие перехода
+// в транзакции tx.
+func (s *service) recordTransition(ctx context.Context, tx Tx, change *StatusChange) error {
+	if err := s.repo.AddStatusHistory(ctx, tx, change); err != nil {
+		return fmt.Errorf("cannot write status history: %w", err)
+	}
+	event, ok, err := NewStatusEvent(change.OrderID, change.FromStatus, change.ToStatus, change.Reason)
+	if err != nil {
+		return fmt.Errorf("cannot build event: %w", err)
+	}
+	if ok {
+		if err = s.repo.AddOutboxEvent(ctx, tx, event); err != nil {
+			return fmt.Errorf("cannot write outbox event: %w", err)
+		}
+	}
+	return nil
 }
 
 func (s *service) repoStatus(ctx context.Context, orderID int64) (string, error) {
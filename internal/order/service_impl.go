@@ -2,90 +2,98 @@ package order
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
+	"database/sql"
+	"errors"
 	"fmt"
-	"net/http"
+	"marketplace/internal/currency"
+	"marketplace/internal/outbox"
+	"marketplace/internal/shipping"
 )
 
 type service struct {
 	repo     Repository
-	idemRepo IdempotencyRepository
+	shipping ShippingCalculator
+	hub      *Hub
+	rates    RateSource
+	cart     CartAdder
+
+	addressRequired bool
+
+	quotes        *QuoteSigner
+	quoteRequired bool
 }
 
-func NewService(repo Repository, idemRepo IdempotencyRepository) Service {
-	return &service{repo: repo, idemRepo: idemRepo}
+// Option настраивает необязательные зависимости сервиса заказов.
+type Option func(*service)
+
+// WithShipping включает расчет стоимости доставки при оформлении заказа.
+func WithShipping(calc ShippingCalculator) Option {
+	return func(s *service) { s.shipping = calc }
 }
 
-func hashRequest(userID int64) string {
-	h := sha256.Sum256([]byte(fmt.Sprintf("create_order:%d", userID)))
-	return hex.EncodeToString(h[:])
+// WithAddressRequired запрещает оформлять заказ без адреса доставки. Без этой опции
+// заказ без адреса в запросе и без адреса по умолчанию оформляется без адреса,
+// если адрес не нужен для расчета доставки.
+func WithAddressRequired(required bool) Option {
+	return func(s *service) { s.addressRequired = required }
 }
 
-func (s *service) CreateFromCart(ctx context.Context, userID int64, idemKey string) (int64, error) {
-	if idemKey != "" && s.idemRepo != nil {
-		reqHash := hashRequest(userID)
-		ok, savedStatus, savedOrderID, err := s.idemRepo.TryStartIdempotent(ctx, userID, idemKey, reqHash)
-		if err != nil {
-			return 0, fmt.Errorf("cannot start idempotent: %w", err)
-		}
-		if !ok {
-			if savedStatus == http.StatusCreated && savedOrderID != 0 {
-				return savedOrderID, nil
-			}
-			return 0, ErrIdempotencyConflict
-		}
-		defer func() {
+// WithEventHub задает Hub для SSE-потока; по умолчанию создается свой.
+func WithEventHub(hub *Hub) Option {
+	return func(s *service) { s.hub = hub }
+}
 
-		}()
+func NewService(repo Repository, opts ...Option) Service {
+	s := &service{repo: repo, hub: NewHub()}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
+}
 
-	// 1) забираем корзину
-	cartItems, err := s.repo.GetCartItemsForUser(ctx, userID)
-	if err != nil || len(cartItems) == 0 {
-		return 0, fmt.Errorf("empty cart: %w", err)
-	}
-	// 2) получаем цены на товары
-	productIDs := make([]int64, 0, len(cartItems))
-	for _, item := range cartItems {
-		productIDs = append(productIDs, item.ProductID)
-	}
-	prices, err := s.repo.GetProductsPrices(ctx, productIDs)
+func (s *service) CreateFromCart(ctx context.Context, userID int64, opts CheckoutOptions) (int64, error) {
+	// 1) проверяем корзину, адрес и выбор доставки
+	co, err := s.prepare(ctx, userID, opts)
 	if err != nil {
-		return 0, fmt.Errorf("cannot get prices: %w", err)
-	}
-	// 3) считаем сумму
-	var totalAmount int64
-	orderItems := make([]OrderItem, 0, len(cartItems))
-	for _, item := range cartItems {
-		price, ok := prices[item.ProductID]
-		if !ok {
-			return 0, fmt.Errorf("price not found for product %d", item.ProductID)
-		}
-		totalAmount += price * int64(item.Quantity)
-		orderItems = append(orderItems, OrderItem{
-			ProductID: item.ProductID,
-			Quantity:  item.Quantity,
-			Price:     price,
-		})
-	}
-	// 4) начинаем транзакцию
+		return 0, err
+	}
+	// 2) начинаем транзакцию
 	tx, err := s.repo.BeginTx(ctx)
 	if err != nil {
 		return 0, fmt.Errorf("cannot begin tx: %w", err)
 	}
 	defer tx.Rollback()
-	// 5) резервируем товары
-	for _, item := range orderItems {
-		if err = s.repo.DecrementStock(ctx, tx, item.ProductID, item.Quantity); err != nil {
-			return 0, fmt.Errorf("stock not enough for product=%d: %w", item.ProductID, err)
-		}
+	// 3) блокируем товары по возрастанию id и считаем заказ по ценам под блокировкой;
+	// курсы, по которым пересчитали цены, сохраняются в заказе
+	pr, err := s.price(ctx, co, opts, tx)
+	if err != nil {
+		return 0, err
+	}
+	if len(pr.totals.Shortfalls) > 0 {
+		f := pr.totals.Shortfalls[0]
+		return 0, fmt.Errorf("%w: product=%d requested=%d available=%d", ErrInsufficientStock, f.ProductID, f.Requested, f.Available)
+	}
+	// 4) сверяем с ценой, показанной в предпросмотре
+	if err = s.checkQuote(userID, opts.QuoteToken, pr); err != nil {
+		return 0, err
+	}
+	orderItems := pr.items
+	// 5) резервируем товары одним запросом
+	if err = s.repo.ReserveStock(ctx, tx, orderItems); err != nil {
+		return 0, fmt.Errorf("cannot reserve stock: %w", err)
 	}
 	// 6) создаем заказ
 	order := &Order{
-		UserID:      userID,
-		Status:      "new",
-		TotalAmount: totalAmount,
+		UserID:           userID,
+		Status:           "new",
+		Currency:         pr.currency,
+		ExchangeRates:    pr.rates.Used(),
+		SubtotalAmount:   pr.totals.Subtotal,
+		TaxAmount:        pr.totals.Tax,
+		TotalAmount:      pr.total,
+		ShippingMethodID: pr.shippingMethodID,
+		ShippingAmount:   pr.shippingAmount,
+		ShippingAddress:  pr.address,
 	}
 	orderID, err := s.repo.CreateOrder(ctx, tx, order)
 	if err != nil {
@@ -95,26 +103,147 @@ func (s *service) CreateFromCart(ctx context.Context, userID int64, idemKey stri
 	if err = s.repo.BulkInsertItems(ctx, tx, orderID, orderItems); err != nil {
 		return 0, fmt.Errorf("cannot insert order items: %w", err)
 	}
-	// 8) очищаем корзину
+	// 8) пишем начальную запись в историю статусов и событие order.created
+	if err = s.repo.AddStatusHistory(ctx, tx, &StatusChange{
+		OrderID:  orderID,
+		ToStatus: order.Status,
+		ActorID:  ActorRef(userID),
+		Reason:   "order created",
+	}); err != nil {
+		return 0, fmt.Errorf("cannot write status history: %w", err)
+	}
+	event, err := outbox.NewEvent(AggregateOrder, orderID, EventOrderCreated, EventPayload{
+		OrderID:     orderID,
+		UserID:      userID,
+		Status:      order.Status,
+		TotalAmount: pr.total,
+		Currency:    pr.currency,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("cannot build event: %w", err)
+	}
+	if err = s.repo.AddOutboxEvent(ctx, tx, event); err != nil {
+		return 0, fmt.Errorf("cannot write outbox event: %w", err)
+	}
+
+	// 9) очищаем корзину
 	if err = s.repo.ClearCart(ctx, tx, userID); err != nil {
 		return 0, fmt.Errorf("cannot clear cart: %w", err)
 	}
-	// 9) коммитим транзакцию
+	// 10) коммитим транзакцию
 	if err = tx.Commit(); err != nil {
 		return 0, fmt.Errorf("cannot commit tx: %w", err)
 	}
-	if idemKey != "" && s.idemRepo != nil {
-		if err = s.idemRepo.SaveIdempotentResult(ctx, idemKey, http.StatusCreated, orderID); err != nil {
-			return 0, fmt.Errorf("cannot save idempotent result: %w", err)
+	return orderID, nil
+}
+
+// ShippingOptions возвращает способы доставки текущей корзины на выбранный адрес.
+func (s *service) ShippingOptions(ctx context.Context, userID, addressID int64) ([]shipping.Option, error) {
+	if s.shipping == nil {
+		return []shipping.Option{}, nil
+	}
+	lines, err := s.cartLines(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := s.cartCurrency(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	rates, err := s.rateTable(ctx)
+	if err != nil {
+		return nil, err
+	}
+	_, totals, err := s.cartItems(ctx, lines, cur, rates, nil)
+	if err != nil {
+		return nil, err
+	}
+	address, err := s.shippingAddress(ctx, userID, addressID, true)
+	if err != nil {
+		return nil, err
+	}
+	// тарифы в базовой валюте, цены вариантов — в валюте корзины
+	gross, err := rates.Convert(totals.Gross(), cur, currency.Base)
+	if err != nil {
+		return nil, fmt.Errorf("cannot convert cart total: %w", err)
+	}
+	options, err := s.shipping.Options(ctx, address.Country, totals.WeightGrams, gross)
+	if err != nil {
+		return nil, err
+	}
+	for i := range options {
+		if options[i].Price, err = rates.Convert(options[i].Price, currency.Base, cur); err != nil {
+			return nil, fmt.Errorf("cannot convert shipping price: %w", err)
 		}
 	}
-	return orderID, nil
+	return options, nil
 }
 
-func (s *service) ListOrders(ctx context.Context, userID int64, offset, limit int) ([]*Order, error) {
-	return s.repo.GetUserOrders(ctx, userID, offset, limit)
+func (s *service) ListOrders(ctx context.Context, userID int64, filter ListFilter) (*OrderPage, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+	limit := filter.Limit
+	// запрашиваем на одну запись больше, чтобы понять, есть ли следующая страница
+	filter.Limit++
+	orders, err := s.repo.GetUserOrders(ctx, userID, filter)
+	if err != nil {
+		return nil, err
+	}
+	page := &OrderPage{Items: orders}
+	if len(orders) > limit {
+		page.Items = orders[:limit]
+		last := page.Items[limit-1]
+		page.NextCursor = Cursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+	if page.Items == nil {
+		page.Items = []*Order{}
+	}
+	return page, nil
 }
 
 func (s *service) GetOrder(ctx context.Context, userID, orderID int64) (*Order, error) {
 	return s.repo.GetOrderWithItems(ctx, userID, orderID)
 }
+
+func (s *service) GetOrderHistory(ctx context.Context, userID, orderID int64) ([]StatusChange, error) {
+	if _, err := s.repo.GetOrderWithItems(ctx, userID, orderID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrOrderNotFound
+		}
+		return nil, err
+	}
+	return s.repo.GetStatusHistory(ctx, orderID)
+}
+
+// maxStatusBacklog ограничивает догрузку событий после переподключения.
+const maxStatusBacklog = 500
+
+// statusResumeWindow — на сколько id ниже Last-Event-ID перечитывается история при
+// переподключении: переход с меньшим id мог закоммититься уже после отправленного.
+// Повторы клиент отбрасывает по id события.
+const statusResumeWindow = 200
+
+func (s *service) SubscribeStatusEvents(ctx context.Context, userID, lastEventID int64) ([]StatusEvent, *Subscription, error) {
+	sub, err := s.hub.Subscribe(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if lastEventID <= 0 {
+		return nil, sub, nil
+	}
+	backlog, err := s.repo.GetStatusEventsSince(ctx, userID, max(lastEventID-statusResumeWindow, 0), maxStatusBacklog)
+	if err != nil {
+		sub.Close()
+		return nil, nil, err
+	}
+	return backlog, sub, nil
+}
+
+// ActorRef возвращает ссылку на автора перехода; 0 означает системное действие.
+func ActorRef(userID int64) *int64 {
+	if userID == 0 {
+		return nil
+	}
+	return &userID
+}
@@ -2,9 +2,15 @@ package order
 
 import (
 	"context"
+	"database/sql"
 	"errors"
-	"net/http"
+	"marketplace/internal/cart"
+	"marketplace/internal/currency"
+	"marketplace/internal/outbox"
+	"marketplace/internal/shipping"
+	"marketplace/internal/tax"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -38,16 +44,59 @@ func (m *mockRepo) GetCartItemsForUser(ctx context.Context, userID int64) ([]Car
 	return args.Get(0).([]CartItemLite), args.Error(1)
 }
 
-func (m *mockRepo) GetProductsPrices(ctx context.Context, productIDs []int64) (map[int64]int64, error) {
+func (m *mockRepo) GetCartCurrency(ctx context.Context, userID int64) (string, error) {
+	args := m.Called(ctx, userID)
+	return args.String(0), args.Error(1)
+}
+
+func (m *mockRepo) GetShippingAddress(ctx context.Context, userID, addressID int64) (*ShippingAddress, error) {
+	args := m.Called(ctx, userID, addressID)
+	if a, ok := args.Get(0).(*ShippingAddress); ok {
+		return a, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *mockRepo) GetProductsForOrder(ctx context.Context, productIDs []int64) (map[int64]ProductSnapshot, error) {
 	args := m.Called(ctx, productIDs)
-	return args.Get(0).(map[int64]int64), args.Error(1)
+	return args.Get(0).(map[int64]ProductSnapshot), args.Error(1)
+}
+
+func (m *mockRepo) LockProductsForOrder(ctx context.Context, tx Tx, productIDs []int64) (map[int64]ProductSnapshot, error) {
+	args := m.Called(ctx, tx, productIDs)
+	return args.Get(0).(map[int64]ProductSnapshot), args.Error(1)
+}
+
+func (m *mockRepo) ReserveStock(ctx context.Context, tx Tx, items []OrderItem) error {
+	args := m.Called(ctx, tx, items)
+	return args.Error(0)
+}
+
+func (m *mockRepo) RestoreStock(ctx context.Context, tx Tx, orderID int64) error {
+	args := m.Called(ctx, tx, orderID)
+	return args.Error(0)
 }
 
-func (m *mockRepo) DecrementStock(ctx context.Context, tx Tx, productID int64, quantity int) error {
-	args := m.Called(ctx, tx, productID, quantity)
+func (m *mockRepo) CompensatePayment(ctx context.Context, tx Tx, orderID int64, reason string) error {
+	args := m.Called(ctx, tx, orderID, reason)
 	return args.Error(0)
 }
 
+func (m *mockRepo) ExpirePaymentIntents(ctx context.Context, tx Tx, orderID int64) error {
+	args := m.Called(ctx, tx, orderID)
+	return args.Error(0)
+}
+
+func (m *mockRepo) ReleaseWalletPayments(ctx context.Context, tx Tx, orderID int64) error {
+	args := m.Called(ctx, tx, orderID)
+	return args.Error(0)
+}
+
+func (m *mockRepo) ClaimExpiredOrders(ctx context.Context, tx Tx, ttl time.Duration, limit int) ([]int64, error) {
+	args := m.Called(ctx, tx, ttl, limit)
+	return args.Get(0).([]int64), args.Error(1)
+}
+
 func (m *mockRepo) CreateOrder(ctx context.Context, tx Tx, order *Order) (int64, error) {
 	args := m.Called(ctx, tx, order)
 	return args.Get(0).(int64), args.Error(1)
@@ -63,8 +112,8 @@ func (m *mockRepo) ClearCart(ctx context.Context, tx Tx, userID int64) error {
 	return args.Error(0)
 }
 
-func (m *mockRepo) GetUserOrders(ctx context.Context, userID int64, offset, limit int) ([]*Order, error) {
-	args := m.Called(ctx, userID, offset, limit)
+func (m *mockRepo) GetUserOrders(ctx context.Context, userID int64, filter ListFilter) ([]*Order, error) {
+	args := m.Called(ctx, userID, filter)
 	return args.Get(0).([]*Order), args.Error(1)
 }
 func (m *mockRepo) GetOrderWithItems(ctx context.Context, userID, orderID int64) (*Order, error) {
@@ -72,27 +121,70 @@ func (m *mockRepo) GetOrderWithItems(ctx context.Context, userID, orderID int64)
 	return args.Get(0).(*Order), args.Error(1)
 }
 
+func (m *mockRepo) GetAllOrders(ctx context.Context, offset, limit int) ([]*Order, error) {
+	args := m.Called(ctx, offset, limit)
+	return args.Get(0).([]*Order), args.Error(1)
+}
+
+func (m *mockRepo) GetOrderByID(ctx context.Context, orderID int64) (*Order, error) {
+	args := m.Called(ctx, orderID)
+	if o, ok := args.Get(0).(*Order); ok {
+		return o, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
 func (m *mockRepo) GetOrderStatus(ctx context.Context, orderID int64) (string, error) {
 	args := m.Called(ctx, orderID)
 	return args.String(0), args.Error(1)
 }
 
-func (m *mockRepo) UpdateOrderStatus(ctx context.Context, orderID int64, from, to string) error {
-	args := m.Called(ctx, orderID, from, to)
+func (m *mockRepo) UpdateOrderStatus(ctx context.Context, tx Tx, orderID int64, from, to string) error {
+	args := m.Called(ctx, tx, orderID, from, to)
+	return args.Error(0)
+}
+
+func (m *mockRepo) AddStatusHistory(ctx context.Context, tx Tx, change *StatusChange) error {
+	args := m.Called(ctx, tx, change)
 	return args.Error(0)
 }
 
-type mockIdemRepo struct {
+func (m *mockRepo) AddOutboxEvent(ctx context.Context, tx Tx, event outbox.Event) error {
+	args := m.Called(ctx, tx, event)
+	return args.Error(0)
+}
+
+func (m *mockRepo) GetStatusHistory(ctx context.Context, orderID int64) ([]StatusChange, error) {
+	args := m.Called(ctx, orderID)
+	return args.Get(0).([]StatusChange), args.Error(1)
+}
+
+func (m *mockRepo) GetStatusEventsSince(ctx context.Context, userID, afterID int64, limit int) ([]StatusEvent, error) {
+	args := m.Called(ctx, userID, afterID, limit)
+	return args.Get(0).([]StatusEvent), args.Error(1)
+}
+
+type mockShipping struct {
 	mock.Mock
 }
 
-func (m *mockIdemRepo) TryStartIdempotent(ctx context.Context, userID int64, key string, reqHash string) (ok bool, savedStatus int, savedOrderID int64, err error) {
-	args := m.Called(ctx, userID, key, reqHash)
-	return args.Get(0).(bool), args.Get(1).(int), args.Get(2).(int64), args.Error(3)
+func (m *mockShipping) Options(ctx context.Context, country string, weightGrams int, subtotal int64) ([]shipping.Option, error) {
+	args := m.Called(ctx, country, weightGrams, subtotal)
+	return args.Get(0).([]shipping.Option), args.Error(1)
 }
-func (m *mockIdemRepo) SaveIdempotentResult(ctx context.Context, key string, status int, orderID int64) error {
-	args := m.Called(ctx, key, status, orderID)
-	return args.Error(0)
+func (m *mockShipping) Quote(ctx context.Context, methodID int64, country string, weightGrams int, subtotal int64) (shipping.Option, error) {
+	args := m.Called(ctx, methodID, country, weightGrams, subtotal)
+	return args.Get(0).(shipping.Option), args.Error(1)
+}
+
+var testAddress = &ShippingAddress{
+	AddressID:     3,
+	RecipientName: "Ivan Ivanov",
+	Phone:         "+79990000000",
+	Country:       "RU",
+	City:          "Moscow",
+	PostalCode:    "101000",
+	Line1:         "Tverskaya 1",
 }
 
 func anyTx() any {
@@ -104,30 +196,41 @@ func anyTx() any {
 func TestCreateFromCart_Success_NoIdempotency(t *testing.T) {
 	ctx := context.Background()
 	repo := new(mockRepo)
-	idem := new(mockIdemRepo)
-	svc := NewService(repo, idem)
+	svc := NewService(repo)
 
 	userID := int64(1)
 	items := []CartItemLite{{ProductID: 10, Quantity: 2}, {ProductID: 20, Quantity: 1}}
-	prices := map[int64]int64{10: 1000, 20: 2000}
+	products := map[int64]ProductSnapshot{
+		10: {ID: 10, Currency: "RUB", Name: "Phone", Price: 1000, CategoryID: 1, CategoryName: "Electronics", Stock: 10},
+		20: {ID: 20, Currency: "RUB", Name: "Case", Price: 2000, CategoryID: 2, CategoryName: "Accessories", Stock: 10},
+	}
 	orderID := int64(777)
 
 	tx := new(mockTx)
 
+	repo.On("GetCartCurrency", ctx, userID).Return("", nil).Maybe()
 	repo.On("GetCartItemsForUser", ctx, userID).Return(items, nil)
-	repo.On("GetProductsPrices", ctx, []int64{10, 20}).Return(prices, nil)
+	repo.On("LockProductsForOrder", ctx, tx, []int64{10, 20}).Return(products, nil)
+	repo.On("GetShippingAddress", ctx, userID, int64(0)).Return(testAddress, nil)
 	repo.On("BeginTx", ctx).Return(tx, nil)
-	repo.On("DecrementStock", ctx, tx, int64(10), 2).Return(nil)
-	repo.On("DecrementStock", ctx, tx, int64(20), 1).Return(nil)
+	repo.On("ReserveStock", ctx, tx, mock.Anything).Return(nil)
 	repo.On("CreateOrder", ctx, tx, mock.MatchedBy(func(o *Order) bool {
-		return o.UserID == userID && o.Status == "new" && o.TotalAmount == 4000
+		return o.UserID == userID && o.Status == "new" && o.TotalAmount == 4000 && o.ShippingAddress == testAddress
 	})).Return(orderID, nil)
-	repo.On("BulkInsertItems", ctx, tx, orderID, mock.Anything).Return(nil)
+	repo.On("BulkInsertItems", ctx, tx, orderID, mock.MatchedBy(func(items []OrderItem) bool {
+		return len(items) == 2 &&
+			items[0].ProductName == "Phone" && items[0].CategoryName == "Electronics" &&
+			items[1].ProductName == "Case" && items[1].CategoryID == 2
+	})).Return(nil)
+	repo.On("AddStatusHistory", ctx, tx, mock.Anything).Return(nil)
+	repo.On("AddOutboxEvent", ctx, tx, mock.MatchedBy(func(e outbox.Event) bool {
+		return e.EventType == EventOrderCreated && e.AggregateID == orderID
+	})).Return(nil)
 	repo.On("ClearCart", ctx, tx, userID).Return(nil)
 	tx.On("Rollback").Return(nil)
 	tx.On("Commit").Return(nil)
 
-	gotID, err := svc.CreateFromCart(ctx, userID, "")
+	gotID, err := svc.CreateFromCart(ctx, userID, CheckoutOptions{})
 	assert.NoError(t, err)
 	assert.Equal(t, orderID, gotID)
 
@@ -135,126 +238,631 @@ func TestCreateFromCart_Success_NoIdempotency(t *testing.T) {
 	tx.AssertExpectations(t)
 }
 
-func TestCreateFromCart_Success_WithIdempotency_FirstCall(t *testing.T) {
+func TestCreateFromCart_EmptyCart_Error(t *testing.T) {
 	ctx := context.Background()
 	repo := new(mockRepo)
-	idem := new(mockIdemRepo)
-	svc := NewService(repo, idem)
+	svc := NewService(repo)
 
 	userID := int64(1)
-	idemKey := "abc-123"
 
+	repo.On("GetCartCurrency", ctx, userID).Return("", nil).Maybe()
+	repo.On("GetCartItemsForUser", ctx, userID).Return([]CartItemLite{}, nil)
+
+	gotID, err := svc.CreateFromCart(ctx, userID, CheckoutOptions{})
+	assert.ErrorIs(t, err, ErrEmptyCart)
+	assert.Equal(t, int64(0), gotID)
+
+	repo.AssertExpectations(t)
+}
+
+func TestCreateFromCart_StockNotEnough_Error(t *testing.T) {
+	ctx := context.Background()
+	repo := new(mockRepo)
+	svc := NewService(repo)
+
+	userID := int64(1)
 	items := []CartItemLite{{ProductID: 10, Quantity: 2}, {ProductID: 20, Quantity: 1}}
-	prices := map[int64]int64{10: 1000, 20: 2000}
-	orderID := int64(555)
+	products := map[int64]ProductSnapshot{
+		10: {ID: 10, Currency: "RUB", Name: "Phone", Price: 1000, CategoryID: 1, CategoryName: "Electronics", Stock: 1},
+		20: {ID: 20, Currency: "RUB", Name: "Case", Price: 2000, CategoryID: 2, CategoryName: "Accessories", Stock: 10},
+	}
+	tx := new(mockTx)
+
+	repo.On("GetCartCurrency", ctx, userID).Return("", nil).Maybe()
+	repo.On("GetCartItemsForUser", ctx, userID).Return(items, nil)
+	repo.On("LockProductsForOrder", ctx, tx, []int64{10, 20}).Return(products, nil)
+	repo.On("GetShippingAddress", ctx, userID, int64(0)).Return(testAddress, nil)
+	repo.On("BeginTx", ctx).Return(tx, nil)
+
+	tx.On("Rollback").Return(nil)
+
+	gotID, err := svc.CreateFromCart(ctx, userID, CheckoutOptions{})
+	assert.ErrorIs(t, err, ErrInsufficientStock)
+	assert.Equal(t, int64(0), gotID)
+	repo.AssertNotCalled(t, "ReserveStock", mock.Anything, mock.Anything, mock.Anything)
+
+	repo.AssertExpectations(t)
+	tx.AssertExpectations(t)
+}
+
+func TestShip_InvalidTransition(t *testing.T) {
+	ctx := context.Background()
+	repo := new(mockRepo)
+	svc := NewService(repo)
+
+	repo.On("GetOrderStatus", ctx, int64(7)).Return(StatusNew, nil)
+
+	err := svc.Ship(ctx, 7, 1, "")
+	assert.True(t, errors.Is(err, ErrInvalidStatusTransition))
+
+	repo.AssertExpectations(t)
+}
+
+func TestShip_Success(t *testing.T) {
+	ctx := context.Background()
+	repo := new(mockRepo)
+	svc := NewService(repo)
 
 	tx := new(mockTx)
 
-	idem.On("TryStartIdempotent", ctx, userID, idemKey, mock.AnythingOfType("string")).Return(true, 0, int64(0), nil)
+	repo.On("GetOrderStatus", ctx, int64(7)).Return(StatusPaid, nil)
+	repo.On("BeginTx", ctx).Return(tx, nil)
+	repo.On("UpdateOrderStatus", ctx, tx, int64(7), StatusPaid, StatusShipped).Return(nil)
+	repo.On("AddStatusHistory", ctx, tx, mock.MatchedBy(func(c *StatusChange) bool {
+		return c.OrderID == 7 && c.FromStatus == StatusPaid && c.ToStatus == StatusShipped &&
+			c.ActorID != nil && *c.ActorID == 1 && c.Reason == "handed to courier"
+	})).Return(nil)
+	repo.On("AddOutboxEvent", ctx, tx, mock.MatchedBy(func(e outbox.Event) bool {
+		return e.EventType == EventOrderShipped && e.AggregateID == 7
+	})).Return(nil)
+	tx.On("Rollback").Return(nil)
+	tx.On("Commit").Return(nil)
 
-	repo.On("GetCartItemsForUser", ctx, userID).Return(items, nil)
-	repo.On("GetProductsPrices", ctx, []int64{10, 20}).Return(prices, nil)
+	assert.NoError(t, svc.Ship(ctx, 7, 1, "handed to courier"))
+
+	repo.AssertExpectations(t)
+	tx.AssertExpectations(t)
+}
+
+func TestCancel_OrderNotFound(t *testing.T) {
+	ctx := context.Background()
+	repo := new(mockRepo)
+	svc := NewService(repo)
+
+	repo.On("GetOrderStatus", ctx, int64(7)).Return("", sql.ErrNoRows)
+
+	err := svc.Cancel(ctx, 7, 1, "")
+	assert.True(t, errors.Is(err, ErrOrderNotFound))
+
+	repo.AssertExpectations(t)
+}
+
+func TestCancel_Paid_RestoresStockReleasesWalletAndCompensates(t *testing.T) {
+	ctx := context.Background()
+	repo := new(mockRepo)
+	svc := NewService(repo)
+	tx := new(mockTx)
+
+	repo.On("GetOrderStatus", ctx, int64(7)).Return(StatusPaid, nil)
+	repo.On("BeginTx", ctx).Return(tx, nil)
+	repo.On("UpdateOrderStatus", ctx, tx, int64(7), StatusPaid, StatusCancelled).Return(nil)
+	repo.On("AddStatusHistory", ctx, tx, mock.Anything).Return(nil)
+	repo.On("AddOutboxEvent", ctx, tx, mock.Anything).Return(nil)
+	repo.On("RestoreStock", ctx, tx, int64(7)).Return(nil)
+	repo.On("ExpirePaymentIntents", ctx, tx, int64(7)).Return(nil)
+	// оплата из кошелька возвращается до компенсации остальных платежей
+	release := repo.On("ReleaseWalletPayments", ctx, tx, int64(7)).Return(nil)
+	repo.On("CompensatePayment", ctx, tx, int64(7), "out of stock").Return(nil).NotBefore(release)
+	tx.On("Rollback").Return(nil)
+	tx.On("Commit").Return(nil)
+
+	assert.NoError(t, svc.Cancel(ctx, 7, 1, "out of stock"))
+
+	repo.AssertExpectations(t)
+	tx.AssertExpectations(t)
+}
+
+func TestCancel_ConcurrentCancel_DoesNotRestock(t *testing.T) {
+	ctx := context.Background()
+	repo := new(mockRepo)
+	svc := NewService(repo)
+	tx := new(mockTx)
+
+	repo.On("GetOrderStatus", ctx, int64(7)).Return(StatusNew, nil)
+	repo.On("BeginTx", ctx).Return(tx, nil)
+	repo.On("UpdateOrderStatus", ctx, tx, int64(7), StatusNew, StatusCancelled).Return(sql.ErrNoRows)
+	tx.On("Rollback").Return(nil)
+
+	err := svc.Cancel(ctx, 7, 1, "")
+	assert.True(t, errors.Is(err, ErrInvalidStatusTransition))
+
+	repo.AssertNotCalled(t, "RestoreStock", mock.Anything, mock.Anything, mock.Anything)
+	repo.AssertExpectations(t)
+	tx.AssertExpectations(t)
+}
+
+func TestCancel_AlreadyCancelled_DoesNotRestock(t *testing.T) {
+	ctx := context.Background()
+	repo := new(mockRepo)
+	svc := NewService(repo)
+
+	// повторная отмена или отмена, прочитавшая статус после параллельной
+	repo.On("GetOrderStatus", ctx, int64(7)).Return(StatusCancelled, nil)
+
+	err := svc.Cancel(ctx, 7, 1, "")
+	assert.ErrorIs(t, err, ErrInvalidStatusTransition)
+
+	repo.AssertNotCalled(t, "UpdateOrderStatus", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	repo.AssertNotCalled(t, "RestoreStock", mock.Anything, mock.Anything, mock.Anything)
+	repo.AssertExpectations(t)
+}
+
+func TestExpireUnpaidOrders(t *testing.T) {
+	ctx := context.Background()
+	repo := new(mockRepo)
+	svc := NewService(repo)
+	tx := new(mockTx)
+
+	repo.On("BeginTx", ctx).Return(tx, nil)
+	repo.On("ClaimExpiredOrders", ctx, tx, time.Minute, 10).Return([]int64{3, 4}, nil)
+	for _, id := range []int64{3, 4} {
+		repo.On("UpdateOrderStatus", ctx, tx, id, StatusAwaitingPayment, StatusCancelled).Return(nil)
+		repo.On("RestoreStock", ctx, tx, id).Return(nil)
+		repo.On("ExpirePaymentIntents", ctx, tx, id).Return(nil)
+		repo.On("ReleaseWalletPayments", ctx, tx, id).Return(nil)
+	}
+	repo.On("AddStatusHistory", ctx, tx, mock.MatchedBy(func(c *StatusChange) bool {
+		return c.ActorID == nil && c.ToStatus == StatusCancelled
+	})).Return(nil)
+	repo.On("AddOutboxEvent", ctx, tx, mock.MatchedBy(func(e outbox.Event) bool {
+		return e.EventType == EventOrderCancelled
+	})).Return(nil)
+	tx.On("Rollback").Return(nil)
+	tx.On("Commit").Return(nil)
+
+	n, err := svc.ExpireUnpaidOrders(ctx, time.Minute, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	repo.AssertNotCalled(t, "CompensatePayment", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	repo.AssertExpectations(t)
+	tx.AssertExpectations(t)
+}
+
+func TestListOrders_ReturnsNextCursor(t *testing.T) {
+	ctx := context.Background()
+	repo := new(mockRepo)
+	svc := NewService(repo)
+
+	now := time.Now().UTC()
+	orders := []*Order{
+		{ID: 3, CreatedAt: now},
+		{ID: 2, CreatedAt: now.Add(-time.Minute)},
+		{ID: 1, CreatedAt: now.Add(-2 * time.Minute)},
+	}
+	repo.On("GetUserOrders", ctx, int64(1), mock.MatchedBy(func(f ListFilter) bool {
+		return f.Limit == 3 && f.Status == StatusPaid
+	})).Return(orders, nil)
+
+	page, err := svc.ListOrders(ctx, 1, ListFilter{Status: StatusPaid, Sort: SortCreatedDesc, Limit: 2})
+	assert.NoError(t, err)
+	assert.Len(t, page.Items, 2)
+
+	cursor, err := DecodeCursor(page.NextCursor)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), cursor.ID)
+	assert.True(t, cursor.CreatedAt.Equal(orders[1].CreatedAt))
+
+	repo.AssertExpectations(t)
+}
+
+func TestListOrders_InvalidStatus(t *testing.T) {
+	svc := NewService(new(mockRepo))
+
+	_, err := svc.ListOrders(context.Background(), 1, ListFilter{Status: "lost", Sort: SortCreatedDesc, Limit: 10})
+	assert.Error(t, err)
+}
+
+func TestCreateFromCart_AddressNotFound(t *testing.T) {
+	ctx := context.Background()
+	repo := new(mockRepo)
+	svc := NewService(repo)
+	userID := int64(1)
+
+	repo.On("GetCartCurrency", ctx, userID).Return("", nil).Maybe()
+	repo.On("GetCartItemsForUser", ctx, userID).Return([]CartItemLite{{ProductID: 10, Quantity: 1}}, nil)
+	repo.On("GetShippingAddress", ctx, userID, int64(99)).Return(nil, ErrAddressNotFound)
+
+	_, err := svc.CreateFromCart(ctx, userID, CheckoutOptions{AddressID: 99})
+	assert.True(t, errors.Is(err, ErrAddressNotFound))
+
+	repo.AssertNotCalled(t, "BeginTx", mock.Anything)
+	repo.AssertExpectations(t)
+}
+
+func TestCreateFromCart_WithoutDefaultAddress(t *testing.T) {
+	ctx := context.Background()
+	repo := new(mockRepo)
+	tx := new(mockTx)
+	svc := NewService(repo)
+	userID, orderID := int64(1), int64(777)
+
+	repo.On("GetCartCurrency", ctx, userID).Return("", nil).Maybe()
+	repo.On("GetCartItemsForUser", ctx, userID).Return([]CartItemLite{{ProductID: 10, Quantity: 1}}, nil)
+	// клиент не знает про адресную книгу: заказ оформляется, как раньше, без адреса
+	repo.On("GetShippingAddress", ctx, userID, int64(0)).Return(nil, ErrAddressNotFound)
 	repo.On("BeginTx", ctx).Return(tx, nil)
-	repo.On("DecrementStock", ctx, tx, int64(10), 2).Return(nil)
-	repo.On("DecrementStock", ctx, tx, int64(20), 1).Return(nil)
+	repo.On("LockProductsForOrder", ctx, tx, []int64{10}).Return(map[int64]ProductSnapshot{
+		10: {ID: 10, Currency: "RUB", Name: "Phone", Price: 1000, Stock: 10},
+	}, nil)
+	repo.On("ReserveStock", ctx, tx, mock.Anything).Return(nil)
 	repo.On("CreateOrder", ctx, tx, mock.MatchedBy(func(o *Order) bool {
-		return o.UserID == userID && o.TotalAmount == 4000
+		return o.ShippingAddress == nil
 	})).Return(orderID, nil)
 	repo.On("BulkInsertItems", ctx, tx, orderID, mock.Anything).Return(nil)
+	repo.On("AddStatusHistory", ctx, tx, mock.Anything).Return(nil)
+	repo.On("AddOutboxEvent", ctx, tx, mock.Anything).Return(nil)
 	repo.On("ClearCart", ctx, tx, userID).Return(nil)
 	tx.On("Rollback").Return(nil)
 	tx.On("Commit").Return(nil)
 
-	idem.On("SaveIdempotentResult", ctx, idemKey, http.StatusCreated, orderID).Return(nil)
-
-	gotID, err := svc.CreateFromCart(ctx, userID, idemKey)
+	gotID, err := svc.CreateFromCart(ctx, userID, CheckoutOptions{})
 	assert.NoError(t, err)
 	assert.Equal(t, orderID, gotID)
-
 	repo.AssertExpectations(t)
-	idem.AssertExpectations(t)
-	tx.AssertExpectations(t)
 }
 
-func TestCreateFromCart_SecondCall_ReturnsSaved(t *testing.T) {
+func TestCreateFromCart_AddressRequired(t *testing.T) {
 	ctx := context.Background()
 	repo := new(mockRepo)
-	idem := new(mockIdemRepo)
-	svc := NewService(repo, idem)
+	svc := NewService(repo, WithAddressRequired(true))
+	userID := int64(1)
+
+	repo.On("GetCartCurrency", ctx, userID).Return("", nil).Maybe()
+	repo.On("GetCartItemsForUser", ctx, userID).Return([]CartItemLite{{ProductID: 10, Quantity: 1}}, nil)
+	repo.On("GetShippingAddress", ctx, userID, int64(0)).Return(nil, ErrAddressNotFound)
 
+	_, err := svc.CreateFromCart(ctx, userID, CheckoutOptions{})
+	assert.ErrorIs(t, err, ErrAddressNotFound)
+	repo.AssertNotCalled(t, "BeginTx", mock.Anything)
+}
+
+func TestCreateFromCart_AddsShippingAmount(t *testing.T) {
+	ctx := context.Background()
+	repo := new(mockRepo)
+	ship := new(mockShipping)
+	svc := NewService(repo, WithShipping(ship))
 	userID := int64(1)
-	idemKey := "abc-123"
-	orderID := int64(555)
+	orderID := int64(42)
+	tx := new(mockTx)
 
-	idem.On("TryStartIdempotent", ctx, userID, idemKey, mock.AnythingOfType("string")).Return(false, http.StatusCreated, orderID, nil)
+	repo.On("GetCartCurrency", ctx, userID).Return("", nil).Maybe()
+	repo.On("GetCartItemsForUser", ctx, userID).Return([]CartItemLite{{ProductID: 10, Quantity: 3}}, nil)
+	repo.On("LockProductsForOrder", ctx, tx, []int64{10}).Return(map[int64]ProductSnapshot{
+		10: {ID: 10, Currency: "RUB", Price: 1000, WeightGrams: 250, Stock: 10},
+	}, nil)
+	repo.On("GetShippingAddress", ctx, userID, int64(0)).Return(testAddress, nil)
+	ship.On("Quote", ctx, int64(5), "RU", 750, int64(3000)).
+		Return(shipping.Option{MethodID: 5, Name: "Courier", Price: 350}, nil)
+	repo.On("BeginTx", ctx).Return(tx, nil)
+	repo.On("ReserveStock", ctx, tx, mock.Anything).Return(nil)
+	repo.On("CreateOrder", ctx, tx, mock.MatchedBy(func(o *Order) bool {
+		return o.TotalAmount == 3350 && o.ShippingAmount == 350 &&
+			o.ShippingMethodID != nil && *o.ShippingMethodID == 5
+	})).Return(orderID, nil)
+	repo.On("BulkInsertItems", ctx, tx, orderID, mock.Anything).Return(nil)
+	repo.On("AddStatusHistory", ctx, tx, mock.Anything).Return(nil)
+	repo.On("AddOutboxEvent", ctx, tx, mock.Anything).Return(nil)
+	repo.On("ClearCart", ctx, tx, userID).Return(nil)
+	tx.On("Rollback").Return(nil)
+	tx.On("Commit").Return(nil)
 
-	gotID, err := svc.CreateFromCart(ctx, userID, idemKey)
+	gotID, err := svc.CreateFromCart(ctx, userID, CheckoutOptions{ShippingMethodID: 5})
 	assert.NoError(t, err)
 	assert.Equal(t, orderID, gotID)
 
-	idem.AssertExpectations(t)
 	repo.AssertExpectations(t)
+	ship.AssertExpectations(t)
 }
 
-func TestCreateFromCart_Conflict_WhenKeyBusyWithoutResult(t *testing.T) {
+func TestCreateFromCart_ShippingMethodRequired(t *testing.T) {
 	ctx := context.Background()
 	repo := new(mockRepo)
-	idem := new(mockIdemRepo)
-	svc := NewService(repo, idem)
+	svc := NewService(repo, WithShipping(new(mockShipping)))
+	userID := int64(1)
+
+	repo.On("GetCartCurrency", ctx, userID).Return("", nil).Maybe()
+	repo.On("GetCartItemsForUser", ctx, userID).Return([]CartItemLite{{ProductID: 10, Quantity: 1}}, nil)
+	repo.On("GetProductsForOrder", ctx, []int64{10}).Return(map[int64]ProductSnapshot{10: {ID: 10, Currency: "RUB", Price: 100}}, nil)
+	repo.On("GetShippingAddress", ctx, userID, int64(0)).Return(testAddress, nil)
 
+	_, err := svc.CreateFromCart(ctx, userID, CheckoutOptions{})
+	assert.True(t, errors.Is(err, ErrShippingRequired))
+	repo.AssertNotCalled(t, "BeginTx", mock.Anything)
+}
+
+func TestCreateFromCart_ComputesTax(t *testing.T) {
+	ctx := context.Background()
+	repo := new(mockRepo)
+	svc := NewService(repo)
 	userID := int64(1)
-	idemKey := "abc-123"
+	orderID := int64(43)
+	tx := new(mockTx)
 
-	idem.On("TryStartIdempotent", ctx, userID, idemKey, mock.AnythingOfType("string")).Return(false, 0, int64(0), nil)
+	repo.On("GetCartCurrency", ctx, userID).Return("", nil).Maybe()
+	repo.On("GetCartItemsForUser", ctx, userID).Return([]CartItemLite{
+		{ProductID: 10, Quantity: 2}, {ProductID: 20, Quantity: 1},
+	}, nil)
+	repo.On("LockProductsForOrder", ctx, tx, []int64{10, 20}).Return(map[int64]ProductSnapshot{
+		// 2 × 120.00 с НДС 20%: налог 40.00
+		10: {ID: 10, Currency: "RUB", Price: 12000, VATRate: tax.Rate20, PriceIncludesTax: true, Stock: 10},
+		// 100.00 без НДС в цене, ставка 10%: налог 10.00 сверху
+		20: {ID: 20, Currency: "RUB", Price: 10000, VATRate: tax.Rate10, Stock: 10},
+	}, nil)
+	repo.On("GetShippingAddress", ctx, userID, int64(0)).Return(testAddress, nil)
+	repo.On("BeginTx", ctx).Return(tx, nil)
+	repo.On("ReserveStock", ctx, tx, mock.Anything).Return(nil)
+	repo.On("CreateOrder", ctx, tx, mock.MatchedBy(func(o *Order) bool {
+		return o.SubtotalAmount == 30000 && o.TaxAmount == 5000 && o.TotalAmount == 35000
+	})).Return(orderID, nil)
+	repo.On("BulkInsertItems", ctx, tx, orderID, mock.MatchedBy(func(items []OrderItem) bool {
+		return items[0].VATRate == tax.Rate20 && items[0].TaxAmount == 4000 &&
+			items[1].VATRate == tax.Rate10 && items[1].TaxAmount == 1000
+	})).Return(nil)
+	repo.On("AddStatusHistory", ctx, tx, mock.Anything).Return(nil)
+	repo.On("AddOutboxEvent", ctx, tx, mock.Anything).Return(nil)
+	repo.On("ClearCart", ctx, tx, userID).Return(nil)
+	tx.On("Rollback").Return(nil)
+	tx.On("Commit").Return(nil)
 
-	gotID, err := svc.CreateFromCart(ctx, userID, idemKey)
-	assert.Error(t, err)
-	assert.True(t, errors.Is(err, ErrIdempotencyConflict))
-	assert.Equal(t, int64(0), gotID)
+	_, err := svc.CreateFromCart(ctx, userID, CheckoutOptions{})
+	assert.NoError(t, err)
+	repo.AssertExpectations(t)
+}
+
+type stubRates []currency.Rate
 
-	idem.AssertExpectations(t)
+func (r stubRates) Table(ctx context.Context, at time.Time) (*currency.Table, error) {
+	return currency.NewTable(r), nil
+}
+
+func TestCreateFromCart_ConvertsToCartCurrencyAndLocksRates(t *testing.T) {
+	ctx := context.Background()
+	repo := new(mockRepo)
+	rates := stubRates{{ID: 5, Base: "USD", Quote: "RUB", Rate: "80"}}
+	svc := NewService(repo, WithRates(rates))
+	userID := int64(1)
+	orderID := int64(44)
+	tx := new(mockTx)
+
+	repo.On("GetCartCurrency", ctx, userID).Return("USD", nil)
+	repo.On("GetCartItemsForUser", ctx, userID).Return([]CartItemLite{{ProductID: 10, Quantity: 2}}, nil)
+	repo.On("LockProductsForOrder", ctx, tx, []int64{10}).Return(map[int64]ProductSnapshot{
+		// 800.00 руб. по 80 = 10.00 USD
+		10: {ID: 10, Currency: "RUB", Price: 80000, Stock: 10},
+	}, nil)
+	repo.On("GetShippingAddress", ctx, userID, int64(0)).Return(testAddress, nil)
+	repo.On("BeginTx", ctx).Return(tx, nil)
+	repo.On("ReserveStock", ctx, tx, mock.Anything).Return(nil)
+	repo.On("CreateOrder", ctx, tx, mock.MatchedBy(func(o *Order) bool {
+		return o.Currency == "USD" && o.TotalAmount == 2000 &&
+			len(o.ExchangeRates) == 1 && o.ExchangeRates[0].ID == 5
+	})).Return(orderID, nil)
+	repo.On("BulkInsertItems", ctx, tx, orderID, mock.MatchedBy(func(items []OrderItem) bool {
+		return items[0].Price == 1000 && items[0].CatalogPrice == 80000 && items[0].CatalogCurrency == "RUB"
+	})).Return(nil)
+	repo.On("AddStatusHistory", ctx, tx, mock.Anything).Return(nil)
+	repo.On("AddOutboxEvent", ctx, tx, mock.Anything).Return(nil)
+	repo.On("ClearCart", ctx, tx, userID).Return(nil)
+	tx.On("Rollback").Return(nil)
+	tx.On("Commit").Return(nil)
+
+	_, err := svc.CreateFromCart(ctx, userID, CheckoutOptions{})
+	assert.NoError(t, err)
 	repo.AssertExpectations(t)
 }
 
-func TestCreateFromCart_EmptyCart_Error(t *testing.T) {
+func TestCreateFromCart_NoRateForCartCurrency(t *testing.T) {
 	ctx := context.Background()
 	repo := new(mockRepo)
-	idem := new(mockIdemRepo)
-	svc := NewService(repo, idem)
+	svc := NewService(repo, WithRates(stubRates{}))
+	userID := int64(1)
+
+	repo.On("GetCartCurrency", ctx, userID).Return("EUR", nil)
+	repo.On("GetCartItemsForUser", ctx, userID).Return([]CartItemLite{{ProductID: 10, Quantity: 1}}, nil)
+	repo.On("GetProductsForOrder", ctx, []int64{10}).Return(map[int64]ProductSnapshot{
+		10: {ID: 10, Currency: "RUB", Price: 80000, Stock: 10},
+	}, nil).Maybe()
+	repo.On("GetShippingAddress", ctx, userID, int64(0)).Return(testAddress, nil).Maybe()
 
+	_, err := svc.Preview(ctx, userID, CheckoutOptions{})
+	assert.ErrorIs(t, err, currency.ErrRateNotFound)
+}
+
+func TestSubscribeStatusEvents_ReturnsBacklog(t *testing.T) {
+	ctx := context.Background()
+	repo := new(mockRepo)
+	hub := NewHub()
+	svc := NewService(repo, WithEventHub(hub))
 	userID := int64(1)
 
-	repo.On("GetCartItemsForUser", ctx, userID).Return([]CartItemLite{}, nil)
+	// 995 закоммитился позже 1000, которое клиент уже получил
+	missed := []StatusEvent{
+		{StatusChange: StatusChange{ID: 995, OrderID: 5, FromStatus: StatusNew, ToStatus: StatusAwaitingPayment}, UserID: userID},
+		{StatusChange: StatusChange{ID: 1000, OrderID: 6, FromStatus: StatusAwaitingPayment, ToStatus: StatusPaid}, UserID: userID},
+		{StatusChange: StatusChange{ID: 1001, OrderID: 5, FromStatus: StatusAwaitingPayment, ToStatus: StatusPaid}, UserID: userID},
+	}
+	repo.On("GetStatusEventsSince", ctx, userID, int64(1000-statusResumeWindow), maxStatusBacklog).Return(missed, nil)
 
-	gotID, err := svc.CreateFromCart(ctx, userID, "")
-	assert.Error(t, err)
-	assert.Equal(t, int64(0), gotID)
+	backlog, sub, err := svc.SubscribeStatusEvents(ctx, userID, 1000)
+	assert.NoError(t, err)
+	defer sub.Close()
+	assert.Equal(t, missed, backlog)
 
+	// подписка оформлена до чтения backlog и уже получает новые события
+	hub.Publish(StatusEvent{StatusChange: StatusChange{ID: 1002, OrderID: 5, ToStatus: StatusShipped}, UserID: userID})
+	e := <-sub.C
+	assert.Equal(t, int64(1002), e.ID)
+}
+
+func TestSubscribeStatusEvents_NoBacklogWithoutLastEventID(t *testing.T) {
+	repo := new(mockRepo)
+	svc := NewService(repo)
+
+	backlog, sub, err := svc.SubscribeStatusEvents(context.Background(), 1, 0)
+	assert.NoError(t, err)
+	defer sub.Close()
+	assert.Empty(t, backlog)
+	repo.AssertNotCalled(t, "GetStatusEventsSince", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+type mockCart struct {
+	mock.Mock
+}
+
+func (m *mockCart) AddItems(ctx context.Context, userID int64, items []cart.CartItem) ([]cart.AddedItem, error) {
+	args := m.Called(ctx, userID, items)
+	added, _ := args.Get(0).([]cart.AddedItem)
+	return added, args.Error(1)
+}
+
+func TestReorder_ReportsSkippedClampedAndPriceChanges(t *testing.T) {
+	ctx := context.Background()
+	repo := new(mockRepo)
+	carts := new(mockCart)
+	svc := NewService(repo, WithCart(carts))
+	userID, orderID := int64(1), int64(9)
+
+	repo.On("GetOrderWithItems", ctx, userID, orderID).Return(&Order{ID: orderID, UserID: userID, Items: []OrderItem{
+		{ProductID: 10, ProductName: "Phone", Quantity: 1, Price: 1000, CatalogPrice: 1000, CatalogCurrency: "RUB"},
+		{ProductID: 0, ProductName: "Deleted", Quantity: 1, Price: 500, CatalogPrice: 500, CatalogCurrency: "RUB"},
+		{ProductID: 20, ProductName: "Case", Quantity: 3, Price: 200, CatalogPrice: 200, CatalogCurrency: "RUB"},
+		{ProductID: 30, ProductName: "Cable", Quantity: 1, Price: 100, CatalogPrice: 100, CatalogCurrency: "RUB"},
+	}}, nil)
+	repo.On("GetProductsForOrder", ctx, []int64{10, 20, 30}).Return(map[int64]ProductSnapshot{
+		10: {ID: 10, Currency: "RUB", Price: 1000, Stock: 5},
+		20: {ID: 20, Currency: "RUB", Price: 250, Stock: 3},
+		30: {ID: 30, Currency: "RUB", Price: 100, Stock: 0},
+	}, nil)
+	// сколько положить, решает корзина: все позиции уходят в нее одним вызовом
+	carts.On("AddItems", ctx, userID, []cart.CartItem{
+		{ProductID: 10, Quantity: 1}, {ProductID: 0, Quantity: 1}, {ProductID: 20, Quantity: 3}, {ProductID: 30, Quantity: 1},
+	}).Return([]cart.AddedItem{
+		{ProductID: 10, Requested: 1, Quantity: 1},
+		{ProductID: 0, Requested: 1, Missing: true},
+		{ProductID: 20, Requested: 3, Quantity: 2},
+		{ProductID: 30, Requested: 1},
+	}, nil)
+
+	res, err := svc.Reorder(ctx, userID, orderID)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []ReorderLine{
+		{ProductID: 10, ProductName: "Phone", Requested: 1, Quantity: 1},
+		{ProductID: 20, ProductName: "Case", Requested: 3, Quantity: 2},
+	}, res.Added)
+	assert.Equal(t, []ReorderLine{
+		{ProductID: 0, ProductName: "Deleted", Requested: 1, Reason: SkipProductUnavailable},
+		{ProductID: 30, ProductName: "Cable", Requested: 1, Reason: SkipOutOfStock},
+	}, res.Skipped)
+	assert.Equal(t, []ReorderLine{
+		{ProductID: 20, ProductName: "Case", Requested: 3, Quantity: 2, Reason: ClampLimitedStock},
+	}, res.Clamped)
+	assert.Equal(t, []ReorderLine{
+		{ProductID: 20, ProductName: "Case", Requested: 3, Quantity: 2, OldPrice: 200, OldCurrency: "RUB", NewPrice: 250, NewCurrency: "RUB"},
+	}, res.PriceChanged)
 	repo.AssertExpectations(t)
+	carts.AssertExpectations(t)
 }
 
-func TestCreateFromCart_StockNotEnough_Error(t *testing.T) {
+func TestReorder_CartFailure(t *testing.T) {
+	ctx := context.Background()
+	repo := new(mockRepo)
+	carts := new(mockCart)
+	svc := NewService(repo, WithCart(carts))
+	userID, orderID := int64(1), int64(9)
+
+	repo.On("GetOrderWithItems", ctx, userID, orderID).Return(&Order{ID: orderID, UserID: userID, Items: []OrderItem{
+		{ProductID: 10, ProductName: "Phone", Quantity: 1, CatalogPrice: 1000, CatalogCurrency: "RUB"},
+	}}, nil)
+	repo.On("GetProductsForOrder", ctx, []int64{10}).Return(map[int64]ProductSnapshot{
+		10: {ID: 10, Currency: "RUB", Price: 1000, Stock: 3},
+	}, nil)
+	carts.On("AddItems", ctx, userID, mock.Anything).Return(nil, errors.New("db down"))
+
+	res, err := svc.Reorder(ctx, userID, orderID)
+	assert.Error(t, err)
+	assert.Nil(t, res)
+}
+
+func TestReorder_ForeignOrder(t *testing.T) {
 	ctx := context.Background()
 	repo := new(mockRepo)
-	idem := new(mockIdemRepo)
-	svc := NewService(repo, idem)
+	carts := new(mockCart)
+	svc := NewService(repo, WithCart(carts))
 
+	repo.On("GetOrderWithItems", ctx, int64(2), int64(9)).Return((*Order)(nil), sql.ErrNoRows)
+
+	_, err := svc.Reorder(ctx, 2, 9)
+	assert.ErrorIs(t, err, ErrOrderNotFound)
+	carts.AssertNotCalled(t, "AddItems", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestPreview_ReturnsLinesShortfallsAndToken(t *testing.T) {
+	ctx := context.Background()
+	repo := new(mockRepo)
+	svc := NewService(repo, WithQuotes(NewQuoteSigner([]byte("secret"), time.Minute), false))
 	userID := int64(1)
-	items := []CartItemLite{{ProductID: 10, Quantity: 2}, {ProductID: 20, Quantity: 1}}
-	prices := map[int64]int64{10: 1000, 20: 2000}
-	tx := new(mockTx)
 
-	repo.On("GetCartItemsForUser", ctx, userID).Return(items, nil)
-	repo.On("GetProductsPrices", ctx, []int64{10, 20}).Return(prices, nil)
-	repo.On("BeginTx", ctx).Return(tx, nil)
+	repo.On("GetCartCurrency", ctx, userID).Return("", nil).Maybe()
+	repo.On("GetCartItemsForUser", ctx, userID).Return([]CartItemLite{
+		{ProductID: 10, Quantity: 2}, {ProductID: 20, Quantity: 5},
+	}, nil)
+	repo.On("GetProductsForOrder", ctx, []int64{10, 20}).Return(map[int64]ProductSnapshot{
+		10: {ID: 10, Currency: "RUB", Name: "Phone", Price: 12000, VATRate: tax.Rate20, PriceIncludesTax: true, Stock: 10},
+		20: {ID: 20, Currency: "RUB", Name: "Case", Price: 500, Stock: 3},
+	}, nil)
+	repo.On("GetShippingAddress", ctx, userID, int64(0)).Return(testAddress, nil)
+
+	q, err := svc.Preview(ctx, userID, CheckoutOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, q.Lines, 2)
+	assert.Equal(t, int64(24000), q.Lines[0].Amount)
+	assert.Equal(t, int64(4000), q.TaxAmount)
+	assert.Equal(t, int64(26500), q.TotalAmount)
+	assert.Equal(t, []StockShortfall{{ProductID: 20, Requested: 5, Available: 3}}, q.Shortfalls)
+	assert.NotEmpty(t, q.Token)
+	// предпросмотр ничего не пишет
+	repo.AssertNotCalled(t, "BeginTx", mock.Anything)
+}
 
-	repo.On("DecrementStock", ctx, tx, int64(10), 2).Return(errors.New("not enough stock"))
-	tx.On("Rollback").Return(nil)
+func TestCreateFromCart_QuoteMismatch(t *testing.T) {
+	ctx := context.Background()
+	repo := new(mockRepo)
+	svc := NewService(repo, WithQuotes(NewQuoteSigner([]byte("secret"), time.Minute), true))
+	userID := int64(1)
 
-	gotID, err := svc.CreateFromCart(ctx, userID, "")
-	assert.Error(t, err)
-	assert.Equal(t, int64(0), gotID)
+	repo.On("GetCartCurrency", ctx, userID).Return("", nil).Maybe()
+	repo.On("GetCartItemsForUser", ctx, userID).Return([]CartItemLite{{ProductID: 10, Quantity: 1}}, nil)
+	repo.On("GetProductsForOrder", ctx, []int64{10}).Return(map[int64]ProductSnapshot{
+		10: {ID: 10, Currency: "RUB", Price: 1000, Stock: 5},
+	}, nil)
+	repo.On("GetShippingAddress", ctx, userID, int64(0)).Return(testAddress, nil)
 
-	repo.AssertExpectations(t)
-	tx.AssertExpectations(t)
+	q, err := svc.Preview(ctx, userID, CheckoutOptions{})
+	assert.NoError(t, err)
+
+	// цена выросла между предпросмотром и оформлением
+	tx := new(mockTx)
+	repo.On("BeginTx", ctx).Return(tx, nil)
+	repo.On("LockProductsForOrder", ctx, tx, []int64{10}).Return(map[int64]ProductSnapshot{
+		10: {ID: 10, Currency: "RUB", Price: 1200, Stock: 5},
+	}, nil)
+	tx.On("Rollback").Return(nil)
+
+	_, err = svc.CreateFromCart(ctx, userID, CheckoutOptions{QuoteToken: q.Token})
+	assert.ErrorIs(t, err, ErrQuoteMismatch)
+	_, err = svc.CreateFromCart(ctx, userID, CheckoutOptions{})
+	assert.ErrorIs(t, err, ErrQuoteRequired)
+	repo.AssertNotCalled(t, "ReserveStock", mock.Anything, mock.Anything, mock.Anything)
 }
@@ -7,8 +7,25 @@ const (
 	StatusShipped         = "shipped"
 	StatusDelivered       = "delivered"
 	StatusCancelled       = "cancelled"
+	// StatusRefunded — деньги за заказ возвращены полностью
+	StatusRefunded = "refunded"
 )
 
+var knownStatuses = map[string]struct{}{
+	StatusNew:             {},
+	StatusAwaitingPayment: {},
+	StatusPaid:            {},
+	StatusShipped:         {},
+	StatusDelivered:       {},
+	StatusCancelled:       {},
+	StatusRefunded:        {},
+}
+
+func IsKnownStatus(status string) bool {
+	_, ok := knownStatuses[status]
+	return ok
+}
+
 var allowedStatusTransitions = map[string]map[string]struct{}{
 	StatusNew: {
 		StatusAwaitingPayment: {},
@@ -21,9 +38,14 @@ var allowedStatusTransitions = map[string]map[string]struct{}{
 	StatusPaid: {
 		StatusShipped:   {},
 		StatusCancelled: {},
+		StatusRefunded:  {},
 	},
 	StatusShipped: {
 		StatusDelivered: {},
+		StatusRefunded:  {},
+	},
+	StatusDelivered: {
+		StatusRefunded: {},
 	},
 }
 
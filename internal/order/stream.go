@@ -0,0 +1,136 @@
+package order
+
+import (
+	"errors"
+	"sync"
+)
+
+var ErrStreamClosed = errors.New("event stream is closed")
+
+// StatusEvent — переход статуса, адресованный владельцу заказа.
+type StatusEvent struct {
+	StatusChange
+	UserID int64 `json:"-" db:"user_id"`
+}
+
+// Hub раздает события о смене статусов подписчикам текущей реплики.
+// События в Hub приходят из LISTEN/NOTIFY, поэтому каждая реплика видит все переходы.
+type Hub struct {
+	mu     sync.Mutex
+	subs   map[int64]map[*Subscription]struct{}
+	closed bool
+}
+
+// Subscription — подписка на события одного пользователя.
+// Канал C закрывается при Close, остановке Hub или если подписчик не успевает читать.
+type Subscription struct {
+	C <-chan StatusEvent
+
+	ch     chan StatusEvent
+	hub    *Hub
+	userID int64
+}
+
+// subscriberBuffer — сколько событий может накопиться у медленного клиента
+// до отключения; после переподключения он догрузит их по Last-Event-ID.
+const subscriberBuffer = 32
+
+func NewHub() *Hub {
+	return &Hub{subs: make(map[int64]map[*Subscription]struct{})}
+}
+
+func (h *Hub) Subscribe(userID int64) (*Subscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil, ErrStreamClosed
+	}
+	ch := make(chan StatusEvent, subscriberBuffer)
+	s := &Subscription{C: ch, ch: ch, hub: h, userID: userID}
+	if h.subs[userID] == nil {
+		h.subs[userID] = make(map[*Subscription]struct{})
+	}
+	h.subs[userID][s] = struct{}{}
+	return s, nil
+}
+
+// Publish не блокируется: подписчик с переполненным буфером отключается.
+func (h *Hub) Publish(e StatusEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subs[e.UserID] {
+		select {
+		case s.ch <- e:
+		default:
+			h.remove(s)
+		}
+	}
+}
+
+// Close отключает всех подписчиков; вызывается при остановке сервера.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for _, subs := range h.subs {
+		for s := range subs {
+			h.remove(s)
+		}
+	}
+}
+
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
+
+// remove вызывается под h.mu.
+func (h *Hub) remove(s *Subscription) {
+	subs, ok := h.subs[s.userID]
+	if !ok {
+		return
+	}
+	if _, ok = subs[s]; !ok {
+		return
+	}
+	delete(subs, s)
+	if len(subs) == 0 {
+		delete(h.subs, s.userID)
+	}
+	close(s.ch)
+}
+
+// SeenEvents — ограниченное множество id уже отправленных событий.
+// Id истории выдаются до коммита, поэтому переход с меньшим id может прийти позже
+// большего: курсор «больше последнего» такие события терял бы, а здесь повтор
+// отсекается только по самому id.
+type SeenEvents struct {
+	ids  map[int64]struct{}
+	ring []int64
+	next int
+}
+
+// seenEventsSize покрывает догрузку после переподключения и запас на живые события.
+const seenEventsSize = 2 * maxStatusBacklog
+
+func NewSeenEvents() *SeenEvents {
+	return &SeenEvents{ids: make(map[int64]struct{}, seenEventsSize), ring: make([]int64, 0, seenEventsSize)}
+}
+
+// Add запоминает id и возвращает false, если событие уже отправлялось.
+// Когда множество заполнено, забывается самый старый id.
+func (s *SeenEvents) Add(id int64) bool {
+	if _, ok := s.ids[id]; ok {
+		return false
+	}
+	if len(s.ring) < cap(s.ring) {
+		s.ring = append(s.ring, id)
+	} else {
+		delete(s.ids, s.ring[s.next])
+		s.ring[s.next] = id
+		s.next = (s.next + 1) % len(s.ring)
+	}
+	s.ids[id] = struct{}{}
+	return true
+}
@@ -0,0 +1,77 @@
+package order
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func statusEvent(id, userID int64) StatusEvent {
+	return StatusEvent{StatusChange: StatusChange{ID: id, OrderID: 1, ToStatus: StatusPaid}, UserID: userID}
+}
+
+func TestHub_DeliversOnlyToOwner(t *testing.T) {
+	hub := NewHub()
+	alice, err := hub.Subscribe(1)
+	require.NoError(t, err)
+	defer alice.Close()
+	bob, err := hub.Subscribe(2)
+	require.NoError(t, err)
+	defer bob.Close()
+
+	hub.Publish(statusEvent(10, 1))
+
+	assert.Equal(t, int64(10), (<-alice.C).ID)
+	assert.Empty(t, bob.C)
+}
+
+func TestHub_DropsSlowSubscriber(t *testing.T) {
+	hub := NewHub()
+	sub, err := hub.Subscribe(1)
+	require.NoError(t, err)
+
+	for i := 0; i <= subscriberBuffer; i++ {
+		hub.Publish(statusEvent(int64(i), 1))
+	}
+
+	n := 0
+	for range sub.C {
+		n++
+	}
+	assert.Equal(t, subscriberBuffer, n)
+	sub.Close() // повторное закрытие безопасно
+}
+
+func TestHub_Close(t *testing.T) {
+	hub := NewHub()
+	sub, err := hub.Subscribe(1)
+	require.NoError(t, err)
+
+	hub.Close()
+	_, ok := <-sub.C
+	assert.False(t, ok)
+
+	_, err = hub.Subscribe(1)
+	assert.ErrorIs(t, err, ErrStreamClosed)
+}
+
+func TestSeenEvents_LateLowerIDIsDelivered(t *testing.T) {
+	seen := NewSeenEvents()
+	assert.True(t, seen.Add(12))
+	// переход 11 закоммитился после 12: он новый, а не устаревший
+	assert.True(t, seen.Add(11))
+	assert.False(t, seen.Add(12))
+	assert.False(t, seen.Add(11))
+}
+
+func TestSeenEvents_Bounded(t *testing.T) {
+	seen := NewSeenEvents()
+	for id := int64(1); id <= seenEventsSize+1; id++ {
+		require.True(t, seen.Add(id))
+	}
+	assert.Len(t, seen.ids, seenEventsSize)
+	// самый старый id забыт, недавние помнятся
+	assert.True(t, seen.Add(1))
+	assert.False(t, seen.Add(seenEventsSize+1))
+}
@@ -0,0 +1,97 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type Repository interface {
+	// ClaimPending захватывает готовые к доставке события и сдвигает их
+	// next_attempt_at на lease, чтобы другие реплики их не взяли.
+	ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]Event, error)
+	MarkDelivered(ctx context.Context, id int64) error
+	// MarkFailed увеличивает attempts; при dead=true событие больше не доставляется.
+	MarkFailed(ctx context.Context, id int64, lastErr string, retryAt time.Time, dead bool) error
+}
+
+type Dispatcher struct {
+	repo        Repository
+	pub         Publisher
+	interval    time.Duration
+	batchSize   int
+	lease       time.Duration
+	maxAttempts int
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+}
+
+func NewDispatcher(repo Repository, pub Publisher, interval time.Duration) *Dispatcher {
+	return &Dispatcher{
+		repo:        repo,
+		pub:         pub,
+		interval:    interval,
+		batchSize:   50,
+		lease:       time.Minute,
+		maxAttempts: 10,
+		baseBackoff: time.Second,
+		maxBackoff:  10 * time.Minute,
+	}
+}
+
+// Run блокируется до отмены ctx.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := d.DispatchOnce(ctx); err != nil && ctx.Err() == nil {
+				zap.L().Error("Failed to dispatch outbox events", zap.Error(err))
+			}
+		}
+	}
+}
+
+// DispatchOnce доставляет одну пачку событий и возвращает число успешно доставленных.
+func (d *Dispatcher) DispatchOnce(ctx context.Context) (int, error) {
+	events, err := d.repo.ClaimPending(ctx, d.batchSize, d.lease)
+	if err != nil {
+		return 0, err
+	}
+	delivered := 0
+	for _, e := range events {
+		if err = d.pub.Publish(ctx, e); err != nil {
+			attempts := e.Attempts + 1
+			dead := attempts >= d.maxAttempts
+			if dead {
+				zap.L().Error("Outbox event moved to dead letter",
+					zap.Int64("id", e.ID), zap.String("type", e.EventType), zap.Error(err))
+			}
+			if mErr := d.repo.MarkFailed(ctx, e.ID, err.Error(), time.Now().Add(d.backoff(attempts)), dead); mErr != nil {
+				return delivered, mErr
+			}
+			continue
+		}
+		if err = d.repo.MarkDelivered(ctx, e.ID); err != nil {
+			return delivered, err
+		}
+		delivered++
+	}
+	return delivered, nil
+}
+
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	b := d.baseBackoff
+	for i := 1; i < attempts && b < d.maxBackoff; i++ {
+		b *= 2
+	}
+	if b > d.maxBackoff {
+		b = d.maxBackoff
+	}
+	return b
+}
@@ -0,0 +1,106 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeRepo struct {
+	pending   []Event
+	delivered []int64
+	failed    map[int64]int
+	dead      []int64
+}
+
+func (r *fakeRepo) ClaimPending(_ context.Context, limit int, _ time.Duration) ([]Event, error) {
+	if len(r.pending) < limit {
+		limit = len(r.pending)
+	}
+	return append([]Event(nil), r.pending[:limit]...), nil
+}
+
+func (r *fakeRepo) MarkDelivered(_ context.Context, id int64) error {
+	r.delivered = append(r.delivered, id)
+	r.remove(id)
+	return nil
+}
+
+func (r *fakeRepo) MarkFailed(_ context.Context, id int64, _ string, _ time.Time, dead bool) error {
+	if r.failed == nil {
+		r.failed = map[int64]int{}
+	}
+	r.failed[id]++
+	for i := range r.pending {
+		if r.pending[i].ID == id {
+			r.pending[i].Attempts++
+		}
+	}
+	if dead {
+		r.dead = append(r.dead, id)
+		r.remove(id)
+	}
+	return nil
+}
+
+func (r *fakeRepo) remove(id int64) {
+	for i, e := range r.pending {
+		if e.ID == id {
+			r.pending = append(r.pending[:i], r.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+func TestDispatcher_DeliversPendingEvents(t *testing.T) {
+	e1, err := NewEvent("order", 1, "order.created", map[string]int{"order_id": 1})
+	require.NoError(t, err)
+	e1.ID = 10
+	e2, err := NewEvent("order", 1, "order.paid", map[string]int{"order_id": 1})
+	require.NoError(t, err)
+	e2.ID = 11
+
+	repo := &fakeRepo{pending: []Event{e1, e2}}
+	pub := &MemoryPublisher{}
+	d := NewDispatcher(repo, pub, time.Second)
+
+	n, err := d.DispatchOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []int64{10, 11}, repo.delivered)
+
+	got := pub.Events()
+	require.Len(t, got, 2)
+	assert.Equal(t, "order.created", got[0].EventType)
+	assert.JSONEq(t, `{"order_id":1}`, string(got[0].Payload))
+}
+
+func TestDispatcher_RetriesAndDeadLetters(t *testing.T) {
+	repo := &fakeRepo{pending: []Event{{ID: 1, EventType: "order.shipped"}}}
+	pub := &MemoryPublisher{Err: errors.New("broker is down")}
+	d := NewDispatcher(repo, pub, time.Second)
+	d.maxAttempts = 3
+
+	for i := 0; i < 3; i++ {
+		n, err := d.DispatchOnce(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 0, n)
+	}
+
+	assert.Equal(t, 3, repo.failed[1])
+	assert.Equal(t, []int64{1}, repo.dead)
+	assert.Empty(t, repo.pending)
+	assert.Empty(t, pub.Events())
+}
+
+func TestDispatcher_Backoff(t *testing.T) {
+	d := NewDispatcher(&fakeRepo{}, &MemoryPublisher{}, time.Second)
+
+	assert.Equal(t, time.Second, d.backoff(1))
+	assert.Equal(t, 4*time.Second, d.backoff(3))
+	assert.Equal(t, d.maxBackoff, d.backoff(50))
+}
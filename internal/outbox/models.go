@@ -0,0 +1,37 @@
+package outbox
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusDead      = "dead"
+)
+
+// Event — доменное событие, записанное в outbox_events в одной транзакции
+// с бизнес-изменением.
+type Event struct {
+	ID            int64           `json:"id" db:"id"`
+	AggregateType string          `json:"aggregate_type" db:"aggregate_type"`
+	AggregateID   int64           `json:"aggregate_id" db:"aggregate_id"`
+	EventType     string          `json:"event_type" db:"event_type"`
+	Payload       json.RawMessage `json:"payload" db:"payload"`
+	Attempts      int             `json:"attempts" db:"attempts"`
+	CreatedAt     time.Time       `json:"created_at" db:"created_at"`
+}
+
+func NewEvent(aggregateType string, aggregateID int64, eventType string, payload any) (Event, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{
+		AggregateType: aggregateType,
+		AggregateID:   aggregateID,
+		EventType:     eventType,
+		Payload:       raw,
+	}, nil
+}
@@ -0,0 +1,65 @@
+package outbox
+
+import (
+	"context"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Publisher доставляет событие во внешний мир. Доставка at-least-once,
+// поэтому получатели должны быть идемпотентны по Event.ID.
+type Publisher interface {
+	Publish(ctx context.Context, e Event) error
+}
+
+// LogPublisher просто пишет события в лог.
+type LogPublisher struct{}
+
+func (LogPublisher) Publish(_ context.Context, e Event) error {
+	zap.L().Info("Outbox event",
+		zap.Int64("id", e.ID),
+		zap.String("type", e.EventType),
+		zap.String("aggregate", e.AggregateType),
+		zap.Int64("aggregate_id", e.AggregateID),
+		zap.ByteString("payload", e.Payload),
+	)
+	return nil
+}
+
+// MemoryPublisher запоминает опубликованные события; используется в тестах.
+type MemoryPublisher struct {
+	mu     sync.Mutex
+	events []Event
+	// Err, если задан, возвращается из Publish вместо записи события.
+	Err error
+}
+
+func (p *MemoryPublisher) Publish(_ context.Context, e Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.Err != nil {
+		return p.Err
+	}
+	p.events = append(p.events, e)
+	return nil
+}
+
+func (p *MemoryPublisher) Events() []Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Event(nil), p.events...)
+}
+
+// MultiPublisher передает событие всем publisher'ам по очереди и
+// останавливается на первой ошибке; событие тогда будет доставлено повторно.
+type MultiPublisher []Publisher
+
+func (m MultiPublisher) Publish(ctx context.Context, e Event) error {
+	for _, p := range m {
+		if err := p.Publish(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package payment
+
+import "marketplace/internal/outbox"
+
+const AggregatePayment = "payment"
+
+const (
+	EventPaymentSucceeded = "payment.succeeded"
+	EventPaymentRefunded  = "payment.refunded"
+)
+
+// EventPayload — тело событий платежа в outbox.
+type EventPayload struct {
+	PaymentIntentID int64  `json:"payment_intent_id"`
+	OrderID         int64  `json:"order_id"`
+	RefundID        int64  `json:"refund_id,omitempty"`
+	Amount          int64  `json:"amount"`
+	Currency        string `json:"currency"`
+	Provider        string `json:"provider,omitempty"`
+}
+
+// NewSucceededEvent собирает событие о списании денег по намерению, в том числе с кошелька.
+func NewSucceededEvent(pi *Intent) (outbox.Event, error) {
+	return outbox.NewEvent(AggregatePayment, pi.ID, EventPaymentSucceeded, EventPayload{
+		PaymentIntentID: pi.ID,
+		OrderID:         pi.OrderID,
+		Amount:          pi.Amount,
+		Currency:        pi.Currency,
+		Provider:        pi.Provider,
+	})
+}
+
+// NewRefundedEvent собирает событие о проведенном возврате.
+func NewRefundedEvent(ref *Refund) (outbox.Event, error) {
+	return outbox.NewEvent(AggregatePayment, ref.IntentID, EventPaymentRefunded, EventPayload{
+		PaymentIntentID: ref.IntentID,
+		OrderID:         ref.OrderID,
+		RefundID:        ref.ID,
+		Amount:          ref.Amount,
+		Currency:        ref.Currency,
+	})
+}
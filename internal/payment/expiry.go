@@ -0,0 +1,52 @@
+package payment
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ExpiryWorker периодически отменяет намерения, не подтвержденные до expires_at.
+type ExpiryWorker struct {
+	svc       *Service
+	interval  time.Duration
+	batchSize int
+}
+
+func NewExpiryWorker(svc *Service, interval time.Duration) *ExpiryWorker {
+	return &ExpiryWorker{svc: svc, interval: interval, batchSize: 100}
+}
+
+// Run блокируется до отмены ctx.
+func (w *ExpiryWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.tick(ctx)
+		}
+	}
+}
+
+func (w *ExpiryWorker) tick(ctx context.Context) {
+	for {
+		n, err := w.svc.ExpireIntents(ctx, w.batchSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				zap.L().Error("Failed to expire payment intents", zap.Error(err))
+			}
+			return
+		}
+		if n > 0 {
+			zap.L().Info("Expired payment intents", zap.Int("count", n))
+		}
+		if n < w.batchSize {
+			return
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Outcome — заранее заданный результат подтверждения в FakeGateway.
+type Outcome int
+
+const (
+	OutcomeSucceed Outcome = iota
+	OutcomeDecline
+	OutcomeTimeout
+	// OutcomeRequire3DS — первое подтверждение требует 3-D Secure, следующее проходит
+	OutcomeRequire3DS
+)
+
+// FakeGateway — детерминированный провайдер в памяти для разработки и тестов.
+// По умолчанию все платежи проходят; Script задает результаты следующих подтверждений.
+type FakeGateway struct {
+	mu      sync.Mutex
+	seq     int
+	script  []Outcome
+	intents map[string]*fakeIntent
+	byKey   map[string]string         // ключ идемпотентности -> id платежа
+	refunds map[string]*GatewayRefund // ключ идемпотентности -> возврат
+	// holdRefunds — новые возвраты остаются pending до SettleRefunds
+	holdRefunds bool
+}
+
+type fakeIntent struct {
+	GatewayIntent
+	amount   int64
+	refunded int64
+	pending  Outcome // исход, назначенный платежу при первом подтверждении
+	assigned bool
+}
+
+func NewFakeGateway() *FakeGateway {
+	return &FakeGateway{intents: map[string]*fakeIntent{}, byKey: map[string]string{}, refunds: map[string]*GatewayRefund{}}
+}
+
+func (g *FakeGateway) Name() string { return "fake" }
+
+// Script добавляет исходы для следующих платежей в порядке их первого подтверждения.
+func (g *FakeGateway) Script(outcomes ...Outcome) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.script = append(g.script, outcomes...)
+}
+
+// HoldRefunds оставляет следующие возвраты в pending, как у провайдера с отложенным проведением.
+func (g *FakeGateway) HoldRefunds() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.holdRefunds = true
+}
+
+// SettleRefunds проводит отложенные возвраты со статусом status и возвращает к немедленному проведению.
+func (g *FakeGateway) SettleRefunds(status string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.holdRefunds = false
+	for _, r := range g.refunds {
+		if r.Status == RefundPending {
+			r.Status = status
+		}
+	}
+}
+
+func (g *FakeGateway) CreateIntent(_ context.Context, req CreateIntentRequest) (*GatewayIntent, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if id, ok := g.byKey[req.IdempotencyKey]; ok {
+		cp := g.intents[id].GatewayIntent
+		return &cp, nil
+	}
+	g.seq++
+	id := fmt.Sprintf("fake_pi_%d", g.seq)
+	in := &fakeIntent{
+		GatewayIntent: GatewayIntent{ProviderID: id, Status: StatusRequiresConfirmation, ClientSecret: id + "_secret"},
+		amount:        req.Amount,
+	}
+	g.intents[id] = in
+	if req.IdempotencyKey != "" {
+		g.byKey[req.IdempotencyKey] = id
+	}
+	cp := in.GatewayIntent
+	return &cp, nil
+}
+
+func (g *FakeGateway) Confirm(_ context.Context, providerID string) (*GatewayIntent, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	in, ok := g.intents[providerID]
+	if !ok {
+		return nil, fmt.Errorf("fake gateway: intent %s: %w", providerID, ErrIntentNotFound)
+	}
+	if in.Status != StatusRequiresConfirmation && in.Status != StatusRequiresAction {
+		cp := in.GatewayIntent
+		return &cp, nil
+	}
+	if !in.assigned {
+		in.assigned = true
+		if len(g.script) > 0 {
+			in.pending, g.script = g.script[0], g.script[1:]
+		}
+	}
+	switch in.pending {
+	case OutcomeTimeout:
+		// таймаут срабатывает один раз: ретрай видит платеж как новый
+		in.assigned = false
+		in.pending = OutcomeSucceed
+		return nil, fmt.Errorf("fake gateway: confirm %s: %w", providerID, ErrGatewayUnavailable)
+	case OutcomeDecline:
+		in.Status = StatusFailed
+		in.FailureReason = "card_declined"
+	case OutcomeRequire3DS:
+		if in.Status == StatusRequiresConfirmation {
+			in.Status = StatusRequiresAction
+			in.NextActionURL = "https://fake-gateway.local/3ds/" + providerID
+		} else {
+			in.Status = StatusSucceeded
+			in.NextActionURL = ""
+		}
+	default:
+		in.Status = StatusSucceeded
+	}
+	cp := in.GatewayIntent
+	return &cp, nil
+}
+
+func (g *FakeGateway) Cancel(_ context.Context, providerID string) (*GatewayIntent, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	in, ok := g.intents[providerID]
+	if !ok {
+		return nil, fmt.Errorf("fake gateway: intent %s: %w", providerID, ErrIntentNotFound)
+	}
+	if in.Status == StatusRequiresConfirmation || in.Status == StatusRequiresAction {
+		in.Status = StatusCancelled
+		in.NextActionURL = ""
+	}
+	cp := in.GatewayIntent
+	return &cp, nil
+}
+
+// ParseEvent принимает уведомления в формате HTTP API, чтобы их можно было слать вручную.
+func (g *FakeGateway) ParseEvent(body []byte) (*ProviderEvent, error) {
+	return parseAPIEvent(body)
+}
+
+func (g *FakeGateway) Refund(_ context.Context, req RefundRequest) (*GatewayRefund, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if r, ok := g.refunds[req.IdempotencyKey]; ok && req.IdempotencyKey != "" {
+		cp := *r
+		return &cp, nil
+	}
+	in, ok := g.intents[req.ProviderIntentID]
+	if !ok {
+		return nil, fmt.Errorf("fake gateway: intent %s: %w", req.ProviderIntentID, ErrIntentNotFound)
+	}
+	if in.Status != StatusSucceeded || in.refunded+req.Amount > in.amount {
+		return &GatewayRefund{Status: "failed"}, nil
+	}
+	in.refunded += req.Amount
+	g.seq++
+	r := &GatewayRefund{ProviderID: fmt.Sprintf("fake_re_%d", g.seq), Status: "succeeded"}
+	if g.holdRefunds {
+		r.Status = RefundPending
+	}
+	key := req.IdempotencyKey
+	if key == "" {
+		key = r.ProviderID
+	}
+	g.refunds[key] = r
+	cp := *r
+	return &cp, nil
+}
+
+func (g *FakeGateway) FetchRefund(_ context.Context, providerRefundID string) (*GatewayRefund, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, r := range g.refunds {
+		if r.ProviderID == providerRefundID {
+			cp := *r
+			return &cp, nil
+		}
+	}
+	return nil, fmt.Errorf("fake gateway: refund %s not found", providerRefundID)
+}
+
+func (g *FakeGateway) Fetch(_ context.Context, providerID string) (*GatewayIntent, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	in, ok := g.intents[providerID]
+	if !ok {
+		return nil, fmt.Errorf("fake gateway: intent %s: %w", providerID, ErrIntentNotFound)
+	}
+	cp := in.GatewayIntent
+	return &cp, nil
+}
@@ -0,0 +1,55 @@
+package payment
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeGateway_ScriptedOutcomes(t *testing.T) {
+	ctx := context.Background()
+	g := NewFakeGateway()
+	g.Script(OutcomeDecline, OutcomeRequire3DS, OutcomeTimeout)
+
+	declined, _ := g.CreateIntent(ctx, CreateIntentRequest{OrderID: 1, Amount: 100})
+	gi, err := g.Confirm(ctx, declined.ProviderID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusFailed, gi.Status)
+	assert.Equal(t, "card_declined", gi.FailureReason)
+
+	secure, _ := g.CreateIntent(ctx, CreateIntentRequest{OrderID: 2, Amount: 100})
+	gi, err = g.Confirm(ctx, secure.ProviderID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusRequiresAction, gi.Status)
+	assert.NotEmpty(t, gi.NextActionURL)
+	gi, err = g.Confirm(ctx, secure.ProviderID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusSucceeded, gi.Status)
+
+	slow, _ := g.CreateIntent(ctx, CreateIntentRequest{OrderID: 3, Amount: 100})
+	_, err = g.Confirm(ctx, slow.ProviderID)
+	assert.ErrorIs(t, err, ErrGatewayUnavailable)
+	gi, err = g.Confirm(ctx, slow.ProviderID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusSucceeded, gi.Status)
+}
+
+func TestFakeGateway_IdempotentCreateAndRefundLimit(t *testing.T) {
+	ctx := context.Background()
+	g := NewFakeGateway()
+
+	a, _ := g.CreateIntent(ctx, CreateIntentRequest{OrderID: 1, Amount: 100, IdempotencyKey: "order-1"})
+	b, _ := g.CreateIntent(ctx, CreateIntentRequest{OrderID: 1, Amount: 100, IdempotencyKey: "order-1"})
+	assert.Equal(t, a.ProviderID, b.ProviderID)
+
+	_, err := g.Confirm(ctx, a.ProviderID)
+	require.NoError(t, err)
+	r, err := g.Refund(ctx, RefundRequest{ProviderIntentID: a.ProviderID, Amount: 60})
+	require.NoError(t, err)
+	assert.Equal(t, "succeeded", r.Status)
+	r, err = g.Refund(ctx, RefundRequest{ProviderIntentID: a.ProviderID, Amount: 60})
+	require.NoError(t, err)
+	assert.Equal(t, "failed", r.Status)
+}
@@ -0,0 +1,48 @@
+package payment
+
+import "context"
+
+// Gateway — платежный провайдер. Методы возвращают состояние платежа у провайдера;
+// ошибка означает, что состояние неизвестно (сеть, таймаут, 5xx), и запрос можно повторить.
+type Gateway interface {
+	// Name — код провайдера, сохраняется в payment_intents.provider.
+	Name() string
+	CreateIntent(ctx context.Context, req CreateIntentRequest) (*GatewayIntent, error)
+	Confirm(ctx context.Context, providerID string) (*GatewayIntent, error)
+	Cancel(ctx context.Context, providerID string) (*GatewayIntent, error)
+	// Refund с тем же IdempotencyKey возвращает уже созданный возврат, а не создает новый.
+	Refund(ctx context.Context, req RefundRequest) (*GatewayRefund, error)
+	FetchRefund(ctx context.Context, providerRefundID string) (*GatewayRefund, error)
+	Fetch(ctx context.Context, providerID string) (*GatewayIntent, error)
+	// ParseEvent разбирает тело уведомления провайдера; подпись проверена до вызова.
+	ParseEvent(body []byte) (*ProviderEvent, error)
+}
+
+type CreateIntentRequest struct {
+	OrderID  int64
+	Amount   int64  // в минорных единицах Currency
+	Currency string // ISO 4217, валюта заказа
+	// IdempotencyKey защищает от двойного создания при ретрае
+	IdempotencyKey string
+}
+
+// GatewayIntent — платеж на стороне провайдера.
+type GatewayIntent struct {
+	ProviderID    string
+	Status        string // одно из Status*
+	ClientSecret  string
+	NextActionURL string
+	FailureReason string
+}
+
+type RefundRequest struct {
+	ProviderIntentID string
+	Amount           int64
+	IdempotencyKey   string
+}
+
+// GatewayRefund — возврат на стороне провайдера.
+type GatewayRefund struct {
+	ProviderID string
+	Status     string // succeeded | pending | failed
+}
@@ -1,7 +1,12 @@
 package payment
 
 import (
+	"database/sql"
+	"errors"
+	"io"
 	"marketplace/internal/auth"
+	"marketplace/internal/wallet"
+	"marketplace/internal/webhook"
 	"net/http"
 	"strconv"
 
@@ -22,24 +27,52 @@ func RegisterRoutes(r *gin.Engine, svc *Service) {
 	{
 		g.POST("/intents/:id", h.createIntent)
 		g.POST("/intents/:id/confirm", h.confirmIntent)
+		g.POST("/intents/:id/cancel", h.cancelIntent)
+		g.POST("/intents/:id/retry", h.retryIntent)
+		g.GET("/intents/:id", h.listIntents)
+	}
+	// уведомления провайдера приходят без токена, подлинность проверяется подписью
+	r.POST("/payments/webhooks/:provider", h.providerWebhook)
+	admin := r.Group("/payments", auth.JWTAuth(), auth.RequireRole("admin"))
+	{
+		admin.POST("/:intent_id/refunds", h.createRefund)
 	}
 }
 
+type intentReq struct {
+	// WalletAmount — сколько оплатить из кошелька, в минорных единицах валюты заказа
+	WalletAmount int64 `json:"wallet_amount" binding:"gte=0"`
+}
+
 // @Summary Create Payment Intent
-// @Description Create a payment intent for the specified order
+// @Description Create a payment intent for the specified order. wallet_amount is taken from the store credit wallet
+// @Description right away and the intent covers the rest; when the wallet covers the whole order it is paid at once
+// @Description and the returned intent has provider "wallet" and status succeeded.
 // @Tags payments
 // @Security BearerAuth
+// @Accept json
 // @Param id path int true "Order ID"
+// @Param input body intentReq false "Wallet part"
 // @Sucscess 201 {object} Intent
 // @Failure 400 {object} map[string]string
 // @Failure 401 {object} map[string]string
+// @Failure 402 {object} map[string]string "insufficient wallet balance"
+// @Failure 404 {object} map[string]string
 // @Failure 409 {object} map[string]string
+// @Failure 503 {object} map[string]string "payment provider unavailable"
 // @Router /orders/{id}/payments [post]
 func (h *Handler) createIntent(c *gin.Context) {
 	oid, _ := strconv.ParseInt(c.Param("id"), 10, 64)
-	pi, err := h.svc.CreateIntent(c, auth.GetUserID(c), oid)
+	var req intentReq
+	// тело необязательно: без него заказ целиком оплачивается у провайдера.
+	// Пустое тело — io.EOF; по ContentLength не судим, у chunked-тела он -1
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	pi, err := h.svc.CreateIntent(c, auth.GetUserID(c), oid, IntentOptions{WalletAmount: req.WalletAmount})
 	if err != nil {
-		c.JSON(400, gin.H{"error": err.Error()})
+		paymentError(c, err)
 		return
 	}
 	c.JSON(http.StatusCreated, pi)
@@ -51,10 +84,15 @@ func (h *Handler) createIntent(c *gin.Context) {
 // @Security BearerAuth
 // @Param id path int true "Order ID"
 // @Param client_secret body map[string]string true "client Secret"
+// @Description Status requires_action means 3-D Secure is needed: open next_action_url, then confirm again.
 // @Sucscess 200 {object} Intent
 // @Failure 400 {object} map[string]string
 // @Failure 401 {object} map[string]string
+// @Failure 402 {object} map[string]string "payment declined"
+// @Failure 404 {object} map[string]string
 // @Failure 409 {object} map[string]string
+// @Failure 410 {object} map[string]string "payment intent expired, start a new attempt"
+// @Failure 503 {object} map[string]string "payment provider unavailable"
 // @Router /orders/{id}/payments/confirm [post]
 func (h *Handler) confirmIntent(c *gin.Context) {
 	oid, _ := strconv.ParseInt(c.Param("id"), 10, 64)
@@ -67,8 +105,192 @@ func (h *Handler) confirmIntent(c *gin.Context) {
 	}
 	pi, err := h.svc.Confirm(c, auth.GetUserID(c), oid, body.ClientSecret)
 	if err != nil {
-		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		paymentError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, pi)
+}
+
+// @Summary Cancel Payment Intent
+// @Description Cancel the active payment intent of the order. The order stays awaiting_payment and can be paid with a new attempt.
+// @Tags payments
+// @Security BearerAuth
+// @Param id path int true "Order ID"
+// @Success 200 {object} Intent
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string "payment already captured"
+// @Failure 503 {object} map[string]string "payment provider unavailable"
+// @Router /payments/intents/{id}/cancel [post]
+func (h *Handler) cancelIntent(c *gin.Context) {
+	oid, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	pi, err := h.svc.Cancel(c, auth.GetUserID(c), oid)
+	if err != nil {
+		paymentError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, pi)
 }
+
+// @Summary Retry Payment
+// @Description Start a new payment attempt for an awaiting_payment order whose previous intent failed, was cancelled or expired.
+// @Tags payments
+// @Security BearerAuth
+// @Param id path int true "Order ID"
+// @Success 201 {object} Intent
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string "order not awaiting payment or has an active intent"
+// @Failure 503 {object} map[string]string "payment provider unavailable"
+// @Router /payments/intents/{id}/retry [post]
+func (h *Handler) retryIntent(c *gin.Context) {
+	oid, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	pi, err := h.svc.Retry(c, auth.GetUserID(c), oid)
+	if err != nil {
+		paymentError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, pi)
+}
+
+// @Summary List Payment Intents
+// @Description All payment attempts of the order, oldest first
+// @Tags payments
+// @Security BearerAuth
+// @Param id path int true "Order ID"
+// @Success 200 {array} Intent
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /payments/intents/{id} [get]
+func (h *Handler) listIntents(c *gin.Context) {
+	oid, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	intents, err := h.svc.Intents(c, auth.GetUserID(c), oid)
+	if err != nil {
+		paymentError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, intents)
+}
+
+type refundReq struct {
+	// Amount — сумма в копейках; без lines обязательна
+	Amount int64           `json:"amount" binding:"gte=0"`
+	Lines  []refundLineReq `json:"lines" binding:"dive"`
+	Reason string          `json:"reason"`
+}
+
+type refundLineReq struct {
+	OrderItemID int64 `json:"order_item_id" binding:"required"`
+	Quantity    int   `json:"quantity" binding:"required,gt=0"`
+}
+
+// @Summary Refund Payment (admin)
+// @Description Refund a succeeded payment fully or partially. Without lines the amount is required;
+// @Description with lines the amount defaults to their value. A full refund moves the order to refunded.
+// @Description If the provider has not settled the refund yet it is returned as pending with 202; retrying
+// @Description the same amount returns that refund instead of creating another one.
+// @Tags admin-payments
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param intent_id path int true "Payment Intent ID"
+// @Param refund body refundReq true "Refund"
+// @Success 201 {object} Refund
+// @Success 202 {object} Refund "refund pending at provider"
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 402 {object} map[string]string "refund declined by provider"
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string "refund exceeds captured amount or ordered quantity"
+// @Router /payments/{intent_id}/refunds [post]
+func (h *Handler) createRefund(c *gin.Context) {
+	intentID, err := strconv.ParseInt(c.Param("intent_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid intent id"})
+		return
+	}
+	var req refundReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	in := RefundInput{Amount: req.Amount, Reason: req.Reason}
+	for _, l := range req.Lines {
+		in.Lines = append(in.Lines, RefundLineInput{OrderItemID: l.OrderItemID, Quantity: l.Quantity})
+	}
+	ref, err := h.svc.Refund(c, auth.GetUserID(c), intentID, in)
+	if err != nil {
+		paymentError(c, err)
+		return
+	}
+	if ref.Status == RefundPending {
+		c.JSON(http.StatusAccepted, ref)
+		return
+	}
+	c.JSON(http.StatusCreated, ref)
+}
+
+// @Summary Payment Provider Webhook
+// @Description Asynchronous payment outcome from the provider. The body is signed with
+// @Description hex(HMAC-SHA256(secret, "<timestamp>.<body>")) in X-Webhook-Signature, the Unix time goes in X-Webhook-Timestamp.
+// @Description Repeated event IDs and events older than the stored payment status are acknowledged without changes.
+// @Tags payments
+// @Accept json
+// @Produce json
+// @Param provider path string true "Provider code"
+// @Param X-Webhook-Signature header string true "sha256=<hex>"
+// @Param X-Webhook-Timestamp header int true "Unix timestamp"
+// @Success 200 {object} map[string]string "result: applied, duplicate, ignored or orphan_capture"
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string "provider should retry"
+// @Router /payments/webhooks/{provider} [post]
+func (h *Handler) providerWebhook(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	result, err := h.svc.HandleWebhook(c, Notification{
+		Provider:  c.Param("provider"),
+		Timestamp: c.GetHeader(webhook.HeaderTimestamp),
+		Signature: c.GetHeader(webhook.HeaderSignature),
+		Body:      body,
+	})
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, gin.H{"result": result})
+	case errors.Is(err, ErrUnknownProvider):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrInvalidSignature):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrInvalidEvent):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		// ошибка БД: не подтверждаем, провайдер доставит событие повторно
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func paymentError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows), errors.Is(err, ErrIntentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrInvalidRefund), errors.Is(err, ErrInvalidWalletAmount):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrRefundDeclined):
+		c.JSON(http.StatusPaymentRequired, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrIntentExpired):
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrInvalidSecret):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrPaymentDeclined), errors.Is(err, wallet.ErrInsufficientFunds):
+		c.JSON(http.StatusPaymentRequired, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrGatewayUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	}
+}
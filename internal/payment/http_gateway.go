@@ -0,0 +1,218 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// HTTPGateway — адаптер к REST API провайдера в стиле Stripe:
+//
+//	POST /v1/payment_intents              {amount, currency, metadata.order_id}
+//	POST /v1/payment_intents/{id}/confirm
+//	POST /v1/payment_intents/{id}/cancel
+//	GET  /v1/payment_intents/{id}
+//	POST /v1/refunds                      {payment_intent, amount}
+//	GET  /v1/refunds/{id}
+//
+// Запросы авторизуются ключом API, создание и возвраты передают Idempotency-Key.
+type HTTPGateway struct {
+	name    string
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+func NewHTTPGateway(name, baseURL, apiKey string, client *http.Client) *HTTPGateway {
+	if client == nil {
+		client = &http.Client{Timeout: 15 * time.Second}
+	}
+	return &HTTPGateway{name: name, baseURL: strings.TrimRight(baseURL, "/"), apiKey: apiKey, client: client}
+}
+
+func (g *HTTPGateway) Name() string { return g.name }
+
+type apiIntent struct {
+	ID           string `json:"id"`
+	Status       string `json:"status"`
+	ClientSecret string `json:"client_secret"`
+	NextAction   *struct {
+		RedirectURL string `json:"redirect_url"`
+	} `json:"next_action"`
+	LastError *apiLastError `json:"last_error"`
+}
+
+type apiLastError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type apiRefund struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+}
+
+type apiError struct {
+	Error struct {
+		apiLastError
+		// PaymentIntent — платеж, по которому провайдер отказал (ответ 402)
+		PaymentIntent *apiIntent `json:"payment_intent"`
+	} `json:"error"`
+}
+
+func (g *HTTPGateway) CreateIntent(ctx context.Context, req CreateIntentRequest) (*GatewayIntent, error) {
+	var out apiIntent
+	err := g.do(ctx, http.MethodPost, "/v1/payment_intents", req.IdempotencyKey, map[string]any{
+		"amount":   req.Amount,
+		"currency": strings.ToLower(req.Currency),
+		"metadata": map[string]string{"order_id": fmt.Sprint(req.OrderID)},
+	}, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out.intent(), nil
+}
+
+func (g *HTTPGateway) Confirm(ctx context.Context, providerID string) (*GatewayIntent, error) {
+	return g.intentAction(ctx, http.MethodPost, providerID, "/confirm")
+}
+
+func (g *HTTPGateway) Cancel(ctx context.Context, providerID string) (*GatewayIntent, error) {
+	return g.intentAction(ctx, http.MethodPost, providerID, "/cancel")
+}
+
+func (g *HTTPGateway) Fetch(ctx context.Context, providerID string) (*GatewayIntent, error) {
+	return g.intentAction(ctx, http.MethodGet, providerID, "")
+}
+
+func (g *HTTPGateway) Refund(ctx context.Context, req RefundRequest) (*GatewayRefund, error) {
+	var out apiRefund
+	err := g.do(ctx, http.MethodPost, "/v1/refunds", req.IdempotencyKey, map[string]any{
+		"payment_intent": req.ProviderIntentID,
+		"amount":         req.Amount,
+	}, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &GatewayRefund{ProviderID: out.ID, Status: out.Status}, nil
+}
+
+func (g *HTTPGateway) FetchRefund(ctx context.Context, providerRefundID string) (*GatewayRefund, error) {
+	var out apiRefund
+	if err := g.do(ctx, http.MethodGet, "/v1/refunds/"+url.PathEscape(providerRefundID), "", nil, &out); err != nil {
+		return nil, err
+	}
+	return &GatewayRefund{ProviderID: out.ID, Status: out.Status}, nil
+}
+
+func (g *HTTPGateway) ParseEvent(body []byte) (*ProviderEvent, error) {
+	return parseAPIEvent(body)
+}
+
+func (g *HTTPGateway) intentAction(ctx context.Context, method, providerID, action string) (*GatewayIntent, error) {
+	var out apiIntent
+	if err := g.do(ctx, method, "/v1/payment_intents/"+url.PathEscape(providerID)+action, "", nil, &out); err != nil {
+		return nil, err
+	}
+	return out.intent(), nil
+}
+
+func (a apiIntent) intent() *GatewayIntent {
+	gi := &GatewayIntent{ProviderID: a.ID, ClientSecret: a.ClientSecret}
+	switch a.Status {
+	case "requires_payment_method", "requires_confirmation":
+		gi.Status = StatusRequiresConfirmation
+		// провайдер возвращает платеж к выбору карты после отказа
+		if a.LastError != nil {
+			gi.Status = StatusFailed
+		}
+	case "requires_action":
+		gi.Status = StatusRequiresAction
+	case "succeeded":
+		gi.Status = StatusSucceeded
+	case "canceled", "cancelled":
+		gi.Status = StatusCancelled
+	default:
+		gi.Status = StatusFailed
+	}
+	if a.NextAction != nil {
+		gi.NextActionURL = a.NextAction.RedirectURL
+	}
+	if a.LastError != nil {
+		gi.FailureReason = a.LastError.Code
+		if gi.FailureReason == "" {
+			gi.FailureReason = a.LastError.Message
+		}
+	}
+	return gi
+}
+
+// do выполняет запрос. Сетевые ошибки и 5xx — ErrGatewayUnavailable; 402 с отказом по карте
+// разбирается как платеж со статусом failed; прочие 4xx — ошибка запроса.
+func (g *HTTPGateway) do(ctx context.Context, method, path, idemKey string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, g.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+g.apiKey)
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if idemKey != "" {
+		req.Header.Set("Idempotency-Key", idemKey)
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w: %v", method, path, ErrGatewayUnavailable, err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("%s %s: %w: %v", method, path, ErrGatewayUnavailable, err)
+	}
+
+	switch {
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("%s %s: %w: status %d", method, path, ErrGatewayUnavailable, resp.StatusCode)
+	case resp.StatusCode == http.StatusPaymentRequired:
+		// тело 402 содержит платеж с отказом — отдаем его как результат со статусом failed
+		var e apiError
+		if err = json.Unmarshal(raw, &e); err != nil || e.Error.PaymentIntent == nil {
+			return fmt.Errorf("%s %s: %w", method, path, ErrPaymentDeclined)
+		}
+		pi, ok := out.(*apiIntent)
+		if !ok {
+			return fmt.Errorf("%s %s: %w: %s", method, path, ErrPaymentDeclined, e.Error.Message)
+		}
+		*pi = *e.Error.PaymentIntent
+		pi.Status = "failed"
+		if pi.LastError == nil {
+			pi.LastError = &e.Error.apiLastError
+		}
+		return nil
+	case resp.StatusCode >= 400:
+		var e apiError
+		_ = json.Unmarshal(raw, &e)
+		return fmt.Errorf("%s %s: provider error %d: %s", method, path, resp.StatusCode, e.Error.Message)
+	}
+	if err = json.Unmarshal(raw, out); err != nil {
+		return fmt.Errorf("%s %s: decode response: %w", method, path, err)
+	}
+	return nil
+}
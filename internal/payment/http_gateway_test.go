@@ -0,0 +1,92 @@
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubProvider — заглушка REST API провайдера.
+func stubProvider(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/payment_intents", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer sk_test", r.Header.Get("Authorization"))
+		assert.Equal(t, "order-7", r.Header.Get("Idempotency-Key"))
+		var body struct {
+			Amount   int64  `json:"amount"`
+			Currency string `json:"currency"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, int64(4200), body.Amount)
+		assert.Equal(t, "rub", body.Currency)
+		w.Write([]byte(`{"id":"pi_1","status":"requires_confirmation","client_secret":"pi_1_secret"}`))
+	})
+	mux.HandleFunc("POST /v1/payment_intents/pi_1/confirm", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"pi_1","status":"requires_action","next_action":{"redirect_url":"https://bank/3ds"}}`))
+	})
+	mux.HandleFunc("POST /v1/payment_intents/pi_declined/confirm", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusPaymentRequired)
+		w.Write([]byte(`{"error":{"code":"card_declined","message":"Your card was declined.",
+			"payment_intent":{"id":"pi_declined","status":"requires_payment_method","last_error":{"code":"card_declined"}}}}`))
+	})
+	mux.HandleFunc("GET /v1/payment_intents/pi_1", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"pi_1","status":"succeeded"}`))
+	})
+	mux.HandleFunc("POST /v1/payment_intents/pi_down/cancel", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	mux.HandleFunc("GET /v1/payment_intents/pi_slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	})
+	mux.HandleFunc("POST /v1/refunds", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"re_1","status":"succeeded"}`))
+	})
+	mux.HandleFunc("GET /v1/refunds/re_2", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"re_2","status":"pending"}`))
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestHTTPGateway(t *testing.T) {
+	srv := stubProvider(t)
+	g := NewHTTPGateway("acme", srv.URL, "sk_test", &http.Client{Timeout: 50 * time.Millisecond})
+	ctx := context.Background()
+
+	gi, err := g.CreateIntent(ctx, CreateIntentRequest{OrderID: 7, Amount: 4200, Currency: "RUB", IdempotencyKey: "order-7"})
+	require.NoError(t, err)
+	assert.Equal(t, &GatewayIntent{ProviderID: "pi_1", Status: StatusRequiresConfirmation, ClientSecret: "pi_1_secret"}, gi)
+
+	gi, err = g.Confirm(ctx, "pi_1")
+	require.NoError(t, err)
+	assert.Equal(t, StatusRequiresAction, gi.Status)
+	assert.Equal(t, "https://bank/3ds", gi.NextActionURL)
+
+	gi, err = g.Fetch(ctx, "pi_1")
+	require.NoError(t, err)
+	assert.Equal(t, StatusSucceeded, gi.Status)
+
+	gi, err = g.Confirm(ctx, "pi_declined")
+	require.NoError(t, err)
+	assert.Equal(t, StatusFailed, gi.Status)
+	assert.Equal(t, "card_declined", gi.FailureReason)
+
+	r, err := g.Refund(ctx, RefundRequest{ProviderIntentID: "pi_1", Amount: 100})
+	require.NoError(t, err)
+	assert.Equal(t, &GatewayRefund{ProviderID: "re_1", Status: "succeeded"}, r)
+	r, err = g.FetchRefund(ctx, "re_2")
+	require.NoError(t, err)
+	assert.Equal(t, &GatewayRefund{ProviderID: "re_2", Status: "pending"}, r)
+
+	_, err = g.Cancel(ctx, "pi_down")
+	assert.ErrorIs(t, err, ErrGatewayUnavailable)
+	_, err = g.Fetch(ctx, "pi_slow")
+	assert.ErrorIs(t, err, ErrGatewayUnavailable)
+}
@@ -0,0 +1,163 @@
+package payment
+
+import (
+	"context"
+	"marketplace/internal/order"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_RetryAfterFailedAttempt(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1_700_000_000, 0)
+	repo, orders, g := new(mockRepo), new(mockOrders), NewFakeGateway()
+	svc := NewService(repo, orders, g, WithIntentTTL(10*time.Minute))
+	svc.now = func() time.Time { return now }
+	first := newIntent(t, g)
+	first.Status = StatusFailed
+
+	orders.On("GetOrderWithItems", ctx, int64(1), int64(5)).Return(awaiting, nil)
+	repo.On("ListIntents", ctx, int64(5)).Return([]Intent{*first}, nil)
+	repo.On("AddAttempt", ctx, awaiting, "fake", mock.MatchedBy(func(gi *GatewayIntent) bool {
+		return gi.ProviderID != *first.ProviderIntentID && gi.Status == StatusRequiresConfirmation
+	}), now.Add(10*time.Minute)).Return(&Intent{ID: 10, Status: StatusRequiresConfirmation}, nil)
+
+	pi, err := svc.Retry(ctx, 1, 5)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), pi.ID)
+	repo.AssertExpectations(t)
+}
+
+func TestService_RetryRejectsActiveIntent(t *testing.T) {
+	ctx := context.Background()
+	repo, orders, g := new(mockRepo), new(mockOrders), NewFakeGateway()
+	svc := NewService(repo, orders, g)
+
+	orders.On("GetOrderWithItems", ctx, int64(1), int64(5)).Return(awaiting, nil)
+	repo.On("ListIntents", ctx, int64(5)).Return([]Intent{*newIntent(t, g)}, nil)
+
+	_, err := svc.Retry(ctx, 1, 5)
+	assert.ErrorIs(t, err, ErrIntentActive)
+	repo.AssertNotCalled(t, "AddAttempt", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestService_RetryRequiresAwaitingPayment(t *testing.T) {
+	ctx := context.Background()
+	repo, orders := new(mockRepo), new(mockOrders)
+	svc := NewService(repo, orders, NewFakeGateway())
+
+	orders.On("GetOrderWithItems", ctx, int64(1), int64(5)).Return(&order.Order{ID: 5, Status: order.StatusPaid}, nil)
+
+	_, err := svc.Retry(ctx, 1, 5)
+	assert.ErrorIs(t, err, ErrOrderNotPayable)
+}
+
+func TestService_ConfirmExpiredIntent(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1_700_000_000, 0)
+	repo, orders, g := new(mockRepo), new(mockOrders), NewFakeGateway()
+	svc := NewService(repo, orders, g)
+	// часы приложения отстают: срок истек по часам БД, и это решает
+	svc.now = func() time.Time { return now.Add(-time.Hour) }
+	pi := newIntent(t, g)
+	deadline := now.Add(-time.Second)
+	pi.ExpiresAt = &deadline
+	pi.Expired = true
+
+	orders.On("GetOrderWithItems", ctx, int64(1), int64(5)).Return(awaiting, nil)
+	repo.On("GetActiveIntent", ctx, int64(5)).Return(pi, nil)
+	repo.On("UpdateIntentStatus", ctx, int64(9), mock.MatchedBy(func(gi *GatewayIntent) bool {
+		return gi.Status == StatusCancelled && gi.FailureReason == "expired"
+	})).Return(&Intent{ID: 9, Status: StatusCancelled}, nil)
+
+	_, err := svc.Confirm(ctx, 1, 5, pi.ClientSecret)
+	assert.ErrorIs(t, err, ErrIntentExpired)
+	gi, err := g.Fetch(ctx, *pi.ProviderIntentID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusCancelled, gi.Status)
+}
+
+func TestService_CancelAfterCapture(t *testing.T) {
+	ctx := context.Background()
+	repo, orders, g := new(mockRepo), new(mockOrders), NewFakeGateway()
+	svc := NewService(repo, orders, g)
+	pi := newIntent(t, g)
+	// провайдер уже списал деньги, а мы об этом еще не знаем
+	_, err := g.Confirm(ctx, *pi.ProviderIntentID)
+	require.NoError(t, err)
+
+	orders.On("GetOrderWithItems", ctx, int64(1), int64(5)).Return(awaiting, nil)
+	repo.On("GetActiveIntent", ctx, int64(5)).Return(pi, nil)
+	repo.On("MarkSucceeded", ctx, int64(9), int64(1)).Return(&Intent{ID: 9, Status: StatusSucceeded}, nil)
+
+	got, err := svc.Cancel(ctx, 1, 5)
+	assert.ErrorIs(t, err, ErrPaymentCaptured)
+	assert.Equal(t, StatusSucceeded, got.Status)
+	repo.AssertNotCalled(t, "UpdateIntentStatus", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestService_ExpireIntentsSkipsFailures(t *testing.T) {
+	ctx := context.Background()
+	repo, g := new(mockRepo), NewFakeGateway()
+	svc := NewService(repo, new(mockOrders), g)
+	ok := newIntent(t, g)
+	missing := "fake_pi_unknown"
+	broken := Intent{ID: 11, Status: StatusRequiresConfirmation, ProviderIntentID: &missing}
+
+	repo.On("ListExpiredIntents", ctx, 100).Return([]Intent{broken, *ok}, nil)
+	repo.On("UpdateIntentStatus", ctx, int64(9), mock.Anything).Return(&Intent{ID: 9, Status: StatusCancelled}, nil)
+
+	n, err := svc.ExpireIntents(ctx, 100)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	repo.AssertNotCalled(t, "UpdateIntentStatus", mock.Anything, int64(11), mock.Anything)
+}
+
+// Отмена заказа только завершает срок его намерений; ждущее 3-D Secure отменяется у провайдера здесь.
+func TestService_ExpireIntentsCancels3DSAtProvider(t *testing.T) {
+	ctx := context.Background()
+	repo, g := new(mockRepo), NewFakeGateway()
+	g.Script(OutcomeRequire3DS)
+	svc := NewService(repo, new(mockOrders), g)
+	pi := newIntent(t, g)
+	gi, err := g.Confirm(ctx, *pi.ProviderIntentID)
+	require.NoError(t, err)
+	require.Equal(t, StatusRequiresAction, gi.Status)
+	pi.Status = StatusRequiresAction
+
+	repo.On("ListExpiredIntents", ctx, 100).Return([]Intent{*pi}, nil)
+	repo.On("UpdateIntentStatus", ctx, int64(9), mock.MatchedBy(func(gi *GatewayIntent) bool {
+		return gi.Status == StatusCancelled && gi.FailureReason == "expired"
+	})).Return(&Intent{ID: 9, Status: StatusCancelled}, nil)
+
+	n, err := svc.ExpireIntents(ctx, 100)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	gi, err = g.Fetch(ctx, *pi.ProviderIntentID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusCancelled, gi.Status)
+	repo.AssertExpectations(t)
+}
+
+func TestService_ExpireIntentCapturedForClosedOrder(t *testing.T) {
+	ctx := context.Background()
+	repo, g := new(mockRepo), NewFakeGateway()
+	svc := NewService(repo, new(mockOrders), g)
+	pi := newIntent(t, g)
+	// покупатель прошел оплату у провайдера, а заказ уже отменен
+	_, err := g.Confirm(ctx, *pi.ProviderIntentID)
+	require.NoError(t, err)
+
+	repo.On("ListExpiredIntents", ctx, 100).Return([]Intent{*pi}, nil)
+	repo.On("MarkSucceeded", ctx, int64(9), int64(0)).
+		Return(&Intent{ID: 9, Status: StatusSucceeded}, ErrOrphanCapture).Once()
+
+	n, err := svc.ExpireIntents(ctx, 100)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	repo.AssertExpectations(t)
+}
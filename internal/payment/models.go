@@ -1,11 +1,90 @@
 package payment
 
+import (
+	"errors"
+	"marketplace/internal/order"
+	"time"
+)
+
+// Статусы платежного намерения; провайдеры приводятся к ним же.
+const (
+	StatusRequiresConfirmation = "requires_confirmation"
+	// StatusRequiresAction — нужна проверка 3-D Secure по NextActionURL, затем повторное подтверждение
+	StatusRequiresAction = "requires_action"
+	StatusSucceeded      = "succeeded"
+	StatusCancelled      = "cancelled"
+	StatusFailed         = "failed"
+)
+
+// WalletProvider — оплата из кошелька покупателя. Такое намерение создается сразу оплаченным
+// вместе со списанием с кошелька, без обращения к провайдеру.
+const WalletProvider = "wallet"
+
+// Статусы возврата.
+const (
+	RefundPending   = "pending"
+	RefundSucceeded = "succeeded"
+	RefundFailed    = "failed"
+)
+
+var (
+	ErrIntentNotFound     = errors.New("payment intent not found")
+	ErrInvalidSecret      = errors.New("invalid client secret")
+	ErrOrderNotPayable    = errors.New("order cannot be paid in its current status")
+	ErrPaymentDeclined    = errors.New("payment declined")
+	ErrGatewayUnavailable = errors.New("payment provider unavailable")
+	ErrIntentActive       = errors.New("order already has an active payment intent")
+	ErrIntentExpired      = errors.New("payment intent expired")
+	ErrPaymentCaptured    = errors.New("payment already captured")
+	// ErrOrphanCapture — провайдер списал деньги за заказ, который уже нельзя оплатить;
+	// платеж проведен и записан к компенсации
+	ErrOrphanCapture       = errors.New("payment captured for order that cannot be paid")
+	ErrInvalidWalletAmount = errors.New("invalid wallet amount")
+
+	ErrInvalidRefund       = errors.New("invalid refund")
+	ErrNotRefundable       = errors.New("payment cannot be refunded in its current status")
+	ErrRefundExceedsAmount = errors.New("refund exceeds captured amount")
+	ErrRefundExceedsItems  = errors.New("refund exceeds ordered quantity")
+	ErrRefundDeclined      = errors.New("refund declined")
+)
+
 type Intent struct {
-	ID           int64  `json:"id" db:"id"`
-	OrderID      int64  `json:"order_id" db:"order_id"`
-	Amount       int64  `json:"amount" db:"amount"`
-	Status       string `json:"status" db:"status"`
-	ClientSecret string `json:"client_secret" db:"client_secret"`
-	CreatedAt    string `json:"created_at" db:"created_at"`
-	UpdatedAt    string `json:"updated_at" db:"updated_at"`
+	ID               int64   `json:"id" db:"id"`
+	OrderID          int64   `json:"order_id" db:"order_id"`
+	Amount           int64   `json:"amount" db:"amount"`
+	Currency         string  `json:"currency" db:"currency"`
+	Status           string  `json:"status" db:"status"`
+	ClientSecret     string  `json:"client_secret" db:"client_secret"`
+	Provider         string  `json:"provider" db:"provider"`
+	ProviderIntentID *string `json:"provider_intent_id,omitempty" db:"provider_intent_id"`
+	NextActionURL    *string `json:"next_action_url,omitempty" db:"next_action_url"`
+	FailureReason    *string `json:"failure_reason,omitempty" db:"failure_reason"`
+	// RefundedAmount — возвраты в работе и проведенные, не больше Amount
+	RefundedAmount int64 `json:"refunded_amount" db:"refunded_amount"`
+	// ExpiresAt — срок подтверждения; пусто у намерений, созданных до появления срока
+	ExpiresAt *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	// Expired — срок истек по часам БД; заполняет GetActiveIntent
+	Expired   bool   `json:"-" db:"expired"`
+	CreatedAt string `json:"created_at" db:"created_at"`
+	UpdatedAt string `json:"updated_at" db:"updated_at"`
+}
+
+// Active — намерение еще ждет подтверждения; у заказа такое может быть только одно.
+func (i *Intent) Active() bool {
+	return i.Status == StatusRequiresConfirmation || i.Status == StatusRequiresAction
+}
+
+type Refund struct {
+	ID               int64              `json:"id" db:"id"`
+	IntentID         int64              `json:"payment_intent_id" db:"payment_intent_id"`
+	OrderID          int64              `json:"order_id" db:"order_id"`
+	Amount           int64              `json:"amount" db:"amount"`
+	Currency         string             `json:"currency" db:"currency"`
+	Status           string             `json:"status" db:"status"`
+	Reason           *string            `json:"reason,omitempty" db:"reason"`
+	ProviderRefundID *string            `json:"provider_refund_id,omitempty" db:"provider_refund_id"`
+	ActorID          *int64             `json:"actor_id,omitempty" db:"actor_id"`
+	Lines            []order.RefundLine `json:"lines,omitempty" db:"-"`
+	CreatedAt        string             `json:"created_at" db:"created_at"`
+	UpdatedAt        string             `json:"updated_at" db:"updated_at"`
 }
@@ -0,0 +1,191 @@
+package payment
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"marketplace/internal/order"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RefundInput — возврат, запрошенный администратором.
+// Без Lines сумма обязательна; с Lines по умолчанию возвращается стоимость позиций,
+// а явная Amount не может ее превышать.
+type RefundInput struct {
+	Amount int64
+	Lines  []RefundLineInput
+	Reason string
+}
+
+type RefundLineInput struct {
+	OrderItemID int64
+	Quantity    int
+}
+
+// Refund возвращает деньги по оплаченному намерению полностью или частично;
+// оплата из кошелька возвращается на кошелек покупателя.
+// Сумма резервируется в БД до обращения к провайдеру, поэтому параллельные возвраты
+// не превысят списанное. Если провайдер не ответил или еще проводит возврат, он остается
+// pending и держит резерв; повторный запрос на ту же сумму получает этот же возврат
+// и тот же ключ идемпотентности у провайдера, а итог подтягивает ReconcileRefunds.
+func (s *Service) Refund(ctx context.Context, actorID, intentID int64, in RefundInput) (*Refund, error) {
+	pi, err := s.payRepo.GetIntent(ctx, intentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrIntentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	fromWallet := pi.Provider == WalletProvider
+	if pi.Status != StatusSucceeded || (pi.ProviderIntentID == nil && !fromWallet) {
+		return nil, ErrNotRefundable
+	}
+	lines, amount, err := s.refundLines(ctx, pi.OrderID, in)
+	if err != nil {
+		return nil, err
+	}
+
+	draft := &Refund{
+		IntentID: pi.ID,
+		OrderID:  pi.OrderID,
+		Amount:   amount,
+		Status:   RefundPending,
+		ActorID:  order.ActorRef(actorID),
+		Lines:    lines,
+	}
+	if in.Reason != "" {
+		draft.Reason = &in.Reason
+	}
+	r, err := s.payRepo.CreateRefund(ctx, draft)
+	if err != nil {
+		return nil, err
+	}
+	// оплата из кошелька возвращается на кошелек той же транзакцией, что закрывает возврат
+	gr := &GatewayRefund{Status: RefundSucceeded}
+	if !fromWallet {
+		if gr, err = s.providerRefund(ctx, pi, r); err != nil {
+			zap.L().Warn("Refund left pending", zap.Int64("refund_id", r.ID), zap.Error(err))
+			return r, nil
+		}
+	}
+	done, err := s.payRepo.FinishRefund(ctx, r.ID, gr, actorID)
+	if err != nil {
+		return nil, err
+	}
+	done.Lines = r.Lines
+	if done.Status == RefundFailed {
+		return done, ErrRefundDeclined
+	}
+	return done, nil
+}
+
+// ReconcileRefunds доводит до limit зависших в pending возвратов до итогового статуса
+// по ответу провайдера и возвращает, сколько закрыто.
+func (s *Service) ReconcileRefunds(ctx context.Context, olderThan time.Duration, limit int) (int, error) {
+	refunds, err := s.payRepo.ListPendingRefunds(ctx, olderThan, limit)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for i := range refunds {
+		r := &refunds[i]
+		pi, err := s.payRepo.GetIntent(ctx, r.IntentID)
+		if err != nil {
+			return n, err
+		}
+		gr := &GatewayRefund{Status: RefundSucceeded}
+		if pi.Provider != WalletProvider {
+			if gr, err = s.providerRefund(ctx, pi, r); err != nil {
+				zap.L().Warn("Failed to reconcile refund", zap.Int64("refund_id", r.ID), zap.Error(err))
+				continue
+			}
+		}
+		if gr.Status == RefundPending {
+			continue
+		}
+		if _, err = s.payRepo.FinishRefund(ctx, r.ID, gr, 0); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// providerRefund запрашивает возврат у провайдера или его текущее состояние.
+// Ключ идемпотентности выводится из id возврата, поэтому повторы не создают второй возврат.
+func (s *Service) providerRefund(ctx context.Context, pi *Intent, r *Refund) (*GatewayRefund, error) {
+	if r.ProviderRefundID != nil {
+		return s.gateway.FetchRefund(ctx, *r.ProviderRefundID)
+	}
+	if pi.ProviderIntentID == nil {
+		return nil, ErrNotRefundable
+	}
+	gr, err := s.gateway.Refund(ctx, RefundRequest{
+		ProviderIntentID: *pi.ProviderIntentID,
+		Amount:           r.Amount,
+		IdempotencyKey:   fmt.Sprintf("refund-%d", r.ID),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("refund at provider: %w", err)
+	}
+	return gr, nil
+}
+
+// refundLines считает стоимость возвращаемых позиций и итоговую сумму возврата.
+// Остаток по количеству с учетом прошлых возвратов проверяет репозиторий.
+func (s *Service) refundLines(ctx context.Context, orderID int64, in RefundInput) ([]order.RefundLine, int64, error) {
+	if in.Amount < 0 {
+		return nil, 0, fmt.Errorf("%w: negative amount", ErrInvalidRefund)
+	}
+	if len(in.Lines) == 0 {
+		if in.Amount == 0 {
+			return nil, 0, fmt.Errorf("%w: amount or lines required", ErrInvalidRefund)
+		}
+		return nil, in.Amount, nil
+	}
+
+	o, err := s.ordRepo.GetOrderByID(ctx, orderID)
+	if err != nil {
+		return nil, 0, err
+	}
+	items := make(map[int64]order.OrderItem, len(o.Items))
+	for _, it := range o.Items {
+		items[it.ID] = it
+	}
+	lines := make([]order.RefundLine, 0, len(in.Lines))
+	seen := make(map[int64]struct{}, len(in.Lines))
+	var total int64
+	for _, l := range in.Lines {
+		it, ok := items[l.OrderItemID]
+		if !ok {
+			return nil, 0, fmt.Errorf("%w: order item %d not in order %d", ErrInvalidRefund, l.OrderItemID, orderID)
+		}
+		if _, dup := seen[l.OrderItemID]; dup {
+			return nil, 0, fmt.Errorf("%w: order item %d listed twice", ErrInvalidRefund, l.OrderItemID)
+		}
+		seen[l.OrderItemID] = struct{}{}
+		if l.Quantity <= 0 {
+			return nil, 0, fmt.Errorf("%w: quantity must be positive", ErrInvalidRefund)
+		}
+		if l.Quantity > it.Quantity {
+			return nil, 0, fmt.Errorf("%w: order item %d", ErrRefundExceedsItems, l.OrderItemID)
+		}
+		// доля суммы позиции с НДС; при возврате всей позиции — ровно ее сумма
+		amount := it.Amount() * int64(l.Quantity) / int64(it.Quantity)
+		lines = append(lines, order.RefundLine{OrderItemID: l.OrderItemID, Quantity: l.Quantity, Amount: amount})
+		total += amount
+	}
+	if in.Amount == 0 {
+		if total == 0 {
+			return nil, 0, fmt.Errorf("%w: nothing to refund", ErrInvalidRefund)
+		}
+		return lines, total, nil
+	}
+	if in.Amount > total {
+		return nil, 0, fmt.Errorf("%w: amount %d exceeds lines total %d", ErrInvalidRefund, in.Amount, total)
+	}
+	return lines, in.Amount, nil
+}
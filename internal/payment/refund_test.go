@@ -0,0 +1,146 @@
+package payment
+
+import (
+	"context"
+	"marketplace/internal/order"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// paidIntent — намерение на 1000, оплаченное в фейковом провайдере.
+func paidIntent(t *testing.T, g *FakeGateway) *Intent {
+	pi := newIntent(t, g)
+	_, err := g.Confirm(context.Background(), *pi.ProviderIntentID)
+	require.NoError(t, err)
+	pi.Status = StatusSucceeded
+	return pi
+}
+
+func TestService_RefundLines(t *testing.T) {
+	ctx := context.Background()
+	repo, orders, g := new(mockRepo), new(mockOrders), NewFakeGateway()
+	svc := NewService(repo, orders, g)
+	pi := paidIntent(t, g)
+
+	orders.On("GetOrderByID", ctx, int64(5)).Return(&order.Order{ID: 5, Items: []order.OrderItem{
+		{ID: 1, Quantity: 3, Price: 200, PriceIncludesTax: true},
+		{ID: 2, Quantity: 1, Price: 300, TaxAmount: 60},
+	}}, nil)
+	repo.On("GetIntent", ctx, int64(9)).Return(pi, nil)
+	repo.On("CreateRefund", ctx, mock.MatchedBy(func(r *Refund) bool {
+		return r.Amount == 760 && len(r.Lines) == 2 && r.Lines[0].Amount == 400 && r.Lines[1].Amount == 360
+	})).Return(&Refund{ID: 3, IntentID: 9, Amount: 760, Status: RefundPending}, nil)
+	repo.On("FinishRefund", ctx, int64(3), mock.MatchedBy(func(gr *GatewayRefund) bool {
+		return gr.Status == RefundSucceeded && gr.ProviderID != ""
+	}), int64(1)).Return(&Refund{ID: 3, Amount: 760, Status: RefundSucceeded}, nil)
+
+	ref, err := svc.Refund(ctx, 1, 9, RefundInput{Lines: []RefundLineInput{
+		{OrderItemID: 1, Quantity: 2}, {OrderItemID: 2, Quantity: 1},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, RefundSucceeded, ref.Status)
+	repo.AssertExpectations(t)
+}
+
+func TestService_RefundAmountAboveLinesTotal(t *testing.T) {
+	ctx := context.Background()
+	repo, orders, g := new(mockRepo), new(mockOrders), NewFakeGateway()
+	svc := NewService(repo, orders, g)
+
+	orders.On("GetOrderByID", ctx, int64(5)).Return(&order.Order{ID: 5, Items: []order.OrderItem{
+		{ID: 1, Quantity: 1, Price: 200, PriceIncludesTax: true},
+	}}, nil)
+	repo.On("GetIntent", ctx, int64(9)).Return(paidIntent(t, g), nil)
+
+	_, err := svc.Refund(ctx, 1, 9, RefundInput{Amount: 500, Lines: []RefundLineInput{{OrderItemID: 1, Quantity: 1}}})
+	assert.ErrorIs(t, err, ErrInvalidRefund)
+	repo.AssertNotCalled(t, "CreateRefund", mock.Anything, mock.Anything)
+}
+
+func TestService_RefundUnpaidIntent(t *testing.T) {
+	ctx := context.Background()
+	repo, orders, g := new(mockRepo), new(mockOrders), NewFakeGateway()
+	svc := NewService(repo, orders, g)
+
+	repo.On("GetIntent", ctx, int64(9)).Return(newIntent(t, g), nil)
+
+	_, err := svc.Refund(ctx, 1, 9, RefundInput{Amount: 100})
+	assert.ErrorIs(t, err, ErrNotRefundable)
+}
+
+func TestService_RefundDeclinedByProvider(t *testing.T) {
+	ctx := context.Background()
+	repo, orders, g := new(mockRepo), new(mockOrders), NewFakeGateway()
+	svc := NewService(repo, orders, g)
+	pi := paidIntent(t, g)
+
+	// провайдер уже вернул всю сумму по другому каналу
+	_, err := g.Refund(ctx, RefundRequest{ProviderIntentID: *pi.ProviderIntentID, Amount: 1000})
+	require.NoError(t, err)
+
+	repo.On("GetIntent", ctx, int64(9)).Return(pi, nil)
+	repo.On("CreateRefund", ctx, mock.Anything).Return(&Refund{ID: 3, Amount: 100, Status: RefundPending}, nil)
+	repo.On("FinishRefund", ctx, int64(3), &GatewayRefund{Status: RefundFailed}, int64(1)).
+		Return(&Refund{ID: 3, Amount: 100, Status: RefundFailed}, nil)
+
+	ref, err := svc.Refund(ctx, 1, 9, RefundInput{Amount: 100})
+	assert.ErrorIs(t, err, ErrRefundDeclined)
+	assert.Equal(t, RefundFailed, ref.Status)
+}
+
+func TestService_RefundPendingAtProviderIsReconciled(t *testing.T) {
+	ctx := context.Background()
+	repo, orders, g := new(mockRepo), new(mockOrders), NewFakeGateway()
+	svc := NewService(repo, orders, g)
+	pi := paidIntent(t, g)
+	g.HoldRefunds()
+
+	repo.On("GetIntent", ctx, int64(9)).Return(pi, nil)
+	repo.On("CreateRefund", ctx, mock.Anything).Return(&Refund{ID: 3, IntentID: 9, Amount: 100, Status: RefundPending}, nil)
+	repo.On("FinishRefund", ctx, int64(3), mock.MatchedBy(func(gr *GatewayRefund) bool { return gr.Status == RefundPending }), int64(1)).
+		Return(&Refund{ID: 3, IntentID: 9, Amount: 100, Status: RefundPending}, nil).Once()
+
+	ref, err := svc.Refund(ctx, 1, 9, RefundInput{Amount: 100})
+	require.NoError(t, err)
+	assert.Equal(t, RefundPending, ref.Status)
+
+	// провайдер провел возврат позже; сверка узнает итог по id возврата у провайдера
+	g.SettleRefunds(RefundSucceeded)
+	providerID := "fake_re_2"
+	repo.On("ListPendingRefunds", ctx, time.Minute, 10).
+		Return([]Refund{{ID: 3, IntentID: 9, Amount: 100, Status: RefundPending, ProviderRefundID: &providerID}}, nil)
+	repo.On("FinishRefund", ctx, int64(3), &GatewayRefund{ProviderID: providerID, Status: RefundSucceeded}, int64(0)).
+		Return(&Refund{ID: 3, Amount: 100, Status: RefundSucceeded}, nil).Once()
+
+	n, err := svc.ReconcileRefunds(ctx, time.Minute, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	repo.AssertExpectations(t)
+}
+
+func TestService_ReconcileRefundWithoutProviderAnswer(t *testing.T) {
+	ctx := context.Background()
+	repo, orders, g := new(mockRepo), new(mockOrders), NewFakeGateway()
+	svc := NewService(repo, orders, g)
+	pi := paidIntent(t, g)
+
+	// ответ на первый запрос потерян, но провайдер возврат провел
+	first, err := g.Refund(ctx, RefundRequest{ProviderIntentID: *pi.ProviderIntentID, Amount: 600, IdempotencyKey: "refund-3"})
+	require.NoError(t, err)
+
+	repo.On("ListPendingRefunds", ctx, time.Minute, 10).
+		Return([]Refund{{ID: 3, IntentID: 9, Amount: 600, Status: RefundPending}}, nil)
+	repo.On("GetIntent", ctx, int64(9)).Return(pi, nil)
+	repo.On("FinishRefund", ctx, int64(3), first, int64(0)).
+		Return(&Refund{ID: 3, Amount: 600, Status: RefundSucceeded}, nil)
+
+	n, err := svc.ReconcileRefunds(ctx, time.Minute, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	// тот же ключ вернул первый возврат: новый возврат на 600 сверх 1000 провайдер отклонил бы
+	repo.AssertExpectations(t)
+}
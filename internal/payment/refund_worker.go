@@ -0,0 +1,51 @@
+package payment
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// refundSettleDelay — сколько ждать, прежде чем сверять возврат с провайдером:
+// свежий pending может еще закрыть запрос, который его создал.
+const refundSettleDelay = time.Minute
+
+// RefundWorker периодически сверяет возвраты, оставшиеся в pending, с провайдером.
+type RefundWorker struct {
+	svc       *Service
+	interval  time.Duration
+	batchSize int
+}
+
+func NewRefundWorker(svc *Service, interval time.Duration) *RefundWorker {
+	return &RefundWorker{svc: svc, interval: interval, batchSize: 100}
+}
+
+// Run блокируется до отмены ctx.
+func (w *RefundWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.tick(ctx)
+		}
+	}
+}
+
+func (w *RefundWorker) tick(ctx context.Context) {
+	n, err := w.svc.ReconcileRefunds(ctx, refundSettleDelay, w.batchSize)
+	if err != nil {
+		if ctx.Err() == nil {
+			zap.L().Error("Failed to reconcile refunds", zap.Error(err))
+		}
+		return
+	}
+	if n > 0 {
+		zap.L().Info("Reconciled refunds", zap.Int("count", n))
+	}
+}
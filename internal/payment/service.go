@@ -2,38 +2,344 @@ package payment
 
 import (
 	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
 	"marketplace/internal/order"
+	"marketplace/internal/wallet"
+	"time"
+
+	"go.uber.org/zap"
 )
 
 type Repository interface {
-	CreateIntent(ctx context.Context, o *order.Order) (*Intent, error)
-	ConfirmIntent(ctx context.Context, orderID int64, clientSecret string) (*Intent, error)
+	// CreateIntent переводит заказ new -> awaiting_payment и сохраняет платеж провайдера
+	// на сумму заказа за вычетом walletAmount; walletAmount списывается с кошелька
+	// покупателя в той же транзакции, либо ничего не сохраняется.
+	CreateIntent(ctx context.Context, o *order.Order, walletAmount int64, provider string, gi *GatewayIntent, expiresAt time.Time, actorID int64) (*Intent, error)
+	// PayWithWallet оплачивает заказ в new целиком из кошелька покупателя: new -> awaiting_payment -> paid.
+	PayWithWallet(ctx context.Context, o *order.Order, actorID int64) (*Intent, error)
+	// WalletBalance — остаток кошелька покупателя в валюте; 0, если кошелька нет.
+	WalletBalance(ctx context.Context, userID int64, currency string) (int64, error)
+	// AddAttempt сохраняет новую попытку оплаты заказа в awaiting_payment на неоплаченный остаток;
+	// ErrIntentActive, если у заказа уже есть активное намерение.
+	AddAttempt(ctx context.Context, o *order.Order, provider string, gi *GatewayIntent, expiresAt time.Time) (*Intent, error)
+	// ListIntents возвращает все попытки оплаты заказа, от старых к новым.
+	ListIntents(ctx context.Context, orderID int64) ([]Intent, error)
+	// ListExpiredIntents возвращает активные намерения с истекшим сроком.
+	ListExpiredIntents(ctx context.Context, limit int) ([]Intent, error)
+	// GetActiveIntent возвращает неоплаченное намерение заказа; sql.ErrNoRows, если его нет.
+	// Expired сравнивает срок с часами БД, как ListExpiredIntents, а не с часами приложения.
+	GetActiveIntent(ctx context.Context, orderID int64) (*Intent, error)
+	// MarkSucceeded отмечает намерение оплаченным и переводит заказ в paid в одной транзакции.
+	// Если заказ уже не ждет оплаты, платеж все равно проводится и записывается к компенсации:
+	// возвращается намерение и ErrOrphanCapture. ErrIntentNotFound — намерение уже не активно.
+	MarkSucceeded(ctx context.Context, intentID, actorID int64) (*Intent, error)
+	// UpdateIntentStatus сохраняет состояние платежа у провайдера, кроме succeeded.
+	UpdateIntentStatus(ctx context.Context, intentID int64, gi *GatewayIntent) (*Intent, error)
+
+	GetIntent(ctx context.Context, intentID int64) (*Intent, error)
+	// CreateRefund резервирует сумму на намерении и сохраняет возврат в статусе pending.
+	// Если по намерению уже ждет ответа провайдера возврат на ту же сумму, возвращает его.
+	CreateRefund(ctx context.Context, r *Refund) (*Refund, error)
+	// ListPendingRefunds возвращает возвраты в pending, не менявшиеся дольше olderThan.
+	ListPendingRefunds(ctx context.Context, olderThan time.Duration, limit int) ([]Refund, error)
+	// FinishRefund сохраняет ответ провайдера: failed снимает резерв,
+	// а полный возврат переводит заказ в refunded в той же транзакции.
+	// Если возврат уже закрыт параллельным вызовом, возвращает его без изменений.
+	FinishRefund(ctx context.Context, refundID int64, gr *GatewayRefund, actorID int64) (*Refund, error)
+	// ApplyEvent один раз применяет уведомление провайдера к намерению и заказу
+	// и возвращает один из Webhook*; повтор того же события — WebhookDuplicate.
+	ApplyEvent(ctx context.Context, provider string, ev *ProviderEvent) (string, error)
 }
 
 type OrderRepository interface {
 	GetOrderWithItems(ctx context.Context, userID, orderID int64) (*order.Order, error)
+	GetOrderByID(ctx context.Context, orderID int64) (*order.Order, error)
 }
 
 type Service struct {
 	payRepo Repository
 	ordRepo OrderRepository
+	gateway Gateway
+
+	intentTTL        time.Duration
+	webhookSecret    string
+	webhookTolerance time.Duration
+	now              func() time.Time
+}
+
+// DefaultIntentTTL — сколько намерение ждет подтверждения, прежде чем его отменит ExpiryWorker.
+const DefaultIntentTTL = 15 * time.Minute
+
+type Option func(*Service)
+
+func WithIntentTTL(ttl time.Duration) Option {
+	return func(s *Service) {
+		if ttl > 0 {
+			s.intentTTL = ttl
+		}
+	}
+}
+
+// WithWebhooks включает прием уведомлений провайдера, подписанных secret.
+// Без него POST /payments/webhooks/:provider отвечает 404.
+func WithWebhooks(secret string, tolerance time.Duration) Option {
+	return func(s *Service) {
+		s.webhookSecret = secret
+		if tolerance > 0 {
+			s.webhookTolerance = tolerance
+		}
+	}
 }
 
-func NewService(payRepo Repository, ordRepo OrderRepository) *Service {
-	return &Service{payRepo: payRepo, ordRepo: ordRepo}
+func NewService(payRepo Repository, ordRepo OrderRepository, gateway Gateway, opts ...Option) *Service {
+	s := &Service{
+		payRepo:          payRepo,
+		ordRepo:          ordRepo,
+		gateway:          gateway,
+		intentTTL:        DefaultIntentTTL,
+		webhookTolerance: DefaultWebhookTolerance,
+		now:              time.Now,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// IntentOptions — как покупатель платит за заказ.
+type IntentOptions struct {
+	// WalletAmount — сколько списать с кошелька, в минорных единицах валюты заказа;
+	// остаток оплачивается у провайдера
+	WalletAmount int64
+}
+
+// CreateIntent начинает оплату заказа. Часть из кошелька списывается сразу вместе
+// с созданием платежа на остаток; если кошелек покрывает весь заказ, заказ сразу оплачен
+// и возвращается намерение кошелька.
+func (s *Service) CreateIntent(ctx context.Context, userID, orderID int64, opts IntentOptions) (*Intent, error) {
+	o, err := s.ordRepo.GetOrderWithItems(ctx, userID, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if o.Status != order.StatusNew {
+		return nil, ErrOrderNotPayable
+	}
+	fromWallet := opts.WalletAmount
+	if fromWallet < 0 || fromWallet > o.TotalAmount {
+		return nil, fmt.Errorf("%w: must be between 0 and order total %d", ErrInvalidWalletAmount, o.TotalAmount)
+	}
+	key := fmt.Sprintf("order-%d", o.ID)
+	if fromWallet > 0 {
+		// проверка до обращения к провайдеру; от гонок защищает условное списание в БД
+		balance, err := s.payRepo.WalletBalance(ctx, o.UserID, o.Currency)
+		if err != nil {
+			return nil, err
+		}
+		if balance < fromWallet {
+			return nil, fmt.Errorf("%w: %d %s available", wallet.ErrInsufficientFunds, balance, o.Currency)
+		}
+		if fromWallet == o.TotalAmount {
+			return s.payRepo.PayWithWallet(ctx, o, userID)
+		}
+		key = fmt.Sprintf("order-%d-wallet-%d", o.ID, fromWallet)
+	}
+	return s.open(ctx, o, o.TotalAmount-fromWallet, key, func(gi *GatewayIntent, expiresAt time.Time) (*Intent, error) {
+		return s.payRepo.CreateIntent(ctx, o, fromWallet, s.gateway.Name(), gi, expiresAt, userID)
+	})
 }
 
-func (s *Service) CreateIntent(ctx context.Context, userID, orderID int64) (*Intent, error) {
+// Retry начинает новую попытку оплаты заказа в awaiting_payment, например после отказа банка.
+// Прошлые намерения остаются в истории; активное нужно сначала отменить.
+func (s *Service) Retry(ctx context.Context, userID, orderID int64) (*Intent, error) {
 	o, err := s.ordRepo.GetOrderWithItems(ctx, userID, orderID)
 	if err != nil {
 		return nil, err
 	}
-	return s.payRepo.CreateIntent(ctx, o)
+	if o.Status != order.StatusAwaitingPayment {
+		return nil, ErrOrderNotPayable
+	}
+	intents, err := s.payRepo.ListIntents(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	var lastID int64
+	due := o.TotalAmount
+	for _, pi := range intents {
+		if pi.Active() {
+			return nil, ErrIntentActive
+		}
+		// до оплаты заказа успешным может быть только списание с кошелька
+		if pi.Status == StatusSucceeded {
+			due -= pi.Amount
+		}
+		lastID = pi.ID
+	}
+	// ключ привязан к прошлой попытке: повтор запроса не создаст у провайдера второй платеж
+	key := fmt.Sprintf("order-%d-retry-%d", o.ID, lastID)
+	return s.open(ctx, o, due, key, func(gi *GatewayIntent, expiresAt time.Time) (*Intent, error) {
+		return s.payRepo.AddAttempt(ctx, o, s.gateway.Name(), gi, expiresAt)
+	})
+}
+
+// open создает платеж у провайдера на amount и сохраняет намерение через save.
+func (s *Service) open(ctx context.Context, o *order.Order, amount int64, idemKey string, save func(*GatewayIntent, time.Time) (*Intent, error)) (*Intent, error) {
+	gi, err := s.gateway.CreateIntent(ctx, CreateIntentRequest{
+		OrderID:        o.ID,
+		Amount:         amount,
+		Currency:       o.Currency,
+		IdempotencyKey: idemKey,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create provider intent: %w", err)
+	}
+	pi, err := save(gi, s.now().Add(s.intentTTL))
+	if err != nil {
+		// заказ успели оплатить или отменить параллельно: платеж у провайдера не нужен
+		if _, cerr := s.gateway.Cancel(ctx, gi.ProviderID); cerr != nil {
+			zap.L().Warn("Failed to cancel orphan provider intent", zap.String("provider_id", gi.ProviderID), zap.Error(cerr))
+		}
+		return nil, err
+	}
+	return pi, nil
+}
+
+// Intents возвращает историю попыток оплаты заказа покупателя.
+func (s *Service) Intents(ctx context.Context, userID, orderID int64) ([]Intent, error) {
+	if _, err := s.ordRepo.GetOrderWithItems(ctx, userID, orderID); err != nil {
+		return nil, err
+	}
+	return s.payRepo.ListIntents(ctx, orderID)
 }
 
 func (s *Service) Confirm(ctx context.Context, userID, orderID int64, clientSecret string) (*Intent, error) {
+	o, err := s.ordRepo.GetOrderWithItems(ctx, userID, orderID)
+	if err != nil {
+		return nil, err
+	}
+	// деньги не списываем, если заказ уже оплачен другой попыткой или отменен
+	if o.Status != order.StatusAwaitingPayment {
+		return nil, ErrOrderNotPayable
+	}
+	pi, err := s.activeIntent(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(pi.ClientSecret), []byte(clientSecret)) != 1 {
+		return nil, ErrInvalidSecret
+	}
+	if pi.Expired {
+		if _, err = s.expire(ctx, pi); err != nil {
+			return nil, err
+		}
+		return nil, ErrIntentExpired
+	}
+	if pi.ProviderIntentID == nil {
+		return nil, fmt.Errorf("intent %d has no provider payment: %w", pi.ID, ErrIntentNotFound)
+	}
+	gi, err := s.gateway.Confirm(ctx, *pi.ProviderIntentID)
+	if err != nil {
+		return nil, fmt.Errorf("confirm provider intent: %w", err)
+	}
+	return s.apply(ctx, pi, gi, userID)
+}
+
+// Cancel отменяет активное намерение заказа; заказ остается ждать оплаты новой попыткой.
+// Если провайдер успел списать деньги, платеж применяется и возвращается ErrPaymentCaptured.
+func (s *Service) Cancel(ctx context.Context, userID, orderID int64) (*Intent, error) {
 	if _, err := s.ordRepo.GetOrderWithItems(ctx, userID, orderID); err != nil {
 		return nil, err
 	}
-	return s.payRepo.ConfirmIntent(ctx, orderID, clientSecret)
+	pi, err := s.activeIntent(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	return s.cancel(ctx, pi, "", userID)
+}
+
+// ExpireIntents отменяет до limit намерений с истекшим сроком и возвращает, сколько обработано.
+// Намерения, которые не удалось отменить у провайдера, останутся до следующего прохода.
+func (s *Service) ExpireIntents(ctx context.Context, limit int) (int, error) {
+	intents, err := s.payRepo.ListExpiredIntents(ctx, limit)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for i := range intents {
+		pi := &intents[i]
+		if _, err = s.expire(ctx, pi); err != nil && !errors.Is(err, ErrPaymentCaptured) {
+			zap.L().Warn("Failed to expire payment intent", zap.Int64("intent_id", pi.ID), zap.Error(err))
+			continue
+		}
+		n++
+	}
+	return n, nil
+}
+
+func (s *Service) expire(ctx context.Context, pi *Intent) (*Intent, error) {
+	return s.cancel(ctx, pi, "expired", 0)
+}
+
+// cancel отменяет платеж у провайдера и сохраняет итог; reason попадает в failure_reason.
+func (s *Service) cancel(ctx context.Context, pi *Intent, reason string, actorID int64) (*Intent, error) {
+	gi := &GatewayIntent{Status: StatusCancelled}
+	if pi.ProviderIntentID != nil {
+		var err error
+		if gi, err = s.gateway.Cancel(ctx, *pi.ProviderIntentID); err != nil {
+			return nil, fmt.Errorf("cancel provider intent: %w", err)
+		}
+	}
+	if gi.Status == StatusSucceeded {
+		captured, err := s.markSucceeded(ctx, pi, actorID)
+		if err != nil && !errors.Is(err, ErrOrphanCapture) {
+			return nil, err
+		}
+		return captured, ErrPaymentCaptured
+	}
+	if gi.Status != StatusFailed {
+		gi.Status = StatusCancelled
+	}
+	if reason != "" {
+		gi.FailureReason = reason
+	}
+	return s.payRepo.UpdateIntentStatus(ctx, pi.ID, gi)
+}
+
+func (s *Service) activeIntent(ctx context.Context, orderID int64) (*Intent, error) {
+	pi, err := s.payRepo.GetActiveIntent(ctx, orderID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrIntentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pi, nil
+}
+
+// markSucceeded проводит списание провайдера; списание за закрытый заказ требует возврата.
+func (s *Service) markSucceeded(ctx context.Context, pi *Intent, actorID int64) (*Intent, error) {
+	captured, err := s.payRepo.MarkSucceeded(ctx, pi.ID, actorID)
+	if errors.Is(err, ErrOrphanCapture) {
+		zap.L().Error("Payment captured for order that cannot be paid, refund required",
+			zap.Int64("intent_id", pi.ID), zap.Int64("order_id", pi.OrderID))
+	}
+	return captured, err
+}
+
+// apply переносит состояние платежа у провайдера на намерение и заказ.
+func (s *Service) apply(ctx context.Context, pi *Intent, gi *GatewayIntent, actorID int64) (*Intent, error) {
+	switch gi.Status {
+	case StatusSucceeded:
+		return s.markSucceeded(ctx, pi, actorID)
+	case StatusFailed:
+		updated, err := s.payRepo.UpdateIntentStatus(ctx, pi.ID, gi)
+		if err != nil {
+			return nil, err
+		}
+		return updated, fmt.Errorf("%w: %s", ErrPaymentDeclined, gi.FailureReason)
+	default:
+		return s.payRepo.UpdateIntentStatus(ctx, pi.ID, gi)
+	}
 }
@@ -0,0 +1,189 @@
+package payment
+
+import (
+	"context"
+	"marketplace/internal/order"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type mockRepo struct {
+	mock.Mock
+}
+
+func (m *mockRepo) CreateIntent(ctx context.Context, o *order.Order, walletAmount int64, provider string, gi *GatewayIntent, expiresAt time.Time, actorID int64) (*Intent, error) {
+	args := m.Called(ctx, o, walletAmount, provider, gi, expiresAt, actorID)
+	pi, _ := args.Get(0).(*Intent)
+	return pi, args.Error(1)
+}
+
+func (m *mockRepo) PayWithWallet(ctx context.Context, o *order.Order, actorID int64) (*Intent, error) {
+	args := m.Called(ctx, o, actorID)
+	pi, _ := args.Get(0).(*Intent)
+	return pi, args.Error(1)
+}
+
+func (m *mockRepo) WalletBalance(ctx context.Context, userID int64, currency string) (int64, error) {
+	args := m.Called(ctx, userID, currency)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *mockRepo) AddAttempt(ctx context.Context, o *order.Order, provider string, gi *GatewayIntent, expiresAt time.Time) (*Intent, error) {
+	args := m.Called(ctx, o, provider, gi, expiresAt)
+	pi, _ := args.Get(0).(*Intent)
+	return pi, args.Error(1)
+}
+
+func (m *mockRepo) ListIntents(ctx context.Context, orderID int64) ([]Intent, error) {
+	args := m.Called(ctx, orderID)
+	intents, _ := args.Get(0).([]Intent)
+	return intents, args.Error(1)
+}
+
+func (m *mockRepo) ListExpiredIntents(ctx context.Context, limit int) ([]Intent, error) {
+	args := m.Called(ctx, limit)
+	intents, _ := args.Get(0).([]Intent)
+	return intents, args.Error(1)
+}
+
+func (m *mockRepo) GetActiveIntent(ctx context.Context, orderID int64) (*Intent, error) {
+	args := m.Called(ctx, orderID)
+	pi, _ := args.Get(0).(*Intent)
+	return pi, args.Error(1)
+}
+
+func (m *mockRepo) MarkSucceeded(ctx context.Context, intentID, actorID int64) (*Intent, error) {
+	args := m.Called(ctx, intentID, actorID)
+	pi, _ := args.Get(0).(*Intent)
+	return pi, args.Error(1)
+}
+
+func (m *mockRepo) UpdateIntentStatus(ctx context.Context, intentID int64, gi *GatewayIntent) (*Intent, error) {
+	args := m.Called(ctx, intentID, gi)
+	pi, _ := args.Get(0).(*Intent)
+	return pi, args.Error(1)
+}
+
+func (m *mockRepo) GetIntent(ctx context.Context, intentID int64) (*Intent, error) {
+	args := m.Called(ctx, intentID)
+	pi, _ := args.Get(0).(*Intent)
+	return pi, args.Error(1)
+}
+
+func (m *mockRepo) CreateRefund(ctx context.Context, r *Refund) (*Refund, error) {
+	args := m.Called(ctx, r)
+	ref, _ := args.Get(0).(*Refund)
+	return ref, args.Error(1)
+}
+
+func (m *mockRepo) ListPendingRefunds(ctx context.Context, olderThan time.Duration, limit int) ([]Refund, error) {
+	args := m.Called(ctx, olderThan, limit)
+	refunds, _ := args.Get(0).([]Refund)
+	return refunds, args.Error(1)
+}
+
+func (m *mockRepo) FinishRefund(ctx context.Context, refundID int64, gr *GatewayRefund, actorID int64) (*Refund, error) {
+	args := m.Called(ctx, refundID, gr, actorID)
+	ref, _ := args.Get(0).(*Refund)
+	return ref, args.Error(1)
+}
+
+func (m *mockRepo) ApplyEvent(ctx context.Context, provider string, ev *ProviderEvent) (string, error) {
+	args := m.Called(ctx, provider, ev)
+	return args.String(0), args.Error(1)
+}
+
+type mockOrders struct {
+	mock.Mock
+}
+
+func (m *mockOrders) GetOrderWithItems(ctx context.Context, userID, orderID int64) (*order.Order, error) {
+	args := m.Called(ctx, userID, orderID)
+	o, _ := args.Get(0).(*order.Order)
+	return o, args.Error(1)
+}
+
+func (m *mockOrders) GetOrderByID(ctx context.Context, orderID int64) (*order.Order, error) {
+	args := m.Called(ctx, orderID)
+	o, _ := args.Get(0).(*order.Order)
+	return o, args.Error(1)
+}
+
+var awaiting = &order.Order{ID: 5, Status: order.StatusAwaitingPayment, TotalAmount: 1000}
+
+// newIntent создает платеж в фейковом провайдере и соответствующее ему намерение.
+func newIntent(t *testing.T, g *FakeGateway) *Intent {
+	gi, err := g.CreateIntent(context.Background(), CreateIntentRequest{OrderID: 5, Amount: 1000})
+	require.NoError(t, err)
+	return &Intent{ID: 9, OrderID: 5, Amount: 1000, Status: StatusRequiresConfirmation,
+		ClientSecret: gi.ClientSecret, Provider: g.Name(), ProviderIntentID: &gi.ProviderID}
+}
+
+func TestService_Confirm3DSThenSucceeds(t *testing.T) {
+	ctx := context.Background()
+	repo, orders, g := new(mockRepo), new(mockOrders), NewFakeGateway()
+	g.Script(OutcomeRequire3DS)
+	svc := NewService(repo, orders, g)
+	pi := newIntent(t, g)
+
+	orders.On("GetOrderWithItems", ctx, int64(1), int64(5)).Return(awaiting, nil)
+	repo.On("GetActiveIntent", ctx, int64(5)).Return(pi, nil)
+	repo.On("UpdateIntentStatus", ctx, int64(9), mock.MatchedBy(func(gi *GatewayIntent) bool {
+		return gi.Status == StatusRequiresAction && gi.NextActionURL != ""
+	})).Return(&Intent{ID: 9, Status: StatusRequiresAction}, nil).Once()
+	repo.On("MarkSucceeded", ctx, int64(9), int64(1)).Return(&Intent{ID: 9, Status: StatusSucceeded}, nil).Once()
+
+	got, err := svc.Confirm(ctx, 1, 5, pi.ClientSecret)
+	require.NoError(t, err)
+	assert.Equal(t, StatusRequiresAction, got.Status)
+
+	got, err = svc.Confirm(ctx, 1, 5, pi.ClientSecret)
+	require.NoError(t, err)
+	assert.Equal(t, StatusSucceeded, got.Status)
+	repo.AssertExpectations(t)
+}
+
+func TestService_ConfirmDeclined(t *testing.T) {
+	ctx := context.Background()
+	repo, orders, g := new(mockRepo), new(mockOrders), NewFakeGateway()
+	g.Script(OutcomeDecline)
+	svc := NewService(repo, orders, g)
+	pi := newIntent(t, g)
+
+	orders.On("GetOrderWithItems", ctx, int64(1), int64(5)).Return(awaiting, nil)
+	repo.On("GetActiveIntent", ctx, int64(5)).Return(pi, nil)
+	repo.On("UpdateIntentStatus", ctx, int64(9), mock.Anything).Return(&Intent{ID: 9, Status: StatusFailed}, nil)
+
+	_, err := svc.Confirm(ctx, 1, 5, pi.ClientSecret)
+	assert.ErrorIs(t, err, ErrPaymentDeclined)
+	repo.AssertNotCalled(t, "MarkSucceeded", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestService_ConfirmWrongSecret(t *testing.T) {
+	ctx := context.Background()
+	repo, orders, g := new(mockRepo), new(mockOrders), NewFakeGateway()
+	svc := NewService(repo, orders, g)
+	pi := newIntent(t, g)
+
+	orders.On("GetOrderWithItems", ctx, int64(1), int64(5)).Return(awaiting, nil)
+	repo.On("GetActiveIntent", ctx, int64(5)).Return(pi, nil)
+
+	_, err := svc.Confirm(ctx, 1, 5, "guess")
+	assert.ErrorIs(t, err, ErrInvalidSecret)
+}
+
+func TestService_CreateIntentRequiresNewOrder(t *testing.T) {
+	ctx := context.Background()
+	repo, orders := new(mockRepo), new(mockOrders)
+	svc := NewService(repo, orders, NewFakeGateway())
+
+	orders.On("GetOrderWithItems", ctx, int64(1), int64(5)).Return(&order.Order{ID: 5, Status: order.StatusPaid}, nil)
+
+	_, err := svc.CreateIntent(ctx, 1, 5, IntentOptions{})
+	assert.ErrorIs(t, err, ErrOrderNotPayable)
+	repo.AssertNotCalled(t, "CreateIntent", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
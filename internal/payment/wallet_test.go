@@ -0,0 +1,129 @@
+package payment
+
+import (
+	"context"
+	"marketplace/internal/order"
+	"marketplace/internal/wallet"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var unpaid = &order.Order{ID: 5, UserID: 1, Status: order.StatusNew, Currency: "RUB", TotalAmount: 1000}
+
+func TestService_CreateIntentSplitsWalletAndProvider(t *testing.T) {
+	ctx := context.Background()
+	repo, orders, g := new(mockRepo), new(mockOrders), NewFakeGateway()
+	svc := NewService(repo, orders, g)
+
+	orders.On("GetOrderWithItems", ctx, int64(1), int64(5)).Return(unpaid, nil)
+	repo.On("WalletBalance", ctx, int64(1), "RUB").Return(int64(500), nil)
+	repo.On("CreateIntent", ctx, unpaid, int64(300), "fake", mock.Anything, mock.Anything, int64(1)).
+		Return(&Intent{ID: 10, Amount: 700, Status: StatusRequiresConfirmation}, nil)
+
+	pi, err := svc.CreateIntent(ctx, 1, 5, IntentOptions{WalletAmount: 300})
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), pi.ID)
+	// у провайдера платят только остаток
+	require.Len(t, g.intents, 1)
+	for _, in := range g.intents {
+		assert.Equal(t, int64(700), in.amount)
+	}
+	repo.AssertExpectations(t)
+}
+
+func TestService_CreateIntentPaidFromWallet(t *testing.T) {
+	ctx := context.Background()
+	repo, orders, g := new(mockRepo), new(mockOrders), NewFakeGateway()
+	svc := NewService(repo, orders, g)
+
+	orders.On("GetOrderWithItems", ctx, int64(1), int64(5)).Return(unpaid, nil)
+	repo.On("WalletBalance", ctx, int64(1), "RUB").Return(int64(1000), nil)
+	repo.On("PayWithWallet", ctx, unpaid, int64(1)).
+		Return(&Intent{ID: 11, Amount: 1000, Provider: WalletProvider, Status: StatusSucceeded}, nil)
+
+	pi, err := svc.CreateIntent(ctx, 1, 5, IntentOptions{WalletAmount: 1000})
+	require.NoError(t, err)
+	assert.Equal(t, StatusSucceeded, pi.Status)
+	assert.Empty(t, g.intents)
+	repo.AssertExpectations(t)
+}
+
+func TestService_CreateIntentInsufficientWallet(t *testing.T) {
+	ctx := context.Background()
+	repo, orders, g := new(mockRepo), new(mockOrders), NewFakeGateway()
+	svc := NewService(repo, orders, g)
+
+	orders.On("GetOrderWithItems", ctx, int64(1), int64(5)).Return(unpaid, nil)
+	repo.On("WalletBalance", ctx, int64(1), "RUB").Return(int64(200), nil)
+
+	_, err := svc.CreateIntent(ctx, 1, 5, IntentOptions{WalletAmount: 300})
+	assert.ErrorIs(t, err, wallet.ErrInsufficientFunds)
+	assert.Empty(t, g.intents)
+
+	_, err = svc.CreateIntent(ctx, 1, 5, IntentOptions{WalletAmount: 1001})
+	assert.ErrorIs(t, err, ErrInvalidWalletAmount)
+}
+
+func TestService_CreateIntentWalletRaceCancelsProviderIntent(t *testing.T) {
+	ctx := context.Background()
+	repo, orders, g := new(mockRepo), new(mockOrders), NewFakeGateway()
+	svc := NewService(repo, orders, g)
+
+	orders.On("GetOrderWithItems", ctx, int64(1), int64(5)).Return(unpaid, nil)
+	repo.On("WalletBalance", ctx, int64(1), "RUB").Return(int64(300), nil)
+	// параллельная покупка успела потратить кошелек между проверкой и списанием
+	repo.On("CreateIntent", ctx, unpaid, int64(300), "fake", mock.Anything, mock.Anything, int64(1)).
+		Return(nil, wallet.ErrInsufficientFunds)
+
+	_, err := svc.CreateIntent(ctx, 1, 5, IntentOptions{WalletAmount: 300})
+	assert.ErrorIs(t, err, wallet.ErrInsufficientFunds)
+	require.Len(t, g.intents, 1)
+	for _, in := range g.intents {
+		assert.Equal(t, StatusCancelled, in.Status)
+	}
+}
+
+func TestService_RetryChargesRemainderAfterWallet(t *testing.T) {
+	ctx := context.Background()
+	repo, orders, g := new(mockRepo), new(mockOrders), NewFakeGateway()
+	svc := NewService(repo, orders, g)
+	failed := newIntent(t, g)
+	failed.Status = StatusFailed
+
+	orders.On("GetOrderWithItems", ctx, int64(1), int64(5)).Return(awaiting, nil)
+	repo.On("ListIntents", ctx, int64(5)).Return([]Intent{
+		{ID: 8, OrderID: 5, Amount: 400, Provider: WalletProvider, Status: StatusSucceeded},
+		*failed,
+	}, nil)
+	repo.On("AddAttempt", ctx, awaiting, "fake", mock.Anything, mock.Anything).
+		Return(&Intent{ID: 10, Amount: 600, Status: StatusRequiresConfirmation}, nil)
+
+	_, err := svc.Retry(ctx, 1, 5)
+	require.NoError(t, err)
+	var amounts []int64
+	for _, in := range g.intents {
+		amounts = append(amounts, in.amount)
+	}
+	assert.ElementsMatch(t, []int64{1000, 600}, amounts)
+}
+
+func TestService_RefundWalletIntentSkipsProvider(t *testing.T) {
+	ctx := context.Background()
+	repo, orders, g := new(mockRepo), new(mockOrders), NewFakeGateway()
+	svc := NewService(repo, orders, g)
+
+	repo.On("GetIntent", ctx, int64(8)).Return(&Intent{ID: 8, OrderID: 5, Amount: 400, Provider: WalletProvider, Status: StatusSucceeded}, nil)
+	repo.On("CreateRefund", ctx, mock.MatchedBy(func(r *Refund) bool { return r.Amount == 150 })).
+		Return(&Refund{ID: 4, IntentID: 8, Amount: 150, Status: RefundPending}, nil)
+	repo.On("FinishRefund", ctx, int64(4), &GatewayRefund{Status: RefundSucceeded}, int64(2)).
+		Return(&Refund{ID: 4, Amount: 150, Status: RefundSucceeded}, nil)
+
+	ref, err := svc.Refund(ctx, 2, 8, RefundInput{Amount: 150})
+	require.NoError(t, err)
+	assert.Equal(t, RefundSucceeded, ref.Status)
+	assert.Empty(t, g.refunds)
+	repo.AssertExpectations(t)
+}
@@ -0,0 +1,122 @@
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"marketplace/internal/webhook"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DefaultWebhookTolerance — допустимое расхождение метки времени уведомления с нашими часами.
+const DefaultWebhookTolerance = 5 * time.Minute
+
+var (
+	ErrUnknownProvider  = errors.New("unknown payment provider")
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrInvalidEvent     = errors.New("invalid webhook event")
+)
+
+// Что сделали с уведомлением провайдера.
+const (
+	WebhookApplied   = "applied"
+	WebhookDuplicate = "duplicate"
+	// WebhookIgnored — платеж не найден или событие устарело относительно сохраненного статуса
+	WebhookIgnored = "ignored"
+	// WebhookOrphanCapture — деньги списаны, но заказ уже нельзя оплатить (например, отменен по таймауту)
+	WebhookOrphanCapture = "orphan_capture"
+)
+
+// ProviderEvent — уведомление провайдера с состоянием платежа на момент события.
+type ProviderEvent struct {
+	ID     string
+	Type   string
+	Intent GatewayIntent
+}
+
+// apiEvent — уведомление в формате API провайдера:
+// {"id": "evt_1", "type": "payment_intent.succeeded", "data": {"object": {...платеж...}}}.
+type apiEvent struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		Object apiIntent `json:"object"`
+	} `json:"data"`
+}
+
+func parseAPIEvent(body []byte) (*ProviderEvent, error) {
+	var e apiEvent
+	if err := json.Unmarshal(body, &e); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+	if e.ID == "" || e.Data.Object.ID == "" {
+		return nil, fmt.Errorf("%w: event id and payment id required", ErrInvalidEvent)
+	}
+	return &ProviderEvent{ID: e.ID, Type: e.Type, Intent: *e.Data.Object.intent()}, nil
+}
+
+// ProviderStatusApplies сообщает, можно ли перевести намерение из from в to по уведомлению.
+// События приходят в любом порядке, поэтому статус только продвигается вперед:
+// ожидающий платеж может стать любым, а failed и cancelled уступают только succeeded —
+// провайдер списал деньги, значит платеж состоялся. Succeeded окончателен.
+func ProviderStatusApplies(from, to string) bool {
+	switch from {
+	case StatusRequiresConfirmation, StatusRequiresAction:
+		return to != StatusRequiresConfirmation || from == to
+	case StatusFailed, StatusCancelled:
+		return to == StatusSucceeded
+	default:
+		return false
+	}
+}
+
+// Notification — входящий запрос провайдера в том виде, в каком он пришел.
+type Notification struct {
+	Provider  string
+	Timestamp string
+	Signature string
+	Body      []byte
+}
+
+// HandleWebhook проверяет подпись уведомления и применяет его к намерению и заказу.
+func (s *Service) HandleWebhook(ctx context.Context, n Notification) (string, error) {
+	if s.webhookSecret == "" || n.Provider != s.gateway.Name() {
+		return "", ErrUnknownProvider
+	}
+	ts, err := strconv.ParseInt(n.Timestamp, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("%w: bad timestamp", ErrInvalidSignature)
+	}
+	if skew := s.now().Sub(time.Unix(ts, 0)).Abs(); skew > s.webhookTolerance {
+		return "", fmt.Errorf("%w: timestamp outside tolerance", ErrInvalidSignature)
+	}
+	if !webhook.Verify(s.webhookSecret, ts, n.Body, n.Signature) {
+		return "", ErrInvalidSignature
+	}
+
+	ev, err := s.gateway.ParseEvent(n.Body)
+	if err != nil {
+		return "", err
+	}
+	result, err := s.payRepo.ApplyEvent(ctx, n.Provider, ev)
+	if err != nil {
+		return "", err
+	}
+	fields := []zap.Field{
+		zap.String("provider", n.Provider),
+		zap.String("event_id", ev.ID),
+		zap.String("event_type", ev.Type),
+		zap.String("provider_intent_id", ev.Intent.ProviderID),
+		zap.String("result", result),
+	}
+	if result == WebhookOrphanCapture {
+		zap.L().Error("Payment captured for order that cannot be paid, refund required", fields...)
+	} else {
+		zap.L().Info("Payment webhook processed", fields...)
+	}
+	return result, nil
+}
@@ -0,0 +1,108 @@
+package payment
+
+import (
+	"context"
+	"marketplace/internal/webhook"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const testWebhookSecret = "whsec"
+
+func signedNotification(now time.Time, body string) Notification {
+	return Notification{
+		Provider:  "fake",
+		Timestamp: strconv.FormatInt(now.Unix(), 10),
+		Signature: webhook.Sign(testWebhookSecret, now.Unix(), []byte(body)),
+		Body:      []byte(body),
+	}
+}
+
+func newWebhookService(repo *mockRepo, now time.Time) *Service {
+	svc := NewService(repo, new(mockOrders), NewFakeGateway(), WithWebhooks(testWebhookSecret, time.Minute))
+	svc.now = func() time.Time { return now }
+	return svc
+}
+
+func TestService_HandleWebhookApplies(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1_700_000_000, 0)
+	repo := new(mockRepo)
+	svc := newWebhookService(repo, now)
+
+	repo.On("ApplyEvent", ctx, "fake", &ProviderEvent{
+		ID:     "evt_1",
+		Type:   "payment_intent.payment_failed",
+		Intent: GatewayIntent{ProviderID: "fake_pi_1", Status: StatusFailed, FailureReason: "card_declined"},
+	}).Return(WebhookApplied, nil)
+
+	result, err := svc.HandleWebhook(ctx, signedNotification(now, `{"id":"evt_1","type":"payment_intent.payment_failed",
+		"data":{"object":{"id":"fake_pi_1","status":"requires_payment_method","last_error":{"code":"card_declined"}}}}`))
+	require.NoError(t, err)
+	assert.Equal(t, WebhookApplied, result)
+	repo.AssertExpectations(t)
+}
+
+func TestService_HandleWebhookRejects(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	body := `{"id":"evt_1","type":"payment_intent.succeeded","data":{"object":{"id":"fake_pi_1","status":"succeeded"}}}`
+
+	tampered := signedNotification(now, body)
+	tampered.Body = []byte(`{"id":"evt_1","type":"payment_intent.succeeded","data":{"object":{"id":"fake_pi_2","status":"succeeded"}}}`)
+	otherProvider := signedNotification(now, body)
+	otherProvider.Provider = "acme"
+
+	tests := []struct {
+		name string
+		n    Notification
+		want error
+	}{
+		{"tampered body", tampered, ErrInvalidSignature},
+		{"stale timestamp", signedNotification(now.Add(-2*time.Minute), body), ErrInvalidSignature},
+		{"future timestamp", signedNotification(now.Add(2*time.Minute), body), ErrInvalidSignature},
+		{"unknown provider", otherProvider, ErrUnknownProvider},
+		{"no event id", signedNotification(now, `{"data":{"object":{"id":"fake_pi_1"}}}`), ErrInvalidEvent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := new(mockRepo)
+			_, err := newWebhookService(repo, now).HandleWebhook(context.Background(), tt.n)
+			assert.ErrorIs(t, err, tt.want)
+			repo.AssertNotCalled(t, "ApplyEvent", mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestService_HandleWebhookDisabled(t *testing.T) {
+	now := time.Now()
+	svc := NewService(new(mockRepo), new(mockOrders), NewFakeGateway())
+	_, err := svc.HandleWebhook(context.Background(), signedNotification(now, `{}`))
+	assert.ErrorIs(t, err, ErrUnknownProvider)
+}
+
+func TestProviderStatusApplies(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{StatusRequiresConfirmation, StatusSucceeded, true},
+		{StatusRequiresConfirmation, StatusRequiresAction, true},
+		{StatusRequiresAction, StatusFailed, true},
+		// запоздавшее событие о более раннем шаге
+		{StatusRequiresAction, StatusRequiresConfirmation, false},
+		{StatusSucceeded, StatusFailed, false},
+		{StatusSucceeded, StatusCancelled, false},
+		{StatusFailed, StatusCancelled, false},
+		// провайдер все-таки списал деньги после отказа
+		{StatusFailed, StatusSucceeded, true},
+		{StatusCancelled, StatusSucceeded, true},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, ProviderStatusApplies(tt.from, tt.to), "%s -> %s", tt.from, tt.to)
+	}
+}
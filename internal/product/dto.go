@@ -1,5 +1,7 @@
 package product
 
+import "marketplace/internal/tax"
+
 // CreateProductReq represents the request body for creating a new product.
 // swagger:model CreateProductReq
 type CreateProductReq struct {
@@ -13,16 +15,26 @@ type CreateProductReq struct {
 	// max: 2000
 	Description string `json:"description" binding:"max=2000"`
 
-	// Price in copecks
+	// Price in minor units of the currency (copecks, cents, yen)
 	// required: true
 	// min: 1
 	Price int64 `json:"price" binding:"required,gt=0"`
 
+	// ISO 4217 currency of the price (default RUB)
+	Currency string `json:"currency" binding:"omitempty,len=3"`
+
 	// Stock quantity
 	// required: true
 	// min: 0
 	Stock int `json:"stock" binding:"required,gte=0"`
 
+	// Weight in grams, used for shipping cost
+	// min: 0
+	WeightGrams int `json:"weight_grams" binding:"gte=0"`
+
+	// Whether the price already includes VAT (default true)
+	PriceIncludesTax *bool `json:"price_includes_tax"`
+
 	// Category ID
 	// required: true
 	// min: 1
@@ -32,11 +44,14 @@ type CreateProductReq struct {
 // UpdateProductReq represents the request body for updating an existing product.
 // swagger:model UpdateProductReq
 type UpdateProductReq struct {
-	Name        string `json:"name" binding:"required, min=2, max=200"`
-	Description string `json:"description" binding:"max=2000"`
-	Price       int64  `json:"price" binding:"required,gt=0"`
-	Stock       int    `json:"stock" binding:"required,gte=0"`
-	CategoryID  int64  `json:"category_id" binding:"required,gt=0"`
+	Name             string `json:"name" binding:"required, min=2, max=200"`
+	Description      string `json:"description" binding:"max=2000"`
+	Price            int64  `json:"price" binding:"required,gt=0"`
+	Currency         string `json:"currency" binding:"omitempty,len=3"`
+	Stock            int    `json:"stock" binding:"required,gte=0"`
+	WeightGrams      *int   `json:"weight_grams" binding:"omitempty,gte=0"`
+	PriceIncludesTax *bool  `json:"price_includes_tax"`
+	CategoryID       int64  `json:"category_id" binding:"required,gt=0"`
 }
 
 // CreateCategoryReq represents the request body for creating a new category.
@@ -47,12 +62,49 @@ type CreateCategoryReq struct {
 	// min: 2
 	// max: 128
 	Name string `json:"name" binding:"required,min=2,max=128"`
+
+	// VAT rate applied to products of the category
+	// enum: none,0,10,20
+	VATRate tax.Rate `json:"vat_rate" binding:"omitempty,oneof=none 0 10 20" swaggertype:"string"`
 }
 
 // UpdateCategoryReq represents the request body for updating an existing category.
 // swagger:model UpdateCategoryReq
 type UpdateCategoryReq struct {
-	Name string `json:"name" binding:"required,min=2,max=128"`
+	Name    string   `json:"name" binding:"required,min=2,max=128"`
+	VATRate tax.Rate `json:"vat_rate" binding:"omitempty,oneof=none 0 10 20" swaggertype:"string"`
+}
+
+// apply переносит запрос на сохраненный товар. Необязательные поля, которых нет
+// в запросе, сохраняют прежние значения, а не сбрасываются к значениям по умолчанию.
+func (r UpdateProductReq) apply(p *Product) {
+	p.Name = r.Name
+	p.Description = r.Description
+	p.Price = r.Price
+	if r.Currency != "" {
+		p.Currency = r.Currency
+	}
+	p.Stock = r.Stock
+	if r.WeightGrams != nil {
+		p.WeightGrams = *r.WeightGrams
+	}
+	if r.PriceIncludesTax != nil {
+		p.PriceIncludesTax = *r.PriceIncludesTax
+	}
+	p.CategoryID = r.CategoryID
+}
+
+// includesTax возвращает флаг цены с НДС для нового товара; по умолчанию цены указаны с НДС.
+func includesTax(v *bool) bool {
+	return v == nil || *v
+}
+
+// vatRateOrNone подставляет «без НДС», если ставка не задана.
+func vatRateOrNone(r tax.Rate) tax.Rate {
+	if r == "" {
+		return tax.RateNone
+	}
+	return r
 }
 
 // IDResponse represents a response containing an ID.
@@ -0,0 +1,43 @@
+package product
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateProductReq_KeepsStoredCurrency(t *testing.T) {
+	p := &Product{ID: 5, Name: "Phone", Price: 1000, Currency: "USD", Stock: 3, CategoryID: 1}
+
+	// без currency цена в долларах не должна превратиться в рубли
+	UpdateProductReq{Name: "Phone 2", Price: 1200, Stock: 2, CategoryID: 1}.apply(p)
+	assert.Equal(t, "USD", p.Currency)
+	assert.Equal(t, int64(1200), p.Price)
+
+	UpdateProductReq{Name: "Phone 2", Price: 90000, Currency: "rub", Stock: 2, CategoryID: 1}.apply(p)
+	assert.Equal(t, "rub", p.Currency)
+}
+
+func TestUpdateProductReq_KeepsStoredTaxFlag(t *testing.T) {
+	p := &Product{ID: 5, Name: "Phone", Price: 1000, Currency: "RUB", PriceIncludesTax: false}
+
+	// товар с ценой без НДС не должен молча стать товаром с НДС
+	UpdateProductReq{Name: "Phone", Price: 1000}.apply(p)
+	assert.False(t, p.PriceIncludesTax)
+
+	yes := true
+	UpdateProductReq{Name: "Phone", Price: 1000, PriceIncludesTax: &yes}.apply(p)
+	assert.True(t, p.PriceIncludesTax)
+}
+
+func TestUpdateProductReq_KeepsStoredWeight(t *testing.T) {
+	p := &Product{ID: 5, Name: "Phone", Price: 1000, Currency: "RUB", WeightGrams: 350}
+
+	// без weight_grams вес не должен обнулиться, иначе доставка посчитается как для 0 г
+	UpdateProductReq{Name: "Phone", Price: 1000}.apply(p)
+	assert.Equal(t, 350, p.WeightGrams)
+
+	zero := 0
+	UpdateProductReq{Name: "Phone", Price: 1000, WeightGrams: &zero}.apply(p)
+	assert.Equal(t, 0, p.WeightGrams)
+}
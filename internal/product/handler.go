@@ -1,8 +1,10 @@
 package product
 
 import (
+	"database/sql"
 	"errors"
 	"marketplace/internal/auth"
+	"marketplace/internal/currency"
 	"net/http"
 	"strconv"
 
@@ -57,6 +59,32 @@ func parseID(c *gin.Context) (int64, bool) {
 	return id, true
 }
 
+// displayCurrency — валюта, в которой покупатель хочет видеть цены: ?currency= или заголовок X-Currency.
+func displayCurrency(c *gin.Context) string {
+	if code := c.Query("currency"); code != "" {
+		return code
+	}
+	return c.GetHeader("X-Currency")
+}
+
+// localize добавляет цены в валюте покупателя; false — ответ с ошибкой уже отправлен.
+func (h *Handler) localize(c *gin.Context, products ...*Product) bool {
+	code := displayCurrency(c)
+	if code == "" {
+		return true
+	}
+	err := h.service.Localize(c.Request.Context(), code, products...)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, currency.ErrUnknownCurrency), errors.Is(err, currency.ErrRateNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		_ = c.Error(err).SetType(gin.ErrorTypePrivate)
+	}
+	return false
+}
+
 func parsePaging(c *gin.Context) (offset, limit int, filter string) {
 	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
 	if err != nil {
@@ -78,6 +106,7 @@ func parsePaging(c *gin.Context) (offset, limit int, filter string) {
 // @Param offset query int false "Offset" default(0)
 // @Param limit query int false "Limit" default(10)
 // @Param filter query string false "Name filter"
+// @Param currency query string false "Display currency (ISO 4217), also accepted as X-Currency header"
 // @Success 200 {array} Product
 // @Failure 400 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
@@ -90,6 +119,9 @@ func (h *Handler) listProducts(c *gin.Context) {
 		_ = c.Error(err).SetType(gin.ErrorTypePrivate)
 		return
 	}
+	if !h.localize(c, products...) {
+		return
+	}
 
 	c.JSON(http.StatusOK, products)
 }
@@ -99,6 +131,7 @@ func (h *Handler) listProducts(c *gin.Context) {
 // @Description Get a single product by its ID
 // @Tags products
 // @Param id path int true "Product ID"
+// @Param currency query string false "Display currency (ISO 4217), also accepted as X-Currency header"
 // @Success 200 {object} Product
 // @Failure 400 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
@@ -119,6 +152,9 @@ func (h *Handler) getProduct(c *gin.Context) {
 		_ = c.Error(errors.New("product not found")).SetType(gin.ErrorTypePrivate)
 		return
 	}
+	if !h.localize(c, product) {
+		return
+	}
 
 	c.JSON(http.StatusOK, product)
 }
@@ -144,11 +180,14 @@ func (h *Handler) createProduct(c *gin.Context) {
 	}
 
 	id, err := h.service.CreateProduct(c.Request.Context(), &Product{
-		Name:        req.Name,
-		Description: req.Description,
-		Price:       req.Price,
-		Stock:       req.Stock,
-		CategoryID:  req.CategoryID,
+		Name:             req.Name,
+		Description:      req.Description,
+		Price:            req.Price,
+		Currency:         req.Currency,
+		Stock:            req.Stock,
+		WeightGrams:      req.WeightGrams,
+		PriceIncludesTax: includesTax(req.PriceIncludesTax),
+		CategoryID:       req.CategoryID,
 	})
 	if err != nil {
 		_ = c.Error(err).SetType(gin.ErrorTypePrivate)
@@ -160,7 +199,7 @@ func (h *Handler) createProduct(c *gin.Context) {
 
 // updateProduct godoc
 // @Summary Update an existing product
-// @Description Update the details of an existing product by its ID
+// @Description Update the details of an existing product by its ID. Omitted currency, weight_grams and price_includes_tax keep the stored values.
 // @Tags products
 // @Security BearerAuth
 // @Accept json
@@ -184,14 +223,18 @@ func (h *Handler) updateProduct(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.UpdateProduct(c.Request.Context(), &Product{
-		ID:          id,
-		Name:        req.Name,
-		Description: req.Description,
-		Price:       req.Price,
-		Stock:       req.Stock,
-		CategoryID:  req.CategoryID,
-	}); err != nil {
+	p, err := h.service.GetProduct(c.Request.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) || err == nil && p == nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, ErrorResponse{Error: "product not found"})
+		return
+	}
+	if err != nil {
+		_ = c.Error(err).SetType(gin.ErrorTypePrivate)
+		return
+	}
+	req.apply(p)
+
+	if err := h.service.UpdateProduct(c.Request.Context(), p); err != nil {
 		_ = c.Error(err).SetType(gin.ErrorTypePrivate)
 		return
 	}
@@ -297,7 +340,8 @@ func (h *Handler) createCategory(c *gin.Context) {
 	}
 
 	id, err := h.service.CreateCategory(c.Request.Context(), &Category{
-		Name: req.Name,
+		Name:    req.Name,
+		VATRate: vatRateOrNone(req.VATRate),
 	})
 	if err != nil {
 		_ = c.Error(err).SetType(gin.ErrorTypePrivate)
@@ -327,10 +371,15 @@ func (h *Handler) updateCategory(c *gin.Context) {
 	}
 
 	var req UpdateCategoryReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(err).SetType(gin.ErrorTypePrivate)
+		return
+	}
 
 	if err := h.service.UpdateCategory(c.Request.Context(), &Category{
-		ID:   id,
-		Name: req.Name,
+		ID:      id,
+		Name:    req.Name,
+		VATRate: vatRateOrNone(req.VATRate),
 	}); err != nil {
 		_ = c.Error(err).SetType(gin.ErrorTypePrivate)
 		return
@@ -1,21 +1,33 @@
 package product
 
-import "time"
+import (
+	"marketplace/internal/tax"
+	"time"
+)
 
 //swagger:model Product
 type Product struct {
-	ID          int64     `json:"id" db:"id"`
-	Name        string    `json:"name" db:"name"`
-	Description string    `json:"description" db:"description"`
-	Price       int64     `json:"price" db:"price"` // в копейках
-	Stock       int       `json:"stock" db:"stock"`
-	CategoryID  int64     `json:"category_id" db:"category_id"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+	ID          int64  `json:"id" db:"id"`
+	Name        string `json:"name" db:"name"`
+	Description string `json:"description" db:"description"`
+	Price       int64  `json:"price" db:"price"` // в минорных единицах Currency
+	Currency    string `json:"currency" db:"currency"`
+	Stock       int    `json:"stock" db:"stock"`
+	WeightGrams int    `json:"weight_grams" db:"weight_grams"`
+	// PriceIncludesTax — цена уже содержит НДС категории
+	PriceIncludesTax bool      `json:"price_includes_tax" db:"price_includes_tax"`
+	CategoryID       int64     `json:"category_id" db:"category_id"`
+	CreatedAt        time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at" db:"updated_at"`
+
+	// цена в валюте, запрошенной покупателем (?currency= или X-Currency), по текущему курсу
+	DisplayPrice    *int64 `json:"display_price,omitempty" db:"-"`
+	DisplayCurrency string `json:"display_currency,omitempty" db:"-"`
 }
 
 // swagger:model Category
 type Category struct {
-	ID   int64  `json:"id" db:"id"`
-	Name string `json:"name" db:"name"`
+	ID      int64    `json:"id" db:"id"`
+	Name    string   `json:"name" db:"name"`
+	VATRate tax.Rate `json:"vat_rate" db:"vat_rate" swaggertype:"string" enums:"none,0,10,20"`
 }
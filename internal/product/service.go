@@ -2,6 +2,8 @@ package product
 
 import (
 	"context"
+	"marketplace/internal/currency"
+	"time"
 )
 
 type Service interface {
@@ -10,6 +12,8 @@ type Service interface {
 	CreateProduct(ctx context.Context, p *Product) (int64, error)
 	UpdateProduct(ctx context.Context, p *Product) error
 	DeleteProduct(ctx context.Context, id int64) error
+	// Localize проставляет товарам цену в валюте покупателя по текущему курсу.
+	Localize(ctx context.Context, code string, products ...*Product) error
 
 	CreateCategory(ctx context.Context, c *Category) (int64, error)
 	GetCategory(ctx context.Context, id int64) (*Category, error)
@@ -18,12 +22,30 @@ type Service interface {
 	DeleteCategory(ctx context.Context, id int64) error
 }
 
+// RateSource отдает курсы валют на момент времени; реализуется currency.Service.
+type RateSource interface {
+	Table(ctx context.Context, at time.Time) (*currency.Table, error)
+}
+
 type productService struct {
-	repo Repository
+	repo  Repository
+	rates RateSource
+}
+
+// Option настраивает необязательные зависимости сервиса товаров.
+type Option func(*productService)
+
+// WithRates включает показ цен в валюте покупателя.
+func WithRates(src RateSource) Option {
+	return func(s *productService) { s.rates = src }
 }
 
-func NewService(r Repository) Service {
-	return &productService{repo: r}
+func NewService(r Repository, opts ...Option) Service {
+	s := &productService{repo: r}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 func (s *productService) GetProduct(ctx context.Context, id int64) (*Product, error) {
@@ -35,13 +57,57 @@ func (s *productService) ListProducts(ctx context.Context, offset, limit int, fi
 }
 
 func (s *productService) CreateProduct(ctx context.Context, p *Product) (int64, error) {
+	// по умолчанию цены в рублях; при обновлении валюта не подставляется
+	if p.Currency == "" {
+		p.Currency = currency.Base
+	}
+	if err := normalizeCurrency(p); err != nil {
+		return 0, err
+	}
 	return s.repo.Create(ctx, p)
 }
 
 func (s *productService) UpdateProduct(ctx context.Context, p *Product) error {
+	if err := normalizeCurrency(p); err != nil {
+		return err
+	}
 	return s.repo.Update(ctx, p)
 }
 
+// normalizeCurrency проверяет валюту цены и приводит код к верхнему регистру.
+func normalizeCurrency(p *Product) error {
+	code, err := currency.Normalize(p.Currency)
+	if err != nil {
+		return err
+	}
+	p.Currency = code
+	return nil
+}
+
+func (s *productService) Localize(ctx context.Context, code string, products ...*Product) error {
+	code, err := currency.Normalize(code)
+	if err != nil {
+		return err
+	}
+	table := currency.NewTable(nil)
+	if s.rates != nil {
+		if table, err = s.rates.Table(ctx, time.Now()); err != nil {
+			return err
+		}
+	}
+	for _, p := range products {
+		if p == nil {
+			continue
+		}
+		price, err := table.Convert(p.Price, p.Currency, code)
+		if err != nil {
+			return err
+		}
+		p.DisplayPrice, p.DisplayCurrency = &price, code
+	}
+	return nil
+}
+
 func (s *productService) DeleteProduct(ctx context.Context, id int64) error {
 	return s.repo.Delete(ctx, id)
 }
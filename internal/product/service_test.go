@@ -172,3 +172,18 @@ func TestService_CreateProduct(t *testing.T) {
 		fakeRepo.AssertExpectations(t)
 	})
 }
+
+func TestService_UpdateProduct_NoDefaultCurrency(t *testing.T) {
+	ctx := context.Background()
+	fakeRepo := new(mockRepo)
+	svc := NewService(fakeRepo)
+
+	// рубли подставляются только при создании; обновление без валюты — ошибка, а не RUB
+	err := svc.UpdateProduct(ctx, &Product{ID: 5, Name: "Phone", Price: 1000})
+	assert.Error(t, err)
+	fakeRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+
+	fakeRepo.On("Update", ctx, mock.MatchedBy(func(p *Product) bool { return p.Currency == "USD" })).Return(nil)
+	assert.NoError(t, svc.UpdateProduct(ctx, &Product{ID: 5, Name: "Phone", Price: 1000, Currency: "usd"}))
+	fakeRepo.AssertExpectations(t)
+}
@@ -0,0 +1,121 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"marketplace/internal/address"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type AddressRepo struct {
+	db *sqlx.DB
+}
+
+func NewAddressRepo(db *sqlx.DB) *AddressRepo {
+	return &AddressRepo{db: db}
+}
+
+// lockAddressBook блокирует строку пользователя: параллельные изменения его адресов
+// выполняются по очереди и не сталкиваются на уникальном адресе по умолчанию.
+func lockAddressBook(ctx context.Context, tx *sqlx.Tx, userID int64) error {
+	var id int64
+	return tx.GetContext(ctx, &id, `SELECT id FROM users WHERE id = $1 FOR UPDATE`, userID)
+}
+
+func clearDefaultAddress(ctx context.Context, tx *sqlx.Tx, userID int64) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE addresses SET is_default = FALSE, updated_at = NOW()
+		WHERE user_id = $1 AND is_default
+	`, userID)
+	return err
+}
+
+func (r *AddressRepo) Create(ctx context.Context, a *address.Address) (int64, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err = lockAddressBook(ctx, tx, a.UserID); err != nil {
+		return 0, err
+	}
+	if a.IsDefault {
+		if err = clearDefaultAddress(ctx, tx, a.UserID); err != nil {
+			return 0, err
+		}
+	}
+	// первый адрес пользователя становится адресом по умолчанию
+	var id int64
+	err = tx.QueryRowxContext(ctx, `
+		INSERT INTO addresses (user_id, recipient_name, phone, country, region, city, postal_code, line1, line2, is_default)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9,
+			$10 OR NOT EXISTS (SELECT 1 FROM addresses WHERE user_id = $1))
+		RETURNING id
+	`, a.UserID, a.RecipientName, a.Phone, a.Country, a.Region, a.City, a.PostalCode, a.Line1, a.Line2, a.IsDefault).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+func (r *AddressRepo) Get(ctx context.Context, userID, id int64) (*address.Address, error) {
+	var a address.Address
+	err := r.db.GetContext(ctx, &a, `
+		SELECT id, user_id, recipient_name, phone, country, region, city, postal_code, line1, line2, is_default, created_at, updated_at
+		FROM addresses
+		WHERE id = $1 AND user_id = $2
+	`, id, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, address.ErrAddressNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (r *AddressRepo) List(ctx context.Context, userID int64) ([]*address.Address, error) {
+	addrs := []*address.Address{}
+	err := r.db.SelectContext(ctx, &addrs, `
+		SELECT id, user_id, recipient_name, phone, country, region, city, postal_code, line1, line2, is_default, created_at, updated_at
+		FROM addresses
+		WHERE user_id = $1
+		ORDER BY is_default DESC, id
+	`, userID)
+	return addrs, err
+}
+
+func (r *AddressRepo) Update(ctx context.Context, a *address.Address) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = lockAddressBook(ctx, tx, a.UserID); err != nil {
+		return err
+	}
+	if a.IsDefault {
+		if err = clearDefaultAddress(ctx, tx, a.UserID); err != nil {
+			return err
+		}
+	}
+	res, err := tx.ExecContext(ctx, `
+		UPDATE addresses
+		SET recipient_name = $3, phone = $4, country = $5, region = $6, city = $7,
+			postal_code = $8, line1 = $9, line2 = $10, is_default = $11, updated_at = NOW()
+		WHERE id = $1 AND user_id = $2
+	`, a.ID, a.UserID, a.RecipientName, a.Phone, a.Country, a.Region, a.City, a.PostalCode, a.Line1, a.Line2, a.IsDefault)
+	if err = affectedOr(res, err, address.ErrAddressNotFound); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *AddressRepo) Delete(ctx context.Context, userID, id int64) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM addresses WHERE id = $1 AND user_id = $2`, id, userID)
+	return affectedOr(res, err, address.ErrAddressNotFound)
+}
@@ -0,0 +1,37 @@
+package postgres
+
+import (
+	"context"
+	"marketplace/internal/address"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddressRepository_Create_FirstBecomesDefaultUnderLock(t *testing.T) {
+	xdb, mock, cleanup := newMockDB(t)
+	repo := NewAddressRepo(xdb)
+	a := &address.Address{UserID: 7, RecipientName: "Ivan", Phone: "+70000000000", Country: "RU",
+		City: "Moscow", PostalCode: "101000", Line1: "Tverskaya 1"}
+
+	mock.ExpectBegin()
+	// два первых адреса подряд не должны оба стать адресами по умолчанию
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM users WHERE id = $1 FOR UPDATE`)).
+		WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectQuery(regexp.QuoteMeta(`$10 OR NOT EXISTS (SELECT 1 FROM addresses WHERE user_id = $1)`)).
+		WithArgs(int64(7), "Ivan", "+70000000000", "RU", "", "Moscow", "101000", "Tverskaya 1", "", false).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	mock.ExpectCommit()
+	mock.ExpectClose()
+
+	id, err := repo.Create(context.Background(), a)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), id)
+
+	cleanup()
+	require.NoError(t, mock.ExpectationsWereMet())
+}
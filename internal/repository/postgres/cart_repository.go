@@ -2,10 +2,13 @@ package postgres
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"marketplace/internal/cart"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 type CartRepo struct {
@@ -17,26 +20,92 @@ func NewCartRepository(db *sqlx.DB) *CartRepo {
 }
 
 func (c *CartRepo) AddItem(ctx context.Context, item *cart.CartItem) (int64, error) {
-	query := `
-INSERT INTO cart_items (user_id, product_id, quantity, created_at, updated_at)
-VALUES (:user_id, :product_id, :quantity, NOW(), NOW())
-RETURNING id
-`
-
-	rows, err := c.db.NamedQueryContext(ctx, query, item)
+	ids, err := upsertCartItems(ctx, c.db, item.UserID, []cart.CartItem{*item})
 	if err != nil {
 		return 0, fmt.Errorf("ошибка вставки в бд: %w", err)
 	}
-	defer rows.Close()
+	if len(ids) == 0 {
+		return 0, fmt.Errorf("не удалось получить id вставленной записи")
+	}
+	return ids[0], nil
+}
+
+func (c *CartRepo) AddItems(ctx context.Context, userID int64, items []cart.CartItem) ([]cart.AddedItem, error) {
+	tx, err := c.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	productIDs := make([]int64, len(items))
+	for i, it := range items {
+		productIDs[i] = it.ProductID
+	}
+	// товары блокируются по возрастанию id, как при оформлении заказа, затем строки корзины
+	var products []struct {
+		ID    int64 `db:"id"`
+		Stock int64 `db:"stock"`
+	}
+	err = tx.SelectContext(ctx, &products, `
+		SELECT id, stock FROM products WHERE id = ANY($1) ORDER BY id FOR UPDATE
+	`, pq.Array(productIDs))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка блокировки товаров: %w", err)
+	}
+	stock := make(map[int64]int64, len(products))
+	for _, p := range products {
+		stock[p.ID] = p.Stock
+	}
+	var lines []cart.CartItem
+	err = tx.SelectContext(ctx, &lines, `
+		SELECT product_id, quantity FROM cart_items WHERE user_id = $1 FOR UPDATE
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка блокировки корзины: %w", err)
+	}
+	inCart := make(map[int64]int64, len(lines))
+	for _, l := range lines {
+		inCart[l.ProductID] = l.Quantity
+	}
 
-	if rows.Next() {
-		var id int64
-		if err = rows.Scan(&id); err != nil {
-			return 0, fmt.Errorf("ошибка получения id: %w", err)
+	added := cart.FitStock(items, stock, inCart)
+	var put []cart.CartItem
+	for _, a := range added {
+		if a.Quantity > 0 {
+			put = append(put, cart.CartItem{ProductID: a.ProductID, Quantity: a.Quantity})
 		}
-		return id, nil
 	}
-	return 0, fmt.Errorf("не удалось получить id вставленной записи")
+	if len(put) > 0 {
+		if _, err = upsertCartItems(ctx, tx, userID, put); err != nil {
+			return nil, fmt.Errorf("ошибка вставки в бд: %w", err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка фиксации транзакции: %w", err)
+	}
+	return added, nil
+}
+
+// upsertCartItems кладет товары в корзину и возвращает id строк. В корзине одна строка на товар,
+// поэтому количество уже лежащего товара увеличивается. Повторяющиеся товары суммируются
+// до вставки: ON CONFLICT не обновляет одну строку дважды.
+func upsertCartItems(ctx context.Context, q sqlx.QueryerContext, userID int64, items []cart.CartItem) ([]int64, error) {
+	productIDs := make([]int64, len(items))
+	quantities := make([]int64, len(items))
+	for i, it := range items {
+		productIDs[i], quantities[i] = it.ProductID, it.Quantity
+	}
+	var ids []int64
+	err := sqlx.SelectContext(ctx, q, &ids, `
+		INSERT INTO cart_items (user_id, product_id, quantity, created_at, updated_at)
+		SELECT $1, i.product_id, SUM(i.quantity), NOW(), NOW()
+		FROM unnest($2::bigint[], $3::bigint[]) AS i(product_id, quantity)
+		GROUP BY i.product_id
+		ON CONFLICT (user_id, product_id) DO UPDATE
+		SET quantity = cart_items.quantity + EXCLUDED.quantity, updated_at = NOW()
+		RETURNING id
+	`, userID, pq.Array(productIDs), pq.Array(quantities))
+	return ids, err
 }
 
 func (c *CartRepo) ListItems(ctx context.Context, userID int64) ([]*cart.CartItem, error) {
@@ -75,3 +144,28 @@ WHERE user_id = $1
 	}
 	return err
 }
+
+func (c *CartRepo) GetCurrency(ctx context.Context, userID int64) (string, error) {
+	var code string
+	err := c.db.GetContext(ctx, &code, `SELECT currency FROM carts WHERE user_id = $1`, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("ошибка получения валюты корзины: %w", err)
+	}
+	return code, nil
+}
+
+func (c *CartRepo) SetCurrency(ctx context.Context, userID int64, code string) error {
+	query := `
+INSERT INTO carts (user_id, currency, updated_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (user_id) DO UPDATE
+SET currency = EXCLUDED.currency, updated_at = NOW()
+`
+	if _, err := c.db.ExecContext(ctx, query, userID, code); err != nil {
+		return fmt.Errorf("ошибка сохранения валюты корзины: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"marketplace/internal/cart"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCartRepository_AddItems_CapsAndMergesInOneUpsert(t *testing.T) {
+	xdb, mock, cleanup := newMockDB(t)
+	repo := NewCartRepository(xdb)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, stock FROM products WHERE id = ANY($1) ORDER BY id FOR UPDATE`)).
+		WithArgs(pq.Array([]int64{10, 10, 20})).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "stock"}).AddRow(10, 3).AddRow(20, 1))
+	// весь остаток товара 20 уже в корзине
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT product_id, quantity FROM cart_items WHERE user_id = $1 FOR UPDATE`)).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"product_id", "quantity"}).AddRow(20, 1))
+	// повторяющиеся товары складываются до upsert, иначе ON CONFLICT упадет на второй строке
+	mock.ExpectQuery(regexp.QuoteMeta(`GROUP BY i.product_id
+		ON CONFLICT (user_id, product_id) DO UPDATE`)).
+		WithArgs(int64(1), pq.Array([]int64{10, 10}), pq.Array([]int64{2, 1})).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	mock.ExpectCommit()
+	mock.ExpectClose()
+
+	added, err := repo.AddItems(context.Background(), 1, []cart.CartItem{
+		{ProductID: 10, Quantity: 2}, {ProductID: 10, Quantity: 2}, {ProductID: 20, Quantity: 1},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []cart.AddedItem{
+		{ProductID: 10, Requested: 2, Quantity: 2},
+		{ProductID: 10, Requested: 2, Quantity: 1},
+		{ProductID: 20, Requested: 1},
+	}, added)
+
+	cleanup()
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCartRepository_AddItems_FailureAddsNothing(t *testing.T) {
+	xdb, mock, cleanup := newMockDB(t)
+	repo := NewCartRepository(xdb)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM products`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "stock"}).AddRow(10, 3))
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM cart_items`)).
+		WillReturnRows(sqlmock.NewRows([]string{"product_id", "quantity"}))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO cart_items`)).WillReturnError(errors.New("db down"))
+	mock.ExpectRollback()
+	mock.ExpectClose()
+
+	_, err := repo.AddItems(context.Background(), 1, []cart.CartItem{{ProductID: 10, Quantity: 1}})
+	assert.Error(t, err)
+
+	cleanup()
+	require.NoError(t, mock.ExpectationsWereMet())
+}
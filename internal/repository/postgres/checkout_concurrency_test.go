@@ -0,0 +1,86 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"marketplace/internal/order"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCreateFromCart_NoOverselling оформляет заказы на один товар из многих горутин
+// на настоящей базе.
+func TestCreateFromCart_NoOverselling(t *testing.T) {
+	db := openTestDB(t)
+
+	const (
+		buyers = 40
+		stock  = 5
+	)
+	ctx := context.Background()
+	suffix := time.Now().UnixNano()
+
+	var categoryID int64
+	require.NoError(t, db.GetContext(ctx, &categoryID,
+		`INSERT INTO categories (name) VALUES ($1) RETURNING id`, fmt.Sprintf("concurrency-%d", suffix)))
+	var scarceID, plentyID int64
+	require.NoError(t, db.GetContext(ctx, &scarceID,
+		`INSERT INTO products (name, price, stock, category_id) VALUES ('scarce', 1000, $1, $2) RETURNING id`, stock, categoryID))
+	require.NoError(t, db.GetContext(ctx, &plentyID,
+		`INSERT INTO products (name, price, stock, category_id) VALUES ('plenty', 500, $1, $2) RETURNING id`, buyers, categoryID))
+
+	userIDs := make([]int64, buyers)
+	for i := range userIDs {
+		userIDs[i] = createTestUser(t, db, fmt.Sprintf("buyer-%d-%d", suffix, i))
+		_, err := db.ExecContext(ctx, `
+			INSERT INTO addresses (user_id, recipient_name, phone, country, city, postal_code, line1, is_default)
+			VALUES ($1, 'Buyer', '+79990000000', 'RU', 'Moscow', '101000', 'Tverskaya 1', TRUE)
+		`, userIDs[i])
+		require.NoError(t, err)
+		// половина корзин содержит товары в обратном порядке: без сортировки блокировок это взаимоблокировка
+		first, second := scarceID, plentyID
+		if i%2 == 1 {
+			first, second = plentyID, scarceID
+		}
+		for _, pid := range []int64{first, second} {
+			_, err = db.ExecContext(ctx, `INSERT INTO cart_items (user_id, product_id, quantity) VALUES ($1, $2, 1)`, userIDs[i], pid)
+			require.NoError(t, err)
+		}
+	}
+
+	svc := order.NewService(NewOrderRepo(db))
+	start := make(chan struct{})
+	errs := make([]error, buyers)
+	var wg sync.WaitGroup
+	for i, uid := range userIDs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, errs[i] = svc.CreateFromCart(ctx, uid, order.CheckoutOptions{})
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	created := 0
+	for _, err := range errs {
+		if err == nil {
+			created++
+			continue
+		}
+		assert.True(t, errors.Is(err, order.ErrInsufficientStock), "unexpected error: %v", err)
+	}
+	assert.Equal(t, stock, created)
+
+	var left, sold int
+	require.NoError(t, db.GetContext(ctx, &left, `SELECT stock FROM products WHERE id = $1`, scarceID))
+	require.NoError(t, db.GetContext(ctx, &sold, `SELECT COALESCE(SUM(quantity), 0) FROM order_items WHERE product_id = $1`, scarceID))
+	assert.Equal(t, 0, left)
+	assert.Equal(t, stock, sold)
+}
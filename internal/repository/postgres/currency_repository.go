@@ -0,0 +1,62 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"marketplace/internal/currency"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type CurrencyRepo struct {
+	db *sqlx.DB
+}
+
+func NewCurrencyRepo(db *sqlx.DB) *CurrencyRepo {
+	return &CurrencyRepo{db: db}
+}
+
+const rateColumns = `id, base, quote, rate::text AS rate, effective_at, created_at`
+
+func (r *CurrencyRepo) CreateRate(ctx context.Context, rate *currency.Rate) (*currency.Rate, error) {
+	var out currency.Rate
+	err := r.db.GetContext(ctx, &out, `
+		INSERT INTO exchange_rates (base, quote, rate, effective_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING `+rateColumns+`
+	`, rate.Base, rate.Quote, rate.Rate, rate.EffectiveAt)
+	var pqe *pq.Error
+	if errors.As(err, &pqe) && pqe.Code == "23505" {
+		return nil, currency.ErrRateExists
+	}
+	if err != nil {
+		return nil, fmt.Errorf("insert exchange rate: %w", err)
+	}
+	return &out, nil
+}
+
+func (r *CurrencyRepo) ListRates(ctx context.Context, f currency.RateFilter) ([]currency.Rate, error) {
+	rates := []currency.Rate{}
+	err := r.db.SelectContext(ctx, &rates, `
+		SELECT `+rateColumns+`
+		FROM exchange_rates
+		WHERE ($1 = '' OR base = $1) AND ($2 = '' OR quote = $2)
+		ORDER BY effective_at DESC, id DESC
+		OFFSET $3 LIMIT $4
+	`, f.Base, f.Quote, f.Offset, f.Limit)
+	return rates, err
+}
+
+func (r *CurrencyRepo) RatesAt(ctx context.Context, at time.Time) ([]currency.Rate, error) {
+	rates := []currency.Rate{}
+	err := r.db.SelectContext(ctx, &rates, `
+		SELECT DISTINCT ON (base, quote) `+rateColumns+`
+		FROM exchange_rates
+		WHERE effective_at <= $1
+		ORDER BY base, quote, effective_at DESC, id DESC
+	`, at)
+	return rates, err
+}
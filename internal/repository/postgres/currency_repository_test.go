@@ -0,0 +1,52 @@
+package postgres
+
+import (
+	"context"
+	"marketplace/internal/currency"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCurrencyRepository_CreateRate_Duplicate(t *testing.T) {
+	xdb, mock, cleanup := newMockDB(t)
+	repo := NewCurrencyRepo(xdb)
+	at := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// курс пары на этот момент уже задан: UNIQUE (base, quote, effective_at)
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO exchange_rates`)).
+		WithArgs("USD", "RUB", "92.5", at).
+		WillReturnError(&pq.Error{Code: "23505"})
+	mock.ExpectClose()
+
+	_, err := repo.CreateRate(context.Background(), &currency.Rate{Base: "USD", Quote: "RUB", Rate: "92.5", EffectiveAt: at})
+	assert.ErrorIs(t, err, currency.ErrRateExists)
+
+	cleanup()
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCurrencyRepository_RatesAt(t *testing.T) {
+	xdb, mock, cleanup := newMockDB(t)
+	repo := NewCurrencyRepo(xdb)
+	at := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT DISTINCT ON (base, quote)`)).
+		WithArgs(at).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "base", "quote", "rate", "effective_at", "created_at"}).
+			AddRow(3, "USD", "RUB", "92.500000000000", at, at))
+	mock.ExpectClose()
+
+	rates, err := repo.RatesAt(context.Background(), at)
+	require.NoError(t, err)
+	require.Len(t, rates, 1)
+	assert.Equal(t, "92.500000000000", rates[0].Rate)
+
+	cleanup()
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -3,8 +3,14 @@ package postgres
 import (
 	"context"
 	"database/sql"
-	"marketplace/internal/order"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"marketplace/internal/idempotency"
+	"net/http"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -16,38 +22,135 @@ func NewIdempotencyRepository(db *sqlx.DB) *IdemRepo {
 	return &IdemRepo{db: db}
 }
 
-func (r *IdemRepo) TryStartIdempotent(ctx context.Context, userID int64, key string, reqHash string) (ok bool, savedStatus int, savedOrderID int64, err error) {
-	_, err = r.db.ExecContext(ctx, `
-		INSERT INTO idempotency_keys (user_id, key, request_hash)
-		VALUES ($1, $2, $3)
-		ON CONFLICT DO NOTHING
-	`, userID, key, reqHash)
-	if err != nil {
-		return false, 0, 0, err
+type idempotencyRow struct {
+	UserID          int64         `db:"user_id"`
+	Key             string        `db:"key"`
+	Method          string        `db:"method"`
+	Path            string        `db:"path"`
+	RequestHash     string        `db:"request_hash"`
+	State           string        `db:"state"`
+	StatusCode      sql.NullInt32 `db:"status_code"`
+	ResponseHeaders []byte        `db:"response_headers"`
+	ResponseBody    []byte        `db:"response_body"`
+}
+
+func (r *IdemRepo) Start(ctx context.Context, req idempotency.Request, lease, ttl time.Duration) (*idempotency.Record, string, error) {
+	token := uuid.NewString()
+	// ключ могут удалить между INSERT и SELECT (сборщик истекших ключей) — тогда пробуем еще раз
+	for attempt := 0; attempt < 2; attempt++ {
+		var got string
+		err := r.db.GetContext(ctx, &got, `
+			INSERT INTO idempotency_keys AS k (user_id, key, method, path, request_hash, state, lock_token, locked_until, expires_at)
+			VALUES ($1, $2, $3, $4, $5, 'in_progress', $6, NOW() + make_interval(secs => $7), NOW() + make_interval(secs => $8))
+			ON CONFLICT (user_id, key) DO UPDATE
+			SET method = EXCLUDED.method,
+				path = EXCLUDED.path,
+				request_hash = EXCLUDED.request_hash,
+				state = 'in_progress',
+				lock_token = EXCLUDED.lock_token,
+				locked_until = EXCLUDED.locked_until,
+				expires_at = EXCLUDED.expires_at,
+				status_code = NULL,
+				response_headers = NULL,
+				response_body = NULL,
+				completed_at = NULL,
+				created_at = NOW()
+			WHERE k.expires_at < NOW()
+				OR (k.method = EXCLUDED.method AND k.path = EXCLUDED.path AND k.request_hash = EXCLUDED.request_hash
+					AND (k.state = 'failed' OR (k.state = 'in_progress' AND k.locked_until < NOW())))
+			RETURNING lock_token
+		`, req.UserID, req.Key, req.Method, req.Path, req.BodyHash, token, lease.Seconds(), ttl.Seconds())
+		if err == nil {
+			return nil, got, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, "", err
+		}
+
+		// ключ занят: отдаем запись, чтобы решить, повторить ответ или отказать
+		var row idempotencyRow
+		err = r.db.GetContext(ctx, &row, `
+			SELECT user_id, key, method, path, request_hash, state, status_code, response_headers, response_body
+			FROM idempotency_keys
+			WHERE user_id = $1 AND key = $2
+		`, req.UserID, req.Key)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		rec, err := row.record()
+		return rec, "", err
 	}
+	return nil, "", fmt.Errorf("idempotency key %q is contended", req.Key)
+}
 
-	var status sql.NullInt32
-	var orderID sql.NullInt64
-	err = r.db.QueryRowContext(ctx, `
-		SELECT status_code, (response_body->>'order_id')::bigint
-		FROM idempotency_keys
-		WHERE key = $1
-	`, key).Scan(&status, &orderID)
-	if err != nil {
-		return false, 0, 0, err
+func (row idempotencyRow) record() (*idempotency.Record, error) {
+	rec := &idempotency.Record{
+		Request: idempotency.Request{
+			UserID:   row.UserID,
+			Key:      row.Key,
+			Method:   row.Method,
+			Path:     row.Path,
+			BodyHash: row.RequestHash,
+		},
+		State: row.State,
+	}
+	if row.State != idempotency.StateCompleted || !row.StatusCode.Valid {
+		return rec, nil
 	}
+	resp := &idempotency.Response{StatusCode: int(row.StatusCode.Int32), Body: row.ResponseBody}
+	if len(row.ResponseHeaders) > 0 {
+		if err := json.Unmarshal(row.ResponseHeaders, &resp.Header); err != nil {
+			return nil, err
+		}
+	}
+	rec.Response = resp
+	return rec, nil
+}
 
-	if orderID.Valid {
-		return false, int(status.Int32), orderID.Int64, nil
+func (r *IdemRepo) Complete(ctx context.Context, req idempotency.Request, token string, resp idempotency.Response) error {
+	if resp.Header == nil {
+		resp.Header = http.Header{}
 	}
-	return false, int(status.Int32), 0, order.ErrIdempotencyConflict
+	headers, err := json.Marshal(resp.Header)
+	if err != nil {
+		return err
+	}
+	// ключ, перехваченный другим запросом после истечения аренды, не перезаписываем
+	_, err = r.db.ExecContext(ctx, `
+		UPDATE idempotency_keys
+		SET state = 'completed', status_code = $4, response_headers = $5, response_body = $6,
+			completed_at = NOW(), lock_token = NULL, locked_until = NULL
+		WHERE user_id = $1 AND key = $2 AND lock_token = $3
+	`, req.UserID, req.Key, token, resp.StatusCode, headers, resp.Body)
+	return err
 }
 
-func (r *IdemRepo) SaveIdempotentResult(ctx context.Context, key string, status int, orderID int64) error {
+func (r *IdemRepo) Fail(ctx context.Context, req idempotency.Request, token string) error {
 	_, err := r.db.ExecContext(ctx, `
 		UPDATE idempotency_keys
-		SET status_code = $1, response_body = jsonb_build_object('order_id', $2)
-		WHERE key = $3
-	`, status, orderID, key)
+		SET state = 'failed', lock_token = NULL, locked_until = NULL
+		WHERE user_id = $1 AND key = $2 AND lock_token = $3
+	`, req.UserID, req.Key, token)
 	return err
 }
+
+func (r *IdemRepo) DeleteExpired(ctx context.Context, limit int) (int, error) {
+	res, err := r.db.ExecContext(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE (user_id, key) IN (
+			SELECT user_id, key
+			FROM idempotency_keys
+			WHERE expires_at < NOW()
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+	`, limit)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
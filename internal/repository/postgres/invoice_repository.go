@@ -0,0 +1,91 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"marketplace/internal/invoice"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type InvoiceRepo struct {
+	db *sqlx.DB
+}
+
+func NewInvoiceRepo(db *sqlx.DB) *InvoiceRepo {
+	return &InvoiceRepo{db: db}
+}
+
+func (r *InvoiceRepo) GetByOrderID(ctx context.Context, orderID int64) (*invoice.Invoice, error) {
+	var inv invoice.Invoice
+	err := r.db.GetContext(ctx, &inv, `
+		SELECT id, order_id, number, version, issued_at, generated_at
+		FROM invoices
+		WHERE order_id = $1
+	`, orderID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, invoice.ErrInvoiceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// Issue берет номер из invoice_counter в той же транзакции, что и вставка счета.
+// Блокировка строки заказа не дает двум запросам выставить счет дважды,
+// а откат транзакции откатывает и счетчик, поэтому номера идут без пропусков.
+func (r *InvoiceRepo) Issue(ctx context.Context, orderID int64) (*invoice.Invoice, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, `SELECT 1 FROM orders WHERE id = $1 FOR UPDATE`, orderID); err != nil {
+		return nil, err
+	}
+	var inv invoice.Invoice
+	err = tx.GetContext(ctx, &inv, `
+		SELECT id, order_id, number, version, issued_at, generated_at
+		FROM invoices
+		WHERE order_id = $1
+	`, orderID)
+	if err == nil {
+		return &inv, tx.Commit()
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	err = tx.GetContext(ctx, &inv, `
+		WITH next AS (
+			UPDATE invoice_counter SET last_number = last_number + 1
+			RETURNING last_number
+		)
+		INSERT INTO invoices (order_id, number)
+		SELECT $1, last_number FROM next
+		RETURNING id, order_id, number, version, issued_at, generated_at
+	`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	return &inv, tx.Commit()
+}
+
+func (r *InvoiceRepo) BumpVersion(ctx context.Context, orderID int64) (*invoice.Invoice, error) {
+	var inv invoice.Invoice
+	err := r.db.GetContext(ctx, &inv, `
+		UPDATE invoices
+		SET version = version + 1, generated_at = NOW()
+		WHERE order_id = $1
+		RETURNING id, order_id, number, version, issued_at, generated_at
+	`, orderID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, invoice.ErrInvoiceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
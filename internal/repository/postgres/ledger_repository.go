@@ -0,0 +1,196 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"marketplace/internal/currency"
+	"marketplace/internal/ledger"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type LedgerRepo struct {
+	db *sqlx.DB
+}
+
+func NewLedgerRepo(db *sqlx.DB) *LedgerRepo {
+	return &LedgerRepo{db: db}
+}
+
+// insertJournal записывает проводку в транзакции бизнес-операции.
+// Если проводка с тем же (kind, reference) уже есть, ничего не пишет и возвращает false.
+func insertJournal(ctx context.Context, ex sqlx.ExtContext, j *ledger.Journal) (bool, error) {
+	if err := j.Validate(); err != nil {
+		return false, err
+	}
+	err := sqlx.GetContext(ctx, ex, j, `
+		INSERT INTO ledger_journals (kind, reference, currency, order_id, memo)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (kind, reference) DO NOTHING
+		RETURNING id, kind, reference, currency, order_id, memo, created_at
+	`, j.Kind, j.Reference, j.Currency, j.OrderID, j.Memo)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("insert journal: %w", err)
+	}
+	accounts := make([]string, len(j.Entries))
+	amounts := make([]int64, len(j.Entries))
+	for i, e := range j.Entries {
+		accounts[i], amounts[i] = e.Account, e.Amount
+	}
+	if _, err = ex.ExecContext(ctx, `
+		INSERT INTO ledger_entries (journal_id, account, amount)
+		SELECT $1, * FROM unnest($2::text[], $3::bigint[])
+	`, j.ID, pq.Array(accounts), pq.Array(amounts)); err != nil {
+		return false, fmt.Errorf("insert journal entries: %w", err)
+	}
+	return true, nil
+}
+
+func (r *LedgerRepo) Balances(ctx context.Context) ([]ledger.AccountBalance, error) {
+	var balances []ledger.AccountBalance
+	err := r.db.SelectContext(ctx, &balances, `
+		SELECT a.code, a.name, COALESCE(j.currency, $1) AS currency, COALESCE(SUM(e.amount), 0) AS balance
+		FROM ledger_accounts a
+		LEFT JOIN ledger_entries e ON e.account = a.code
+		LEFT JOIN ledger_journals j ON j.id = e.journal_id
+		GROUP BY a.code, a.name, j.currency
+		ORDER BY a.code, currency
+	`, currency.Base)
+	return balances, err
+}
+
+func (r *LedgerRepo) ListJournals(ctx context.Context, f ledger.JournalFilter) ([]*ledger.Journal, error) {
+	journals := []*ledger.Journal{}
+	if err := r.db.SelectContext(ctx, &journals, `
+		SELECT id, kind, reference, currency, order_id, memo, created_at
+		FROM ledger_journals
+		WHERE ($1 = 0 OR order_id = $1) AND ($2 = '' OR kind = $2)
+		ORDER BY id DESC
+		OFFSET $3 LIMIT $4
+	`, f.OrderID, f.Kind, f.Offset, f.Limit); err != nil {
+		return nil, err
+	}
+	if len(journals) == 0 {
+		return journals, nil
+	}
+	ids := make([]int64, len(journals))
+	byID := make(map[int64]*ledger.Journal, len(journals))
+	for i, j := range journals {
+		ids[i], byID[j.ID] = j.ID, j
+	}
+	var entries []struct {
+		JournalID int64 `db:"journal_id"`
+		ledger.Entry
+	}
+	if err := r.db.SelectContext(ctx, &entries, `
+		SELECT journal_id, account, amount
+		FROM ledger_entries
+		WHERE journal_id = ANY($1)
+		ORDER BY id
+	`, pq.Array(ids)); err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		byID[e.JournalID].Entries = append(byID[e.JournalID].Entries, e.Entry)
+	}
+	return journals, nil
+}
+
+func (r *LedgerRepo) Check(ctx context.Context) (*ledger.Check, error) {
+	res := &ledger.Check{Unbalanced: []int64{}, Totals: map[string]int64{}}
+	if err := r.db.SelectContext(ctx, &res.Unbalanced, `
+		SELECT j.id
+		FROM ledger_journals j
+		LEFT JOIN ledger_entries e ON e.journal_id = j.id
+		GROUP BY j.id
+		HAVING COALESCE(SUM(e.amount), 0) <> 0 OR COUNT(e.id) < 2
+		ORDER BY j.id
+	`); err != nil {
+		return nil, err
+	}
+	var totals []struct {
+		Currency string `db:"currency"`
+		Total    int64  `db:"total"`
+	}
+	if err := r.db.SelectContext(ctx, &totals, `
+		SELECT j.currency, SUM(e.amount) AS total
+		FROM ledger_entries e
+		JOIN ledger_journals j ON j.id = e.journal_id
+		GROUP BY j.currency
+	`); err != nil {
+		return nil, err
+	}
+	if err := r.db.GetContext(ctx, &res.Journals, `SELECT COUNT(*) FROM ledger_journals`); err != nil {
+		return nil, err
+	}
+	res.OK = len(res.Unbalanced) == 0
+	for _, t := range totals {
+		res.Totals[t.Currency] = t.Total
+		if t.Total != 0 {
+			res.OK = false
+		}
+	}
+	return res, nil
+}
+
+func (r *LedgerRepo) PostPayout(ctx context.Context, j *ledger.Journal) (*ledger.Journal, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	// строка счета сериализует выплаты: две параллельные не уведут баланс в минус
+	if _, err = tx.ExecContext(ctx, `SELECT 1 FROM ledger_accounts WHERE code = $1 FOR UPDATE`, ledger.AccountSellerPayable); err != nil {
+		return nil, fmt.Errorf("lock account: %w", err)
+	}
+	var existing ledger.Journal
+	err = tx.GetContext(ctx, &existing, `
+		SELECT id, kind, reference, currency, order_id, memo, created_at
+		FROM ledger_journals
+		WHERE kind = $1 AND reference = $2
+	`, j.Kind, j.Reference)
+	if err == nil {
+		if err = tx.SelectContext(ctx, &existing.Entries, `
+			SELECT account, amount FROM ledger_entries WHERE journal_id = $1 ORDER BY id
+		`, existing.ID); err != nil {
+			return nil, err
+		}
+		return &existing, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	var balance int64
+	if err = tx.GetContext(ctx, &balance, `
+		SELECT COALESCE(SUM(e.amount), 0)
+		FROM ledger_entries e
+		JOIN ledger_journals j ON j.id = e.journal_id
+		WHERE e.account = $1 AND j.currency = $2
+	`, ledger.AccountSellerPayable, j.Currency); err != nil {
+		return nil, err
+	}
+	var amount int64
+	for _, e := range j.Entries {
+		if e.Account == ledger.AccountSellerPayable {
+			amount -= e.Amount
+		}
+	}
+	if amount > balance {
+		return nil, fmt.Errorf("%w: payout %d %s, available %d", ledger.ErrInsufficientBalance, amount, j.Currency, balance)
+	}
+	if _, err = insertJournal(ctx, tx, j); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit tx: %w", err)
+	}
+	return j, nil
+}
@@ -0,0 +1,54 @@
+package postgres
+
+import (
+	"context"
+	"marketplace/internal/ledger"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInsertJournal_AlreadyPosted(t *testing.T) {
+	xdb, mock, cleanup := newMockDB(t)
+
+	// проводка по этому платежу уже есть: строки второй раз не пишутся
+	mock.ExpectQuery(regexp.QuoteMeta(`ON CONFLICT (kind, reference) DO NOTHING`)).
+		WithArgs(ledger.KindPaymentCaptured, "payment_intent:9", "RUB", int64(5), nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "kind", "reference", "currency", "order_id", "memo", "created_at"}))
+	mock.ExpectClose()
+
+	posted, err := insertJournal(context.Background(), xdb, ledger.Capture("RUB", 5, 9, 1000, 0, 1000, 0))
+	require.NoError(t, err)
+	assert.False(t, posted)
+
+	cleanup()
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLedgerRepository_PostPayout_InsufficientBalance(t *testing.T) {
+	xdb, mock, cleanup := newMockDB(t)
+	repo := NewLedgerRepo(xdb)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`FOR UPDATE`)).
+		WithArgs(ledger.AccountSellerPayable).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`WHERE kind = $1 AND reference = $2`)).
+		WithArgs(ledger.KindPayout, "PP-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	// баланс считается только в валюте выплаты
+	mock.ExpectQuery(regexp.QuoteMeta(`WHERE e.account = $1 AND j.currency = $2`)).
+		WithArgs(ledger.AccountSellerPayable, "RUB").
+		WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(500))
+	mock.ExpectRollback()
+	mock.ExpectClose()
+
+	_, err := repo.PostPayout(context.Background(), ledger.Payout("PP-1", "RUB", 700, ""))
+	assert.ErrorIs(t, err, ledger.ErrInsufficientBalance)
+
+	cleanup()
+	require.NoError(t, mock.ExpectationsWereMet())
+}
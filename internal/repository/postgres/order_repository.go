@@ -3,9 +3,17 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"marketplace/internal/order"
+	"marketplace/internal/outbox"
+	"marketplace/internal/payment"
+	"marketplace/internal/wallet"
+	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 type OrderRepo struct {
@@ -42,78 +50,261 @@ func (r *OrderRepo) GetCartItemsForUser(ctx context.Context, userID int64) ([]or
 		SELECT product_id, quantity
 		FROM cart_items
 		WHERE user_id=$1
+		ORDER BY id
 	`, userID)
 	return items, err
 }
 
-func (r *OrderRepo) GetProductsPrices(ctx context.Context, productIDs []int64) (map[int64]int64, error) {
-	query, args, err := sqlx.In(`
-		SELECT id, price
-		FROM products
-		WHERE id IN (?)
-	`, productIDs)
+func (r *OrderRepo) GetCartCurrency(ctx context.Context, userID int64) (string, error) {
+	var code string
+	err := r.db.GetContext(ctx, &code, `SELECT currency FROM carts WHERE user_id = $1`, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return code, err
+}
+
+const productSnapshotColumns = `
+	p.id, p.name, COALESCE(p.description, '') AS description, p.price, p.currency, p.category_id, c.name AS category_name, p.weight_grams, p.stock,
+	c.vat_rate, p.price_includes_tax`
+
+func (r *OrderRepo) GetProductsForOrder(ctx context.Context, productIDs []int64) (map[int64]order.ProductSnapshot, error) {
+	var rows []order.ProductSnapshot
+	err := r.db.SelectContext(ctx, &rows, `
+		SELECT `+productSnapshotColumns+`
+		FROM products p
+		JOIN categories c ON c.id = p.category_id
+		WHERE p.id = ANY($1)
+	`, pq.Array(productIDs))
 	if err != nil {
 		return nil, err
 	}
-	query = r.db.Rebind(query)
+	return snapshotsByID(rows), nil
+}
 
-	type row struct {
-		ID    int64 `db:"id"`
-		Price int64 `db:"price"`
-	}
-	var rows []row
-	if err = r.db.SelectContext(ctx, &rows, query, args...); err != nil {
+// LockProductsForOrder блокирует строки товаров до конца транзакции и читает их под блокировкой.
+// Строки блокируются по возрастанию id: две корзины с одними товарами в разном порядке
+// ждут друг друга, а не взаимоблокируются.
+func (r *OrderRepo) LockProductsForOrder(ctx context.Context, tx order.Tx, productIDs []int64) (map[int64]order.ProductSnapshot, error) {
+	xtx := tx.(*txWrap)
+	var rows []order.ProductSnapshot
+	err := xtx.SelectContext(ctx, &rows, `
+		SELECT `+productSnapshotColumns+`
+		FROM products p
+		JOIN categories c ON c.id = p.category_id
+		WHERE p.id = ANY($1)
+		ORDER BY p.id
+		FOR UPDATE OF p
+	`, pq.Array(productIDs))
+	if err != nil {
 		return nil, err
 	}
-	m := make(map[int64]int64, len(rows))
+	return snapshotsByID(rows), nil
+}
+
+func snapshotsByID(rows []order.ProductSnapshot) map[int64]order.ProductSnapshot {
+	m := make(map[int64]order.ProductSnapshot, len(rows))
 	for _, v := range rows {
-		m[v.ID] = v.Price
+		m[v.ID] = v
+	}
+	return m
+}
+
+func (r *OrderRepo) GetShippingAddress(ctx context.Context, userID, addressID int64) (*order.ShippingAddress, error) {
+	var a order.ShippingAddress
+	err := r.db.QueryRowxContext(ctx, `
+		SELECT id, recipient_name, phone, country, region, city, postal_code, line1, line2
+		FROM addresses
+		WHERE user_id = $1 AND (id = $2 OR ($2 = 0 AND is_default))
+	`, userID, addressID).Scan(&a.AddressID, &a.RecipientName, &a.Phone, &a.Country, &a.Region,
+		&a.City, &a.PostalCode, &a.Line1, &a.Line2)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, order.ErrAddressNotFound
 	}
-	return m, nil
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
 }
 
-func (r *OrderRepo) DecrementStock(ctx context.Context, tx order.Tx, productID int64, quantity int) error {
+// ReserveStock списывает остатки по всем позициям одним запросом.
+// Если хоть одного товара не хватает, ничего не списывается.
+func (r *OrderRepo) ReserveStock(ctx context.Context, tx order.Tx, items []order.OrderItem) error {
 	xtx := tx.(*txWrap)
-	result, err := xtx.ExecContext(ctx, `
-		UPDATE products
-		SET stock = stock - $1
-		WHERE id=$2 AND stock >= $1
-	`, quantity, productID)
+	ids := make([]int64, len(items))
+	qty := make([]int64, len(items))
+	for i, item := range items {
+		ids[i], qty[i] = item.ProductID, int64(item.Quantity)
+	}
+	var reserved int
+	err := xtx.GetContext(ctx, &reserved, `
+		WITH want AS (
+			SELECT product_id, SUM(quantity) AS quantity
+			FROM unnest($1::bigint[], $2::int[]) AS w(product_id, quantity)
+			GROUP BY product_id
+		), upd AS (
+			UPDATE products p
+			SET stock = p.stock - want.quantity, updated_at = NOW()
+			FROM want
+			WHERE p.id = want.product_id AND p.stock >= want.quantity
+			RETURNING p.id
+		)
+		SELECT (SELECT COUNT(*) FROM upd) - (SELECT COUNT(*) FROM want)
+	`, pq.Array(ids), pq.Array(qty))
 	if err != nil {
 		return err
 	}
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
+	if reserved != 0 {
+		return order.ErrInsufficientStock
+	}
+	return nil
+}
+
+func (r *OrderRepo) RestoreStock(ctx context.Context, tx order.Tx, orderID int64) error {
+	xtx := tx.(*txWrap)
+	_, err := xtx.ExecContext(ctx, `
+		UPDATE products p
+		SET stock = p.stock + oi.quantity, updated_at = NOW()
+		FROM (
+			SELECT product_id, SUM(quantity) AS quantity
+			FROM order_items
+			WHERE order_id = $1
+			GROUP BY product_id
+		) oi
+		WHERE p.id = oi.product_id
+	`, orderID)
+	return err
+}
+
+func (r *OrderRepo) CompensatePayment(ctx context.Context, tx order.Tx, orderID int64, reason string) error {
+	xtx := tx.(*txWrap)
+	if _, err := xtx.ExecContext(ctx, `
+		INSERT INTO payment_compensations (order_id, payment_intent_id, amount, reason)
+		SELECT order_id, id, amount, $2
+		FROM payment_intents
+		WHERE order_id = $1 AND status = 'succeeded'
+		ON CONFLICT (payment_intent_id) DO NOTHING
+	`, orderID, reason); err != nil {
 		return err
 	}
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
+	return postCaptureReversal(ctx, xtx, orderID, fmt.Sprintf("order:%d", orderID))
+}
+
+func (r *OrderRepo) ExpirePaymentIntents(ctx context.Context, tx order.Tx, orderID int64) error {
+	xtx := tx.(*txWrap)
+	_, err := xtx.ExecContext(ctx, `
+		UPDATE payment_intents
+		SET expires_at = NOW(), updated_at = NOW()
+		WHERE order_id = $1 AND status IN ('requires_confirmation', 'requires_action')
+	`, orderID)
+	return err
+}
+
+func (r *OrderRepo) ReleaseWalletPayments(ctx context.Context, tx order.Tx, orderID int64) error {
+	xtx := tx.(*txWrap)
+	var spent []struct {
+		ID       int64  `db:"id"`
+		Amount   int64  `db:"amount"`
+		Currency string `db:"currency"`
+		UserID   int64  `db:"user_id"`
+	}
+	if err := xtx.SelectContext(ctx, &spent, `
+		UPDATE payment_intents pi
+		SET status = 'cancelled', failure_reason = 'order cancelled', updated_at = NOW()
+		FROM orders o
+		WHERE o.id = pi.order_id AND pi.order_id = $1 AND pi.provider = $2 AND pi.status = 'succeeded'
+		RETURNING pi.id, pi.amount - pi.refunded_amount AS amount, pi.currency, o.user_id
+	`, orderID, payment.WalletProvider); err != nil {
+		return err
+	}
+	for _, w := range spent {
+		// возвраты по оплате из кошелька уже вернули свою часть
+		if w.Amount == 0 {
+			continue
+		}
+		if _, err := applyWalletTx(ctx, xtx, &wallet.Transaction{
+			UserID:          w.UserID,
+			Currency:        w.Currency,
+			Amount:          w.Amount,
+			Kind:            wallet.KindOrderRelease,
+			OrderID:         &orderID,
+			PaymentIntentID: &w.ID,
+		}); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+func (r *OrderRepo) ClaimExpiredOrders(ctx context.Context, tx order.Tx, ttl time.Duration, limit int) ([]int64, error) {
+	xtx := tx.(*txWrap)
+	var ids []int64
+	// срок считается по часам БД, в которых записан updated_at: расхождение часов
+	// приложения не отменит заказ раньше времени
+	err := xtx.SelectContext(ctx, &ids, `
+		SELECT id
+		FROM orders
+		WHERE status = 'awaiting_payment' AND updated_at < NOW() - make_interval(secs => $1)
+		ORDER BY id
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED
+	`, ttl.Seconds(), limit)
+	return ids, err
+}
+
 func (r *OrderRepo) CreateOrder(ctx context.Context, tx order.Tx, o *order.Order) (int64, error) {
 	xtx := tx.(*txWrap)
 	var id int64
 	err := xtx.QueryRowContext(ctx, `
-		INSERT INTO orders (user_id, status, total_amount, created_at, updated_at)
-		VALUES (:user_id, :status, :total_amount, now(), now())
+		INSERT INTO orders (user_id, status, currency, subtotal_amount, tax_amount, total_amount, shipping_method_id, shipping_amount, shipping_address, exchange_rates, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, now(), now())
 		RETURNING id
-	`, o).Scan(&id)
+	`, o.UserID, o.Status, o.Currency, o.SubtotalAmount, o.TaxAmount, o.TotalAmount, o.ShippingMethodID, o.ShippingAmount, o.ShippingAddress, o.ExchangeRates).Scan(&id)
 
 	return id, err
 }
 
 func (r *OrderRepo) BulkInsertItems(ctx context.Context, tx order.Tx, orderID int64, items []order.OrderItem) error {
 	xtx := tx.(*txWrap)
-	q := `INSERT INTO order_items (order_id, product_id, quantity, price) VALUES ($1, $2, $3, $4)`
-	for _, item := range items {
-		_, err := xtx.ExecContext(ctx, q, orderID, item.ProductID, item.Quantity, item.Price)
-		if err != nil {
-			return err
-		}
+	var (
+		productIDs   = make([]int64, len(items))
+		quantities   = make([]int64, len(items))
+		prices       = make([]int64, len(items))
+		vatRates     = make([]string, len(items))
+		taxAmounts   = make([]int64, len(items))
+		inclusive    = make([]bool, len(items))
+		names        = make([]string, len(items))
+		descriptions = make([]string, len(items))
+		categoryIDs  = make([]int64, len(items))
+		categories   = make([]string, len(items))
+		catalogPrice = make([]int64, len(items))
+		catalogCur   = make([]string, len(items))
+	)
+	for i, item := range items {
+		productIDs[i] = item.ProductID
+		quantities[i] = int64(item.Quantity)
+		prices[i] = item.Price
+		vatRates[i] = string(item.VATRate)
+		taxAmounts[i] = item.TaxAmount
+		inclusive[i] = item.PriceIncludesTax
+		names[i] = item.ProductName
+		descriptions[i] = item.ProductDescription
+		categoryIDs[i] = item.CategoryID
+		categories[i] = item.CategoryName
+		catalogPrice[i] = item.CatalogPrice
+		catalogCur[i] = item.CatalogCurrency
 	}
-	return nil
+	// все позиции одним запросом
+	_, err := xtx.ExecContext(ctx, `
+		INSERT INTO order_items (order_id, product_id, quantity, price, vat_rate, tax_amount, price_includes_tax,
+			product_name, product_description, category_id, category_name, catalog_price, catalog_currency)
+		SELECT $1, i.*
+		FROM unnest($2::bigint[], $3::int[], $4::bigint[], $5::varchar[], $6::bigint[], $7::boolean[],
+			$8::varchar[], $9::text[], $10::bigint[], $11::varchar[], $12::bigint[], $13::char(3)[]) AS i
+	`, orderID, pq.Array(productIDs), pq.Array(quantities), pq.Array(prices), pq.Array(vatRates), pq.Array(taxAmounts),
+		pq.Array(inclusive), pq.Array(names), pq.Array(descriptions), pq.Array(categoryIDs), pq.Array(categories),
+		pq.Array(catalogPrice), pq.Array(catalogCur))
+	return err
 }
 
 func (r *OrderRepo) ClearCart(ctx context.Context, tx order.Tx, userID int64) error {
@@ -125,41 +316,145 @@ func (r *OrderRepo) ClearCart(ctx context.Context, tx order.Tx, userID int64) er
 	return err
 }
 
-func (r *OrderRepo) GetUserOrders(ctx context.Context, userID int64, offset, limit int) ([]*order.Order, error) {
-	var orders []*order.Order
-	err := r.db.SelectContext(ctx, &orders, `
-		SELECT id, user_id, status, total_amount, created_at, updated_at
+func (r *OrderRepo) GetUserOrders(ctx context.Context, userID int64, f order.ListFilter) ([]*order.Order, error) {
+	conds := []string{"user_id = ?"}
+	args := []any{userID}
+	if f.Status != "" {
+		conds = append(conds, "status = ?")
+		args = append(args, f.Status)
+	}
+	if f.CreatedFrom != nil {
+		conds = append(conds, "created_at >= ?")
+		args = append(args, *f.CreatedFrom)
+	}
+	if f.CreatedTo != nil {
+		conds = append(conds, "created_at < ?")
+		args = append(args, *f.CreatedTo)
+	}
+	dir, cmp := "DESC", "<"
+	if f.Sort == order.SortCreatedAsc {
+		dir, cmp = "ASC", ">"
+	}
+	if f.After != nil {
+		conds = append(conds, "(created_at, id) "+cmp+" (?, ?)")
+		args = append(args, f.After.CreatedAt, f.After.ID)
+	}
+	args = append(args, f.Limit)
+
+	query := r.db.Rebind(`
+		SELECT id, user_id, status, currency, subtotal_amount, tax_amount, total_amount, shipping_method_id, shipping_amount, shipping_address, exchange_rates, created_at, updated_at
 		FROM orders
-		WHERE user_id = $1
-		ORDER BY created_at DESC
-		OFFSET $2 LIMIT $3
-	`, userID, offset, limit)
+		WHERE ` + strings.Join(conds, " AND ") + `
+		ORDER BY created_at ` + dir + `, id ` + dir + `
+		LIMIT ?`)
+
+	var orders []*order.Order
+	err := r.db.SelectContext(ctx, &orders, query, args...)
 	return orders, err
 }
 
 func (r *OrderRepo) GetOrderWithItems(ctx context.Context, userID, orderID int64) (*order.Order, error) {
 	var o order.Order
 	err := r.db.GetContext(ctx, &o, `
-		SELECT id, user_id, status, total_amount, created_at, updated_at
+		SELECT id, user_id, status, currency, subtotal_amount, tax_amount, total_amount, shipping_method_id, shipping_amount, shipping_address, exchange_rates, created_at, updated_at
 		FROM orders
 		WHERE id = $1 AND user_id = $2
 	`, orderID, userID)
 	if err != nil {
 		return nil, err
 	}
-	var items []order.OrderItem
-	err = r.db.SelectContext(ctx, &items, `
-		SELECT product_id, quantity, price
-		FROM order_items
-		WHERE order_id = $1
+	if o.Items, err = r.getOrderItems(ctx, orderID); err != nil {
+		return nil, err
+	}
+	if err = r.loadRefunds(ctx, &o); err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+func (r *OrderRepo) GetAllOrders(ctx context.Context, offset, limit int) ([]*order.Order, error) {
+	var orders []*order.Order
+	err := r.db.SelectContext(ctx, &orders, `
+		SELECT id, user_id, status, currency, subtotal_amount, tax_amount, total_amount, shipping_method_id, shipping_amount, shipping_address, exchange_rates, created_at, updated_at
+		FROM orders
+		ORDER BY created_at DESC
+		OFFSET $1 LIMIT $2
+	`, offset, limit)
+	return orders, err
+}
+
+func (r *OrderRepo) GetOrderByID(ctx context.Context, orderID int64) (*order.Order, error) {
+	var o order.Order
+	err := r.db.GetContext(ctx, &o, `
+		SELECT id, user_id, status, currency, subtotal_amount, tax_amount, total_amount, shipping_method_id, shipping_amount, shipping_address, exchange_rates, created_at, updated_at
+		FROM orders
+		WHERE id = $1
 	`, orderID)
 	if err != nil {
 		return nil, err
 	}
-	o.Items = items
+	if o.Items, err = r.getOrderItems(ctx, orderID); err != nil {
+		return nil, err
+	}
+	if err = r.loadRefunds(ctx, &o); err != nil {
+		return nil, err
+	}
 	return &o, nil
 }
 
+func (r *OrderRepo) getOrderItems(ctx context.Context, orderID int64) ([]order.OrderItem, error) {
+	var items []order.OrderItem
+	err := r.db.SelectContext(ctx, &items, `
+		SELECT id, order_id, COALESCE(product_id, 0) AS product_id, quantity, price, vat_rate, tax_amount, price_includes_tax,
+			product_name, product_description, COALESCE(category_id, 0) AS category_id, category_name, catalog_price, catalog_currency
+		FROM order_items
+		WHERE order_id = $1
+		ORDER BY id
+	`, orderID)
+	return items, err
+}
+
+// loadRefunds добавляет к заказу возвраты с позициями и сумму проведенных возвратов.
+func (r *OrderRepo) loadRefunds(ctx context.Context, o *order.Order) error {
+	o.Refunds, o.RefundedAmount = nil, 0
+	if err := r.db.SelectContext(ctx, &o.Refunds, `
+		SELECT id, amount, status, reason, created_at
+		FROM refunds
+		WHERE order_id = $1
+		ORDER BY id
+	`, o.ID); err != nil {
+		return err
+	}
+	if len(o.Refunds) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(o.Refunds))
+	byID := make(map[int64]*order.RefundEntry, len(o.Refunds))
+	for i := range o.Refunds {
+		ref := &o.Refunds[i]
+		ids[i], byID[ref.ID] = ref.ID, ref
+		if ref.Status == "succeeded" {
+			o.RefundedAmount += ref.Amount
+		}
+	}
+	var lines []struct {
+		RefundID int64 `db:"refund_id"`
+		order.RefundLine
+	}
+	if err := r.db.SelectContext(ctx, &lines, `
+		SELECT refund_id, order_item_id, quantity, amount
+		FROM refund_items
+		WHERE refund_id = ANY($1)
+		ORDER BY refund_id, order_item_id
+	`, pq.Array(ids)); err != nil {
+		return err
+	}
+	for _, l := range lines {
+		byID[l.RefundID].Lines = append(byID[l.RefundID].Lines, l.RefundLine)
+	}
+	return nil
+}
+
 func (r *OrderRepo) GetOrderStatus(ctx context.Context, orderID int64) (string, error) {
 	var status string
 	if err := r.db.GetContext(ctx, &status, `
@@ -172,8 +467,9 @@ func (r *OrderRepo) GetOrderStatus(ctx context.Context, orderID int64) (string,
 	return status, nil
 }
 
-func (r *OrderRepo) UpdateOrderStatus(ctx context.Context, orderID int64, from, to string) error {
-	result, err := r.db.ExecContext(ctx, `
+func (r *OrderRepo) UpdateOrderStatus(ctx context.Context, tx order.Tx, orderID int64, from, to string) error {
+	xtx := tx.(*txWrap)
+	result, err := xtx.ExecContext(ctx, `
 		UPDATE orders
 		SET status = $1, updated_at = NOW()
 		WHERE id = $2 AND status = $3
@@ -187,3 +483,48 @@ func (r *OrderRepo) UpdateOrderStatus(ctx context.Context, orderID int64, from,
 	}
 	return nil
 }
+
+func (r *OrderRepo) AddStatusHistory(ctx context.Context, tx order.Tx, change *order.StatusChange) error {
+	xtx := tx.(*txWrap)
+	return insertStatusHistory(ctx, xtx, change)
+}
+
+func (r *OrderRepo) GetStatusHistory(ctx context.Context, orderID int64) ([]order.StatusChange, error) {
+	history := []order.StatusChange{}
+	err := r.db.SelectContext(ctx, &history, `
+		SELECT id, order_id, COALESCE(from_status, '') AS from_status, to_status, actor_id, reason, created_at
+		FROM order_status_history
+		WHERE order_id = $1
+		ORDER BY created_at, id
+	`, orderID)
+	return history, err
+}
+
+func (r *OrderRepo) GetStatusEventsSince(ctx context.Context, userID, afterID int64, limit int) ([]order.StatusEvent, error) {
+	var events []order.StatusEvent
+	err := r.db.SelectContext(ctx, &events, `
+		SELECT h.id, h.order_id, COALESCE(h.from_status, '') AS from_status, h.to_status, h.actor_id, h.reason, h.created_at,
+			o.user_id
+		FROM order_status_history h
+		JOIN orders o ON o.id = h.order_id
+		WHERE o.user_id = $1 AND h.id > $2
+		ORDER BY h.id
+		LIMIT $3
+	`, userID, afterID, limit)
+	return events, err
+}
+
+func (r *OrderRepo) AddOutboxEvent(ctx context.Context, tx order.Tx, event outbox.Event) error {
+	xtx := tx.(*txWrap)
+	return insertOutboxEvent(ctx, xtx, event)
+}
+
+// insertStatusHistory пишет запись истории статусов; используется всеми
+// репозиториями, которые меняют orders.status.
+func insertStatusHistory(ctx context.Context, ex sqlx.ExecerContext, change *order.StatusChange) error {
+	_, err := ex.ExecContext(ctx, `
+		INSERT INTO order_status_history (order_id, from_status, to_status, actor_id, reason)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5)
+	`, change.OrderID, change.FromStatus, change.ToStatus, change.ActorID, change.Reason)
+	return err
+}
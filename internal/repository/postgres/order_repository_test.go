@@ -0,0 +1,204 @@
+package postgres
+
+import (
+	"context"
+	"marketplace/internal/ledger"
+	"marketplace/internal/order"
+	"marketplace/internal/payment"
+	"marketplace/internal/wallet"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderRepository_GetUserOrders_Filtered(t *testing.T) {
+	xdb, mock, cleanup := newMockDB(t)
+	repo := NewOrderRepo(xdb)
+
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	after := &order.Cursor{CreatedAt: time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC), ID: 10}
+
+	rows := sqlmock.NewRows([]string{"id", "user_id", "status", "total_amount", "created_at", "updated_at"}).
+		AddRow(9, 1, order.StatusPaid, int64(1000), time.Now(), time.Now())
+
+	mock.ExpectQuery(regexp.QuoteMeta(`
+		WHERE user_id = $1 AND status = $2 AND created_at >= $3 AND (created_at, id) > ($4, $5)
+		ORDER BY created_at ASC, id ASC
+		LIMIT $6`)).
+		WithArgs(int64(1), order.StatusPaid, from, after.CreatedAt, after.ID, 21).
+		WillReturnRows(rows)
+	mock.ExpectClose()
+
+	got, err := repo.GetUserOrders(context.Background(), 1, order.ListFilter{
+		Status:      order.StatusPaid,
+		CreatedFrom: &from,
+		Sort:        order.SortCreatedAsc,
+		After:       after,
+		Limit:       21,
+	})
+	require.NoError(t, err)
+	assert.Len(t, got, 1)
+	assert.Equal(t, int64(9), got[0].ID)
+
+	cleanup()
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_ReserveStock_NotEnough(t *testing.T) {
+	xdb, mock, cleanup := newMockDB(t)
+	repo := NewOrderRepo(xdb)
+
+	mock.ExpectBegin()
+	// одна из двух позиций не списалась: весь запрос считается неудачным
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT (SELECT COUNT(*) FROM upd) - (SELECT COUNT(*) FROM want)`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"diff"}).AddRow(-1))
+	mock.ExpectRollback()
+	mock.ExpectClose()
+
+	tx, err := repo.BeginTx(context.Background())
+	require.NoError(t, err)
+	err = repo.ReserveStock(context.Background(), tx, []order.OrderItem{
+		{ProductID: 10, Quantity: 2}, {ProductID: 20, Quantity: 1},
+	})
+	assert.ErrorIs(t, err, order.ErrInsufficientStock)
+	require.NoError(t, tx.Rollback())
+
+	cleanup()
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_BulkInsertItems_SingleStatement(t *testing.T) {
+	xdb, mock, cleanup := newMockDB(t)
+	repo := NewOrderRepo(xdb)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT $1, i.*`)).
+		WithArgs(int64(7), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+			sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+			sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+	mock.ExpectClose()
+
+	tx, err := repo.BeginTx(context.Background())
+	require.NoError(t, err)
+	err = repo.BulkInsertItems(context.Background(), tx, 7, []order.OrderItem{
+		{ProductID: 1, Quantity: 1, Price: 100}, {ProductID: 2, Quantity: 2, Price: 200}, {ProductID: 3, Quantity: 3, Price: 300},
+	})
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+
+	cleanup()
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_ExpirePaymentIntents_Includes3DS(t *testing.T) {
+	xdb, mock, cleanup := newMockDB(t)
+	repo := NewOrderRepo(xdb)
+
+	mock.ExpectBegin()
+	// статус не меняем: отменит ExpiryWorker платежей, сначала у провайдера
+	mock.ExpectExec(regexp.QuoteMeta(`SET expires_at = NOW(), updated_at = NOW()
+		WHERE order_id = $1 AND status IN ('requires_confirmation', 'requires_action')`)).
+		WithArgs(int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectRollback()
+	mock.ExpectClose()
+
+	tx, err := repo.BeginTx(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, repo.ExpirePaymentIntents(context.Background(), tx, 7))
+	require.NoError(t, tx.Rollback())
+
+	cleanup()
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_ReleaseWalletPayments_PaidOrder(t *testing.T) {
+	xdb, mock, cleanup := newMockDB(t)
+	repo := NewOrderRepo(xdb)
+	orderID, intentID := int64(7), int64(9)
+
+	mock.ExpectBegin()
+	// оплачено 600 из кошелька, 200 из них уже вернули: на кошелек уходит остаток
+	mock.ExpectQuery(regexp.QuoteMeta(`RETURNING pi.id, pi.amount - pi.refunded_amount AS amount, pi.currency, o.user_id`)).
+		WithArgs(orderID, payment.WalletProvider).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "amount", "currency", "user_id"}).AddRow(intentID, 400, "RUB", 3))
+	mock.ExpectQuery(regexp.QuoteMeta(`ON CONFLICT (user_id, currency)`)).
+		WithArgs(int64(3), "RUB", int64(400)).
+		WillReturnRows(sqlmock.NewRows([]string{"balance"}).AddRow(400))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO wallet_transactions`)).
+		WithArgs(int64(3), "RUB", int64(400), int64(400), wallet.KindOrderRelease, &orderID, &intentID, nil, nil, nil).
+		WillReturnRows(sqlmock.NewRows(walletTxRow).
+			AddRow(12, 3, "RUB", 400, 400, wallet.KindOrderRelease, orderID, intentID, nil, nil, nil, time.Now()))
+	mock.ExpectRollback()
+	mock.ExpectClose()
+
+	tx, err := repo.BeginTx(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, repo.ReleaseWalletPayments(context.Background(), tx, orderID))
+	require.NoError(t, tx.Rollback())
+
+	cleanup()
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_CompensatePayment_PostsReversal(t *testing.T) {
+	xdb, mock, cleanup := newMockDB(t)
+	repo := NewOrderRepo(xdb)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO payment_compensations`)).
+		WithArgs(int64(7), "out of stock").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	// по заказу: 1000 продавцу, 200 НДС, 300 выручки; 500 оплачено бонусами и уже вернулось на кошелек
+	mock.ExpectQuery(regexp.QuoteMeta(`AS seller`)).
+		WithArgs(int64(7), ledger.AccountSellerPayable, ledger.AccountTaxPayable, ledger.AccountPlatformRevenue, ledger.AccountStoreCredit).
+		WillReturnRows(sqlmock.NewRows([]string{"currency", "seller", "tax", "revenue", "credit"}).AddRow("RUB", 1000, 200, 300, 500))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO ledger_journals`)).
+		WithArgs(ledger.KindPaymentReversed, "order:7", "RUB", int64(7), nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO ledger_entries`)).
+		WithArgs(int64(3),
+			pq.Array([]string{ledger.AccountSellerPayable, ledger.AccountTaxPayable, ledger.AccountPlatformRevenue, ledger.AccountStoreCredit, ledger.AccountRefundsPayable}),
+			pq.Array([]int64{-1000, -200, -300, 500, 1000})).
+		WillReturnResult(sqlmock.NewResult(0, 5))
+	mock.ExpectRollback()
+	mock.ExpectClose()
+
+	tx, err := repo.BeginTx(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, repo.CompensatePayment(context.Background(), tx, 7, "out of stock"))
+	require.NoError(t, tx.Rollback())
+
+	cleanup()
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_ClaimExpiredOrders_DatabaseClock(t *testing.T) {
+	xdb, mock, cleanup := newMockDB(t)
+	repo := NewOrderRepo(xdb)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`updated_at < NOW() - make_interval(secs => $1)`)).
+		WithArgs(float64(900), 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3).AddRow(4))
+	mock.ExpectRollback()
+	mock.ExpectClose()
+
+	tx, err := repo.BeginTx(context.Background())
+	require.NoError(t, err)
+	ids, err := repo.ClaimExpiredOrders(context.Background(), tx, 15*time.Minute, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{3, 4}, ids)
+	require.NoError(t, tx.Rollback())
+
+	cleanup()
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,68 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"marketplace/internal/order"
+	"time"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// orderStatusChannel — канал NOTIFY, в который пишет триггер на order_status_history.
+const orderStatusChannel = "order_status"
+
+// orderStatusNotification — payload триггера notify_order_status.
+type orderStatusNotification struct {
+	order.StatusChange
+	UserID int64 `json:"user_id"`
+}
+
+// OrderStatusListener слушает NOTIFY о переходах статусов и раздает их в Hub.
+type OrderStatusListener struct {
+	dsn string
+	hub *order.Hub
+}
+
+func NewOrderStatusListener(dsn string, hub *order.Hub) *OrderStatusListener {
+	return &OrderStatusListener{dsn: dsn, hub: hub}
+}
+
+// Run блокируется до отмены ctx. pq.Listener сам переподключается к базе;
+// события, пришедшие во время разрыва, клиенты догружают по Last-Event-ID.
+func (l *OrderStatusListener) Run(ctx context.Context) {
+	listener := pq.NewListener(l.dsn, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			zap.L().Warn("Order status listener connection event", zap.Int("event", int(ev)), zap.Error(err))
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(orderStatusChannel); err != nil {
+		zap.L().Error("Failed to listen for order status notifications", zap.Error(err))
+		return
+	}
+
+	ping := time.NewTicker(90 * time.Second)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-listener.Notify:
+			if n == nil {
+				// соединение восстановлено, часть уведомлений могла потеряться
+				continue
+			}
+			var p orderStatusNotification
+			if err := json.Unmarshal([]byte(n.Extra), &p); err != nil {
+				zap.L().Error("Invalid order status notification", zap.String("payload", n.Extra), zap.Error(err))
+				continue
+			}
+			l.hub.Publish(order.StatusEvent{StatusChange: p.StatusChange, UserID: p.UserID})
+		case <-ping.C:
+			go listener.Ping()
+		}
+	}
+}
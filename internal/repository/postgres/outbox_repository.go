@@ -0,0 +1,70 @@
+package postgres
+
+import (
+	"context"
+	"marketplace/internal/outbox"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type OutboxRepo struct {
+	db *sqlx.DB
+}
+
+func NewOutboxRepo(db *sqlx.DB) *OutboxRepo {
+	return &OutboxRepo{db: db}
+}
+
+// insertOutboxEvent пишет событие в outbox; вызывается внутри транзакции
+// бизнес-изменения.
+func insertOutboxEvent(ctx context.Context, ex sqlx.ExecerContext, e outbox.Event) error {
+	_, err := ex.ExecContext(ctx, `
+		INSERT INTO outbox_events (aggregate_type, aggregate_id, event_type, payload)
+		VALUES ($1, $2, $3, $4)
+	`, e.AggregateType, e.AggregateID, e.EventType, []byte(e.Payload))
+	return err
+}
+
+func (r *OutboxRepo) ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]outbox.Event, error) {
+	var events []outbox.Event
+	err := r.db.SelectContext(ctx, &events, `
+		WITH claimed AS (
+			UPDATE outbox_events
+			SET next_attempt_at = NOW() + make_interval(secs => $2)
+			WHERE id IN (
+				SELECT id
+				FROM outbox_events
+				WHERE status = 'pending' AND next_attempt_at <= NOW()
+				ORDER BY id
+				LIMIT $1
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING id, aggregate_type, aggregate_id, event_type, payload, attempts, created_at
+		)
+		SELECT * FROM claimed ORDER BY id
+	`, limit, lease.Seconds())
+	return events, err
+}
+
+func (r *OutboxRepo) MarkDelivered(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE outbox_events
+		SET status = 'delivered', delivered_at = NOW(), attempts = attempts + 1, last_error = NULL
+		WHERE id = $1
+	`, id)
+	return err
+}
+
+func (r *OutboxRepo) MarkFailed(ctx context.Context, id int64, lastErr string, retryAt time.Time, dead bool) error {
+	status := outbox.StatusPending
+	if dead {
+		status = outbox.StatusDead
+	}
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE outbox_events
+		SET status = $2, attempts = attempts + 1, last_error = $3, next_attempt_at = $4
+		WHERE id = $1
+	`, id, status, lastErr, retryAt)
+	return err
+}
@@ -2,13 +2,17 @@ package postgres
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/hex"
+	"database/sql"
+	"errors"
 	"fmt"
+	"marketplace/internal/ledger"
 	"marketplace/internal/order"
 	"marketplace/internal/payment"
+	"marketplace/internal/wallet"
+	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 type PaymentRepo struct {
@@ -19,72 +23,775 @@ func NewPaymentRepo(db *sqlx.DB) *PaymentRepo {
 	return &PaymentRepo{db: db}
 }
 
-func randSecret(n int) (string, error) {
-	b := make([]byte, n)
-	if _, err := rand.Read(b); err != nil {
-		return "", err
+const intentColumns = `id, order_id, amount, currency, status, client_secret, provider, provider_intent_id,
+	next_action_url, failure_reason, refunded_amount, expires_at, created_at, updated_at`
+
+const refundColumns = `id, payment_intent_id, order_id, amount, currency, status, reason, provider_refund_id, actor_id, created_at, updated_at`
+
+func (r *PaymentRepo) CreateIntent(ctx context.Context, o *order.Order, walletAmount int64, provider string, gi *payment.GatewayIntent, expiresAt time.Time, actorID int64) (*payment.Intent, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	// смена статуса блокирует заказ: параллельный запрос не спишет кошелек второй раз
+	var pi payment.Intent
+	err = tx.QueryRowxContext(ctx, `
+		WITH upd AS (
+			UPDATE orders SET status = 'awaiting_payment', updated_at = NOW()
+			WHERE id = $1 AND status IN ('new')
+			RETURNING id, total_amount, currency
+		), hist AS (
+			INSERT INTO order_status_history (order_id, from_status, to_status, actor_id, reason)
+				SELECT id, 'new', 'awaiting_payment', $3, 'payment intent created' FROM upd
+		)
+		INSERT INTO payment_intents (order_id, amount, currency, status, client_secret, provider, provider_intent_id, next_action_url, expires_at)
+			SELECT id, total_amount - $9, currency, $6, $2, $4, $5, NULLIF($7, ''), $8 FROM upd
+		RETURNING `+intentColumns+`
+	`, o.ID, gi.ClientSecret, order.ActorRef(actorID), provider, gi.ProviderID, gi.Status, gi.NextActionURL, expiresAt, walletAmount).StructScan(&pi)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, payment.ErrOrderNotPayable
 	}
-	return hex.EncodeToString(b), nil
+	if err != nil {
+		return nil, fmt.Errorf("create intent failed: %w", err)
+	}
+	if walletAmount > 0 {
+		if _, err = spendWallet(ctx, tx, o, walletAmount, actorID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit tx: %w", err)
+	}
+	return &pi, nil
 }
 
-func (r *PaymentRepo) CreateIntent(ctx context.Context, o *order.Order) (*payment.Intent, error) {
-	secret, err := randSecret(16)
+func (r *PaymentRepo) PayWithWallet(ctx context.Context, o *order.Order, actorID int64) (*payment.Intent, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("begin tx: %w", err)
 	}
-	var pi payment.Intent
-	err = r.db.QueryRowxContext(ctx, `
+	defer tx.Rollback()
+
+	var total int64
+	err = tx.GetContext(ctx, &total, `
 		WITH upd AS (
-			UPDATE orders SET status = 'awaiting_payment'
+			UPDATE orders SET status = 'awaiting_payment', updated_at = NOW()
 			WHERE id = $1 AND status IN ('new')
 			RETURNING id, total_amount
+		), hist AS (
+			INSERT INTO order_status_history (order_id, from_status, to_status, actor_id, reason)
+				SELECT id, 'new', 'awaiting_payment', $2, 'paid from wallet' FROM upd
 		)
-		INSERT INTO payment_intents (order_id, amount, status, client_secret)
-			SELECT id, total_amount, 'requires_confirmation', $2 FROM upd
-		RETURNING id, order_id, amount, status, client_secret, created_at, updated_at
-	`, o.ID, secret).Scan(&pi.ID, &pi.OrderID, &pi.Amount, &pi.Status, &pi.ClientSecret, &pi.CreatedAt, &pi.UpdatedAt)
+		SELECT total_amount FROM upd
+	`, o.ID, order.ActorRef(actorID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, payment.ErrOrderNotPayable
+	}
 	if err != nil {
-		return nil, fmt.Errorf("create intent failed: %w", err)
+		return nil, fmt.Errorf("lock order: %w", err)
+	}
+	pi, err := spendWallet(ctx, tx, o, total, actorID)
+	if err != nil {
+		return nil, err
+	}
+	if err = postCapture(ctx, tx, pi); err != nil {
+		return nil, err
+	}
+	paid, err := markOrderPaid(ctx, tx, o.ID, actorID, "paid from wallet")
+	if err != nil {
+		return nil, err
+	}
+	if !paid {
+		return nil, payment.ErrOrderNotPayable
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit tx: %w", err)
+	}
+	return pi, nil
+}
+
+func (r *PaymentRepo) WalletBalance(ctx context.Context, userID int64, currency string) (int64, error) {
+	var balance int64
+	err := r.db.GetContext(ctx, &balance, `
+		SELECT COALESCE((SELECT balance FROM wallets WHERE user_id = $1 AND currency = $2), 0)
+	`, userID, currency)
+	return balance, err
+}
+
+// spendWallet списывает amount с кошелька покупателя в валюте заказа и сохраняет
+// оплаченное намерение кошелька. Не хватает денег — wallet.ErrInsufficientFunds.
+func spendWallet(ctx context.Context, tx *sqlx.Tx, o *order.Order, amount, actorID int64) (*payment.Intent, error) {
+	var pi payment.Intent
+	if err := tx.GetContext(ctx, &pi, `
+		INSERT INTO payment_intents (order_id, amount, currency, status, client_secret, provider)
+			SELECT id, $2, currency, 'succeeded', '', $3 FROM orders WHERE id = $1
+		RETURNING `+intentColumns+`
+	`, o.ID, amount, payment.WalletProvider); err != nil {
+		return nil, fmt.Errorf("create wallet intent: %w", err)
+	}
+	if _, err := applyWalletTx(ctx, tx, &wallet.Transaction{
+		UserID:          o.UserID,
+		Currency:        pi.Currency,
+		Amount:          -amount,
+		Kind:            wallet.KindOrderPayment,
+		OrderID:         &pi.OrderID,
+		PaymentIntentID: &pi.ID,
+		ActorID:         order.ActorRef(actorID),
+	}); err != nil {
+		return nil, err
+	}
+	if err := insertPaymentSucceeded(ctx, tx, &pi); err != nil {
+		return nil, err
+	}
+	return &pi, nil
+}
+
+func (r *PaymentRepo) AddAttempt(ctx context.Context, o *order.Order, provider string, gi *payment.GatewayIntent, expiresAt time.Time) (*payment.Intent, error) {
+	var pi payment.Intent
+	err := r.db.GetContext(ctx, &pi, `
+		INSERT INTO payment_intents (order_id, amount, currency, status, client_secret, provider, provider_intent_id, next_action_url, expires_at)
+			SELECT o.id, o.total_amount - COALESCE(SUM(paid.amount), 0), o.currency, $2, $3, $4, $5, NULLIF($6, ''), $7
+			FROM orders o
+			LEFT JOIN payment_intents paid ON paid.order_id = o.id AND paid.status = 'succeeded'
+			WHERE o.id = $1 AND o.status = 'awaiting_payment'
+			GROUP BY o.id
+		RETURNING `+intentColumns+`
+	`, o.ID, gi.Status, gi.ClientSecret, provider, gi.ProviderID, gi.NextActionURL, expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, payment.ErrOrderNotPayable
+	}
+	var pqe *pq.Error
+	if errors.As(err, &pqe) && pqe.Code == "23505" && pqe.Constraint == "idx_payment_intents_one_active" {
+		return nil, payment.ErrIntentActive
+	}
+	if err != nil {
+		return nil, fmt.Errorf("add payment attempt failed: %w", err)
 	}
 	return &pi, nil
 }
 
-func (r *PaymentRepo) ConfirmIntent(ctx context.Context, orderID int64, clientSecret string) (*payment.Intent, error) {
+func (r *PaymentRepo) ListIntents(ctx context.Context, orderID int64) ([]payment.Intent, error) {
+	intents := []payment.Intent{}
+	err := r.db.SelectContext(ctx, &intents, `
+		SELECT `+intentColumns+`
+		FROM payment_intents
+		WHERE order_id = $1
+		ORDER BY id
+	`, orderID)
+	return intents, err
+}
+
+func (r *PaymentRepo) ListExpiredIntents(ctx context.Context, limit int) ([]payment.Intent, error) {
+	var intents []payment.Intent
+	err := r.db.SelectContext(ctx, &intents, `
+		SELECT `+intentColumns+`
+		FROM payment_intents
+		WHERE status IN ('requires_confirmation', 'requires_action') AND expires_at <= NOW()
+		ORDER BY expires_at
+		LIMIT $1
+	`, limit)
+	return intents, err
+}
+
+func (r *PaymentRepo) GetActiveIntent(ctx context.Context, orderID int64) (*payment.Intent, error) {
+	var pi payment.Intent
+	err := r.db.GetContext(ctx, &pi, `
+		SELECT `+intentColumns+`, NOT COALESCE(expires_at > NOW(), true) AS expired
+		FROM payment_intents
+		WHERE order_id = $1 AND status IN ('requires_confirmation', 'requires_action')
+		ORDER BY id DESC
+		LIMIT 1
+	`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	return &pi, nil
+}
+
+func (r *PaymentRepo) GetIntent(ctx context.Context, intentID int64) (*payment.Intent, error) {
+	var pi payment.Intent
+	if err := r.db.GetContext(ctx, &pi, `
+		SELECT `+intentColumns+`
+		FROM payment_intents
+		WHERE id = $1
+	`, intentID); err != nil {
+		return nil, err
+	}
+	return &pi, nil
+}
+
+func (r *PaymentRepo) UpdateIntentStatus(ctx context.Context, intentID int64, gi *payment.GatewayIntent) (*payment.Intent, error) {
+	var pi payment.Intent
+	err := r.db.GetContext(ctx, &pi, `
+		UPDATE payment_intents
+		SET status = $2, next_action_url = NULLIF($3, ''), failure_reason = NULLIF($4, ''), updated_at = NOW()
+		WHERE id = $1 AND status IN ('requires_confirmation', 'requires_action')
+		RETURNING `+intentColumns+`
+	`, intentID, gi.Status, gi.NextActionURL, gi.FailureReason)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, payment.ErrIntentNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("update intent failed: %w", err)
+	}
+	return &pi, nil
+}
+
+func (r *PaymentRepo) MarkSucceeded(ctx context.Context, intentID, actorID int64) (*payment.Intent, error) {
 	tx, err := r.db.BeginTxx(ctx, nil)
 	if err != nil {
 		return nil, fmt.Errorf("begin tx: %w", err)
 	}
 	defer tx.Rollback()
 
+	if err = lockIntentOrder(ctx, tx, `pi.id = $1`, intentID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, payment.ErrIntentNotFound
+		}
+		return nil, err
+	}
 	var pi payment.Intent
-	err = tx.QueryRowxContext(ctx, `
+	err = tx.GetContext(ctx, &pi, `
 		UPDATE payment_intents
-		SET status = 'succeeded', updated_at = NOW()
-		WHERE order_id = $1 AND client_secret = $2 AND status = 'requires_confirmation'
-		RETURNING id, order_id, amount, status, client_secret, created_at, updated_at
-	`, orderID, clientSecret).Scan(
-		&pi.ID, &pi.OrderID, &pi.Amount, &pi.Status, &pi.ClientSecret, &pi.CreatedAt, &pi.UpdatedAt)
+		SET status = 'succeeded', next_action_url = NULL, updated_at = NOW()
+		WHERE id = $1 AND status IN ('requires_confirmation', 'requires_action')
+		RETURNING `+intentColumns+`
+	`, intentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, payment.ErrIntentNotFound
+	}
 	if err != nil {
 		return nil, fmt.Errorf("confirm intent failed: %w", err)
 	}
+	if err = postCapture(ctx, tx, &pi); err != nil {
+		return nil, err
+	}
+	if err = insertPaymentSucceeded(ctx, tx, &pi); err != nil {
+		return nil, err
+	}
+	paid, err := markOrderPaid(ctx, tx, pi.OrderID, actorID, "payment confirmed")
+	if err != nil {
+		return nil, err
+	}
+	if !paid {
+		// деньги уже у нас: фиксируем списание, иначе ExpiryWorker будет находить намерение вечно
+		if err = recordOrphanCapture(ctx, tx, &pi); err != nil {
+			return nil, err
+		}
+	}
 
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit tx: %w", err)
+	}
+	if !paid {
+		return &pi, payment.ErrOrphanCapture
+	}
+	return &pi, nil
+}
+
+// recordOrphanCapture ставит к компенсации платеж, списанный за заказ, который уже нельзя оплатить,
+// и сторнирует его проводку.
+func recordOrphanCapture(ctx context.Context, tx *sqlx.Tx, pi *payment.Intent) error {
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO payment_compensations (order_id, payment_intent_id, amount, reason)
+		VALUES ($1, $2, $3, 'captured after order closed')
+		ON CONFLICT (payment_intent_id) DO NOTHING
+	`, pi.OrderID, pi.ID, pi.Amount); err != nil {
+		return fmt.Errorf("record orphan capture: %w", err)
+	}
+	return postCaptureReversal(ctx, tx, pi.OrderID, fmt.Sprintf("payment_intent:%d", pi.ID))
+}
+
+func (r *PaymentRepo) ApplyEvent(ctx context.Context, provider string, ev *payment.ProviderEvent) (string, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	// параллельная доставка того же события ждет на ключе и видит конфликт
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO payment_provider_events (provider, event_id, event_type, provider_intent_id)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (provider, event_id) DO NOTHING
+	`, provider, ev.ID, ev.Type, ev.Intent.ProviderID)
+	if err != nil {
+		return "", fmt.Errorf("record event: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return "", fmt.Errorf("rows affected: %w", err)
+	} else if n == 0 {
+		return payment.WebhookDuplicate, nil
+	}
+
+	result, err := applyProviderIntent(ctx, tx, provider, &ev.Intent)
+	if err != nil {
+		return "", err
+	}
+	if _, err = tx.ExecContext(ctx, `
+		UPDATE payment_provider_events SET result = $3
+		WHERE provider = $1 AND event_id = $2
+	`, provider, ev.ID, result); err != nil {
+		return "", fmt.Errorf("record event result: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("commit tx: %w", err)
+	}
+	return result, nil
+}
+
+// applyProviderIntent переносит состояние платежа у провайдера на намерение под блокировкой строки,
+// а при succeeded оплачивает заказ. Устаревшие события не меняют ничего.
+func applyProviderIntent(ctx context.Context, tx *sqlx.Tx, provider string, gi *payment.GatewayIntent) (string, error) {
+	err := lockIntentOrder(ctx, tx, `pi.provider = $1 AND pi.provider_intent_id = $2`, provider, gi.ProviderID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return payment.WebhookIgnored, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	var pi payment.Intent
+	err = tx.GetContext(ctx, &pi, `
+		SELECT `+intentColumns+`
+		FROM payment_intents
+		WHERE provider = $1 AND provider_intent_id = $2
+		FOR UPDATE
+	`, provider, gi.ProviderID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return payment.WebhookIgnored, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("lock intent: %w", err)
+	}
+	if !payment.ProviderStatusApplies(pi.Status, gi.Status) {
+		return payment.WebhookIgnored, nil
+	}
+
+	if _, err = tx.ExecContext(ctx, `
+		UPDATE payment_intents
+		SET status = $2, next_action_url = NULLIF($3, ''), failure_reason = NULLIF($4, ''), updated_at = NOW()
+		WHERE id = $1
+	`, pi.ID, gi.Status, gi.NextActionURL, gi.FailureReason); err != nil {
+		return "", fmt.Errorf("update intent failed: %w", err)
+	}
+	if gi.Status != payment.StatusSucceeded {
+		return payment.WebhookApplied, nil
+	}
+	if err = postCapture(ctx, tx, &pi); err != nil {
+		return "", err
+	}
+	if err = insertPaymentSucceeded(ctx, tx, &pi); err != nil {
+		return "", err
+	}
+	paid, err := markOrderPaid(ctx, tx, pi.OrderID, 0, "payment confirmed by provider")
+	if err != nil {
+		return "", err
+	}
+	if !paid {
+		if err = recordOrphanCapture(ctx, tx, &pi); err != nil {
+			return "", err
+		}
+		return payment.WebhookOrphanCapture, nil
+	}
+	return payment.WebhookApplied, nil
+}
+
+func (r *PaymentRepo) CreateRefund(ctx context.Context, ref *payment.Refund) (*payment.Refund, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	// блокировка намерения сериализует возвраты по нему
+	var pi payment.Intent
+	err = tx.GetContext(ctx, &pi, `
+		SELECT `+intentColumns+`
+		FROM payment_intents
+		WHERE id = $1
+		FOR UPDATE
+	`, ref.IntentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, payment.ErrIntentNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lock intent: %w", err)
+	}
+	if pi.Status != payment.StatusSucceeded {
+		return nil, payment.ErrNotRefundable
+	}
+	// повтор после сбоя у провайдера: тот же возврат уже ждет ответа и держит резерв
+	var open payment.Refund
+	err = tx.GetContext(ctx, &open, `
+		SELECT `+refundColumns+`
+		FROM refunds
+		WHERE payment_intent_id = $1 AND amount = $2 AND status = 'pending'
+		ORDER BY id
+		LIMIT 1
+	`, ref.IntentID, ref.Amount)
+	if err == nil {
+		return &open, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("get pending refund: %w", err)
+	}
+	if pi.RefundedAmount+ref.Amount > pi.Amount {
+		return nil, fmt.Errorf("%w: %d of %d already refunded", payment.ErrRefundExceedsAmount, pi.RefundedAmount, pi.Amount)
+	}
+
+	var (
+		itemIDs    = make([]int64, len(ref.Lines))
+		quantities = make([]int64, len(ref.Lines))
+		amounts    = make([]int64, len(ref.Lines))
+	)
+	for i, l := range ref.Lines {
+		itemIDs[i], quantities[i], amounts[i] = l.OrderItemID, int64(l.Quantity), l.Amount
+	}
+	if len(ref.Lines) > 0 {
+		// позиции, по которым просят вернуть больше, чем осталось после прошлых возвратов
+		var over []int64
+		if err = tx.SelectContext(ctx, &over, `
+			SELECT req.item_id
+			FROM unnest($1::bigint[], $2::bigint[]) AS req(item_id, quantity)
+			JOIN order_items oi ON oi.id = req.item_id AND oi.order_id = $3
+			LEFT JOIN refund_items ri ON ri.order_item_id = oi.id
+			LEFT JOIN refunds rf ON rf.id = ri.refund_id AND rf.status <> 'failed'
+			GROUP BY req.item_id, req.quantity, oi.quantity
+			HAVING oi.quantity - COALESCE(SUM(ri.quantity) FILTER (WHERE rf.id IS NOT NULL), 0) < req.quantity
+		`, pq.Array(itemIDs), pq.Array(quantities), ref.OrderID); err != nil {
+			return nil, fmt.Errorf("check refunded items: %w", err)
+		}
+		if len(over) > 0 {
+			return nil, fmt.Errorf("%w: order items %v", payment.ErrRefundExceedsItems, over)
+		}
+	}
+
+	var out payment.Refund
+	if err = tx.GetContext(ctx, &out, `
+		INSERT INTO refunds (payment_intent_id, order_id, amount, currency, status, reason, actor_id)
+		VALUES ($1, $2, $3, $4, 'pending', $5, $6)
+		RETURNING `+refundColumns+`
+	`, ref.IntentID, ref.OrderID, ref.Amount, pi.Currency, ref.Reason, ref.ActorID); err != nil {
+		return nil, fmt.Errorf("insert refund: %w", err)
+	}
+	if len(ref.Lines) > 0 {
+		if _, err = tx.ExecContext(ctx, `
+			INSERT INTO refund_items (refund_id, order_item_id, quantity, amount)
+			SELECT $1, * FROM unnest($2::bigint[], $3::int[], $4::bigint[])
+		`, out.ID, pq.Array(itemIDs), pq.Array(quantities), pq.Array(amounts)); err != nil {
+			return nil, fmt.Errorf("insert refund items: %w", err)
+		}
+	}
+	if _, err = tx.ExecContext(ctx, `
+		UPDATE payment_intents
+		SET refunded_amount = refunded_amount + $2, updated_at = NOW()
+		WHERE id = $1
+	`, ref.IntentID, ref.Amount); err != nil {
+		return nil, fmt.Errorf("reserve refund amount: %w", err)
+	}
+	if _, err = insertJournal(ctx, tx, ledger.RefundRequested(out.Currency, out.OrderID, out.ID, out.Amount)); err != nil {
+		return nil, fmt.Errorf("post refund to ledger: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit tx: %w", err)
+	}
+	out.Lines = ref.Lines
+	return &out, nil
+}
+
+func (r *PaymentRepo) ListPendingRefunds(ctx context.Context, olderThan time.Duration, limit int) ([]payment.Refund, error) {
+	refunds := []payment.Refund{}
+	err := r.db.SelectContext(ctx, &refunds, `
+		SELECT `+refundColumns+`
+		FROM refunds
+		WHERE status = 'pending' AND updated_at < NOW() - make_interval(secs => $1)
+		ORDER BY updated_at
+		LIMIT $2
+	`, olderThan.Seconds(), limit)
+	return refunds, err
+}
+
+func (r *PaymentRepo) FinishRefund(ctx context.Context, refundID int64, gr *payment.GatewayRefund, actorID int64) (*payment.Refund, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err = lockIntentOrder(ctx, tx, `pi.id = (SELECT payment_intent_id FROM refunds WHERE id = $1)`, refundID); err != nil {
+		return nil, err
+	}
+	var ref payment.Refund
+	err = tx.GetContext(ctx, &ref, `
+		UPDATE refunds
+		SET status = $2, provider_refund_id = COALESCE(NULLIF($3, ''), provider_refund_id), updated_at = NOW()
+		WHERE id = $1 AND status = 'pending'
+		RETURNING `+refundColumns+`
+	`, refundID, gr.Status, gr.ProviderID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// возврат закрыл параллельный вызов (сверка или уведомление провайдера): отдаем его итог
+		if err = tx.GetContext(ctx, &ref, `SELECT `+refundColumns+` FROM refunds WHERE id = $1`, refundID); err != nil {
+			return nil, fmt.Errorf("get refund: %w", err)
+		}
+		return &ref, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("update refund: %w", err)
+	}
+
+	switch ref.Status {
+	case payment.RefundFailed:
+		if _, err = tx.ExecContext(ctx, `
+			UPDATE payment_intents
+			SET refunded_amount = refunded_amount - $2, updated_at = NOW()
+			WHERE id = $1
+		`, ref.IntentID, ref.Amount); err != nil {
+			return nil, fmt.Errorf("release refund amount: %w", err)
+		}
+		if _, err = insertJournal(ctx, tx, ledger.RefundFailed(ref.Currency, ref.OrderID, ref.ID, ref.Amount)); err != nil {
+			return nil, fmt.Errorf("post refund to ledger: %w", err)
+		}
+	case payment.RefundSucceeded:
+		if err = settleRefund(ctx, tx, &ref); err != nil {
+			return nil, err
+		}
+		// заказ возвращен целиком, когда возвращено все оплаченное — и провайдеру, и из кошелька
+		var full bool
+		if err = tx.GetContext(ctx, &full, `
+			SELECT COALESCE(SUM(pi.amount), 0) = (
+				SELECT COALESCE(SUM(rf.amount), 0) FROM refunds rf
+				WHERE rf.order_id = $1 AND rf.status = 'succeeded'
+			)
+			FROM payment_intents pi
+			WHERE pi.order_id = $1 AND pi.status = 'succeeded'
+		`, ref.OrderID); err != nil {
+			return nil, fmt.Errorf("sum refunds: %w", err)
+		}
+		if full {
+			if err = markOrderRefunded(ctx, tx, ref.OrderID, actorID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit tx: %w", err)
+	}
+	return &ref, nil
+}
+
+// settleRefund проводит проведенный возврат: деньги провайдера уходят покупателю,
+// а оплата из кошелька возвращается на кошелек.
+func settleRefund(ctx context.Context, tx *sqlx.Tx, ref *payment.Refund) error {
+	var src struct {
+		Provider string `db:"provider"`
+		UserID   int64  `db:"user_id"`
+	}
+	if err := tx.GetContext(ctx, &src, `
+		SELECT pi.provider, o.user_id
+		FROM payment_intents pi
+		JOIN orders o ON o.id = pi.order_id
+		WHERE pi.id = $1
+	`, ref.IntentID); err != nil {
+		return fmt.Errorf("get refund source: %w", err)
+	}
+	j := ledger.RefundSucceeded(ref.Currency, ref.OrderID, ref.ID, ref.Amount)
+	if src.Provider == payment.WalletProvider {
+		if _, err := applyWalletTx(ctx, tx, &wallet.Transaction{
+			UserID:   src.UserID,
+			Currency: ref.Currency,
+			Amount:   ref.Amount,
+			Kind:     wallet.KindRefund,
+			OrderID:  &ref.OrderID,
+			RefundID: &ref.ID,
+			ActorID:  ref.ActorID,
+			Reason:   ref.Reason,
+		}); err != nil {
+			return err
+		}
+		j = ledger.RefundToWallet(ref.Currency, ref.OrderID, ref.ID, ref.Amount)
+	}
+	if _, err := insertJournal(ctx, tx, j); err != nil {
+		return fmt.Errorf("post refund to ledger: %w", err)
+	}
+	event, err := payment.NewRefundedEvent(ref)
+	if err != nil {
+		return fmt.Errorf("build event: %w", err)
+	}
+	if err = insertOutboxEvent(ctx, tx, event); err != nil {
+		return fmt.Errorf("write outbox event: %w", err)
+	}
+	return nil
+}
+
+// insertPaymentSucceeded пишет в outbox событие о списании денег по намерению.
+func insertPaymentSucceeded(ctx context.Context, tx *sqlx.Tx, pi *payment.Intent) error {
+	event, err := payment.NewSucceededEvent(pi)
+	if err != nil {
+		return fmt.Errorf("build event: %w", err)
+	}
+	if err = insertOutboxEvent(ctx, tx, event); err != nil {
+		return fmt.Errorf("write outbox event: %w", err)
+	}
+	return nil
+}
+
+// postCapture проводит оплату заказа по главной книге: товары — продавцам, НДС — к уплате,
+// остаток — в выручку. Списанное с кошелька проводится здесь же, вместе с платежом,
+// который завершил оплату. Проводится и оплата заказа, который уже нельзя оплатить: деньги получены.
+func postCapture(ctx context.Context, tx *sqlx.Tx, pi *payment.Intent) error {
+	var o struct {
+		Subtotal int64 `db:"subtotal_amount"`
+		Tax      int64 `db:"tax_amount"`
+		Credit   int64 `db:"credit"`
+	}
+	if err := tx.GetContext(ctx, &o, `
+		SELECT o.subtotal_amount, o.tax_amount, COALESCE(SUM(w.amount), 0) AS credit
+		FROM orders o
+		LEFT JOIN payment_intents w ON w.order_id = o.id AND w.provider = $2 AND w.status = 'succeeded'
+		WHERE o.id = $1
+		GROUP BY o.id
+	`, pi.OrderID, payment.WalletProvider); err != nil {
+		return fmt.Errorf("get order amounts: %w", err)
+	}
+	amount := pi.Amount
+	if pi.Provider == payment.WalletProvider {
+		amount = 0
+	}
+	if _, err := insertJournal(ctx, tx, ledger.Capture(pi.Currency, pi.OrderID, pi.ID, amount, o.Credit, o.Subtotal, o.Tax)); err != nil {
+		return fmt.Errorf("post capture to ledger: %w", err)
+	}
+	return nil
+}
+
+// postCaptureReversal сторнирует по главной книге оплату заказа, который уже нельзя выполнить:
+// обнуляет по заказу долг продавцам, НДС, выручку и списанные бонусы. Бонусы к этому моменту
+// уже возвращены на кошелек, остальное остается к возврату покупателю.
+func postCaptureReversal(ctx context.Context, ex sqlx.ExtContext, orderID int64, reference string) error {
+	var b struct {
+		Currency string `db:"currency"`
+		Seller   int64  `db:"seller"`
+		Tax      int64  `db:"tax"`
+		Revenue  int64  `db:"revenue"`
+		Credit   int64  `db:"credit"`
+	}
+	if err := sqlx.GetContext(ctx, ex, &b, `
+		SELECT o.currency,
+			COALESCE(SUM(e.amount) FILTER (WHERE e.account = $2), 0) AS seller,
+			COALESCE(SUM(e.amount) FILTER (WHERE e.account = $3), 0) AS tax,
+			COALESCE(SUM(e.amount) FILTER (WHERE e.account = $4), 0) AS revenue,
+			-COALESCE(SUM(e.amount) FILTER (WHERE e.account = $5), 0) AS credit
+		FROM orders o
+		LEFT JOIN ledger_journals j ON j.order_id = o.id
+		LEFT JOIN ledger_entries e ON e.journal_id = j.id
+		WHERE o.id = $1
+		GROUP BY o.id
+	`, orderID, ledger.AccountSellerPayable, ledger.AccountTaxPayable, ledger.AccountPlatformRevenue, ledger.AccountStoreCredit); err != nil {
+		return fmt.Errorf("get order ledger balances: %w", err)
+	}
+	j := ledger.CaptureReversed(reference, b.Currency, orderID, b.Seller, b.Tax, b.Revenue, b.Credit)
+	if len(j.Entries) == 0 {
+		return nil
+	}
+	if _, err := insertJournal(ctx, ex, j); err != nil {
+		return fmt.Errorf("post capture reversal to ledger: %w", err)
+	}
+	return nil
+}
+
+// lockIntentOrder блокирует заказ намерения, найденного по условию на pi, до любых изменений
+// намерения. Отмена и истечение заказа берут orders раньше payment_intents; платежи блокируют
+// в том же порядке, иначе встречные транзакции взаимоблокируются. sql.ErrNoRows — намерения нет.
+func lockIntentOrder(ctx context.Context, tx *sqlx.Tx, cond string, args ...any) error {
+	var orderID int64
+	err := tx.GetContext(ctx, &orderID, `
+		SELECT o.id
+		FROM payment_intents pi
+		JOIN orders o ON o.id = pi.order_id
+		WHERE `+cond+`
+		FOR UPDATE OF o
+	`, args...)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("lock order: %w", err)
+	}
+	return err
+}
+
+// markOrderPaid переводит заказ awaiting_payment -> paid с историей и событием;
+// false — заказ уже в другом статусе.
+func markOrderPaid(ctx context.Context, tx *sqlx.Tx, orderID, actorID int64, reason string) (bool, error) {
 	res, err := tx.ExecContext(ctx, `
 		UPDATE orders SET status = 'paid', updated_at = NOW()
 		WHERE id = $1 AND status = 'awaiting_payment'
 	`, orderID)
 	if err != nil {
-		return nil, fmt.Errorf("update order status failed: %w", err)
+		return false, fmt.Errorf("update order status failed: %w", err)
 	}
 	rowsAffected, err := res.RowsAffected()
 	if err != nil {
-		return nil, fmt.Errorf("rows affected: %w", err)
+		return false, fmt.Errorf("rows affected: %w", err)
 	}
 	if rowsAffected == 0 {
-		return nil, fmt.Errorf("order not found or not in awaiting_payment status")
+		return false, nil
 	}
 
-	if err := tx.Commit(); err != nil {
-		return nil, fmt.Errorf("commit tx: %w", err)
+	if err = insertStatusHistory(ctx, tx, &order.StatusChange{
+		OrderID:    orderID,
+		FromStatus: order.StatusAwaitingPayment,
+		ToStatus:   order.StatusPaid,
+		ActorID:    order.ActorRef(actorID),
+		Reason:     reason,
+	}); err != nil {
+		return false, fmt.Errorf("write status history: %w", err)
 	}
-	return &pi, nil
+	event, _, err := order.NewStatusEvent(orderID, order.StatusAwaitingPayment, order.StatusPaid, reason)
+	if err != nil {
+		return false, fmt.Errorf("build event: %w", err)
+	}
+	if err = insertOutboxEvent(ctx, tx, event); err != nil {
+		return false, fmt.Errorf("write outbox event: %w", err)
+	}
+	return true, nil
+}
+
+// markOrderRefunded переводит заказ в refunded, если переход допустим из текущего статуса;
+// например, отмененный заказ так и остается отмененным.
+func markOrderRefunded(ctx context.Context, tx *sqlx.Tx, orderID, actorID int64) error {
+	var from string
+	if err := tx.GetContext(ctx, &from, `SELECT status FROM orders WHERE id = $1 FOR UPDATE`, orderID); err != nil {
+		return fmt.Errorf("lock order: %w", err)
+	}
+	if from == order.StatusRefunded || !order.IsValidStatusTransition(from, order.StatusRefunded) {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE orders SET status = 'refunded', updated_at = NOW()
+		WHERE id = $1
+	`, orderID); err != nil {
+		return fmt.Errorf("update order status failed: %w", err)
+	}
+	const reason = "payment refunded"
+	if err := insertStatusHistory(ctx, tx, &order.StatusChange{
+		OrderID:    orderID,
+		FromStatus: from,
+		ToStatus:   order.StatusRefunded,
+		ActorID:    order.ActorRef(actorID),
+		Reason:     reason,
+	}); err != nil {
+		return fmt.Errorf("write status history: %w", err)
+	}
+	event, _, err := order.NewStatusEvent(orderID, from, order.StatusRefunded, reason)
+	if err != nil {
+		return fmt.Errorf("build event: %w", err)
+	}
+	if err = insertOutboxEvent(ctx, tx, event); err != nil {
+		return fmt.Errorf("write outbox event: %w", err)
+	}
+	return nil
 }
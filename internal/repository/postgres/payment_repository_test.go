@@ -0,0 +1,244 @@
+package postgres
+
+import (
+	"context"
+	"marketplace/internal/ledger"
+	"marketplace/internal/payment"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func intentRow(status string, refunded int64) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "order_id", "amount", "status", "client_secret", "provider",
+		"provider_intent_id", "next_action_url", "failure_reason", "refunded_amount", "expires_at", "created_at", "updated_at"}).
+		AddRow(9, 5, 1000, status, "s", "fake", "fake_pi_1", nil, nil, refunded, nil, "", "")
+}
+
+func TestPaymentRepository_CreateRefund_ExceedsCaptured(t *testing.T) {
+	xdb, mock, cleanup := newMockDB(t)
+	repo := NewPaymentRepo(xdb)
+
+	mock.ExpectBegin()
+	// 800 из 1000 уже возвращено или в работе: еще 300 вернуть нельзя
+	mock.ExpectQuery(regexp.QuoteMeta(`FOR UPDATE`)).
+		WithArgs(int64(9)).
+		WillReturnRows(intentRow(payment.StatusSucceeded, 800))
+	mock.ExpectQuery(regexp.QuoteMeta(`AND status = 'pending'`)).
+		WithArgs(int64(9), int64(300)).
+		WillReturnRows(sqlmock.NewRows(refundRowColumns))
+	mock.ExpectRollback()
+	mock.ExpectClose()
+
+	_, err := repo.CreateRefund(context.Background(), &payment.Refund{IntentID: 9, OrderID: 5, Amount: 300})
+	assert.ErrorIs(t, err, payment.ErrRefundExceedsAmount)
+
+	cleanup()
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+var refundRowColumns = []string{"id", "payment_intent_id", "order_id", "amount", "currency", "status", "reason",
+	"provider_refund_id", "actor_id", "created_at", "updated_at"}
+
+func TestPaymentRepository_CreateRefund_ReusesPending(t *testing.T) {
+	xdb, mock, cleanup := newMockDB(t)
+	repo := NewPaymentRepo(xdb)
+
+	mock.ExpectBegin()
+	// весь платеж уже зарезервирован возвратом, который ждет провайдера
+	mock.ExpectQuery(regexp.QuoteMeta(`FOR UPDATE`)).
+		WithArgs(int64(9)).
+		WillReturnRows(intentRow(payment.StatusSucceeded, 1000))
+	mock.ExpectQuery(regexp.QuoteMeta(`AND status = 'pending'`)).
+		WithArgs(int64(9), int64(1000)).
+		WillReturnRows(sqlmock.NewRows(refundRowColumns).
+			AddRow(3, 9, 5, 1000, "RUB", payment.RefundPending, nil, nil, 1, "", ""))
+	mock.ExpectRollback()
+	mock.ExpectClose()
+
+	ref, err := repo.CreateRefund(context.Background(), &payment.Refund{IntentID: 9, OrderID: 5, Amount: 1000})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), ref.ID)
+
+	cleanup()
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPaymentRepository_ApplyEvent_Duplicate(t *testing.T) {
+	xdb, mock, cleanup := newMockDB(t)
+	repo := NewPaymentRepo(xdb)
+
+	mock.ExpectBegin()
+	// событие уже записано: намерение и заказ не трогаем
+	mock.ExpectExec(regexp.QuoteMeta(`ON CONFLICT (provider, event_id) DO NOTHING`)).
+		WithArgs("fake", "evt_1", "payment_intent.succeeded", "fake_pi_1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	mock.ExpectClose()
+
+	result, err := repo.ApplyEvent(context.Background(), "fake", &payment.ProviderEvent{
+		ID:     "evt_1",
+		Type:   "payment_intent.succeeded",
+		Intent: payment.GatewayIntent{ProviderID: "fake_pi_1", Status: payment.StatusSucceeded},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, payment.WebhookDuplicate, result)
+
+	cleanup()
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPaymentRepository_ApplyEvent_StaleAfterSuccess(t *testing.T) {
+	xdb, mock, cleanup := newMockDB(t)
+	repo := NewPaymentRepo(xdb)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO payment_provider_events`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`FOR UPDATE OF o`)).
+		WithArgs("fake", "fake_pi_1").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	// отказ по первой попытке пришел после успешной оплаты
+	mock.ExpectQuery(regexp.QuoteMeta(`WHERE provider = $1 AND provider_intent_id = $2`)).
+		WithArgs("fake", "fake_pi_1").
+		WillReturnRows(intentRow(payment.StatusSucceeded, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE payment_provider_events SET result = $3`)).
+		WithArgs("fake", "evt_0", payment.WebhookIgnored).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectClose()
+
+	result, err := repo.ApplyEvent(context.Background(), "fake", &payment.ProviderEvent{
+		ID:     "evt_0",
+		Type:   "payment_intent.payment_failed",
+		Intent: payment.GatewayIntent{ProviderID: "fake_pi_1", Status: payment.StatusFailed},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, payment.WebhookIgnored, result)
+
+	cleanup()
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPaymentRepository_MarkSucceeded_OrderClosed(t *testing.T) {
+	xdb, mock, cleanup := newMockDB(t)
+	repo := NewPaymentRepo(xdb)
+
+	mock.ExpectBegin()
+	// заказ блокируется раньше намерения, в том же порядке, что при отмене заказа
+	mock.ExpectQuery(regexp.QuoteMeta(`FOR UPDATE OF o`)).
+		WithArgs(int64(9)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	mock.ExpectQuery(regexp.QuoteMeta(`SET status = 'succeeded', next_action_url = NULL`)).
+		WithArgs(int64(9)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "order_id", "amount", "currency", "status", "provider"}).
+			AddRow(9, 5, 1000, "RUB", payment.StatusSucceeded, "fake"))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT o.subtotal_amount, o.tax_amount`)).
+		WithArgs(int64(5), payment.WalletProvider).
+		WillReturnRows(sqlmock.NewRows([]string{"subtotal_amount", "tax_amount", "credit"}).AddRow(1000, 0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO ledger_journals`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO ledger_entries`)).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	// о списании узнают подписчики webhook, даже если заказ уже закрыт
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO outbox_events`)).
+		WithArgs(payment.AggregatePayment, int64(9), payment.EventPaymentSucceeded, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	// заказ отменили, пока провайдер проводил платеж
+	mock.ExpectExec(regexp.QuoteMeta(`WHERE id = $1 AND status = 'awaiting_payment'`)).
+		WithArgs(int64(5)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO payment_compensations`)).
+		WithArgs(int64(5), int64(9), int64(1000)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	// проводка оплаты сторнируется: долг продавцу не должен висеть за отмененный заказ
+	mock.ExpectQuery(regexp.QuoteMeta(`AS seller`)).
+		WithArgs(int64(5), ledger.AccountSellerPayable, ledger.AccountTaxPayable, ledger.AccountPlatformRevenue, ledger.AccountStoreCredit).
+		WillReturnRows(sqlmock.NewRows([]string{"currency", "seller", "tax", "revenue", "credit"}).AddRow("RUB", 1000, 0, 0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO ledger_journals`)).
+		WithArgs(ledger.KindPaymentReversed, "payment_intent:9", "RUB", int64(5), nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO ledger_entries`)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+	mock.ExpectClose()
+
+	pi, err := repo.MarkSucceeded(context.Background(), 9, 0)
+	assert.ErrorIs(t, err, payment.ErrOrphanCapture)
+	require.NotNil(t, pi)
+	assert.Equal(t, payment.StatusSucceeded, pi.Status)
+
+	cleanup()
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPaymentRepository_MarkSucceeded_NotActive(t *testing.T) {
+	xdb, mock, cleanup := newMockDB(t)
+	repo := NewPaymentRepo(xdb)
+
+	mock.ExpectBegin()
+	// заказ блокируется раньше намерения, в том же порядке, что при отмене заказа
+	mock.ExpectQuery(regexp.QuoteMeta(`FOR UPDATE OF o`)).
+		WithArgs(int64(9)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	mock.ExpectQuery(regexp.QuoteMeta(`SET status = 'succeeded', next_action_url = NULL`)).
+		WithArgs(int64(9)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectRollback()
+	mock.ExpectClose()
+
+	_, err := repo.MarkSucceeded(context.Background(), 9, 0)
+	assert.ErrorIs(t, err, payment.ErrIntentNotFound)
+
+	cleanup()
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPaymentRepository_GetActiveIntent_ExpiredByDBClock(t *testing.T) {
+	xdb, mock, cleanup := newMockDB(t)
+	repo := NewPaymentRepo(xdb)
+
+	// срок сравнивается с NOW() базы, как в ListExpiredIntents, а не с часами приложения
+	mock.ExpectQuery(regexp.QuoteMeta(`NOT COALESCE(expires_at > NOW(), true) AS expired`)).
+		WithArgs(int64(5)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "order_id", "status", "expired"}).
+			AddRow(9, 5, payment.StatusRequiresConfirmation, true))
+	mock.ExpectClose()
+
+	pi, err := repo.GetActiveIntent(context.Background(), 5)
+	require.NoError(t, err)
+	assert.True(t, pi.Expired)
+
+	cleanup()
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPaymentRepository_FinishRefund_AlreadyFinished(t *testing.T) {
+	xdb, mock, cleanup := newMockDB(t)
+	repo := NewPaymentRepo(xdb)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`FOR UPDATE OF o`)).
+		WithArgs(int64(3)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	// сверка успела закрыть возврат, пока уведомление ждало блокировку
+	mock.ExpectQuery(regexp.QuoteMeta(`WHERE id = $1 AND status = 'pending'`)).
+		WithArgs(int64(3), payment.RefundSucceeded, "re_1").
+		WillReturnRows(sqlmock.NewRows(refundRowColumns))
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM refunds WHERE id = $1`)).
+		WithArgs(int64(3)).
+		WillReturnRows(sqlmock.NewRows(refundRowColumns).
+			AddRow(3, 9, 5, 1000, "RUB", payment.RefundSucceeded, nil, "re_1", 1, "", ""))
+	mock.ExpectRollback()
+	mock.ExpectClose()
+
+	ref, err := repo.FinishRefund(context.Background(), 3, &payment.GatewayRefund{Status: payment.RefundSucceeded, ProviderID: "re_1"}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, payment.RefundSucceeded, ref.Status)
+
+	cleanup()
+	require.NoError(t, mock.ExpectationsWereMet())
+}
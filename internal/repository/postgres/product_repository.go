@@ -20,8 +20,8 @@ func NewProductRepository(db *sqlx.DB) *ProductRepo {
 
 func (r *ProductRepo) Create(ctx context.Context, p *product.Product) (int64, error) {
 	query := `
-INSERT INTO products (name, description, price, stock, category_id, created_at, updated_at)
-VALUES (:name, :description, :price, :stock, :category_id, NOW(), NOW())
+INSERT INTO products (name, description, price, currency, stock, weight_grams, price_includes_tax, category_id, created_at, updated_at)
+VALUES (:name, :description, :price, :currency, :stock, :weight_grams, :price_includes_tax, :category_id, NOW(), NOW())
 RETURNING id
 `
 
@@ -46,7 +46,7 @@ RETURNING id
 
 func (r *ProductRepo) GetByID(ctx context.Context, id int64) (*product.Product, error) {
 	query := `
-SELECT id, name, description, price, stock, category_id, created_at, updated_at
+SELECT id, name, description, price, currency, stock, weight_grams, price_includes_tax, category_id, created_at, updated_at
 FROM products
 WHERE id = :id
 `
@@ -73,7 +73,7 @@ WHERE id = :id
 
 func (r *ProductRepo) List(ctx context.Context, offset, limit int, filter string) ([]*product.Product, error) {
 	query := `
-SELECT id, name, description, price, stock, category_id, created_at, updated_at
+SELECT id, name, description, price, currency, stock, weight_grams, price_includes_tax, category_id, created_at, updated_at
 FROM products
 WHERE name ILIKE '%' || :filter || '%'
 ORDER BY name
@@ -108,7 +108,7 @@ OFFSET :offset LIMIT :limit
 func (r *ProductRepo) Update(ctx context.Context, p *product.Product) error {
 	query := `
 UPDATE products
-SET name = :name, description = :description, price = :price, stock = :stock, category_id = :category_id, updated_at = NOW()
+SET name = :name, description = :description, price = :price, currency = :currency, stock = :stock, weight_grams = :weight_grams, price_includes_tax = :price_includes_tax, category_id = :category_id, updated_at = NOW()
 WHERE id = :id
 `
 
@@ -134,8 +134,8 @@ WHERE id = :id
 
 func (r *ProductRepo) CreateCategory(ctx context.Context, c *product.Category) (int64, error) {
 	query := `
-INSERT INTO categories (name)
-VALUES (:name)
+INSERT INTO categories (name, vat_rate)
+VALUES (:name, :vat_rate)
 RETURNING id
 `
 	rows, err := r.db.NamedQueryContext(ctx, query, c)
@@ -158,7 +158,7 @@ RETURNING id
 
 func (r *ProductRepo) GetCategory(ctx context.Context, id int64) (*product.Category, error) {
 	query := `
-SELECT id, name
+SELECT id, name, vat_rate
 FROM categories
 WHERE id = :id
 `
@@ -183,7 +183,7 @@ WHERE id = :id
 
 func (r *ProductRepo) ListCategories(ctx context.Context, offset, limit int, filter string) ([]*product.Category, error) {
 	query := `
-SELECT id, name
+SELECT id, name, vat_rate
 FROM categories
 WHERE name ILIKE '%' || :filter || '%'
 ORDER BY name
@@ -221,7 +221,7 @@ OFFSET :offset LIMIT :limit
 func (r *ProductRepo) UpdateCategory(ctx context.Context, c *product.Category) error {
 	query := `
 UPDATE categories
-SET name = :name
+SET name = :name, vat_rate = :vat_rate
 WHERE id = :id
 `
 	_, err := r.db.NamedExecContext(ctx, query, c)
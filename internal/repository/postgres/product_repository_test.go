@@ -38,7 +38,7 @@ func TestProductRepository_List(t *testing.T) {
 		1, "iphone", "Description 1", int64(10000), 10, int64(2), time.Now(), time.Now(),
 	)
 	rawQuery := `
-SELECT id, name, description, price, stock, category_id, created_at, updated_at
+SELECT id, name, description, price, currency, stock, weight_grams, price_includes_tax, category_id, created_at, updated_at
 FROM products
 WHERE name ILIKE '%' || $1 || '%'
 ORDER BY name
@@ -80,11 +80,11 @@ func TestProductRepository_Create(t *testing.T) {
 	}
 
 	mock.ExpectQuery(regexp.QuoteMeta(`
-INSERT INTO products (name, description, price, stock, category_id, created_at, updated_at)
-VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
+INSERT INTO products (name, description, price, currency, stock, weight_grams, price_includes_tax, category_id, created_at, updated_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW(), NOW())
 RETURNING id
 `)).
-		WithArgs(p.Name, p.Description, p.Price, p.Stock, p.CategoryID).
+		WithArgs(p.Name, p.Description, p.Price, p.Currency, p.Stock, p.WeightGrams, p.PriceIncludesTax, p.CategoryID).
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(42))
 
 	mock.ExpectClose()
@@ -119,7 +119,7 @@ func TestProductRepository_GetByID(t *testing.T) {
 			expected.CategoryID, expected.CreatedAt, expected.UpdatedAt)
 
 	mock.ExpectQuery(regexp.QuoteMeta(`
-SELECT id, name, description, price, stock, category_id, created_at, updated_at
+SELECT id, name, description, price, currency, stock, weight_grams, price_includes_tax, category_id, created_at, updated_at
 FROM products
 WHERE id = $1
 `)).
@@ -160,10 +160,10 @@ func TestProductRepository_Update(t *testing.T) {
 
 	mock.ExpectExec(regexp.QuoteMeta(`
 UPDATE products
-SET name = $1, description = $2, price = $3, stock = $4, category_id = $5, updated_at = NOW()
-WHERE id = $6
+SET name = $1, description = $2, price = $3, currency = $4, stock = $5, weight_grams = $6, price_includes_tax = $7, category_id = $8, updated_at = NOW()
+WHERE id = $9
 `)).
-		WithArgs(p.Name, p.Description, p.Price, p.Stock, p.CategoryID, p.ID).
+		WithArgs(p.Name, p.Description, p.Price, p.Currency, p.Stock, p.WeightGrams, p.PriceIncludesTax, p.CategoryID, p.ID).
 		WillReturnResult(sqlmock.NewResult(0, 1)) // Last insert ID is not used in UPDATE
 
 	mock.ExpectClose()
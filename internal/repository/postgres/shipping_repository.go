@@ -0,0 +1,164 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"marketplace/internal/shipping"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type ShippingRepo struct {
+	db *sqlx.DB
+}
+
+func NewShippingRepo(db *sqlx.DB) *ShippingRepo {
+	return &ShippingRepo{db: db}
+}
+
+func (r *ShippingRepo) ListZones(ctx context.Context) ([]shipping.Zone, error) {
+	zones := []shipping.Zone{}
+	err := r.db.SelectContext(ctx, &zones, `SELECT code, name, countries FROM shipping_zones ORDER BY code`)
+	return zones, err
+}
+
+func (r *ShippingRepo) UpsertZone(ctx context.Context, z *shipping.Zone) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO shipping_zones (code, name, countries)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (code) DO UPDATE SET name = EXCLUDED.name, countries = EXCLUDED.countries
+	`, z.Code, z.Name, z.Countries)
+	return err
+}
+
+func (r *ShippingRepo) DeleteZone(ctx context.Context, code string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM shipping_zones WHERE code = $1`, code)
+	return affectedOr(res, err, shipping.ErrZoneNotFound)
+}
+
+func insertRates(ctx context.Context, tx *sqlx.Tx, methodID int64, rates []shipping.Rate) error {
+	for _, rate := range rates {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO shipping_rates (method_id, zone_code, max_weight_grams, price)
+			VALUES ($1, $2, $3, $4)
+		`, methodID, rate.ZoneCode, rate.MaxWeightGrams, rate.Price); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *ShippingRepo) CreateMethod(ctx context.Context, m *shipping.Method) (int64, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRowxContext(ctx, `
+		INSERT INTO shipping_methods (name, active, free_threshold)
+		VALUES ($1, $2, $3)
+		RETURNING id
+	`, m.Name, m.Active, m.FreeThreshold).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	if err = insertRates(ctx, tx, id, m.Rates); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// loadRates заполняет тарифные сетки методов одним запросом.
+func (r *ShippingRepo) loadRates(ctx context.Context, methods []*shipping.Method) error {
+	if len(methods) == 0 {
+		return nil
+	}
+	byID := make(map[int64]*shipping.Method, len(methods))
+	ids := make([]int64, 0, len(methods))
+	for _, m := range methods {
+		m.Rates = []shipping.Rate{}
+		byID[m.ID] = m
+		ids = append(ids, m.ID)
+	}
+	query, args, err := sqlx.In(`
+		SELECT id, method_id, zone_code, max_weight_grams, price
+		FROM shipping_rates
+		WHERE method_id IN (?)
+		ORDER BY method_id, zone_code, max_weight_grams
+	`, ids)
+	if err != nil {
+		return err
+	}
+	var rates []shipping.Rate
+	if err = r.db.SelectContext(ctx, &rates, r.db.Rebind(query), args...); err != nil {
+		return err
+	}
+	for _, rate := range rates {
+		byID[rate.MethodID].Rates = append(byID[rate.MethodID].Rates, rate)
+	}
+	return nil
+}
+
+func (r *ShippingRepo) GetMethod(ctx context.Context, id int64) (*shipping.Method, error) {
+	var m shipping.Method
+	err := r.db.GetContext(ctx, &m, `
+		SELECT id, name, active, free_threshold, created_at, updated_at
+		FROM shipping_methods
+		WHERE id = $1
+	`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, shipping.ErrMethodNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = r.loadRates(ctx, []*shipping.Method{&m}); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (r *ShippingRepo) ListMethods(ctx context.Context) ([]*shipping.Method, error) {
+	methods := []*shipping.Method{}
+	err := r.db.SelectContext(ctx, &methods, `
+		SELECT id, name, active, free_threshold, created_at, updated_at
+		FROM shipping_methods
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	return methods, r.loadRates(ctx, methods)
+}
+
+func (r *ShippingRepo) UpdateMethod(ctx context.Context, m *shipping.Method) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE shipping_methods
+		SET name = $2, active = $3, free_threshold = $4, updated_at = NOW()
+		WHERE id = $1
+	`, m.ID, m.Name, m.Active, m.FreeThreshold)
+	if err = affectedOr(res, err, shipping.ErrMethodNotFound); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM shipping_rates WHERE method_id = $1`, m.ID); err != nil {
+		return err
+	}
+	if err = insertRates(ctx, tx, m.ID, m.Rates); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *ShippingRepo) DeleteMethod(ctx context.Context, id int64) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM shipping_methods WHERE id = $1`, id)
+	return affectedOr(res, err, shipping.ErrMethodNotFound)
+}
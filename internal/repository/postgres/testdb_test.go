@@ -0,0 +1,36 @@
+package postgres
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pressly/goose/v3"
+	"github.com/stretchr/testify/require"
+)
+
+// openTestDB подключается к настоящей базе из TEST_DATABASE_URL и накатывает миграции.
+// Без переменной тест пропускается: в обычном прогоне есть только sqlmock.
+func openTestDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := sqlx.Connect("postgres", dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	require.NoError(t, goose.SetDialect("postgres"))
+	require.NoError(t, goose.Up(db.DB, "../../../migrations"))
+	return db
+}
+
+// createTestUser заводит покупателя с уникальным именем name.
+func createTestUser(t *testing.T, db *sqlx.DB, name string) int64 {
+	t.Helper()
+	var id int64
+	require.NoError(t, db.GetContext(context.Background(), &id,
+		`INSERT INTO users (username, email, password_hash) VALUES ($1, $1 || '@example.com', 'x') RETURNING id`, name))
+	return id
+}
@@ -0,0 +1,132 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"marketplace/internal/order"
+	"marketplace/internal/payment"
+	"marketplace/internal/wallet"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newWalletOrder создает заказ покупателя в статусе new на total.
+func newWalletOrder(t *testing.T, db *sqlx.DB, userID, total int64) *order.Order {
+	t.Helper()
+	o := &order.Order{UserID: userID, Status: order.StatusNew, Currency: "RUB", SubtotalAmount: total, TotalAmount: total}
+	require.NoError(t, db.GetContext(context.Background(), &o.ID, `
+		INSERT INTO orders (user_id, status, currency, subtotal_amount, total_amount)
+		VALUES ($1, 'new', $2, $3, $3)
+		RETURNING id
+	`, userID, o.Currency, total))
+	return o
+}
+
+// TestWallet_ConcurrentOrderPaymentsNeverOverdraw оплачивает из одного кошелька
+// несколько заказов одновременно: часть целиком, часть вместе с картой.
+func TestWallet_ConcurrentOrderPaymentsNeverOverdraw(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	const (
+		orders = 12
+		credit = 1000
+	)
+	userID := createTestUser(t, db, fmt.Sprintf("wallet-%d", time.Now().UnixNano()))
+	_, err := wallet.NewService(NewWalletRepo(db)).Credit(ctx, 0, userID, wallet.Adjustment{Amount: credit, Reason: "test"})
+	require.NoError(t, err)
+
+	repo := NewPaymentRepo(db)
+	pending := make([]*order.Order, orders)
+	spends := make([]int64, orders)
+	for i := range pending {
+		pending[i] = newWalletOrder(t, db, userID, 400)
+		// четные заказы оплачиваются из кошелька целиком, нечетные — 300 бонусами и 100 картой
+		spends[i] = 400
+		if i%2 == 1 {
+			spends[i] = 300
+		}
+	}
+
+	start := make(chan struct{})
+	errs := make([]error, orders)
+	var wg sync.WaitGroup
+	for i, o := range pending {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			if i%2 == 0 {
+				_, errs[i] = repo.PayWithWallet(ctx, o, userID)
+				return
+			}
+			gi := &payment.GatewayIntent{
+				ProviderID:   fmt.Sprintf("test_pi_%d", o.ID),
+				Status:       payment.StatusRequiresConfirmation,
+				ClientSecret: "secret",
+			}
+			_, errs[i] = repo.CreateIntent(ctx, o, spends[i], "fake", gi, time.Now().Add(time.Hour), userID)
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	var balance, history, spent int64
+	require.NoError(t, db.GetContext(ctx, &balance, `SELECT balance FROM wallets WHERE user_id = $1`, userID))
+	require.NoError(t, db.GetContext(ctx, &history, `SELECT SUM(amount) FROM wallet_transactions WHERE user_id = $1`, userID))
+	assert.Equal(t, balance, history)
+
+	for i, err := range errs {
+		var status string
+		require.NoError(t, db.GetContext(ctx, &status, `SELECT status FROM orders WHERE id = $1`, pending[i].ID))
+		if err == nil {
+			spent += spends[i]
+			continue
+		}
+		assert.True(t, errors.Is(err, wallet.ErrInsufficientFunds), "unexpected error: %v", err)
+		// остаток только уменьшался: раз списание не прошло тогда, не прошло бы и сейчас
+		assert.Less(t, balance, spends[i])
+		assert.Equal(t, order.StatusNew, status, "failed payment must leave order %d untouched", pending[i].ID)
+	}
+	assert.Equal(t, int64(credit)-spent, balance)
+}
+
+// TestWallet_CancelPaidOrderReturnsCredit отменяет заказ, оплаченный из кошелька,
+// и проверяет, что бонусы вернулись покупателю, а проводки по заказу сторнированы.
+func TestWallet_CancelPaidOrderReturnsCredit(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	userID := createTestUser(t, db, fmt.Sprintf("wallet-cancel-%d", time.Now().UnixNano()))
+	_, err := wallet.NewService(NewWalletRepo(db)).Credit(ctx, 0, userID, wallet.Adjustment{Amount: 1000, Reason: "test"})
+	require.NoError(t, err)
+
+	o := newWalletOrder(t, db, userID, 600)
+	_, err = NewPaymentRepo(db).PayWithWallet(ctx, o, userID)
+	require.NoError(t, err)
+
+	require.NoError(t, order.NewService(NewOrderRepo(db)).Cancel(ctx, o.ID, 0, "out of stock"))
+
+	var balance, compensations int64
+	require.NoError(t, db.GetContext(ctx, &balance, `SELECT balance FROM wallets WHERE user_id = $1`, userID))
+	require.NoError(t, db.GetContext(ctx, &compensations, `SELECT COUNT(*) FROM payment_compensations WHERE order_id = $1`, o.ID))
+	assert.Equal(t, int64(1000), balance)
+	// деньги уже на кошельке: компенсировать по оплате из кошелька нечего
+	assert.Zero(t, compensations)
+
+	// оплата и ее сторно по заказу в сумме дают ноль на каждом счете
+	var nonZero []string
+	require.NoError(t, db.SelectContext(ctx, &nonZero, `
+		SELECT e.account
+		FROM ledger_entries e
+		JOIN ledger_journals j ON j.id = e.journal_id
+		WHERE j.order_id = $1
+		GROUP BY e.account
+		HAVING SUM(e.amount) <> 0
+	`, o.ID))
+	assert.Empty(t, nonZero)
+}
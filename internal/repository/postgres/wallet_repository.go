@@ -0,0 +1,116 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"marketplace/internal/ledger"
+	"marketplace/internal/wallet"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type WalletRepo struct {
+	db *sqlx.DB
+}
+
+func NewWalletRepo(db *sqlx.DB) *WalletRepo {
+	return &WalletRepo{db: db}
+}
+
+const walletTxColumns = `id, user_id, currency, amount, balance_after, kind, order_id, payment_intent_id,
+	refund_id, actor_id, reason, created_at`
+
+func (r *WalletRepo) Balances(ctx context.Context, userID int64) ([]wallet.Wallet, error) {
+	wallets := []wallet.Wallet{}
+	err := r.db.SelectContext(ctx, &wallets, `
+		SELECT user_id, currency, balance, updated_at
+		FROM wallets
+		WHERE user_id = $1
+		ORDER BY currency
+	`, userID)
+	return wallets, err
+}
+
+func (r *WalletRepo) ListTransactions(ctx context.Context, userID int64, f wallet.TransactionFilter) ([]wallet.Transaction, error) {
+	txs := []wallet.Transaction{}
+	err := r.db.SelectContext(ctx, &txs, `
+		SELECT `+walletTxColumns+`
+		FROM wallet_transactions
+		WHERE user_id = $1 AND ($2 = '' OR currency = $2)
+		ORDER BY id DESC
+		OFFSET $3 LIMIT $4
+	`, userID, f.Currency, f.Offset, f.Limit)
+	return txs, err
+}
+
+func (r *WalletRepo) Adjust(ctx context.Context, t *wallet.Transaction) (*wallet.Transaction, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	out, err := applyWalletTx(ctx, tx, t)
+	if err != nil {
+		return nil, err
+	}
+	var memo string
+	if out.Reason != nil {
+		memo = *out.Reason
+	}
+	j := ledger.WalletCredited(out.Currency, out.ID, out.Amount, memo)
+	if out.Amount < 0 {
+		j = ledger.WalletDebited(out.Currency, out.ID, -out.Amount, memo)
+	}
+	if _, err = insertJournal(ctx, tx, j); err != nil {
+		return nil, fmt.Errorf("post wallet adjustment to ledger: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit tx: %w", err)
+	}
+	return out, nil
+}
+
+// applyWalletTx меняет остаток кошелька и записывает операцию в транзакции вызывающего.
+// Списание — условный UPDATE: строка кошелька блокируется, параллельное списание ждет
+// и перепроверяет условие на новом остатке, поэтому баланс не уходит в минус.
+func applyWalletTx(ctx context.Context, ex sqlx.ExtContext, t *wallet.Transaction) (*wallet.Transaction, error) {
+	var (
+		balance int64
+		err     error
+	)
+	if t.Amount > 0 {
+		err = sqlx.GetContext(ctx, ex, &balance, `
+			INSERT INTO wallets (user_id, currency, balance)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (user_id, currency)
+			DO UPDATE SET balance = wallets.balance + EXCLUDED.balance, updated_at = NOW()
+			RETURNING balance
+		`, t.UserID, t.Currency, t.Amount)
+	} else {
+		err = sqlx.GetContext(ctx, ex, &balance, `
+			UPDATE wallets SET balance = balance + $3, updated_at = NOW()
+			WHERE user_id = $1 AND currency = $2 AND balance + $3 >= 0
+			RETURNING balance
+		`, t.UserID, t.Currency, t.Amount)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %d %s", wallet.ErrInsufficientFunds, -t.Amount, t.Currency)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("update wallet balance: %w", err)
+	}
+
+	var out wallet.Transaction
+	if err = sqlx.GetContext(ctx, ex, &out, `
+		INSERT INTO wallet_transactions (user_id, currency, amount, balance_after, kind, order_id, payment_intent_id, refund_id, actor_id, reason)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING `+walletTxColumns+`
+	`, t.UserID, t.Currency, t.Amount, balance, t.Kind, t.OrderID, t.PaymentIntentID, t.RefundID, t.ActorID, t.Reason); err != nil {
+		return nil, fmt.Errorf("insert wallet transaction: %w", err)
+	}
+	return &out, nil
+}
@@ -0,0 +1,66 @@
+package postgres
+
+import (
+	"context"
+	"marketplace/internal/ledger"
+	"marketplace/internal/wallet"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var walletTxRow = []string{"id", "user_id", "currency", "amount", "balance_after", "kind", "order_id",
+	"payment_intent_id", "refund_id", "actor_id", "reason", "created_at"}
+
+func TestWalletRepository_Adjust_DebitOverBalance(t *testing.T) {
+	xdb, mock, cleanup := newMockDB(t)
+	repo := NewWalletRepo(xdb)
+
+	mock.ExpectBegin()
+	// условие на остаток не выполнилось: строка не обновлена, операция не пишется
+	mock.ExpectQuery(regexp.QuoteMeta(`WHERE user_id = $1 AND currency = $2 AND balance + $3 >= 0`)).
+		WithArgs(int64(7), "RUB", int64(-500)).
+		WillReturnRows(sqlmock.NewRows([]string{"balance"}))
+	mock.ExpectRollback()
+	mock.ExpectClose()
+
+	_, err := repo.Adjust(context.Background(), &wallet.Transaction{UserID: 7, Currency: "RUB", Amount: -500, Kind: wallet.KindDebit})
+	assert.ErrorIs(t, err, wallet.ErrInsufficientFunds)
+
+	cleanup()
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWalletRepository_Adjust_CreditPostsLedger(t *testing.T) {
+	xdb, mock, cleanup := newMockDB(t)
+	repo := NewWalletRepo(xdb)
+	reason := "late delivery"
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`ON CONFLICT (user_id, currency)`)).
+		WithArgs(int64(7), "RUB", int64(300)).
+		WillReturnRows(sqlmock.NewRows([]string{"balance"}).AddRow(800))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO wallet_transactions`)).
+		WithArgs(int64(7), "RUB", int64(300), int64(800), wallet.KindCredit, nil, nil, nil, nil, &reason).
+		WillReturnRows(sqlmock.NewRows(walletTxRow).AddRow(12, 7, "RUB", 300, 800, wallet.KindCredit, nil, nil, nil, nil, reason, now))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO ledger_journals`)).
+		WithArgs(ledger.KindWalletCredited, "wallet_transaction:12", "RUB", nil, &reason).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "kind", "reference", "currency", "order_id", "memo", "created_at"}).
+			AddRow(40, ledger.KindWalletCredited, "wallet_transaction:12", "RUB", nil, reason, now))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO ledger_entries`)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+	mock.ExpectClose()
+
+	out, err := repo.Adjust(context.Background(), &wallet.Transaction{UserID: 7, Currency: "RUB", Amount: 300, Kind: wallet.KindCredit, Reason: &reason})
+	require.NoError(t, err)
+	assert.Equal(t, int64(800), out.BalanceAfter)
+
+	cleanup()
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,203 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"marketplace/internal/webhook"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type WebhookRepo struct {
+	db *sqlx.DB
+}
+
+func NewWebhookRepo(db *sqlx.DB) *WebhookRepo {
+	return &WebhookRepo{db: db}
+}
+
+func (r *WebhookRepo) CreateEndpoint(ctx context.Context, e *webhook.Endpoint) (int64, error) {
+	var id int64
+	err := r.db.QueryRowxContext(ctx, `
+		INSERT INTO webhook_endpoints (url, event_types, secret, active)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, e.URL, e.EventTypes, e.Secret, e.Active).Scan(&id)
+	return id, err
+}
+
+func (r *WebhookRepo) GetEndpoint(ctx context.Context, id int64) (*webhook.Endpoint, error) {
+	var e webhook.Endpoint
+	err := r.db.GetContext(ctx, &e, `
+		SELECT id, url, event_types, secret, active, created_at, updated_at
+		FROM webhook_endpoints
+		WHERE id = $1
+	`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, webhook.ErrEndpointNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (r *WebhookRepo) ListEndpoints(ctx context.Context) ([]*webhook.Endpoint, error) {
+	endpoints := []*webhook.Endpoint{}
+	err := r.db.SelectContext(ctx, &endpoints, `
+		SELECT id, url, event_types, secret, active, created_at, updated_at
+		FROM webhook_endpoints
+		ORDER BY id
+	`)
+	return endpoints, err
+}
+
+func (r *WebhookRepo) ListActiveEndpoints(ctx context.Context) ([]*webhook.Endpoint, error) {
+	var endpoints []*webhook.Endpoint
+	err := r.db.SelectContext(ctx, &endpoints, `
+		SELECT id, url, event_types, secret, active, created_at, updated_at
+		FROM webhook_endpoints
+		WHERE active
+	`)
+	return endpoints, err
+}
+
+func (r *WebhookRepo) UpdateEndpoint(ctx context.Context, e *webhook.Endpoint) error {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE webhook_endpoints
+		SET url = $2, event_types = $3, secret = COALESCE(NULLIF($4, ''), secret), active = $5, updated_at = NOW()
+		WHERE id = $1
+	`, e.ID, e.URL, e.EventTypes, e.Secret, e.Active)
+	return affectedOr(res, err, webhook.ErrEndpointNotFound)
+}
+
+func (r *WebhookRepo) DeleteEndpoint(ctx context.Context, id int64) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM webhook_endpoints WHERE id = $1`, id)
+	return affectedOr(res, err, webhook.ErrEndpointNotFound)
+}
+
+func (r *WebhookRepo) EnqueueDelivery(ctx context.Context, d *webhook.Delivery) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO webhook_deliveries (endpoint_id, event_id, event_type, payload)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (endpoint_id, event_id) DO NOTHING
+	`, d.EndpointID, d.EventID, d.EventType, []byte(d.Payload))
+	return err
+}
+
+// ClaimDueDeliveries берет в работу доставки активных endpoint'ов. Доставки выключенного
+// endpoint'а остаются в очереди и уйдут, когда его включат снова.
+func (r *WebhookRepo) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]webhook.DeliveryTarget, error) {
+	var targets []webhook.DeliveryTarget
+	err := r.db.SelectContext(ctx, &targets, `
+		WITH claimed AS (
+			UPDATE webhook_deliveries
+			SET next_attempt_at = NOW() + make_interval(secs => $2)
+			WHERE id IN (
+				SELECT d.id
+				FROM webhook_deliveries d
+				JOIN webhook_endpoints e ON e.id = d.endpoint_id
+				WHERE d.status = 'pending' AND d.next_attempt_at <= NOW() AND e.active
+				ORDER BY d.id
+				LIMIT $1
+				FOR UPDATE OF d SKIP LOCKED
+			)
+			RETURNING *
+		)
+		SELECT c.id, c.endpoint_id, c.event_id, c.event_type, c.payload, c.status, c.attempts,
+			c.next_attempt_at, c.created_at, c.delivered_at, e.url, e.secret
+		FROM claimed c
+		JOIN webhook_endpoints e ON e.id = c.endpoint_id
+		ORDER BY c.id
+	`, limit, lease.Seconds())
+	return targets, err
+}
+
+func (r *WebhookRepo) RecordAttempt(ctx context.Context, a *webhook.Attempt, status string, nextAttemptAt time.Time) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, `
+		INSERT INTO webhook_delivery_attempts (delivery_id, response_code, error, duration_ms)
+		VALUES ($1, $2, $3, $4)
+	`, a.DeliveryID, a.ResponseCode, a.Error, a.DurationMS); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = $2,
+			attempts = attempts + 1,
+			next_attempt_at = $3,
+			delivered_at = CASE WHEN $2 = 'succeeded' THEN NOW() ELSE delivered_at END
+		WHERE id = $1
+	`, a.DeliveryID, status, nextAttemptAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *WebhookRepo) ListDeliveries(ctx context.Context, endpointID int64, offset, limit int) ([]*webhook.Delivery, error) {
+	deliveries := []*webhook.Delivery{}
+	err := r.db.SelectContext(ctx, &deliveries, `
+		SELECT id, endpoint_id, event_id, event_type, payload, status, attempts, next_attempt_at, created_at, delivered_at
+		FROM webhook_deliveries
+		WHERE endpoint_id = $1
+		ORDER BY id DESC
+		OFFSET $2 LIMIT $3
+	`, endpointID, offset, limit)
+	return deliveries, err
+}
+
+func (r *WebhookRepo) GetDelivery(ctx context.Context, endpointID, deliveryID int64) (*webhook.Delivery, error) {
+	var d webhook.Delivery
+	err := r.db.GetContext(ctx, &d, `
+		SELECT id, endpoint_id, event_id, event_type, payload, status, attempts, next_attempt_at, created_at, delivered_at
+		FROM webhook_deliveries
+		WHERE id = $1 AND endpoint_id = $2
+	`, deliveryID, endpointID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, webhook.ErrDeliveryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = r.db.SelectContext(ctx, &d.Log, `
+		SELECT id, delivery_id, response_code, error, duration_ms, created_at
+		FROM webhook_delivery_attempts
+		WHERE delivery_id = $1
+		ORDER BY id
+	`, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (r *WebhookRepo) ResetDelivery(ctx context.Context, endpointID, deliveryID int64) error {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = 'pending', attempts = 0, next_attempt_at = NOW()
+		WHERE id = $1 AND endpoint_id = $2
+	`, deliveryID, endpointID)
+	return affectedOr(res, err, webhook.ErrDeliveryNotFound)
+}
+
+// affectedOr возвращает notFound, если запрос не затронул ни одной строки.
+func affectedOr(res sql.Result, err error, notFound error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return notFound
+	}
+	return nil
+}
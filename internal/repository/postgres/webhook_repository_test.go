@@ -0,0 +1,31 @@
+package postgres
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookRepository_ClaimDueDeliveries_ActiveEndpointsOnly(t *testing.T) {
+	xdb, mock, cleanup := newMockDB(t)
+	repo := NewWebhookRepo(xdb)
+
+	// выключенный endpoint не получает доставок, даже поставленных до выключения
+	mock.ExpectQuery(regexp.QuoteMeta(`WHERE d.status = 'pending' AND d.next_attempt_at <= NOW() AND e.active`)).
+		WithArgs(10, float64(30)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "endpoint_id", "event_id", "event_type", "payload", "status",
+			"attempts", "next_attempt_at", "created_at", "delivered_at", "url", "secret"}))
+	mock.ExpectClose()
+
+	targets, err := repo.ClaimDueDeliveries(context.Background(), 10, 30*time.Second)
+	require.NoError(t, err)
+	assert.Empty(t, targets)
+
+	cleanup()
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,59 @@
+package shipping
+
+import "sort"
+
+// zoneFor возвращает код зоны, в которую входит страна.
+func zoneFor(zones []Zone, country string) (string, bool) {
+	for _, z := range zones {
+		for _, c := range z.Countries {
+			if c == country {
+				return z.Code, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Calculate считает цену доставки методом m в зону zoneCode.
+// Выбирается самый легкий тариф, вмещающий weightGrams.
+// ok=false, если метод не возит в зону или посылка слишком тяжелая.
+func Calculate(m *Method, zoneCode string, weightGrams int, subtotal int64) (Option, bool) {
+	var best *Rate
+	for i := range m.Rates {
+		r := &m.Rates[i]
+		if r.ZoneCode != zoneCode || r.MaxWeightGrams < weightGrams {
+			continue
+		}
+		if best == nil || r.MaxWeightGrams < best.MaxWeightGrams {
+			best = r
+		}
+	}
+	if best == nil {
+		return Option{}, false
+	}
+	opt := Option{MethodID: m.ID, Name: m.Name, Price: best.Price}
+	if m.FreeThreshold != nil && subtotal >= *m.FreeThreshold {
+		opt.Price = 0
+		opt.Free = true
+	}
+	return opt, true
+}
+
+// Options возвращает доступные активные методы, отсортированные по цене.
+func Options(methods []*Method, zones []Zone, country string, weightGrams int, subtotal int64) []Option {
+	opts := []Option{}
+	zoneCode, ok := zoneFor(zones, country)
+	if !ok {
+		return opts
+	}
+	for _, m := range methods {
+		if !m.Active {
+			continue
+		}
+		if opt, ok := Calculate(m, zoneCode, weightGrams, subtotal); ok {
+			opts = append(opts, opt)
+		}
+	}
+	sort.SliceStable(opts, func(i, j int) bool { return opts[i].Price < opts[j].Price })
+	return opts
+}
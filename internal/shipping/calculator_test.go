@@ -0,0 +1,73 @@
+package shipping
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testMethods() ([]*Method, []Zone) {
+	threshold := int64(500000)
+	zones := []Zone{
+		{Code: "domestic", Countries: []string{"RU"}},
+		{Code: "cis", Countries: []string{"KZ", "BY"}},
+	}
+	methods := []*Method{
+		{ID: 1, Name: "Post", Active: true, Rates: []Rate{
+			{ZoneCode: "domestic", MaxWeightGrams: 1000, Price: 30000},
+			{ZoneCode: "domestic", MaxWeightGrams: 5000, Price: 50000},
+			{ZoneCode: "cis", MaxWeightGrams: 5000, Price: 90000},
+		}},
+		{ID: 2, Name: "Courier", Active: true, FreeThreshold: &threshold, Rates: []Rate{
+			{ZoneCode: "domestic", MaxWeightGrams: 20000, Price: 40000},
+		}},
+		{ID: 3, Name: "Disabled", Active: false, Rates: []Rate{
+			{ZoneCode: "domestic", MaxWeightGrams: 20000, Price: 100},
+		}},
+	}
+	return methods, zones
+}
+
+func TestCalculate_PicksSmallestFittingBracket(t *testing.T) {
+	methods, _ := testMethods()
+
+	opt, ok := Calculate(methods[0], "domestic", 1000, 0)
+	assert.True(t, ok)
+	assert.Equal(t, int64(30000), opt.Price)
+
+	opt, ok = Calculate(methods[0], "domestic", 1001, 0)
+	assert.True(t, ok)
+	assert.Equal(t, int64(50000), opt.Price)
+
+	_, ok = Calculate(methods[0], "domestic", 5001, 0)
+	assert.False(t, ok)
+}
+
+func TestCalculate_FreeThreshold(t *testing.T) {
+	methods, _ := testMethods()
+
+	opt, ok := Calculate(methods[1], "domestic", 2000, 499999)
+	assert.True(t, ok)
+	assert.Equal(t, int64(40000), opt.Price)
+	assert.False(t, opt.Free)
+
+	opt, ok = Calculate(methods[1], "domestic", 2000, 500000)
+	assert.True(t, ok)
+	assert.Equal(t, int64(0), opt.Price)
+	assert.True(t, opt.Free)
+}
+
+func TestOptions_FiltersByZoneAndActive(t *testing.T) {
+	methods, zones := testMethods()
+
+	opts := Options(methods, zones, "RU", 2000, 0)
+	assert.Equal(t, []Option{
+		{MethodID: 2, Name: "Courier", Price: 40000},
+		{MethodID: 1, Name: "Post", Price: 50000},
+	}, opts)
+
+	opts = Options(methods, zones, "KZ", 2000, 0)
+	assert.Equal(t, []Option{{MethodID: 1, Name: "Post", Price: 90000}}, opts)
+
+	assert.Empty(t, Options(methods, zones, "US", 2000, 0))
+}
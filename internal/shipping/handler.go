@@ -0,0 +1,274 @@
+package shipping
+
+import (
+	"errors"
+	"marketplace/internal/auth"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Handler struct {
+	svc *Service
+}
+
+func NewHandler(svc *Service) *Handler {
+	return &Handler{svc: svc}
+}
+
+func RegisterRoutes(r *gin.Engine, svc *Service) {
+	h := NewHandler(svc)
+
+	admin := r.Group("/admin/shipping")
+	admin.Use(auth.JWTAuth(), auth.RequireRole("admin"))
+	{
+		admin.GET("/zones", h.listZones)
+		admin.PUT("/zones/:code", h.upsertZone)
+		admin.DELETE("/zones/:code", h.deleteZone)
+
+		admin.POST("/methods", h.createMethod)
+		admin.GET("/methods", h.listMethods)
+		admin.GET("/methods/:id", h.getMethod)
+		admin.PUT("/methods/:id", h.updateMethod)
+		admin.DELETE("/methods/:id", h.deleteMethod)
+	}
+}
+
+type zoneReq struct {
+	Name      string   `json:"name" binding:"required,max=255"`
+	Countries []string `json:"countries" binding:"required,min=1,dive,len=2,alpha"`
+}
+
+type rateReq struct {
+	ZoneCode       string `json:"zone_code" binding:"required"`
+	MaxWeightGrams int    `json:"max_weight_grams" binding:"required,gt=0"`
+	Price          int64  `json:"price" binding:"gte=0"`
+}
+
+type methodReq struct {
+	Name          string    `json:"name" binding:"required,max=255"`
+	Active        *bool     `json:"active"`
+	FreeThreshold *int64    `json:"free_threshold" binding:"omitempty,gte=0"`
+	Rates         []rateReq `json:"rates" binding:"required,min=1,dive"`
+}
+
+func (r methodReq) toMethod() *Method {
+	active := true
+	if r.Active != nil {
+		active = *r.Active
+	}
+	m := &Method{Name: r.Name, Active: active, FreeThreshold: r.FreeThreshold}
+	for _, rr := range r.Rates {
+		m.Rates = append(m.Rates, Rate{ZoneCode: rr.ZoneCode, MaxWeightGrams: rr.MaxWeightGrams, Price: rr.Price})
+	}
+	return m
+}
+
+func parseID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return 0, false
+	}
+	return id, true
+}
+
+func writeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidRates):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrMethodNotFound), errors.Is(err, ErrZoneNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// @Summary List shipping zones
+// @Tags admin-shipping
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} shipping.Zone
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/shipping/zones [get]
+func (h *Handler) listZones(c *gin.Context) {
+	zones, err := h.svc.ListZones(c)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, zones)
+}
+
+// @Summary Create or update shipping zone
+// @Description Zone groups destination countries (ISO 3166-1 alpha-2) for rate tables
+// @Tags admin-shipping
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param code path string true "Zone code"
+// @Param input body zoneReq true "Zone"
+// @Success 200 {object} shipping.Zone
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/shipping/zones/{code} [put]
+func (h *Handler) upsertZone(c *gin.Context) {
+	var req zoneReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	z := &Zone{Code: c.Param("code"), Name: req.Name}
+	for _, country := range req.Countries {
+		z.Countries = append(z.Countries, strings.ToUpper(country))
+	}
+	if err := h.svc.UpsertZone(c, z); err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, z)
+}
+
+// @Summary Delete shipping zone
+// @Description Deleting a zone also removes its rates from all methods
+// @Tags admin-shipping
+// @Security BearerAuth
+// @Param code path string true "Zone code"
+// @Success 204
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /admin/shipping/zones/{code} [delete]
+func (h *Handler) deleteZone(c *gin.Context) {
+	if err := h.svc.DeleteZone(c, c.Param("code")); err != nil {
+		writeError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Create shipping method
+// @Tags admin-shipping
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param input body methodReq true "Method with rate table"
+// @Success 201 {object} shipping.Method
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/shipping/methods [post]
+func (h *Handler) createMethod(c *gin.Context) {
+	var req methodReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	m, err := h.svc.CreateMethod(c, req.toMethod())
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, m)
+}
+
+// @Summary List shipping methods
+// @Tags admin-shipping
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} shipping.Method
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/shipping/methods [get]
+func (h *Handler) listMethods(c *gin.Context) {
+	methods, err := h.svc.ListMethods(c)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, methods)
+}
+
+// @Summary Get shipping method
+// @Tags admin-shipping
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Method ID"
+// @Success 200 {object} shipping.Method
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /admin/shipping/methods/{id} [get]
+func (h *Handler) getMethod(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+	m, err := h.svc.GetMethod(c, id)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, m)
+}
+
+// @Summary Update shipping method
+// @Description Replaces the method and its whole rate table
+// @Tags admin-shipping
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Method ID"
+// @Param input body methodReq true "Method with rate table"
+// @Success 200 {object} shipping.Method
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/shipping/methods/{id} [put]
+func (h *Handler) updateMethod(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+	var req methodReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	m := req.toMethod()
+	m.ID = id
+	updated, err := h.svc.UpdateMethod(c, m)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// @Summary Delete shipping method
+// @Description Existing orders keep their shipping amount
+// @Tags admin-shipping
+// @Security BearerAuth
+// @Param id path int true "Method ID"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /admin/shipping/methods/{id} [delete]
+func (h *Handler) deleteMethod(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+	if err := h.svc.DeleteMethod(c, id); err != nil {
+		writeError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
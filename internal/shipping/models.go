@@ -0,0 +1,42 @@
+package shipping
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Zone — зона доставки, объединяющая страны.
+type Zone struct {
+	Code      string         `json:"code" db:"code"`
+	Name      string         `json:"name" db:"name"`
+	Countries pq.StringArray `json:"countries" db:"countries" swaggertype:"array,string"`
+}
+
+// Method — способ доставки с тарифной сеткой по весу и зонам.
+type Method struct {
+	ID            int64     `json:"id" db:"id"`
+	Name          string    `json:"name" db:"name"`
+	Active        bool      `json:"active" db:"active"`
+	FreeThreshold *int64    `json:"free_threshold,omitempty" db:"free_threshold"` // в копейках
+	Rates         []Rate    `json:"rates" db:"-"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Rate — цена доставки в зону для посылок весом до MaxWeightGrams включительно.
+type Rate struct {
+	ID             int64  `json:"id" db:"id"`
+	MethodID       int64  `json:"method_id" db:"method_id"`
+	ZoneCode       string `json:"zone_code" db:"zone_code"`
+	MaxWeightGrams int    `json:"max_weight_grams" db:"max_weight_grams"`
+	Price          int64  `json:"price" db:"price"` // в копейках
+}
+
+// Option — доступный покупателю способ доставки с рассчитанной ценой.
+type Option struct {
+	MethodID int64  `json:"method_id"`
+	Name     string `json:"name"`
+	Price    int64  `json:"price"` // в копейках
+	Free     bool   `json:"free"`
+}
@@ -0,0 +1,134 @@
+package shipping
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrMethodNotFound = errors.New("shipping method not found")
+	ErrZoneNotFound   = errors.New("shipping zone not found")
+	ErrNotDeliverable = errors.New("shipping method does not deliver to this address")
+	ErrInvalidRates   = errors.New("shipping rates must reference existing zones")
+)
+
+type Repository interface {
+	ListZones(ctx context.Context) ([]Zone, error)
+	UpsertZone(ctx context.Context, z *Zone) error
+	DeleteZone(ctx context.Context, code string) error
+
+	// CreateMethod и UpdateMethod целиком заменяют тарифную сетку метода.
+	CreateMethod(ctx context.Context, m *Method) (int64, error)
+	GetMethod(ctx context.Context, id int64) (*Method, error)
+	ListMethods(ctx context.Context) ([]*Method, error)
+	UpdateMethod(ctx context.Context, m *Method) error
+	DeleteMethod(ctx context.Context, id int64) error
+}
+
+type Service struct {
+	repo Repository
+}
+
+func NewService(repo Repository) *Service {
+	return &Service{repo: repo}
+}
+
+func (s *Service) ListZones(ctx context.Context) ([]Zone, error) {
+	return s.repo.ListZones(ctx)
+}
+
+func (s *Service) UpsertZone(ctx context.Context, z *Zone) error {
+	return s.repo.UpsertZone(ctx, z)
+}
+
+func (s *Service) DeleteZone(ctx context.Context, code string) error {
+	return s.repo.DeleteZone(ctx, code)
+}
+
+func (s *Service) validateRates(ctx context.Context, rates []Rate) error {
+	zones, err := s.repo.ListZones(ctx)
+	if err != nil {
+		return err
+	}
+	known := make(map[string]bool, len(zones))
+	for _, z := range zones {
+		known[z.Code] = true
+	}
+	for _, r := range rates {
+		if !known[r.ZoneCode] {
+			return fmt.Errorf("%w: %s", ErrInvalidRates, r.ZoneCode)
+		}
+	}
+	return nil
+}
+
+func (s *Service) CreateMethod(ctx context.Context, m *Method) (*Method, error) {
+	if err := s.validateRates(ctx, m.Rates); err != nil {
+		return nil, err
+	}
+	id, err := s.repo.CreateMethod(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.GetMethod(ctx, id)
+}
+
+func (s *Service) GetMethod(ctx context.Context, id int64) (*Method, error) {
+	return s.repo.GetMethod(ctx, id)
+}
+
+func (s *Service) ListMethods(ctx context.Context) ([]*Method, error) {
+	return s.repo.ListMethods(ctx)
+}
+
+func (s *Service) UpdateMethod(ctx context.Context, m *Method) (*Method, error) {
+	if err := s.validateRates(ctx, m.Rates); err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdateMethod(ctx, m); err != nil {
+		return nil, err
+	}
+	return s.repo.GetMethod(ctx, m.ID)
+}
+
+func (s *Service) DeleteMethod(ctx context.Context, id int64) error {
+	return s.repo.DeleteMethod(ctx, id)
+}
+
+// Options возвращает способы доставки, доступные для посылки в страну country.
+func (s *Service) Options(ctx context.Context, country string, weightGrams int, subtotal int64) ([]Option, error) {
+	zones, err := s.repo.ListZones(ctx)
+	if err != nil {
+		return nil, err
+	}
+	methods, err := s.repo.ListMethods(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return Options(methods, zones, country, weightGrams, subtotal), nil
+}
+
+// Quote считает цену доставки выбранным методом.
+func (s *Service) Quote(ctx context.Context, methodID int64, country string, weightGrams int, subtotal int64) (Option, error) {
+	m, err := s.repo.GetMethod(ctx, methodID)
+	if err != nil {
+		return Option{}, err
+	}
+	if !m.Active {
+		return Option{}, ErrMethodNotFound
+	}
+	zones, err := s.repo.ListZones(ctx)
+	if err != nil {
+		return Option{}, err
+	}
+	zoneCode, ok := zoneFor(zones, country)
+	if !ok {
+		return Option{}, ErrNotDeliverable
+	}
+	opt, ok := Calculate(m, zoneCode, weightGrams, subtotal)
+	if !ok {
+		return Option{}, ErrNotDeliverable
+	}
+	return opt, nil
+}
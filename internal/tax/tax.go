@@ -0,0 +1,88 @@
+package tax
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+)
+
+// Rate — ставка НДС категории товаров.
+type Rate string
+
+const (
+	RateNone Rate = "none" // без НДС
+	Rate0    Rate = "0"
+	Rate10   Rate = "10"
+	Rate20   Rate = "20"
+)
+
+var ErrUnknownRate = errors.New("unknown vat rate")
+
+var percents = map[Rate]int64{
+	RateNone: 0,
+	Rate0:    0,
+	Rate10:   10,
+	Rate20:   20,
+}
+
+func (r Rate) Valid() bool {
+	_, ok := percents[r]
+	return ok
+}
+
+// Percent возвращает ставку в процентах; для RateNone — 0.
+func (r Rate) Percent() int64 {
+	return percents[r]
+}
+
+func (r Rate) Value() (driver.Value, error) {
+	if !r.Valid() {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownRate, string(r))
+	}
+	return string(r), nil
+}
+
+func (r *Rate) Scan(src any) error {
+	switch v := src.(type) {
+	case string:
+		*r = Rate(v)
+	case []byte:
+		*r = Rate(v)
+	default:
+		return fmt.Errorf("cannot scan %T into tax.Rate", src)
+	}
+	if !r.Valid() {
+		return fmt.Errorf("%w: %q", ErrUnknownRate, string(*r))
+	}
+	return nil
+}
+
+// Line — суммы позиции в копейках: Net + Tax = Gross.
+type Line struct {
+	Net   int64
+	Tax   int64
+	Gross int64
+}
+
+// Compute считает налог для позиции заказа.
+//
+// Налог считается от суммы позиции (цена × количество), а не от цены единицы,
+// и округляется до копейки по правилу «половина вверх». Так сумма позиции
+// не зависит от порядка операций и совпадает с чеком.
+// Если inclusive, цена уже содержит НДС и налог выделяется из нее:
+// tax = gross × rate / (100 + rate); иначе начисляется сверху: tax = net × rate / 100.
+func Compute(unitPrice int64, quantity int, rate Rate, inclusive bool) Line {
+	amount := unitPrice * int64(quantity)
+	p := rate.Percent()
+	if inclusive {
+		t := divRound(amount*p, 100+p)
+		return Line{Net: amount - t, Tax: t, Gross: amount}
+	}
+	t := divRound(amount*p, 100)
+	return Line{Net: amount, Tax: t, Gross: amount + t}
+}
+
+// divRound делит неотрицательное a на положительное b с округлением половины вверх.
+func divRound(a, b int64) int64 {
+	return (2*a + b) / (2 * b)
+}
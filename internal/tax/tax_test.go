@@ -0,0 +1,70 @@
+package tax
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompute_Inclusive(t *testing.T) {
+	cases := []struct {
+		name     string
+		price    int64
+		qty      int
+		rate     Rate
+		expected Line
+	}{
+		{"vat20", 12000, 1, Rate20, Line{Net: 10000, Tax: 2000, Gross: 12000}},
+		{"vat20 rounds up", 100, 1, Rate20, Line{Net: 83, Tax: 17, Gross: 100}}, // 16.67 -> 17
+		{"vat10 rounds up", 32, 1, Rate10, Line{Net: 29, Tax: 3, Gross: 32}},    // 2.91 -> 3
+		{"vat10 rounds down", 12, 1, Rate10, Line{Net: 11, Tax: 1, Gross: 12}},  // 1.09 -> 1
+		{"vat20 half per line", 1, 3, Rate20, Line{Net: 2, Tax: 1, Gross: 3}},   // 0.5 -> 1, не 3×0
+		{"vat20 tiny", 1, 1, Rate20, Line{Net: 1, Tax: 0, Gross: 1}},            // 0.1667 -> 0
+		{"vat0", 999, 2, Rate0, Line{Net: 1998, Tax: 0, Gross: 1998}},
+		{"without vat", 999, 2, RateNone, Line{Net: 1998, Tax: 0, Gross: 1998}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, Compute(tc.price, tc.qty, tc.rate, true))
+		})
+	}
+}
+
+func TestCompute_Exclusive(t *testing.T) {
+	cases := []struct {
+		name     string
+		price    int64
+		qty      int
+		rate     Rate
+		expected Line
+	}{
+		{"vat20", 10000, 1, Rate20, Line{Net: 10000, Tax: 2000, Gross: 12000}},
+		{"vat20 exact", 5, 1, Rate20, Line{Net: 5, Tax: 1, Gross: 6}},      // 1.0
+		{"vat10 half up", 5, 1, Rate10, Line{Net: 5, Tax: 1, Gross: 6}},    // 0.5 -> 1
+		{"vat10 below half", 4, 1, Rate10, Line{Net: 4, Tax: 0, Gross: 4}}, // 0.4 -> 0
+		{"vat10 per line", 5, 3, Rate10, Line{Net: 15, Tax: 2, Gross: 17}}, // 1.5 -> 2, не 3×1
+		{"without vat", 700, 1, RateNone, Line{Net: 700, Tax: 0, Gross: 700}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, Compute(tc.price, tc.qty, tc.rate, false))
+		})
+	}
+}
+
+func TestCompute_Deterministic(t *testing.T) {
+	for price := int64(0); price < 1000; price++ {
+		for _, rate := range []Rate{RateNone, Rate0, Rate10, Rate20} {
+			l := Compute(price, 1, rate, true)
+			assert.Equal(t, l.Gross, l.Net+l.Tax)
+			assert.Equal(t, l, Compute(price, 1, rate, true))
+		}
+	}
+}
+
+func TestRate_Scan(t *testing.T) {
+	var r Rate
+	assert.NoError(t, r.Scan([]byte("10")))
+	assert.Equal(t, Rate10, r)
+	assert.ErrorIs(t, r.Scan("18"), ErrUnknownRate)
+}
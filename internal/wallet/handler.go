@@ -0,0 +1,218 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"marketplace/internal/auth"
+	"marketplace/internal/currency"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Handler struct {
+	svc *Service
+}
+
+func NewHandler(svc *Service) *Handler {
+	return &Handler{svc: svc}
+}
+
+func RegisterRoutes(r *gin.Engine, svc *Service) {
+	h := NewHandler(svc)
+
+	g := r.Group("/wallet", auth.JWTAuth())
+	{
+		g.GET("", h.balances)
+		g.GET("/transactions", h.transactions)
+	}
+
+	admin := r.Group("/admin/wallets")
+	admin.Use(auth.JWTAuth(), auth.RequireRole("admin"))
+	{
+		admin.GET("/:user_id", h.adminBalances)
+		admin.GET("/:user_id/transactions", h.adminTransactions)
+		admin.POST("/:user_id/credit", h.credit)
+		admin.POST("/:user_id/debit", h.debit)
+	}
+}
+
+func writeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidAmount), errors.Is(err, currency.ErrUnknownCurrency):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrInsufficientFunds):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func parseUserID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return 0, false
+	}
+	return id, true
+}
+
+func transactionFilter(c *gin.Context) TransactionFilter {
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	return TransactionFilter{Currency: c.Query("currency"), Offset: offset, Limit: limit}
+}
+
+// @Summary My wallet
+// @Description Store credit balance per currency, in minor units. Empty when nothing was ever credited.
+// @Tags wallet
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} wallet.Wallet
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /wallet [get]
+func (h *Handler) balances(c *gin.Context) {
+	wallets, err := h.svc.Balances(c, auth.GetUserID(c))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, wallets)
+}
+
+// @Summary My wallet transactions
+// @Description Credits, debits and order payments, newest first. Amounts are signed.
+// @Tags wallet
+// @Security BearerAuth
+// @Produce json
+// @Param currency query string false "Currency"
+// @Param offset query int false "Offset" default(0)
+// @Param limit query int false "Limit" default(50)
+// @Success 200 {array} wallet.Transaction
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /wallet/transactions [get]
+func (h *Handler) transactions(c *gin.Context) {
+	txs, err := h.svc.Transactions(c, auth.GetUserID(c), transactionFilter(c))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, txs)
+}
+
+// @Summary Customer wallet (admin)
+// @Tags admin-wallets
+// @Security BearerAuth
+// @Produce json
+// @Param user_id path int true "User ID"
+// @Success 200 {array} wallet.Wallet
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/wallets/{user_id} [get]
+func (h *Handler) adminBalances(c *gin.Context) {
+	userID, ok := parseUserID(c)
+	if !ok {
+		return
+	}
+	wallets, err := h.svc.Balances(c, userID)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, wallets)
+}
+
+// @Summary Customer wallet transactions (admin)
+// @Tags admin-wallets
+// @Security BearerAuth
+// @Produce json
+// @Param user_id path int true "User ID"
+// @Param currency query string false "Currency"
+// @Param offset query int false "Offset" default(0)
+// @Param limit query int false "Limit" default(50)
+// @Success 200 {array} wallet.Transaction
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/wallets/{user_id}/transactions [get]
+func (h *Handler) adminTransactions(c *gin.Context) {
+	userID, ok := parseUserID(c)
+	if !ok {
+		return
+	}
+	txs, err := h.svc.Transactions(c, userID, transactionFilter(c))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, txs)
+}
+
+type adjustmentReq struct {
+	// Amount — сумма в минорных единицах валюты, всегда положительная
+	Amount   int64  `json:"amount" binding:"required,gt=0"`
+	Currency string `json:"currency" binding:"omitempty,len=3"`
+	Reason   string `json:"reason" binding:"required"`
+}
+
+// @Summary Credit customer wallet (admin)
+// @Description Add store credit, e.g. instead of a card refund or as a goodwill gesture. Send Idempotency-Key to make retries safe.
+// @Tags admin-wallets
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param user_id path int true "User ID"
+// @Param input body adjustmentReq true "Credit"
+// @Success 201 {object} wallet.Transaction
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/wallets/{user_id}/credit [post]
+func (h *Handler) credit(c *gin.Context) {
+	h.adjust(c, h.svc.Credit)
+}
+
+// @Summary Debit customer wallet (admin)
+// @Description Remove store credit. The balance never goes negative.
+// @Tags admin-wallets
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param user_id path int true "User ID"
+// @Param input body adjustmentReq true "Debit"
+// @Success 201 {object} wallet.Transaction
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 409 {object} map[string]string "insufficient wallet balance"
+// @Failure 500 {object} map[string]string
+// @Router /admin/wallets/{user_id}/debit [post]
+func (h *Handler) debit(c *gin.Context) {
+	h.adjust(c, h.svc.Debit)
+}
+
+func (h *Handler) adjust(c *gin.Context, apply func(context.Context, int64, int64, Adjustment) (*Transaction, error)) {
+	userID, ok := parseUserID(c)
+	if !ok {
+		return
+	}
+	var req adjustmentReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	t, err := apply(c, auth.GetUserID(c), userID, Adjustment{Amount: req.Amount, Currency: req.Currency, Reason: req.Reason})
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, t)
+}
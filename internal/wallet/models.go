@@ -0,0 +1,57 @@
+package wallet
+
+import (
+	"errors"
+	"time"
+)
+
+// Виды операций кошелька. Сумма операции со знаком: начисления положительные, списания отрицательные.
+const (
+	// KindCredit — начисление администратором: компенсация, жест доброй воли
+	KindCredit = "credit"
+	// KindDebit — списание администратором, например ошибочного начисления
+	KindDebit = "debit"
+	// KindOrderPayment — оплата заказа из кошелька
+	KindOrderPayment = "order_payment"
+	// KindOrderRelease — возврат списанного на кошелек, если заказ отменили неоплаченным
+	KindOrderRelease = "order_release"
+	// KindRefund — возврат оплаты из кошелька администратором
+	KindRefund = "refund"
+)
+
+var (
+	ErrInvalidAmount     = errors.New("invalid wallet amount")
+	ErrInsufficientFunds = errors.New("insufficient wallet balance")
+)
+
+// Wallet — остаток покупателя в одной валюте, в минорных единицах; не бывает отрицательным.
+type Wallet struct {
+	UserID    int64     `json:"user_id" db:"user_id"`
+	Currency  string    `json:"currency" db:"currency"`
+	Balance   int64     `json:"balance" db:"balance"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Transaction — операция кошелька. История только пополняется;
+// остаток кошелька всегда равен сумме его операций.
+type Transaction struct {
+	ID       int64  `json:"id" db:"id"`
+	UserID   int64  `json:"user_id" db:"user_id"`
+	Currency string `json:"currency" db:"currency"`
+	Amount   int64  `json:"amount" db:"amount"`
+	// BalanceAfter — остаток кошелька сразу после операции
+	BalanceAfter    int64     `json:"balance_after" db:"balance_after"`
+	Kind            string    `json:"kind" db:"kind"`
+	OrderID         *int64    `json:"order_id,omitempty" db:"order_id"`
+	PaymentIntentID *int64    `json:"payment_intent_id,omitempty" db:"payment_intent_id"`
+	RefundID        *int64    `json:"refund_id,omitempty" db:"refund_id"`
+	ActorID         *int64    `json:"actor_id,omitempty" db:"actor_id"`
+	Reason          *string   `json:"reason,omitempty" db:"reason"`
+	CreatedAt       time.Time `json:"created_at" db:"created_at"`
+}
+
+type TransactionFilter struct {
+	Currency string
+	Offset   int
+	Limit    int
+}
@@ -0,0 +1,96 @@
+package wallet
+
+import (
+	"context"
+	"fmt"
+	"marketplace/internal/currency"
+	"strings"
+)
+
+type Repository interface {
+	// Balances возвращает кошельки покупателя по всем валютам.
+	Balances(ctx context.Context, userID int64) ([]Wallet, error)
+	// ListTransactions возвращает операции покупателя, от новых к старым.
+	ListTransactions(ctx context.Context, userID int64, f TransactionFilter) ([]Transaction, error)
+	// Adjust проводит начисление или списание администратора вместе с проводкой в главной книге.
+	// Списание больше остатка не проходит: ErrInsufficientFunds.
+	Adjust(ctx context.Context, t *Transaction) (*Transaction, error)
+}
+
+// Adjustment — начисление или списание администратора; Amount всегда положительная.
+type Adjustment struct {
+	Amount   int64
+	Currency string // по умолчанию currency.Base
+	Reason   string
+}
+
+type Service struct {
+	repo Repository
+}
+
+func NewService(repo Repository) *Service {
+	return &Service{repo: repo}
+}
+
+func (s *Service) Balances(ctx context.Context, userID int64) ([]Wallet, error) {
+	return s.repo.Balances(ctx, userID)
+}
+
+func (s *Service) Transactions(ctx context.Context, userID int64, f TransactionFilter) ([]Transaction, error) {
+	if f.Limit <= 0 || f.Limit > 200 {
+		f.Limit = 50
+	}
+	if f.Offset < 0 {
+		f.Offset = 0
+	}
+	if f.Currency != "" {
+		code, err := currency.Normalize(f.Currency)
+		if err != nil {
+			return nil, err
+		}
+		f.Currency = code
+	}
+	return s.repo.ListTransactions(ctx, userID, f)
+}
+
+// Credit начисляет покупателю бонусы, например вместо возврата на карту.
+func (s *Service) Credit(ctx context.Context, actorID, userID int64, adj Adjustment) (*Transaction, error) {
+	return s.adjust(ctx, KindCredit, actorID, userID, adj)
+}
+
+// Debit списывает бонусы; остаток не может стать отрицательным.
+func (s *Service) Debit(ctx context.Context, actorID, userID int64, adj Adjustment) (*Transaction, error) {
+	return s.adjust(ctx, KindDebit, actorID, userID, adj)
+}
+
+func (s *Service) adjust(ctx context.Context, kind string, actorID, userID int64, adj Adjustment) (*Transaction, error) {
+	if adj.Amount <= 0 {
+		return nil, fmt.Errorf("%w: amount must be positive", ErrInvalidAmount)
+	}
+	reason := strings.TrimSpace(adj.Reason)
+	if reason == "" {
+		return nil, fmt.Errorf("%w: reason required", ErrInvalidAmount)
+	}
+	code := adj.Currency
+	if code == "" {
+		code = currency.Base
+	}
+	code, err := currency.Normalize(code)
+	if err != nil {
+		return nil, err
+	}
+	t := &Transaction{
+		UserID:   userID,
+		Currency: code,
+		Amount:   adj.Amount,
+		Kind:     kind,
+		Reason:   &reason,
+	}
+	if kind == KindDebit {
+		t.Amount = -adj.Amount
+	}
+	if actorID != 0 {
+		t.ActorID = &actorID
+	}
+	return s.repo.Adjust(ctx, t)
+}
@@ -0,0 +1,76 @@
+package wallet
+
+import (
+	"context"
+	"marketplace/internal/currency"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type mockRepo struct {
+	mock.Mock
+}
+
+func (m *mockRepo) Balances(ctx context.Context, userID int64) ([]Wallet, error) {
+	args := m.Called(ctx, userID)
+	w, _ := args.Get(0).([]Wallet)
+	return w, args.Error(1)
+}
+
+func (m *mockRepo) ListTransactions(ctx context.Context, userID int64, f TransactionFilter) ([]Transaction, error) {
+	args := m.Called(ctx, userID, f)
+	txs, _ := args.Get(0).([]Transaction)
+	return txs, args.Error(1)
+}
+
+func (m *mockRepo) Adjust(ctx context.Context, t *Transaction) (*Transaction, error) {
+	args := m.Called(ctx, t)
+	out, _ := args.Get(0).(*Transaction)
+	return out, args.Error(1)
+}
+
+func TestService_DebitIsNegativeInBaseCurrency(t *testing.T) {
+	ctx := context.Background()
+	repo := new(mockRepo)
+	svc := NewService(repo)
+
+	repo.On("Adjust", ctx, mock.MatchedBy(func(t *Transaction) bool {
+		return t.UserID == 7 && t.Amount == -500 && t.Currency == "RUB" && t.Kind == KindDebit &&
+			*t.ActorID == 1 && *t.Reason == "duplicate credit"
+	})).Return(&Transaction{ID: 3}, nil)
+
+	_, err := svc.Debit(ctx, 1, 7, Adjustment{Amount: 500, Reason: " duplicate credit "})
+	require.NoError(t, err)
+	repo.AssertExpectations(t)
+}
+
+func TestService_CreditNormalizesCurrency(t *testing.T) {
+	ctx := context.Background()
+	repo := new(mockRepo)
+	svc := NewService(repo)
+
+	repo.On("Adjust", ctx, mock.MatchedBy(func(t *Transaction) bool {
+		return t.Amount == 1000 && t.Currency == "USD" && t.Kind == KindCredit
+	})).Return(&Transaction{ID: 4}, nil)
+
+	_, err := svc.Credit(ctx, 1, 7, Adjustment{Amount: 1000, Currency: "usd", Reason: "late delivery"})
+	require.NoError(t, err)
+	repo.AssertExpectations(t)
+}
+
+func TestService_AdjustRejectsInvalidInput(t *testing.T) {
+	ctx := context.Background()
+	repo := new(mockRepo)
+	svc := NewService(repo)
+
+	_, err := svc.Credit(ctx, 1, 7, Adjustment{Amount: 0, Reason: "x"})
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+	_, err = svc.Credit(ctx, 1, 7, Adjustment{Amount: 100, Reason: "  "})
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+	_, err = svc.Debit(ctx, 1, 7, Adjustment{Amount: 100, Currency: "XXX", Reason: "x"})
+	assert.ErrorIs(t, err, currency.ErrUnknownCurrency)
+	repo.AssertNotCalled(t, "Adjust", mock.Anything, mock.Anything)
+}
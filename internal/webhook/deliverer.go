@@ -0,0 +1,155 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// envelope — тело POST-запроса получателю.
+type envelope struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Deliverer отправляет поставленные в очередь доставки с экспоненциальной
+// задержкой между попытками.
+type Deliverer struct {
+	repo        Repository
+	client      *http.Client
+	interval    time.Duration
+	batchSize   int
+	lease       time.Duration
+	maxAttempts int
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+	now         func() time.Time
+}
+
+func NewDeliverer(repo Repository, client *http.Client, interval time.Duration) *Deliverer {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Deliverer{
+		repo:        repo,
+		client:      client,
+		interval:    interval,
+		batchSize:   20,
+		lease:       time.Minute,
+		maxAttempts: 8,
+		baseBackoff: 5 * time.Second,
+		maxBackoff:  time.Hour,
+		now:         time.Now,
+	}
+}
+
+// Run блокируется до отмены ctx.
+func (d *Deliverer) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := d.DeliverOnce(ctx); err != nil && ctx.Err() == nil {
+				zap.L().Error("Failed to deliver webhooks", zap.Error(err))
+			}
+		}
+	}
+}
+
+// DeliverOnce отправляет одну пачку доставок и возвращает число успешных.
+func (d *Deliverer) DeliverOnce(ctx context.Context) (int, error) {
+	targets, err := d.repo.ClaimDueDeliveries(ctx, d.batchSize, d.lease)
+	if err != nil {
+		return 0, err
+	}
+	succeeded := 0
+	for i := range targets {
+		t := &targets[i]
+		attempt := d.send(ctx, t)
+
+		status, next := DeliverySucceeded, d.now()
+		if attempt.Error != "" {
+			status = DeliveryPending
+			next = d.now().Add(d.backoff(t.Attempts + 1))
+			if t.Attempts+1 >= d.maxAttempts {
+				status = DeliveryFailed
+			}
+		}
+		if err = d.repo.RecordAttempt(ctx, attempt, status, next); err != nil {
+			return succeeded, err
+		}
+		if status == DeliverySucceeded {
+			succeeded++
+		}
+	}
+	return succeeded, nil
+}
+
+func (d *Deliverer) send(ctx context.Context, t *DeliveryTarget) *Attempt {
+	attempt := &Attempt{DeliveryID: t.ID}
+	start := d.now()
+	defer func() {
+		attempt.DurationMS = d.now().Sub(start).Milliseconds()
+	}()
+
+	body, err := json.Marshal(envelope{
+		ID:        t.EventID,
+		Type:      t.EventType,
+		CreatedAt: t.CreatedAt,
+		Data:      t.Payload,
+	})
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	ts := d.now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, t.EventType)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(t.ID, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+	req.Header.Set(HeaderSignature, Sign(t.Secret, ts, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	code := resp.StatusCode
+	attempt.ResponseCode = &code
+	if code < 200 || code >= 300 {
+		attempt.Error = fmt.Sprintf("unexpected status %d", code)
+	}
+	return attempt
+}
+
+func (d *Deliverer) backoff(attempts int) time.Duration {
+	b := d.baseBackoff
+	for i := 1; i < attempts && b < d.maxBackoff; i++ {
+		b *= 2
+	}
+	if b > d.maxBackoff {
+		b = d.maxBackoff
+	}
+	return b
+}
@@ -0,0 +1,119 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordedAttempt struct {
+	attempt Attempt
+	status  string
+	next    time.Time
+}
+
+type fakeRepo struct {
+	Repository
+	mu       sync.Mutex
+	due      []DeliveryTarget
+	attempts []recordedAttempt
+}
+
+func (r *fakeRepo) ClaimDueDeliveries(context.Context, int, time.Duration) ([]DeliveryTarget, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	due := r.due
+	r.due = nil
+	return due, nil
+}
+
+func (r *fakeRepo) RecordAttempt(_ context.Context, a *Attempt, status string, next time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempts = append(r.attempts, recordedAttempt{attempt: *a, status: status, next: next})
+	return nil
+}
+
+func newTarget(url string, attempts int) DeliveryTarget {
+	return DeliveryTarget{
+		Delivery: Delivery{
+			ID:        5,
+			EventID:   42,
+			EventType: "order.paid",
+			Payload:   json.RawMessage(`{"order_id":1,"status":"paid"}`),
+			Attempts:  attempts,
+		},
+		URL:    url,
+		Secret: "test-secret-0123456789",
+	}
+}
+
+func TestDeliverer_SendsSignedRequest(t *testing.T) {
+	var (
+		gotBody    []byte
+		gotHeaders http.Header
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotBody, _ = io.ReadAll(r.Body)
+		gotHeaders = r.Header.Clone()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	repo := &fakeRepo{due: []DeliveryTarget{newTarget(srv.URL, 0)}}
+	d := NewDeliverer(repo, srv.Client(), time.Second)
+
+	n, err := d.DeliverOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	assert.Equal(t, "order.paid", gotHeaders.Get(HeaderEvent))
+	assert.Equal(t, "5", gotHeaders.Get(HeaderDelivery))
+	ts, err := strconv.ParseInt(gotHeaders.Get(HeaderTimestamp), 10, 64)
+	require.NoError(t, err)
+	assert.True(t, Verify("test-secret-0123456789", ts, gotBody, gotHeaders.Get(HeaderSignature)))
+	assert.False(t, Verify("other-secret", ts, gotBody, gotHeaders.Get(HeaderSignature)))
+
+	var env envelope
+	require.NoError(t, json.Unmarshal(gotBody, &env))
+	assert.Equal(t, int64(42), env.ID)
+	assert.JSONEq(t, `{"order_id":1,"status":"paid"}`, string(env.Data))
+
+	require.Len(t, repo.attempts, 1)
+	assert.Equal(t, DeliverySucceeded, repo.attempts[0].status)
+	assert.Equal(t, http.StatusNoContent, *repo.attempts[0].attempt.ResponseCode)
+}
+
+func TestDeliverer_RetriesWithBackoffAndGivesUp(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	repo := &fakeRepo{due: []DeliveryTarget{newTarget(srv.URL, 2)}}
+	d := NewDeliverer(repo, srv.Client(), time.Second)
+	d.now = func() time.Time { return now }
+
+	_, err := d.DeliverOnce(context.Background())
+	require.NoError(t, err)
+	require.Len(t, repo.attempts, 1)
+	assert.Equal(t, DeliveryPending, repo.attempts[0].status)
+	assert.Equal(t, now.Add(4*d.baseBackoff), repo.attempts[0].next)
+	assert.Equal(t, "unexpected status 500", repo.attempts[0].attempt.Error)
+
+	repo.due = []DeliveryTarget{newTarget(srv.URL, d.maxAttempts-1)}
+	_, err = d.DeliverOnce(context.Background())
+	require.NoError(t, err)
+	require.Len(t, repo.attempts, 2)
+	assert.Equal(t, DeliveryFailed, repo.attempts[1].status)
+}
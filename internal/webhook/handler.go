@@ -0,0 +1,279 @@
+package webhook
+
+import (
+	"database/sql"
+	"errors"
+	"marketplace/internal/auth"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Handler struct {
+	svc *Service
+}
+
+func NewHandler(svc *Service) *Handler {
+	return &Handler{svc: svc}
+}
+
+func RegisterRoutes(r *gin.Engine, svc *Service) {
+	h := NewHandler(svc)
+
+	admin := r.Group("/admin/webhooks")
+	admin.Use(auth.JWTAuth(), auth.RequireRole("admin"))
+	{
+		admin.POST("", h.create)
+		admin.GET("", h.list)
+		admin.GET("/:id", h.get)
+		admin.PUT("/:id", h.update)
+		admin.DELETE("/:id", h.delete)
+		admin.GET("/:id/deliveries", h.listDeliveries)
+		admin.GET("/:id/deliveries/:delivery_id", h.getDelivery)
+		admin.POST("/:id/deliveries/:delivery_id/replay", h.replay)
+	}
+}
+
+type endpointReq struct {
+	URL        string   `json:"url" binding:"required,url"`
+	EventTypes []string `json:"event_types" binding:"required,min=1,dive,required"`
+	Secret     string   `json:"secret" binding:"omitempty,min=16"`
+	Active     *bool    `json:"active"`
+}
+
+func (r endpointReq) toEndpoint() *Endpoint {
+	active := true
+	if r.Active != nil {
+		active = *r.Active
+	}
+	return &Endpoint{URL: r.URL, EventTypes: r.EventTypes, Secret: r.Secret, Active: active}
+}
+
+func parseParamID(c *gin.Context, name string) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param(name), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + name})
+		return 0, false
+	}
+	return id, true
+}
+
+func writeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidURL):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrEndpointNotFound), errors.Is(err, ErrDeliveryNotFound), errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// @Summary Create webhook endpoint
+// @Description Subscribe an external URL to domain events. The secret is returned only once.
+// @Description Events: order.created, order.paid, order.shipped, order.delivered, order.cancelled, order.refunded,
+// @Description payment.succeeded, payment.refunded; "*" subscribes to all of them.
+// @Tags admin-webhooks
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param input body endpointReq true "Endpoint"
+// @Success 201 {object} webhook.Endpoint
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/webhooks [post]
+func (h *Handler) create(c *gin.Context) {
+	var req endpointReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	e, err := h.svc.CreateEndpoint(c, req.toEndpoint())
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, e)
+}
+
+// @Summary List webhook endpoints
+// @Tags admin-webhooks
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} webhook.Endpoint
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/webhooks [get]
+func (h *Handler) list(c *gin.Context) {
+	endpoints, err := h.svc.ListEndpoints(c)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, endpoints)
+}
+
+// @Summary Get webhook endpoint
+// @Tags admin-webhooks
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Endpoint ID"
+// @Success 200 {object} webhook.Endpoint
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /admin/webhooks/{id} [get]
+func (h *Handler) get(c *gin.Context) {
+	id, ok := parseParamID(c, "id")
+	if !ok {
+		return
+	}
+	e, err := h.svc.GetEndpoint(c, id)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, e)
+}
+
+// @Summary Update webhook endpoint
+// @Description Empty secret keeps the current one
+// @Tags admin-webhooks
+// @Security BearerAuth
+// @Accept json
+// @Param id path int true "Endpoint ID"
+// @Param input body endpointReq true "Endpoint"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /admin/webhooks/{id} [put]
+func (h *Handler) update(c *gin.Context) {
+	id, ok := parseParamID(c, "id")
+	if !ok {
+		return
+	}
+	var req endpointReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	e := req.toEndpoint()
+	e.ID = id
+	if err := h.svc.UpdateEndpoint(c, e); err != nil {
+		writeError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Delete webhook endpoint
+// @Tags admin-webhooks
+// @Security BearerAuth
+// @Param id path int true "Endpoint ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /admin/webhooks/{id} [delete]
+func (h *Handler) delete(c *gin.Context) {
+	id, ok := parseParamID(c, "id")
+	if !ok {
+		return
+	}
+	if err := h.svc.DeleteEndpoint(c, id); err != nil {
+		writeError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary List webhook deliveries
+// @Description Deliveries log of an endpoint, newest first
+// @Tags admin-webhooks
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Endpoint ID"
+// @Param offset query int false "Offset" default(0)
+// @Param limit query int false "Limit" default(50)
+// @Success 200 {array} webhook.Delivery
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /admin/webhooks/{id}/deliveries [get]
+func (h *Handler) listDeliveries(c *gin.Context) {
+	id, ok := parseParamID(c, "id")
+	if !ok {
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid offset"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 200 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+		return
+	}
+	deliveries, err := h.svc.ListDeliveries(c, id, offset, limit)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// @Summary Get webhook delivery
+// @Description Delivery with the log of all attempts
+// @Tags admin-webhooks
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Endpoint ID"
+// @Param delivery_id path int true "Delivery ID"
+// @Success 200 {object} webhook.Delivery
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /admin/webhooks/{id}/deliveries/{delivery_id} [get]
+func (h *Handler) getDelivery(c *gin.Context) {
+	id, ok := parseParamID(c, "id")
+	if !ok {
+		return
+	}
+	deliveryID, ok := parseParamID(c, "delivery_id")
+	if !ok {
+		return
+	}
+	d, err := h.svc.GetDelivery(c, id, deliveryID)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, d)
+}
+
+// @Summary Replay webhook delivery
+// @Description Queue the delivery again regardless of its current status
+// @Tags admin-webhooks
+// @Security BearerAuth
+// @Param id path int true "Endpoint ID"
+// @Param delivery_id path int true "Delivery ID"
+// @Success 202 "Accepted"
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /admin/webhooks/{id}/deliveries/{delivery_id}/replay [post]
+func (h *Handler) replay(c *gin.Context) {
+	id, ok := parseParamID(c, "id")
+	if !ok {
+		return
+	}
+	deliveryID, ok := parseParamID(c, "delivery_id")
+	if !ok {
+		return
+	}
+	if err := h.svc.Replay(c, id, deliveryID); err != nil {
+		writeError(c, err)
+		return
+	}
+	c.Status(http.StatusAccepted)
+}
@@ -0,0 +1,69 @@
+package webhook
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+
+	// AllEvents в EventTypes подписывает endpoint на все события.
+	AllEvents = "*"
+)
+
+// Endpoint — подписка внешней системы на события.
+type Endpoint struct {
+	ID         int64          `json:"id" db:"id"`
+	URL        string         `json:"url" db:"url"`
+	EventTypes pq.StringArray `json:"event_types" db:"event_types" swaggertype:"array,string"`
+	Secret     string         `json:"secret,omitempty" db:"secret"`
+	Active     bool           `json:"active" db:"active"`
+	CreatedAt  time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at" db:"updated_at"`
+}
+
+func (e *Endpoint) Subscribed(eventType string) bool {
+	for _, t := range e.EventTypes {
+		if t == AllEvents || t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery — доставка одного события на один endpoint.
+type Delivery struct {
+	ID            int64           `json:"id" db:"id"`
+	EndpointID    int64           `json:"endpoint_id" db:"endpoint_id"`
+	EventID       int64           `json:"event_id" db:"event_id"`
+	EventType     string          `json:"event_type" db:"event_type"`
+	Payload       json.RawMessage `json:"payload" db:"payload" swaggertype:"object"`
+	Status        string          `json:"status" db:"status"`
+	Attempts      int             `json:"attempts" db:"attempts"`
+	NextAttemptAt time.Time       `json:"next_attempt_at" db:"next_attempt_at"`
+	CreatedAt     time.Time       `json:"created_at" db:"created_at"`
+	DeliveredAt   *time.Time      `json:"delivered_at,omitempty" db:"delivered_at"`
+	Log           []Attempt       `json:"log,omitempty" db:"-"`
+}
+
+// Attempt — запись журнала о попытке доставки.
+type Attempt struct {
+	ID           int64     `json:"id" db:"id"`
+	DeliveryID   int64     `json:"delivery_id" db:"delivery_id"`
+	ResponseCode *int      `json:"response_code,omitempty" db:"response_code"`
+	Error        string    `json:"error,omitempty" db:"error"`
+	DurationMS   int64     `json:"duration_ms" db:"duration_ms"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+// DeliveryTarget — доставка вместе с адресом и секретом endpoint'а.
+type DeliveryTarget struct {
+	Delivery
+	URL    string `db:"url"`
+	Secret string `db:"secret"`
+}
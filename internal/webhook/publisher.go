@@ -0,0 +1,38 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"marketplace/internal/outbox"
+)
+
+// Publisher раскладывает события outbox по подписанным endpoint'ам.
+// Сама отправка выполняется Deliverer'ом.
+type Publisher struct {
+	repo Repository
+}
+
+func NewPublisher(repo Repository) *Publisher {
+	return &Publisher{repo: repo}
+}
+
+func (p *Publisher) Publish(ctx context.Context, e outbox.Event) error {
+	endpoints, err := p.repo.ListActiveEndpoints(ctx)
+	if err != nil {
+		return fmt.Errorf("list webhook endpoints: %w", err)
+	}
+	for _, ep := range endpoints {
+		if !ep.Subscribed(e.EventType) {
+			continue
+		}
+		if err = p.repo.EnqueueDelivery(ctx, &Delivery{
+			EndpointID: ep.ID,
+			EventID:    e.ID,
+			EventType:  e.EventType,
+			Payload:    e.Payload,
+		}); err != nil {
+			return fmt.Errorf("enqueue webhook delivery: %w", err)
+		}
+	}
+	return nil
+}
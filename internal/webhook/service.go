@@ -0,0 +1,125 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"time"
+)
+
+var (
+	ErrEndpointNotFound = errors.New("webhook endpoint not found")
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+	ErrInvalidURL       = errors.New("webhook url must be absolute http(s) url")
+)
+
+type Repository interface {
+	CreateEndpoint(ctx context.Context, e *Endpoint) (int64, error)
+	GetEndpoint(ctx context.Context, id int64) (*Endpoint, error)
+	ListEndpoints(ctx context.Context) ([]*Endpoint, error)
+	UpdateEndpoint(ctx context.Context, e *Endpoint) error
+	DeleteEndpoint(ctx context.Context, id int64) error
+	ListActiveEndpoints(ctx context.Context) ([]*Endpoint, error)
+
+	// EnqueueDelivery идемпотентна по (endpoint_id, event_id).
+	EnqueueDelivery(ctx context.Context, d *Delivery) error
+	ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]DeliveryTarget, error)
+	RecordAttempt(ctx context.Context, a *Attempt, status string, nextAttemptAt time.Time) error
+	ListDeliveries(ctx context.Context, endpointID int64, offset, limit int) ([]*Delivery, error)
+	GetDelivery(ctx context.Context, endpointID, deliveryID int64) (*Delivery, error)
+	ResetDelivery(ctx context.Context, endpointID, deliveryID int64) error
+}
+
+type Service struct {
+	repo Repository
+}
+
+func NewService(repo Repository) *Service {
+	return &Service{repo: repo}
+}
+
+func validateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidURL
+	}
+	return nil
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// CreateEndpoint создает подписку; если секрет не задан, генерирует его.
+// Секрет возвращается только здесь.
+func (s *Service) CreateEndpoint(ctx context.Context, e *Endpoint) (*Endpoint, error) {
+	if err := validateURL(e.URL); err != nil {
+		return nil, err
+	}
+	if e.Secret == "" {
+		secret, err := newSecret()
+		if err != nil {
+			return nil, err
+		}
+		e.Secret = secret
+	}
+	id, err := s.repo.CreateEndpoint(ctx, e)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.GetEndpoint(ctx, id)
+}
+
+func (s *Service) GetEndpoint(ctx context.Context, id int64) (*Endpoint, error) {
+	e, err := s.repo.GetEndpoint(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	e.Secret = ""
+	return e, nil
+}
+
+func (s *Service) ListEndpoints(ctx context.Context) ([]*Endpoint, error) {
+	endpoints, err := s.repo.ListEndpoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range endpoints {
+		e.Secret = ""
+	}
+	return endpoints, nil
+}
+
+// UpdateEndpoint меняет подписку; пустой Secret оставляет прежний секрет.
+func (s *Service) UpdateEndpoint(ctx context.Context, e *Endpoint) error {
+	if err := validateURL(e.URL); err != nil {
+		return err
+	}
+	return s.repo.UpdateEndpoint(ctx, e)
+}
+
+func (s *Service) DeleteEndpoint(ctx context.Context, id int64) error {
+	return s.repo.DeleteEndpoint(ctx, id)
+}
+
+func (s *Service) ListDeliveries(ctx context.Context, endpointID int64, offset, limit int) ([]*Delivery, error) {
+	if _, err := s.repo.GetEndpoint(ctx, endpointID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListDeliveries(ctx, endpointID, offset, limit)
+}
+
+func (s *Service) GetDelivery(ctx context.Context, endpointID, deliveryID int64) (*Delivery, error) {
+	return s.repo.GetDelivery(ctx, endpointID, deliveryID)
+}
+
+// Replay ставит доставку в очередь заново, независимо от ее текущего статуса.
+func (s *Service) Replay(ctx context.Context, endpointID, deliveryID int64) error {
+	return s.repo.ResetDelivery(ctx, endpointID, deliveryID)
+}
@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE order_status_history (
+    id BIGSERIAL PRIMARY KEY,
+    order_id BIGINT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    from_status VARCHAR(50), -- NULL для создания заказа
+    to_status VARCHAR(50) NOT NULL,
+    actor_id BIGINT REFERENCES users(id) ON DELETE SET NULL, -- NULL, если переход сделала система
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_order_status_history_order ON order_status_history(order_id, created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS order_status_history;
@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE payment_compensations (
+    id BIGSERIAL PRIMARY KEY,
+    order_id BIGINT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    payment_intent_id BIGINT NOT NULL UNIQUE REFERENCES payment_intents(id) ON DELETE CASCADE,
+    amount BIGINT NOT NULL, -- в копейках
+    status VARCHAR(50) NOT NULL DEFAULT 'pending', -- pending | completed
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_payment_compensations_order ON payment_compensations(order_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS payment_compensations;
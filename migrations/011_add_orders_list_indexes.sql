@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE INDEX idx_orders_user_created ON orders(user_id, created_at DESC, id DESC)
+    INCLUDE (status, total_amount, updated_at);
+CREATE INDEX idx_orders_user_status_created ON orders(user_id, status, created_at DESC, id DESC)
+    INCLUDE (total_amount, updated_at);
+DROP INDEX IF EXISTS idx_orders_user_id;
+
+-- +goose Down
+CREATE INDEX IF NOT EXISTS idx_orders_user_id ON orders(user_id);
+DROP INDEX IF EXISTS idx_orders_user_status_created;
+DROP INDEX IF EXISTS idx_orders_user_created;
@@ -0,0 +1,35 @@
+-- +goose Up
+ALTER TABLE order_items
+    ADD COLUMN product_name VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN product_description TEXT NOT NULL DEFAULT '',
+    ADD COLUMN category_id BIGINT,
+    ADD COLUMN category_name VARCHAR(255) NOT NULL DEFAULT '';
+
+UPDATE order_items oi
+SET product_name = p.name,
+    product_description = COALESCE(p.description, ''),
+    category_id = p.category_id,
+    category_name = c.name
+FROM products p
+JOIN categories c ON c.id = p.category_id
+WHERE p.id = oi.product_id;
+
+-- позиции заказа хранят снимок товара, поэтому сам товар можно удалять
+ALTER TABLE order_items ALTER COLUMN product_id DROP NOT NULL;
+ALTER TABLE order_items DROP CONSTRAINT IF EXISTS order_items_product_id_fkey;
+ALTER TABLE order_items
+    ADD CONSTRAINT order_items_product_id_fkey
+    FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE SET NULL;
+
+-- +goose Down
+ALTER TABLE order_items DROP CONSTRAINT IF EXISTS order_items_product_id_fkey;
+DELETE FROM order_items WHERE product_id IS NULL;
+ALTER TABLE order_items ALTER COLUMN product_id SET NOT NULL;
+ALTER TABLE order_items
+    ADD CONSTRAINT order_items_product_id_fkey
+    FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE RESTRICT;
+ALTER TABLE order_items
+    DROP COLUMN category_name,
+    DROP COLUMN category_id,
+    DROP COLUMN product_description,
+    DROP COLUMN product_name;
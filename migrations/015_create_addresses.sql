@@ -0,0 +1,27 @@
+-- +goose Up
+CREATE TABLE addresses (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    recipient_name VARCHAR(255) NOT NULL,
+    phone VARCHAR(32) NOT NULL,
+    country CHAR(2) NOT NULL,
+    region VARCHAR(255) NOT NULL DEFAULT '',
+    city VARCHAR(255) NOT NULL,
+    postal_code VARCHAR(20) NOT NULL,
+    line1 VARCHAR(255) NOT NULL,
+    line2 VARCHAR(255) NOT NULL DEFAULT '',
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_addresses_user ON addresses(user_id);
+-- у пользователя не больше одного адреса по умолчанию
+CREATE UNIQUE INDEX uq_addresses_user_default ON addresses(user_id) WHERE is_default;
+
+-- снимок адреса на момент оформления заказа
+ALTER TABLE orders ADD COLUMN shipping_address JSONB;
+
+-- +goose Down
+ALTER TABLE orders DROP COLUMN IF EXISTS shipping_address;
+DROP TABLE IF EXISTS addresses;
@@ -0,0 +1,37 @@
+-- +goose Up
+ALTER TABLE products ADD COLUMN weight_grams INT NOT NULL DEFAULT 0 CHECK (weight_grams >= 0);
+
+CREATE TABLE shipping_zones (
+    code VARCHAR(50) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    countries TEXT[] NOT NULL -- ISO 3166-1 alpha-2
+);
+
+CREATE TABLE shipping_methods (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    free_threshold BIGINT, -- сумма товаров в копейках, начиная с которой доставка бесплатна
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE shipping_rates (
+    id BIGSERIAL PRIMARY KEY,
+    method_id BIGINT NOT NULL REFERENCES shipping_methods(id) ON DELETE CASCADE,
+    zone_code VARCHAR(50) NOT NULL REFERENCES shipping_zones(code) ON DELETE CASCADE,
+    max_weight_grams INT NOT NULL CHECK (max_weight_grams > 0),
+    price BIGINT NOT NULL CHECK (price >= 0), -- в копейках
+    UNIQUE (method_id, zone_code, max_weight_grams)
+);
+
+ALTER TABLE orders
+    ADD COLUMN shipping_method_id BIGINT REFERENCES shipping_methods(id) ON DELETE SET NULL,
+    ADD COLUMN shipping_amount BIGINT NOT NULL DEFAULT 0; -- в копейках, входит в total_amount
+
+-- +goose Down
+ALTER TABLE orders DROP COLUMN IF EXISTS shipping_amount, DROP COLUMN IF EXISTS shipping_method_id;
+DROP TABLE IF EXISTS shipping_rates;
+DROP TABLE IF EXISTS shipping_methods;
+DROP TABLE IF EXISTS shipping_zones;
+ALTER TABLE products DROP COLUMN IF EXISTS weight_grams;
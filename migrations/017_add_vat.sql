@@ -0,0 +1,23 @@
+-- +goose Up
+ALTER TABLE categories ADD COLUMN vat_rate VARCHAR(4) NOT NULL DEFAULT 'none'
+    CHECK (vat_rate IN ('none', '0', '10', '20'));
+
+-- цена товара уже включает НДС (розничная цена) или НДС начисляется сверху
+ALTER TABLE products ADD COLUMN price_includes_tax BOOLEAN NOT NULL DEFAULT TRUE;
+
+ALTER TABLE order_items
+    ADD COLUMN vat_rate VARCHAR(4) NOT NULL DEFAULT 'none',
+    ADD COLUMN tax_amount BIGINT NOT NULL DEFAULT 0;
+
+-- total_amount = subtotal_amount + tax_amount + shipping_amount
+ALTER TABLE orders
+    ADD COLUMN subtotal_amount BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN tax_amount BIGINT NOT NULL DEFAULT 0;
+
+UPDATE orders SET subtotal_amount = total_amount - shipping_amount;
+
+-- +goose Down
+ALTER TABLE orders DROP COLUMN IF EXISTS tax_amount, DROP COLUMN IF EXISTS subtotal_amount;
+ALTER TABLE order_items DROP COLUMN IF EXISTS tax_amount, DROP COLUMN IF EXISTS vat_rate;
+ALTER TABLE products DROP COLUMN IF EXISTS price_includes_tax;
+ALTER TABLE categories DROP COLUMN IF EXISTS vat_rate;
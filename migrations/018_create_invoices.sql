@@ -0,0 +1,25 @@
+-- +goose Up
+-- счетчик номеров счетов: обновляется в той же транзакции, что и вставка счета,
+-- поэтому номера идут без пропусков и никогда не переиспользуются
+CREATE TABLE invoice_counter (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    last_number BIGINT NOT NULL
+);
+INSERT INTO invoice_counter (last_number) VALUES (0);
+
+CREATE TABLE invoices (
+    id BIGSERIAL PRIMARY KEY,
+    order_id BIGINT NOT NULL UNIQUE REFERENCES orders(id) ON DELETE RESTRICT,
+    number BIGINT NOT NULL UNIQUE,
+    version INT NOT NULL DEFAULT 1, -- увеличивается при перегенерации документа
+    issued_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    generated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- для печати суммы позиции в счете
+ALTER TABLE order_items ADD COLUMN price_includes_tax BOOLEAN NOT NULL DEFAULT TRUE;
+
+-- +goose Down
+ALTER TABLE order_items DROP COLUMN IF EXISTS price_includes_tax;
+DROP TABLE IF EXISTS invoices;
+DROP TABLE IF EXISTS invoice_counter;
@@ -0,0 +1,29 @@
+-- +goose Up
+-- Каждая запись истории статусов (UpdateOrderStatus, подтверждение оплаты, создание заказа)
+-- рассылается через NOTIFY, чтобы все реплики могли отдать ее в SSE-поток.
+-- NOTIFY внутри транзакции доставляется только после COMMIT.
+-- +goose StatementBegin
+CREATE FUNCTION notify_order_status() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('order_status', json_build_object(
+        'id', NEW.id,
+        'order_id', NEW.order_id,
+        'user_id', (SELECT user_id FROM orders WHERE id = NEW.order_id),
+        'from_status', COALESCE(NEW.from_status, ''),
+        'to_status', NEW.to_status,
+        'actor_id', NEW.actor_id,
+        'reason', NEW.reason,
+        'created_at', NEW.created_at
+    )::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER order_status_history_notify
+    AFTER INSERT ON order_status_history
+    FOR EACH ROW EXECUTE FUNCTION notify_order_status();
+
+-- +goose Down
+DROP TRIGGER IF EXISTS order_status_history_notify ON order_status_history;
+DROP FUNCTION IF EXISTS notify_order_status();
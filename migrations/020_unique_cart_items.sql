@@ -0,0 +1,21 @@
+-- +goose Up
+-- одна строка корзины на товар: повторное добавление увеличивает количество
+WITH merged AS (
+    SELECT user_id, product_id, SUM(quantity) AS quantity, MIN(id) AS keep_id
+    FROM cart_items
+    GROUP BY user_id, product_id
+    HAVING COUNT(*) > 1
+)
+UPDATE cart_items c
+SET quantity = m.quantity, updated_at = NOW()
+FROM merged m
+WHERE c.id = m.keep_id;
+
+DELETE FROM cart_items c
+USING cart_items d
+WHERE c.user_id = d.user_id AND c.product_id = d.product_id AND c.id > d.id;
+
+ALTER TABLE cart_items ADD CONSTRAINT cart_items_user_product_key UNIQUE (user_id, product_id);
+
+-- +goose Down
+ALTER TABLE cart_items DROP CONSTRAINT IF EXISTS cart_items_user_product_key;
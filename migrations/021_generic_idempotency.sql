@@ -0,0 +1,20 @@
+-- +goose Up
+-- в старых записях был только order_id, повторить по ним полный ответ нельзя
+DELETE FROM idempotency_keys;
+
+ALTER TABLE idempotency_keys
+    ADD COLUMN method VARCHAR(10) NOT NULL,
+    ADD COLUMN path TEXT NOT NULL,
+    ADD COLUMN response_headers JSONB,
+    ADD COLUMN completed_at TIMESTAMPTZ,
+    ALTER COLUMN response_body TYPE BYTEA USING NULL;
+
+-- +goose Down
+DELETE FROM idempotency_keys;
+
+ALTER TABLE idempotency_keys
+    ALTER COLUMN response_body TYPE JSONB USING NULL,
+    DROP COLUMN IF EXISTS completed_at,
+    DROP COLUMN IF EXISTS response_headers,
+    DROP COLUMN IF EXISTS path,
+    DROP COLUMN IF EXISTS method;
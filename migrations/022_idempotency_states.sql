@@ -0,0 +1,31 @@
+-- +goose Up
+-- in_progress — запрос выполняется, пока не истек locked_until; потом ключ можно перехватить.
+-- completed — ответ сохранен и повторяется; failed — запрос упал, ключ можно повторить.
+ALTER TABLE idempotency_keys
+    ADD COLUMN state VARCHAR(16) NOT NULL DEFAULT 'in_progress'
+        CHECK (state IN ('in_progress', 'completed', 'failed')),
+    ADD COLUMN lock_token TEXT,
+    ADD COLUMN locked_until TIMESTAMPTZ,
+    ADD COLUMN expires_at TIMESTAMPTZ NOT NULL DEFAULT NOW() + INTERVAL '24 hours';
+
+UPDATE idempotency_keys SET state = 'completed' WHERE status_code IS NOT NULL;
+-- брошенные ключи без результата сразу освобождаются
+UPDATE idempotency_keys SET state = 'failed' WHERE status_code IS NULL;
+
+-- ключи разных пользователей не пересекаются
+ALTER TABLE idempotency_keys DROP CONSTRAINT idempotency_keys_pkey;
+ALTER TABLE idempotency_keys ADD PRIMARY KEY (user_id, key);
+
+CREATE INDEX idx_idempotency_keys_expires_at ON idempotency_keys (expires_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_idempotency_keys_expires_at;
+DELETE FROM idempotency_keys a USING idempotency_keys b
+WHERE a.key = b.key AND a.user_id > b.user_id;
+ALTER TABLE idempotency_keys DROP CONSTRAINT idempotency_keys_pkey;
+ALTER TABLE idempotency_keys ADD PRIMARY KEY (key);
+ALTER TABLE idempotency_keys
+    DROP COLUMN IF EXISTS expires_at,
+    DROP COLUMN IF EXISTS locked_until,
+    DROP COLUMN IF EXISTS lock_token,
+    DROP COLUMN IF EXISTS state;
@@ -0,0 +1,18 @@
+-- +goose Up
+-- legacy — намерения, созданные до подключения провайдеров
+ALTER TABLE payment_intents
+    ADD COLUMN provider VARCHAR(32) NOT NULL DEFAULT 'legacy',
+    ADD COLUMN provider_intent_id TEXT,
+    ADD COLUMN next_action_url TEXT,
+    ADD COLUMN failure_reason TEXT;
+
+CREATE UNIQUE INDEX idx_payment_intents_provider_id ON payment_intents (provider, provider_intent_id)
+    WHERE provider_intent_id IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_payment_intents_provider_id;
+ALTER TABLE payment_intents
+    DROP COLUMN IF EXISTS failure_reason,
+    DROP COLUMN IF EXISTS next_action_url,
+    DROP COLUMN IF EXISTS provider_intent_id,
+    DROP COLUMN IF EXISTS provider;
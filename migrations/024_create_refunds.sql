@@ -0,0 +1,40 @@
+-- +goose Up
+-- refunded_amount — сумма возвратов в работе и проведенных (pending + succeeded);
+-- резервируется под блокировкой намерения, CHECK не дает вернуть больше списанного
+ALTER TABLE payment_intents
+    ADD COLUMN refunded_amount BIGINT NOT NULL DEFAULT 0,
+    ADD CONSTRAINT payment_intents_refund_within_amount CHECK (refunded_amount BETWEEN 0 AND amount);
+
+CREATE TABLE refunds (
+    id BIGSERIAL PRIMARY KEY,
+    payment_intent_id BIGINT NOT NULL REFERENCES payment_intents(id) ON DELETE RESTRICT,
+    order_id BIGINT NOT NULL REFERENCES orders(id) ON DELETE RESTRICT,
+    amount BIGINT NOT NULL CHECK (amount > 0),
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending | succeeded | failed
+    reason TEXT,
+    provider_refund_id TEXT,
+    actor_id BIGINT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_refunds_intent ON refunds (payment_intent_id);
+CREATE INDEX idx_refunds_order ON refunds (order_id);
+
+-- позиции заказа, за которые вернули деньги
+CREATE TABLE refund_items (
+    refund_id BIGINT NOT NULL REFERENCES refunds(id) ON DELETE CASCADE,
+    order_item_id BIGINT NOT NULL REFERENCES order_items(id) ON DELETE RESTRICT,
+    quantity INT NOT NULL CHECK (quantity > 0),
+    amount BIGINT NOT NULL,
+    PRIMARY KEY (refund_id, order_item_id)
+);
+
+CREATE INDEX idx_refund_items_order_item ON refund_items (order_item_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS refund_items;
+DROP TABLE IF EXISTS refunds;
+ALTER TABLE payment_intents
+    DROP CONSTRAINT IF EXISTS payment_intents_refund_within_amount,
+    DROP COLUMN IF EXISTS refunded_amount;
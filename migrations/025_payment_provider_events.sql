@@ -0,0 +1,17 @@
+-- +goose Up
+-- входящие уведомления платежных провайдеров: ключ отсекает повторную доставку,
+-- result — что сделали с событием (applied | ignored | orphan_capture)
+CREATE TABLE payment_provider_events (
+    provider VARCHAR(32) NOT NULL,
+    event_id TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    provider_intent_id TEXT,
+    result VARCHAR(32),
+    received_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (provider, event_id)
+);
+
+CREATE INDEX idx_payment_provider_events_intent ON payment_provider_events (provider, provider_intent_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS payment_provider_events;
@@ -0,0 +1,29 @@
+-- +goose Up
+-- expires_at — после этого момента неподтвержденное намерение отменяется
+ALTER TABLE payment_intents ADD COLUMN expires_at TIMESTAMPTZ;
+
+UPDATE payment_intents SET expires_at = created_at + INTERVAL '15 minutes'
+WHERE status IN ('requires_confirmation', 'requires_action');
+
+-- из нескольких активных намерений заказа оставляем последнее
+UPDATE payment_intents pi
+SET status = 'cancelled', failure_reason = 'superseded', updated_at = NOW()
+WHERE status IN ('requires_confirmation', 'requires_action')
+  AND EXISTS (
+      SELECT 1 FROM payment_intents newer
+      WHERE newer.order_id = pi.order_id
+        AND newer.id > pi.id
+        AND newer.status IN ('requires_confirmation', 'requires_action')
+  );
+
+-- не больше одного активного намерения на заказ; прошлые попытки остаются для истории
+CREATE UNIQUE INDEX idx_payment_intents_one_active ON payment_intents (order_id)
+    WHERE status IN ('requires_confirmation', 'requires_action');
+
+CREATE INDEX idx_payment_intents_expires ON payment_intents (expires_at)
+    WHERE status IN ('requires_confirmation', 'requires_action');
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_payment_intents_expires;
+DROP INDEX IF EXISTS idx_payment_intents_one_active;
+ALTER TABLE payment_intents DROP COLUMN IF EXISTS expires_at;
@@ -0,0 +1,85 @@
+-- +goose Up
+-- Двойная запись: каждая проводка (journal) — набор строк со знаковыми суммами в копейках,
+-- сумма строк проводки всегда ноль. Таблицы только пополняются.
+CREATE TABLE ledger_accounts (
+    code VARCHAR(32) PRIMARY KEY,
+    name TEXT NOT NULL
+);
+
+INSERT INTO ledger_accounts (code, name) VALUES
+    ('customer', 'Деньги покупателей'),
+    ('seller_payable', 'К выплате продавцам'),
+    ('tax_payable', 'НДС к уплате'),
+    ('platform_revenue', 'Выручка площадки'),
+    ('refunds_payable', 'Возвраты в обработке'),
+    ('payouts', 'Выплачено продавцам');
+
+-- reference — бизнес-событие, породившее проводку (например, payment_intent:9);
+-- уникальность (kind, reference) не дает провести одно событие дважды
+CREATE TABLE ledger_journals (
+    id BIGSERIAL PRIMARY KEY,
+    kind VARCHAR(32) NOT NULL,
+    reference VARCHAR(64) NOT NULL,
+    order_id BIGINT REFERENCES orders(id) ON DELETE RESTRICT,
+    memo TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (kind, reference)
+);
+
+CREATE INDEX idx_ledger_journals_order ON ledger_journals (order_id);
+
+CREATE TABLE ledger_entries (
+    id BIGSERIAL PRIMARY KEY,
+    journal_id BIGINT NOT NULL REFERENCES ledger_journals(id) ON DELETE RESTRICT,
+    account VARCHAR(32) NOT NULL REFERENCES ledger_accounts(code),
+    amount BIGINT NOT NULL CHECK (amount <> 0)
+);
+
+CREATE INDEX idx_ledger_entries_journal ON ledger_entries (journal_id);
+CREATE INDEX idx_ledger_entries_account ON ledger_entries (account);
+
+-- +goose StatementBegin
+CREATE FUNCTION ledger_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'ledger is append-only: % on % is not allowed', TG_OP, TG_TABLE_NAME;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER ledger_journals_append_only
+    BEFORE UPDATE OR DELETE ON ledger_journals
+    FOR EACH ROW EXECUTE FUNCTION ledger_append_only();
+
+CREATE TRIGGER ledger_entries_append_only
+    BEFORE UPDATE OR DELETE ON ledger_entries
+    FOR EACH ROW EXECUTE FUNCTION ledger_append_only();
+
+-- баланс проверяется при COMMIT, когда все строки проводки уже вставлены
+-- +goose StatementBegin
+CREATE FUNCTION ledger_check_balanced() RETURNS trigger AS $$
+DECLARE
+    total BIGINT;
+BEGIN
+    SELECT SUM(amount) INTO total FROM ledger_entries WHERE journal_id = NEW.journal_id;
+    IF total <> 0 THEN
+        RAISE EXCEPTION 'ledger journal % is unbalanced by %', NEW.journal_id, total;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE CONSTRAINT TRIGGER ledger_entries_balanced
+    AFTER INSERT ON ledger_entries
+    DEFERRABLE INITIALLY DEFERRED
+    FOR EACH ROW EXECUTE FUNCTION ledger_check_balanced();
+
+-- +goose Down
+DROP TRIGGER IF EXISTS ledger_entries_balanced ON ledger_entries;
+DROP FUNCTION IF EXISTS ledger_check_balanced();
+DROP TRIGGER IF EXISTS ledger_entries_append_only ON ledger_entries;
+DROP TRIGGER IF EXISTS ledger_journals_append_only ON ledger_journals;
+DROP FUNCTION IF EXISTS ledger_append_only();
+DROP TABLE IF EXISTS ledger_entries;
+DROP TABLE IF EXISTS ledger_journals;
+DROP TABLE IF EXISTS ledger_accounts;
@@ -0,0 +1,51 @@
+-- +goose Up
+-- Все суммы — целые минорные единицы своей валюты (ISO 4217): копейки, центы, иены, филсы.
+-- Существующие данные — рубли.
+CREATE TABLE exchange_rates (
+    id BIGSERIAL PRIMARY KEY,
+    base CHAR(3) NOT NULL,
+    quote CHAR(3) NOT NULL,
+    -- единиц quote за одну единицу base
+    rate NUMERIC(24, 12) NOT NULL CHECK (rate > 0),
+    effective_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (base <> quote),
+    UNIQUE (base, quote, effective_at)
+);
+
+ALTER TABLE products ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'RUB';
+
+-- валюта корзины — в ней покупатель видит цены и оформляет заказ
+CREATE TABLE carts (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    currency CHAR(3) NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- exchange_rates — курсы, по которым считали заказ; суммы заказа уже в его валюте
+ALTER TABLE orders
+    ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'RUB',
+    ADD COLUMN exchange_rates JSONB NOT NULL DEFAULT '[]';
+
+-- цена товара в каталоге до пересчета в валюту заказа
+ALTER TABLE order_items
+    ADD COLUMN catalog_currency CHAR(3) NOT NULL DEFAULT 'RUB',
+    ADD COLUMN catalog_price BIGINT;
+UPDATE order_items SET catalog_price = price;
+ALTER TABLE order_items ALTER COLUMN catalog_price SET NOT NULL;
+
+ALTER TABLE payment_intents ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'RUB';
+ALTER TABLE refunds ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'RUB';
+
+-- проводка целиком в одной валюте; балансы считаются по каждой валюте отдельно
+ALTER TABLE ledger_journals ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'RUB';
+
+-- +goose Down
+ALTER TABLE ledger_journals DROP COLUMN IF EXISTS currency;
+ALTER TABLE refunds DROP COLUMN IF EXISTS currency;
+ALTER TABLE payment_intents DROP COLUMN IF EXISTS currency;
+ALTER TABLE order_items DROP COLUMN IF EXISTS catalog_price, DROP COLUMN IF EXISTS catalog_currency;
+ALTER TABLE orders DROP COLUMN IF EXISTS exchange_rates, DROP COLUMN IF EXISTS currency;
+DROP TABLE IF EXISTS carts;
+ALTER TABLE products DROP COLUMN IF EXISTS currency;
+DROP TABLE IF EXISTS exchange_rates;
@@ -0,0 +1,44 @@
+-- +goose Up
+-- Кошелек покупателя: бонусный баланс в каждой валюте, в минорных единицах.
+-- CHECK — последняя защита: списания идут условным UPDATE ... WHERE balance >= сумма.
+CREATE TABLE wallets (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    currency CHAR(3) NOT NULL,
+    balance BIGINT NOT NULL DEFAULT 0 CHECK (balance >= 0),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, currency)
+);
+
+-- история операций только пополняется; amount со знаком, сумма операций равна остатку
+CREATE TABLE wallet_transactions (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    currency CHAR(3) NOT NULL,
+    amount BIGINT NOT NULL CHECK (amount <> 0),
+    balance_after BIGINT NOT NULL CHECK (balance_after >= 0),
+    kind VARCHAR(32) NOT NULL,
+    order_id BIGINT REFERENCES orders(id) ON DELETE RESTRICT,
+    payment_intent_id BIGINT REFERENCES payment_intents(id) ON DELETE RESTRICT,
+    refund_id BIGINT REFERENCES refunds(id) ON DELETE RESTRICT,
+    actor_id BIGINT,
+    reason TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (user_id, currency) REFERENCES wallets(user_id, currency) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_wallet_transactions_user ON wallet_transactions (user_id, id DESC);
+-- оплату из кошелька списывают и возвращают по одному разу на намерение
+CREATE UNIQUE INDEX idx_wallet_transactions_intent ON wallet_transactions (payment_intent_id, kind)
+    WHERE payment_intent_id IS NOT NULL;
+
+-- из кошелька заказ оплачивают один раз; остаток — обычными попытками оплаты у провайдера
+CREATE UNIQUE INDEX idx_payment_intents_one_wallet ON payment_intents (order_id)
+    WHERE provider = 'wallet' AND status = 'succeeded';
+
+INSERT INTO ledger_accounts (code, name) VALUES ('store_credit', 'Бонусы покупателей в кошельках');
+
+-- +goose Down
+DELETE FROM ledger_accounts WHERE code = 'store_credit';
+DROP INDEX IF EXISTS idx_payment_intents_one_wallet;
+DROP TABLE IF EXISTS wallet_transactions;
+DROP TABLE IF EXISTS wallets;